@@ -11,6 +11,7 @@ import (
 // Node describes a node in the ast.
 type Node interface {
 	TokenLiteral() token.Literal
+	Pos() token.Position
 	String() string
 }
 
@@ -33,6 +34,7 @@ type Expression interface {
 // by statement nodes in the ast.
 type Program struct {
 	Statements []Statement
+	Comments   []*Comment // Comments of the source in the order they appear
 }
 
 // TokenLiteral returns the token literal at the current node.
@@ -45,6 +47,15 @@ func (p *Program) TokenLiteral() token.Literal {
 	return ""
 }
 
+// Pos returns the position of the first statement.
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+
+	return token.Position{}
+}
+
 // String implements the stringer interface
 func (p *Program) String() string {
 	var out bytes.Buffer
@@ -56,3 +67,24 @@ func (p *Program) String() string {
 
 	return out.String()
 }
+
+// Comment represents a line comment, comments aren't part of the statements of
+// a program and are kept for the tools working on source code.
+type Comment struct {
+	Token token.Token // The comment token, its literal starts with //
+}
+
+// TokenLiteral returns the text of the comment.
+func (c *Comment) TokenLiteral() token.Literal {
+	return c.Token.Literal
+}
+
+// Pos returns the position of the comment.
+func (c *Comment) Pos() token.Position {
+	return c.Token.Pos
+}
+
+// String implements the stringer interface.
+func (c *Comment) String() string {
+	return string(c.Token.Literal)
+}
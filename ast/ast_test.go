@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/actuallyachraf/monkey-giggle/token"
@@ -27,4 +28,80 @@ func TestAST(t *testing.T) {
 	if program.String() != expected {
 		t.Fatalf("program.String() failed got %s expected %s", program.String(), expected)
 	}
+	t.Run("TestJSON", func(t *testing.T) {
+		// tools may generate programs without positions
+		input := `{"kind": "Program", "statements": [
+			{"kind": "LetStatement", "name": {"kind": "Identifier", "value": "x"},
+			 "value": {"kind": "InfixExpression", "operator": "*",
+			   "left": {"kind": "IntegerLiteral", "value": 6},
+			   "right": {"kind": "PrefixExpression", "operator": "-", "right": {"kind": "IntegerLiteral", "value": 7}}}},
+			{"kind": "ExpressionStatement", "pos": {"line": 2, "column": 1},
+			 "expression": {"kind": "CallExpression", "function": {"kind": "Identifier", "value": "len"},
+			   "arguments": [{"kind": "StringLiteral", "value": "giggle"}]}}]}`
+		program := &Program{}
+		if err := json.Unmarshal([]byte(input), program); err != nil {
+			t.Fatalf("failed to decode with error : %s", err)
+		}
+		if got := program.String(); got != `let x = (6 * (-7));len(giggle)` {
+			t.Errorf("wrong decoded program got %s", got)
+		}
+		let := program.Statements[0].(*LetStatement)
+		if let.Token.Type != token.LET || let.Name.Token.Type != token.IDENT || let.Pos().IsValid() {
+			t.Errorf("wrong decoded tokens got %v and %v", let.Token, let.Name.Token)
+		}
+		if pos := program.Statements[1].Pos(); pos != (token.Position{Line: 2, Column: 1}) {
+			t.Errorf("wrong decoded position got %s", pos)
+		}
+
+		errors := []struct {
+			input    string
+			expected string
+		}{
+			{`{"kind": "Program", "statements": [{"kind": "Loop"}]}`, `ast: unknown node kind "Loop"`},
+			{`{"kind": "ReturnStatement", "returnValue": {"kind": "NullLiteral"}}`, "ast: expected a Program got ReturnStatement"},
+			{`{"kind": "Program", "statements": [{"kind": "NullLiteral"}]}`, "ast: expected a statement in statements of Program got NullLiteral"},
+			{`{"kind": "PrefixExpression", "operator": "~"}`, `ast: unknown operator "~" for PrefixExpression`},
+			{`{"kind": "Program", "statements": [{"kind": "LetStatement", "value": {"kind": "NullLiteral"}}]}`, "ast: LetStatement expects either a name or a pattern"},
+			{`{"kind": "IntegerLiteral", "value": "1"}`, `ast: wrong value for field value of IntegerLiteral : "1"`},
+			{`{"kind": "BigIntegerLiteral", "value": "1e30"}`, `ast: wrong value for field value of BigIntegerLiteral : "1e30"`},
+			{`[]`, "ast: expected a node got []"},
+			{`{"kind": "Program", "statements": [{"kind": "ExpressionStatement"}]}`, "ast: ExpressionStatement expects expression"},
+			{`{"kind": "Program", "statements": [{"kind": "ReturnStatement", "returnValue": null}]}`, "ast: ReturnStatement expects returnValue"},
+			{`{"kind": "InfixExpression", "operator": "+", "right": {"kind": "IntegerLiteral", "value": 1}}`, "ast: InfixExpression expects left"},
+			{`{"kind": "InfixExpression", "operator": "+", "left": {"kind": "IntegerLiteral", "value": 1}, "right": null}`, "ast: InfixExpression expects right"},
+			{`{"kind": "PrefixExpression", "operator": "!"}`, "ast: PrefixExpression expects right"},
+			{`{"kind": "IfExpression", "condition": {"kind": "BooleanLiteral", "value": true}}`, "ast: IfExpression expects consequence"},
+			{`{"kind": "CallExpression", "arguments": []}`, "ast: CallExpression expects function"},
+			{`{"kind": "CallExpression", "function": {"kind": "Identifier", "value": "f"}, "arguments": [null]}`, "ast: CallExpression expects arguments without null"},
+			{`{"kind": "ArrayLiteral", "elements": [null]}`, "ast: ArrayLiteral expects elements without null"},
+			{`{"kind": "IndexExpression", "left": {"kind": "Identifier", "value": "a"}}`, "ast: IndexExpression expects index"},
+			{`{"kind": "FunctionLiteral", "parameters": []}`, "ast: FunctionLiteral expects body"},
+			{`{"kind": "MatchExpression", "arms": []}`, "ast: MatchExpression expects value"},
+			{`{"kind": "TryExpression", "block": {"kind": "BlockStatement"}}`, "ast: TryExpression expects a catch block with its param or a finally block"},
+		}
+		for _, tt := range errors {
+			err := json.Unmarshal([]byte(tt.input), &Program{})
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("wrong error for %s expected %q got %v", tt.input, tt.expected, err)
+			}
+		}
+	})
+	t.Run("TestWalk", func(t *testing.T) {
+		// programs with syntax errors hold nil nodes
+		program := &Program{Statements: []Statement{
+			&LetStatement{Name: &Identifier{Value: "x"}},
+			&ExpressionStatement{Expression: &CallExpression{Arguments: []Expression{nil, &NullLiteral{}}}},
+		}}
+		visited := 0
+		Inspect(program, func(node Node) bool {
+			visited++
+			return true
+		})
+		if visited != 6 {
+			t.Errorf("wrong number of visited nodes got %d", visited)
+		}
+		if Rewrite(nil, func(node Node) Node { return node }) != nil {
+			t.Errorf("rewriting a nil node should return nil")
+		}
+	})
 }
@@ -0,0 +1,84 @@
+package ast
+
+import (
+	"bytes"
+
+	"github.com/actuallyachraf/monkey-giggle/token"
+)
+
+// exceptions.go implements the nodes used to raise and handle exceptions.
+
+// ThrowStatement represents statements of the form throw <expression>;
+type ThrowStatement struct {
+	Token token.Token
+	Value Expression
+}
+
+func (ts *ThrowStatement) statementNode() {}
+
+// TokenLiteral implements the node interface
+func (ts *ThrowStatement) TokenLiteral() token.Literal {
+	return ts.Token.Literal
+}
+
+// Pos returns the position of the node token.
+func (ts *ThrowStatement) Pos() token.Position {
+	return ts.Token.Pos
+}
+
+// String implements the stringer interface
+func (ts *ThrowStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(string(ts.TokenLiteral()) + " ")
+	out.WriteString(ts.Value.String())
+	out.WriteString(";")
+
+	return out.String()
+}
+
+// TryExpression represents expressions of the form
+// try { } catch (e) { } finally { }
+// at least one of the catch and finally blocks is present, the value of the
+// expression is the value of the try block or of the catch block when an
+// exception was caught.
+type TryExpression struct {
+	Token   token.Token
+	Block   *BlockStatement
+	Param   *Identifier
+	Catch   *BlockStatement
+	Finally *BlockStatement
+}
+
+func (te *TryExpression) expressionNode() {}
+
+// TokenLiteral implements the node interface
+func (te *TryExpression) TokenLiteral() token.Literal {
+	return te.Token.Literal
+}
+
+// Pos returns the position of the node token.
+func (te *TryExpression) Pos() token.Position {
+	return te.Token.Pos
+}
+
+// String implements the stringer interface
+func (te *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(te.Block.String())
+
+	if te.Catch != nil {
+		out.WriteString(" catch (")
+		out.WriteString(te.Param.String())
+		out.WriteString(") ")
+		out.WriteString(te.Catch.String())
+	}
+	if te.Finally != nil {
+		out.WriteString(" finally ")
+		out.WriteString(te.Finally.String())
+	}
+
+	return out.String()
+}
@@ -0,0 +1,812 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strconv"
+
+	"github.com/actuallyachraf/monkey-giggle/token"
+)
+
+// json.go implements the JSON form of programs used by tools that don't link
+// the Go packages. Nodes are objects holding their kind (the name of their
+// type), their position and their fields named after the struct fields :
+//
+//	{"kind": "InfixExpression", "pos": {"line": 1, "column": 3},
+//	 "operator": "+", "left": {...}, "right": {...}}
+//
+// Positions are omitted for synthesized nodes and may be omitted by tools
+// generating programs. Tokens aren't encoded, decoding rebuilds them from the
+// kind and fields of the nodes.
+
+// infixOperators maps the infix operators to their token type.
+var infixOperators = map[token.Literal]token.Type{
+	"+":  token.ADD,
+	"-":  token.SUB,
+	"*":  token.MUL,
+	"/":  token.DIV,
+	"%":  token.MOD,
+	"<":  token.LT,
+	">":  token.GT,
+	"==": token.EQ,
+	"!=": token.NEQ,
+	"<=": token.LE,
+	">=": token.GE,
+	"??": token.NULLISH,
+}
+
+// prefixOperators maps the prefix operators to their token type.
+var prefixOperators = map[token.Literal]token.Type{
+	"!": token.BANG,
+	"-": token.SUB,
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p *Program) MarshalJSON() ([]byte, error) {
+	return json.Marshal(encode(p))
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, the program is
+// replaced by the decoded one.
+func (p *Program) UnmarshalJSON(data []byte) error {
+	node, err := decode(data)
+	if err != nil {
+		return err
+	}
+	program, ok := node.(*Program)
+	if !ok {
+		return fmt.Errorf("ast: expected a Program got %s", kindOf(node))
+	}
+	*p = *program
+
+	return nil
+}
+
+// object is a JSON object keeping the order of its fields.
+type object struct {
+	keys   []string
+	values []interface{}
+}
+
+func (o *object) set(key string, value interface{}) {
+	o.keys = append(o.keys, key)
+	o.values = append(o.values, value)
+}
+
+// setPosition sets a position field, invalid positions are omitted.
+func (o *object) setPosition(key string, pos token.Position) {
+	if pos.IsValid() {
+		o.set(key, position{pos.Line, pos.Column})
+	}
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (o *object) MarshalJSON() ([]byte, error) {
+	var out bytes.Buffer
+
+	out.WriteString("{")
+	for i, key := range o.keys {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		value, err := json.Marshal(o.values[i])
+		if err != nil {
+			return nil, err
+		}
+		out.WriteString(strconv.Quote(key) + ":")
+		out.Write(value)
+	}
+	out.WriteString("}")
+
+	return out.Bytes(), nil
+}
+
+// position is the JSON form of positions.
+type position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// kindOf returns the kind of a node, the name of its type.
+func kindOf(node Node) string {
+	if isNil(node) {
+		return "null"
+	}
+	return reflect.TypeOf(node).Elem().Name()
+}
+
+// isNil reports whether a node is missing, optional fields hold nil pointers.
+func isNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// encode returns the JSON form of a node, nil nodes encode as null.
+func encode(node Node) interface{} {
+	if isNil(node) {
+		return nil
+	}
+
+	o := &object{}
+	o.set("kind", kindOf(node))
+	if pos := node.Pos(); pos.IsValid() {
+		if _, ok := node.(*Program); !ok {
+			o.set("pos", position{pos.Line, pos.Column})
+		}
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		comments := []interface{}{}
+		for _, c := range node.Comments {
+			comments = append(comments, encode(c))
+		}
+		o.set("statements", encodeStatements(node.Statements))
+		o.set("comments", comments)
+	case *Comment:
+		o.set("text", string(node.Token.Literal))
+	case *LetStatement:
+		o.set("name", encode(node.Name))
+		o.set("pattern", encode(node.Pattern))
+		o.set("value", encode(node.Value))
+		o.set("exported", node.Exported)
+	case *Identifier:
+		o.set("value", string(node.Value))
+	case *ReturnStatement:
+		o.set("returnValue", encode(node.ReturnValue))
+	case *ExpressionStatement:
+		o.set("expression", encode(node.Expression))
+	case *BlockStatement:
+		o.set("statements", encodeStatements(node.Statements))
+		o.setPosition("rbrace", node.Rbrace)
+	case *ThrowStatement:
+		o.set("value", encode(node.Value))
+	case *IntegerLiteral:
+		o.set("value", node.Value)
+	case *BigIntegerLiteral:
+		// big integers are encoded as decimal strings to stay exact
+		o.set("value", node.Value.String())
+	case *StringLiteral:
+		o.set("value", node.Value)
+	case *BooleanLiteral:
+		o.set("value", node.Value)
+	case *NullLiteral:
+	case *ArrayLiteral:
+		o.set("elements", encodeExpressions(node.Elements))
+		o.setPosition("rbracket", node.Rbracket)
+	case *HashmapLiteral:
+		pairs := []interface{}{}
+		for _, key := range sortedKeys(node) {
+			pair := &object{}
+			pair.set("key", encode(key))
+			pair.set("value", encode(node.Pairs[key]))
+			pairs = append(pairs, pair)
+		}
+		o.set("pairs", pairs)
+		o.setPosition("rbrace", node.Rbrace)
+	case *PrefixExpression:
+		o.set("operator", string(node.Operator))
+		o.set("right", encode(node.Right))
+	case *InfixExpression:
+		o.set("operator", string(node.Operator))
+		o.set("left", encode(node.Left))
+		o.set("right", encode(node.Right))
+	case *IfExpression:
+		o.set("condition", encode(node.Condition))
+		o.set("consequence", encode(node.Consequence))
+		o.set("alternative", encode(node.Alternative))
+	case *FunctionLiteral:
+		params := []interface{}{}
+		for _, param := range node.Parameters {
+			params = append(params, encode(param))
+		}
+		o.set("parameters", params)
+		o.set("defaults", encodeExpressions(node.Defaults))
+		o.set("patterns", encodeExpressions(node.Patterns))
+		o.set("rest", encode(node.Rest))
+		o.set("body", encode(node.Body))
+		o.set("name", node.Name)
+	case *MacroLiteral:
+		params := []interface{}{}
+		for _, param := range node.Parameters {
+			params = append(params, encode(param))
+		}
+		o.set("parameters", params)
+		o.set("body", encode(node.Body))
+	case *SpreadExpression:
+		o.set("value", encode(node.Value))
+	case *CallExpression:
+		o.set("function", encode(node.Function))
+		o.set("arguments", encodeExpressions(node.Arguments))
+		o.setPosition("rparen", node.Rparen)
+	case *IndexExpression:
+		o.set("left", encode(node.Left))
+		o.set("index", encode(node.Index))
+		o.set("optional", node.Optional)
+	case *SliceExpression:
+		o.set("left", encode(node.Left))
+		o.set("start", encode(node.Start))
+		o.set("end", encode(node.End))
+		o.set("optional", node.Optional)
+	case *ArrayPattern:
+		o.set("elements", encodeExpressions(node.Elements))
+		o.set("rest", encode(node.Rest))
+	case *HashPattern:
+		keys := []interface{}{}
+		for _, key := range node.Keys {
+			keys = append(keys, encode(key))
+		}
+		o.set("keys", keys)
+		o.set("values", encodeExpressions(node.Values))
+	case *MatchExpression:
+		arms := []interface{}{}
+		for _, arm := range node.Arms {
+			a := &object{}
+			a.set("pattern", encode(arm.Pattern))
+			a.set("guard", encode(arm.Guard))
+			a.set("body", encode(arm.Body))
+			arms = append(arms, a)
+		}
+		o.set("value", encode(node.Value))
+		o.set("arms", arms)
+		o.setPosition("rbrace", node.Rbrace)
+	case *TryExpression:
+		o.set("block", encode(node.Block))
+		o.set("param", encode(node.Param))
+		o.set("catch", encode(node.Catch))
+		o.set("finally", encode(node.Finally))
+	case *ImportExpression:
+		o.set("path", node.Path)
+	}
+
+	return o
+}
+
+func encodeStatements(stmts []Statement) []interface{} {
+	encoded := []interface{}{}
+	for _, stmt := range stmts {
+		encoded = append(encoded, encode(stmt))
+	}
+	return encoded
+}
+
+func encodeExpressions(exps []Expression) []interface{} {
+	encoded := []interface{}{}
+	for _, exp := range exps {
+		encoded = append(encoded, encode(exp))
+	}
+	return encoded
+}
+
+// fields holds the fields of an encoded node.
+type fields struct {
+	kind string
+	raw  map[string]json.RawMessage
+}
+
+// decode rebuilds a node from its JSON form, null decodes as a nil node.
+func decode(data []byte) (Node, error) {
+	if isNull(data) {
+		return nil, nil
+	}
+
+	f := fields{raw: map[string]json.RawMessage{}}
+	if err := json.Unmarshal(data, &f.raw); err != nil {
+		return nil, fmt.Errorf("ast: expected a node got %s", data)
+	}
+	if err := json.Unmarshal(f.raw["kind"], &f.kind); err != nil {
+		return nil, fmt.Errorf("ast: node without a kind %s", data)
+	}
+	pos, err := f.position("pos")
+	if err != nil {
+		return nil, err
+	}
+
+	switch f.kind {
+	case "Program":
+		statements, err := f.statements("statements")
+		if err != nil {
+			return nil, err
+		}
+		program := &Program{Statements: statements}
+		var comments []json.RawMessage
+		if err := f.field("comments", &comments); err != nil {
+			return nil, err
+		}
+		for _, raw := range comments {
+			node, err := decode(raw)
+			if err != nil {
+				return nil, err
+			}
+			c, ok := node.(*Comment)
+			if !ok {
+				return nil, fmt.Errorf("ast: expected a Comment in comments of Program got %s", kindOf(node))
+			}
+			program.Comments = append(program.Comments, c)
+		}
+		return program, nil
+	case "Comment":
+		var text string
+		err := f.field("text", &text)
+		return &Comment{Token: token.Token{Type: token.COMMENT, Literal: token.Literal(text), Pos: pos}}, err
+	case "LetStatement":
+		stmt := &LetStatement{Token: token.Token{Type: token.LET, Literal: "let", Pos: pos}}
+		if stmt.Name, err = f.identifier("name"); err != nil {
+			return nil, err
+		}
+		if stmt.Pattern, err = f.expression("pattern"); err != nil {
+			return nil, err
+		}
+		if stmt.Value, err = f.expression("value"); err != nil {
+			return nil, err
+		}
+		if (stmt.Name == nil) == (stmt.Pattern == nil) {
+			return nil, fmt.Errorf("ast: LetStatement expects either a name or a pattern")
+		}
+		return stmt, f.field("exported", &stmt.Exported)
+	case "Identifier":
+		var value string
+		if err := f.field("value", &value); err != nil {
+			return nil, err
+		}
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: token.Literal(value), Pos: pos}, Value: token.Literal(value)}, nil
+	case "ReturnStatement":
+		stmt := &ReturnStatement{Token: token.Token{Type: token.RETURN, Literal: "return", Pos: pos}}
+		stmt.ReturnValue, err = f.requiredExpression("returnValue")
+		return stmt, err
+	case "ExpressionStatement":
+		stmt := &ExpressionStatement{Token: token.Token{Pos: pos}}
+		if stmt.Expression, err = f.requiredExpression("expression"); err != nil {
+			return nil, err
+		}
+		stmt.Token.Literal = stmt.Expression.TokenLiteral()
+		return stmt, nil
+	case "BlockStatement":
+		block := &BlockStatement{Token: token.Token{Type: token.LBRACE, Literal: "{", Pos: pos}}
+		if block.Statements, err = f.statements("statements"); err != nil {
+			return nil, err
+		}
+		block.Rbrace, err = f.position("rbrace")
+		return block, err
+	case "ThrowStatement":
+		stmt := &ThrowStatement{Token: token.Token{Type: token.THROW, Literal: "throw", Pos: pos}}
+		stmt.Value, err = f.requiredExpression("value")
+		return stmt, err
+	case "IntegerLiteral":
+		lit := &IntegerLiteral{}
+		if err := f.field("value", &lit.Value); err != nil {
+			return nil, err
+		}
+		lit.Token = token.Token{Type: token.INT, Literal: token.Literal(strconv.FormatInt(lit.Value, 10)), Pos: pos}
+		return lit, nil
+	case "BigIntegerLiteral":
+		var value string
+		if err := f.field("value", &value); err != nil {
+			return nil, err
+		}
+		lit := &BigIntegerLiteral{Value: new(big.Int)}
+		if _, ok := lit.Value.SetString(value, 10); !ok {
+			return nil, fmt.Errorf("ast: wrong value for field value of BigIntegerLiteral : %q", value)
+		}
+		lit.Token = token.Token{Type: token.INT, Literal: token.Literal(value), Pos: pos}
+		return lit, nil
+	case "StringLiteral":
+		lit := &StringLiteral{}
+		if err := f.field("value", &lit.Value); err != nil {
+			return nil, err
+		}
+		lit.Token = token.Token{Type: token.STRING, Literal: token.Literal(lit.Value), Pos: pos}
+		return lit, nil
+	case "BooleanLiteral":
+		lit := &BooleanLiteral{Token: token.Token{Type: token.FALSE, Literal: "false", Pos: pos}}
+		if err := f.field("value", &lit.Value); err != nil {
+			return nil, err
+		}
+		if lit.Value {
+			lit.Token.Type, lit.Token.Literal = token.TRUE, "true"
+		}
+		return lit, nil
+	case "NullLiteral":
+		return &NullLiteral{Token: token.Token{Type: token.NULL, Literal: "null", Pos: pos}}, nil
+	case "ArrayLiteral":
+		lit := &ArrayLiteral{Token: token.Token{Type: token.LBRACKET, Literal: "[", Pos: pos}}
+		if lit.Elements, err = f.requiredExpressions("elements"); err != nil {
+			return nil, err
+		}
+		lit.Rbracket, err = f.position("rbracket")
+		return lit, err
+	case "HashmapLiteral":
+		lit := &HashmapLiteral{Token: token.Token{Type: token.LBRACE, Literal: "{", Pos: pos}, Pairs: map[Expression]Expression{}}
+		var pairs []map[string]json.RawMessage
+		if err := f.field("pairs", &pairs); err != nil {
+			return nil, err
+		}
+		for _, raw := range pairs {
+			pair := fields{kind: f.kind, raw: raw}
+			key, err := pair.expression("key")
+			if err != nil {
+				return nil, err
+			}
+			value, err := pair.expression("value")
+			if err != nil {
+				return nil, err
+			}
+			if key == nil || value == nil {
+				return nil, fmt.Errorf("ast: HashmapLiteral pairs expect a key and a value")
+			}
+			lit.Pairs[key] = value
+		}
+		lit.Rbrace, err = f.position("rbrace")
+		return lit, err
+	case "PrefixExpression":
+		exp := &PrefixExpression{}
+		if err := f.operator(&exp.Operator, &exp.Token, prefixOperators, pos); err != nil {
+			return nil, err
+		}
+		exp.Right, err = f.requiredExpression("right")
+		return exp, err
+	case "InfixExpression":
+		exp := &InfixExpression{}
+		if err := f.operator(&exp.Operator, &exp.Token, infixOperators, pos); err != nil {
+			return nil, err
+		}
+		if exp.Left, err = f.requiredExpression("left"); err != nil {
+			return nil, err
+		}
+		exp.Right, err = f.requiredExpression("right")
+		return exp, err
+	case "IfExpression":
+		exp := &IfExpression{Token: token.Token{Type: token.IF, Literal: "if", Pos: pos}}
+		if exp.Condition, err = f.requiredExpression("condition"); err != nil {
+			return nil, err
+		}
+		if exp.Consequence, err = f.requiredBlock("consequence"); err != nil {
+			return nil, err
+		}
+		exp.Alternative, err = f.block("alternative")
+		return exp, err
+	case "FunctionLiteral":
+		lit := &FunctionLiteral{Token: token.Token{Type: token.FUNCTION, Literal: "fn", Pos: pos}}
+		var params []json.RawMessage
+		if err := f.field("parameters", &params); err != nil {
+			return nil, err
+		}
+		for _, raw := range params {
+			param, err := decodeIdentifier(raw, "parameters", f.kind)
+			if err != nil {
+				return nil, err
+			}
+			lit.Parameters = append(lit.Parameters, param)
+		}
+		if lit.Defaults, err = f.expressions("defaults"); err != nil {
+			return nil, err
+		}
+		if lit.Patterns, err = f.expressions("patterns"); err != nil {
+			return nil, err
+		}
+		if len(lit.Defaults) > len(lit.Parameters) || len(lit.Patterns) > len(lit.Parameters) {
+			return nil, fmt.Errorf("ast: FunctionLiteral has more defaults or patterns than parameters")
+		}
+		if lit.Rest, err = f.identifier("rest"); err != nil {
+			return nil, err
+		}
+		if lit.Body, err = f.requiredBlock("body"); err != nil {
+			return nil, err
+		}
+		return lit, f.field("name", &lit.Name)
+	case "MacroLiteral":
+		lit := &MacroLiteral{Token: token.Token{Type: token.MACRO, Literal: "macro", Pos: pos}}
+		var params []json.RawMessage
+		if err := f.field("parameters", &params); err != nil {
+			return nil, err
+		}
+		for _, raw := range params {
+			param, err := decodeIdentifier(raw, "parameters", f.kind)
+			if err != nil {
+				return nil, err
+			}
+			lit.Parameters = append(lit.Parameters, param)
+		}
+		lit.Body, err = f.requiredBlock("body")
+		return lit, err
+	case "SpreadExpression":
+		exp := &SpreadExpression{Token: token.Token{Type: token.ELLIPSIS, Literal: "...", Pos: pos}}
+		exp.Value, err = f.requiredExpression("value")
+		return exp, err
+	case "CallExpression":
+		exp := &CallExpression{Token: token.Token{Type: token.LPAREN, Literal: "(", Pos: pos}}
+		if exp.Function, err = f.requiredExpression("function"); err != nil {
+			return nil, err
+		}
+		if exp.Arguments, err = f.requiredExpressions("arguments"); err != nil {
+			return nil, err
+		}
+		exp.Rparen, err = f.position("rparen")
+		return exp, err
+	case "IndexExpression":
+		exp := &IndexExpression{}
+		if err := f.field("optional", &exp.Optional); err != nil {
+			return nil, err
+		}
+		exp.Token = indexToken(exp.Optional, pos)
+		if exp.Left, err = f.requiredExpression("left"); err != nil {
+			return nil, err
+		}
+		exp.Index, err = f.requiredExpression("index")
+		return exp, err
+	case "SliceExpression":
+		exp := &SliceExpression{}
+		if err := f.field("optional", &exp.Optional); err != nil {
+			return nil, err
+		}
+		exp.Token = indexToken(exp.Optional, pos)
+		if exp.Left, err = f.requiredExpression("left"); err != nil {
+			return nil, err
+		}
+		if exp.Start, err = f.expression("start"); err != nil {
+			return nil, err
+		}
+		exp.End, err = f.expression("end")
+		return exp, err
+	case "ArrayPattern":
+		pattern := &ArrayPattern{Token: token.Token{Type: token.LBRACKET, Literal: "[", Pos: pos}}
+		if pattern.Elements, err = f.requiredExpressions("elements"); err != nil {
+			return nil, err
+		}
+		pattern.Rest, err = f.identifier("rest")
+		return pattern, err
+	case "HashPattern":
+		pattern := &HashPattern{Token: token.Token{Type: token.LBRACE, Literal: "{", Pos: pos}}
+		keys, err := f.requiredExpressions("keys")
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			lit, ok := key.(*StringLiteral)
+			if !ok {
+				return nil, fmt.Errorf("ast: expected a StringLiteral in keys of HashPattern")
+			}
+			pattern.Keys = append(pattern.Keys, lit)
+		}
+		if pattern.Values, err = f.requiredExpressions("values"); err != nil {
+			return nil, err
+		}
+		if len(pattern.Keys) != len(pattern.Values) {
+			return nil, fmt.Errorf("ast: HashPattern expects as many keys as values")
+		}
+		return pattern, nil
+	case "MatchExpression":
+		exp := &MatchExpression{Token: token.Token{Type: token.MATCH, Literal: "match", Pos: pos}}
+		if exp.Value, err = f.requiredExpression("value"); err != nil {
+			return nil, err
+		}
+		var arms []map[string]json.RawMessage
+		if err := f.field("arms", &arms); err != nil {
+			return nil, err
+		}
+		for _, raw := range arms {
+			a := fields{kind: f.kind, raw: raw}
+			arm := &MatchArm{}
+			if arm.Pattern, err = a.expression("pattern"); err != nil {
+				return nil, err
+			}
+			if arm.Guard, err = a.expression("guard"); err != nil {
+				return nil, err
+			}
+			if arm.Body, err = a.block("body"); err != nil {
+				return nil, err
+			}
+			if arm.Pattern == nil || arm.Body == nil {
+				return nil, fmt.Errorf("ast: MatchExpression arms expect a pattern and a body")
+			}
+			exp.Arms = append(exp.Arms, arm)
+		}
+		exp.Rbrace, err = f.position("rbrace")
+		return exp, err
+	case "TryExpression":
+		exp := &TryExpression{Token: token.Token{Type: token.TRY, Literal: "try", Pos: pos}}
+		if exp.Block, err = f.requiredBlock("block"); err != nil {
+			return nil, err
+		}
+		if exp.Param, err = f.identifier("param"); err != nil {
+			return nil, err
+		}
+		if exp.Catch, err = f.block("catch"); err != nil {
+			return nil, err
+		}
+		if exp.Finally, err = f.block("finally"); err != nil {
+			return nil, err
+		}
+		if (exp.Param == nil) != (exp.Catch == nil) || (exp.Catch == nil && exp.Finally == nil) {
+			return nil, fmt.Errorf("ast: TryExpression expects a catch block with its param or a finally block")
+		}
+		return exp, nil
+	case "ImportExpression":
+		exp := &ImportExpression{Token: token.Token{Type: token.IMPORT, Literal: "import", Pos: pos}}
+		return exp, f.field("path", &exp.Path)
+	default:
+		return nil, fmt.Errorf("ast: unknown node kind %q", f.kind)
+	}
+}
+
+// isNull reports whether a JSON value is missing or null.
+func isNull(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) == 0 || string(data) == "null"
+}
+
+// indexToken returns the token of index and slice expressions.
+func indexToken(optional bool, pos token.Position) token.Token {
+	if optional {
+		return token.Token{Type: token.OPTCHAIN, Literal: "?.", Pos: pos}
+	}
+	return token.Token{Type: token.LBRACKET, Literal: "[", Pos: pos}
+}
+
+// field decodes the value of a field, missing fields keep their zero value.
+func (f fields) field(key string, v interface{}) error {
+	raw, ok := f.raw[key]
+	if !ok || isNull(raw) {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("ast: wrong value for field %s of %s : %s", key, f.kind, raw)
+	}
+	return nil
+}
+
+// position decodes a position field.
+func (f fields) position(key string) (token.Position, error) {
+	var pos position
+	err := f.field(key, &pos)
+	return token.Position{Line: pos.Line, Column: pos.Column}, err
+}
+
+// operator decodes the operator of prefix and infix expressions.
+func (f fields) operator(op *token.Literal, tok *token.Token, operators map[token.Literal]token.Type, pos token.Position) error {
+	var value string
+	if err := f.field("operator", &value); err != nil {
+		return err
+	}
+	typ, ok := operators[token.Literal(value)]
+	if !ok {
+		return fmt.Errorf("ast: unknown operator %q for %s", value, f.kind)
+	}
+	*op = token.Literal(value)
+	*tok = token.Token{Type: typ, Literal: token.Literal(value), Pos: pos}
+
+	return nil
+}
+
+// expression decodes an expression field.
+func (f fields) expression(key string) (Expression, error) {
+	node, err := decode(f.raw[key])
+	if err != nil || node == nil {
+		return nil, err
+	}
+	exp, ok := node.(Expression)
+	if !ok {
+		return nil, fmt.Errorf("ast: expected an expression in %s of %s got %s", key, f.kind, kindOf(node))
+	}
+	return exp, nil
+}
+
+// requiredExpression decodes an expression field that can't be null.
+func (f fields) requiredExpression(key string) (Expression, error) {
+	exp, err := f.expression(key)
+	if err == nil && exp == nil {
+		err = f.missing(key)
+	}
+	return exp, err
+}
+
+// missing reports a required field that is missing or null.
+func (f fields) missing(key string) error {
+	return fmt.Errorf("ast: %s expects %s", f.kind, key)
+}
+
+// identifier decodes an identifier field.
+func (f fields) identifier(key string) (*Identifier, error) {
+	return decodeIdentifier(f.raw[key], key, f.kind)
+}
+
+func decodeIdentifier(data []byte, key string, kind string) (*Identifier, error) {
+	node, err := decode(data)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	ident, ok := node.(*Identifier)
+	if !ok {
+		return nil, fmt.Errorf("ast: expected an Identifier in %s of %s got %s", key, kind, kindOf(node))
+	}
+	return ident, nil
+}
+
+// block decodes a block statement field.
+func (f fields) block(key string) (*BlockStatement, error) {
+	node, err := decode(f.raw[key])
+	if err != nil || node == nil {
+		return nil, err
+	}
+	block, ok := node.(*BlockStatement)
+	if !ok {
+		return nil, fmt.Errorf("ast: expected a BlockStatement in %s of %s got %s", key, f.kind, kindOf(node))
+	}
+	return block, nil
+}
+
+// requiredBlock decodes a block statement field that can't be null.
+func (f fields) requiredBlock(key string) (*BlockStatement, error) {
+	block, err := f.block(key)
+	if err == nil && block == nil {
+		err = f.missing(key)
+	}
+	return block, err
+}
+
+// requiredExpressions decodes a list of expressions that can't hold null.
+func (f fields) requiredExpressions(key string) ([]Expression, error) {
+	exps, err := f.expressions(key)
+	if err != nil {
+		return nil, err
+	}
+	for _, exp := range exps {
+		if exp == nil {
+			return nil, fmt.Errorf("ast: %s expects %s without null", f.kind, key)
+		}
+	}
+	return exps, nil
+}
+
+// expressions decodes a list of expressions, lists of defaults and patterns
+// hold null for the parameters without any.
+func (f fields) expressions(key string) ([]Expression, error) {
+	var raws []json.RawMessage
+	if err := f.field(key, &raws); err != nil {
+		return nil, err
+	}
+	exps := []Expression{}
+	for _, raw := range raws {
+		node, err := decode(raw)
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			exps = append(exps, nil)
+			continue
+		}
+		exp, ok := node.(Expression)
+		if !ok {
+			return nil, fmt.Errorf("ast: expected an expression in %s of %s got %s", key, f.kind, kindOf(node))
+		}
+		exps = append(exps, exp)
+	}
+	return exps, nil
+}
+
+// statements decodes a list of statements.
+func (f fields) statements(key string) ([]Statement, error) {
+	var raws []json.RawMessage
+	if err := f.field(key, &raws); err != nil {
+		return nil, err
+	}
+	stmts := []Statement{}
+	for _, raw := range raws {
+		node, err := decode(raw)
+		if err != nil {
+			return nil, err
+		}
+		stmt, ok := node.(Statement)
+		if !ok {
+			return nil, fmt.Errorf("ast: expected a statement in %s of %s got %s", key, f.kind, kindOf(node))
+		}
+		stmts = append(stmts, stmt)
+	}
+	return stmts, nil
+}
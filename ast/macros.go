@@ -0,0 +1,48 @@
+package ast
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/actuallyachraf/monkey-giggle/token"
+)
+
+// MacroLiteral represents macro definitions of the form macro(x, y) { body },
+// macros are bound by top-level let statements and called like functions with
+// the syntax trees of their arguments, their body returns the quoted tree the
+// call expands to.
+type MacroLiteral struct {
+	Token      token.Token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode() {}
+
+// TokenLiteral implements the node interface returns the token literal macro.
+func (ml *MacroLiteral) TokenLiteral() token.Literal {
+	return ml.Token.Literal
+}
+
+// Pos returns the position of the node token.
+func (ml *MacroLiteral) Pos() token.Position {
+	return ml.Token.Pos
+}
+
+// String implements the stringer interface.
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(string(ml.TokenLiteral()))
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(")")
+	out.WriteString(ml.Body.String())
+
+	return out.String()
+}
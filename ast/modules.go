@@ -0,0 +1,31 @@
+package ast
+
+import (
+	"strconv"
+
+	"github.com/actuallyachraf/monkey-giggle/token"
+)
+
+// ImportExpression represents expressions of the form import "path/to/module"
+// which evaluate to the module object holding the module exports.
+type ImportExpression struct {
+	Token token.Token
+	Path  string
+}
+
+func (ie *ImportExpression) expressionNode() {}
+
+// TokenLiteral implements the node interface
+func (ie *ImportExpression) TokenLiteral() token.Literal {
+	return ie.Token.Literal
+}
+
+// Pos returns the position of the node token.
+func (ie *ImportExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
+
+// String implements the stringer interface
+func (ie *ImportExpression) String() string {
+	return "import " + strconv.Quote(ie.Path)
+}
@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"math/big"
 	"strings"
 
 	"github.com/actuallyachraf/monkey-giggle/token"
@@ -9,11 +10,14 @@ import (
 
 // nodes.go implements Node for various declarations.
 
-// LetStatement implements the Node interface for let statements
+// LetStatement implements the Node interface for let statements, destructuring
+// let statements bind a Pattern instead of a single Name.
 type LetStatement struct {
-	Token token.Token // Let token
-	Name  *Identifier // Name of the identifier used to hold the left-value expression
-	Value Expression  // The value held by this identifier
+	Token    token.Token // Let token
+	Name     *Identifier // Name of the identifier used to hold the left-value expression
+	Pattern  Expression  // Destructuring pattern used instead of Name
+	Value    Expression  // The value held by this identifier
+	Exported bool        // Exported bindings are part of the module exports
 }
 
 func (ls *LetStatement) statementNode() {}
@@ -23,13 +27,25 @@ func (ls *LetStatement) TokenLiteral() token.Literal {
 	return ls.Token.Literal
 }
 
+// Pos returns the position of the node token.
+func (ls *LetStatement) Pos() token.Position {
+	return ls.Token.Pos
+}
+
 // Stringer implements the stringer interface.
 func (ls *LetStatement) String() string {
 
 	var out bytes.Buffer
 
+	if ls.Exported {
+		out.WriteString("export ")
+	}
 	out.WriteString(string(ls.TokenLiteral()) + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(ls.Pattern.String())
+	} else {
+		out.WriteString(ls.Name.String())
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
@@ -40,6 +56,15 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// Names returns the identifiers bound by the let statement.
+func (ls *LetStatement) Names() []*Identifier {
+	if ls.Pattern != nil {
+		return patternNames(ls.Pattern, nil)
+	}
+
+	return []*Identifier{ls.Name}
+}
+
 // Identifier implements the Node interface for identifier declarations.
 type Identifier struct {
 	Token token.Token
@@ -53,6 +78,11 @@ func (i *Identifier) TokenLiteral() token.Literal {
 	return i.Token.Literal
 }
 
+// Pos returns the position of the node token.
+func (i *Identifier) Pos() token.Position {
+	return i.Token.Pos
+}
+
 // String implements the stringer interface.
 func (i *Identifier) String() string {
 	return string(i.Value)
@@ -71,6 +101,11 @@ func (rs *ReturnStatement) TokenLiteral() token.Literal {
 	return rs.Token.Literal
 }
 
+// Pos returns the position of the node token.
+func (rs *ReturnStatement) Pos() token.Position {
+	return rs.Token.Pos
+}
+
 // String implements the stringer interface.
 func (rs *ReturnStatement) String() string {
 
@@ -100,6 +135,11 @@ func (es *ExpressionStatement) TokenLiteral() token.Literal {
 	return es.Token.Literal
 }
 
+// Pos returns the position of the node token.
+func (es *ExpressionStatement) Pos() token.Position {
+	return es.Token.Pos
+}
+
 // String implements the stringer interface.
 func (es *ExpressionStatement) String() string {
 
@@ -122,11 +162,39 @@ func (il *IntegerLiteral) TokenLiteral() token.Literal {
 	return il.Token.Literal
 }
 
+// Pos returns the position of the node token.
+func (il *IntegerLiteral) Pos() token.Position {
+	return il.Token.Pos
+}
+
 // String implements the stringer interface.
 func (il *IntegerLiteral) String() string {
 	return string(il.Token.Literal)
 }
 
+// BigIntegerLiteral represents a literal integer too large for an int64
+type BigIntegerLiteral struct {
+	Token token.Token
+	Value *big.Int
+}
+
+func (bl *BigIntegerLiteral) expressionNode() {}
+
+// TokenLiteral implements the node interface
+func (bl *BigIntegerLiteral) TokenLiteral() token.Literal {
+	return bl.Token.Literal
+}
+
+// Pos returns the position of the node token.
+func (bl *BigIntegerLiteral) Pos() token.Position {
+	return bl.Token.Pos
+}
+
+// String implements the stringer interface.
+func (bl *BigIntegerLiteral) String() string {
+	return string(bl.Token.Literal)
+}
+
 // StringLiteral represents a literal string
 type StringLiteral struct {
 	Token token.Token
@@ -140,10 +208,16 @@ func (sl *StringLiteral) TokenLiteral() token.Literal {
 	return sl.Token.Literal
 }
 
+// Pos returns the position of the node token.
+func (sl *StringLiteral) Pos() token.Position {
+	return sl.Token.Pos
+}
+
 // ArrayLiteral represents arrays
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
+	Rbracket token.Position // Position of the closing bracket
 }
 
 func (al *ArrayLiteral) expressionNode() {}
@@ -153,6 +227,11 @@ func (al *ArrayLiteral) TokenLiteral() token.Literal {
 	return al.Token.Literal
 }
 
+// Pos returns the position of the node token.
+func (al *ArrayLiteral) Pos() token.Position {
+	return al.Token.Pos
+}
+
 // String implements the stringer interface
 func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
@@ -189,6 +268,11 @@ func (pe *PrefixExpression) TokenLiteral() token.Literal {
 	return pe.Token.Literal
 }
 
+// Pos returns the position of the node token.
+func (pe *PrefixExpression) Pos() token.Position {
+	return pe.Token.Pos
+}
+
 // String implements the stringer interface
 func (pe *PrefixExpression) String() string {
 
@@ -218,6 +302,11 @@ func (ie *InfixExpression) TokenLiteral() token.Literal {
 	return ie.Token.Literal
 }
 
+// Pos returns the position of the node token.
+func (ie *InfixExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
+
 // String implements the stringer interface
 func (ie *InfixExpression) String() string {
 
@@ -247,11 +336,38 @@ func (bl *BooleanLiteral) TokenLiteral() token.Literal {
 	return bl.Token.Literal
 }
 
+// Pos returns the position of the node token.
+func (bl *BooleanLiteral) Pos() token.Position {
+	return bl.Token.Pos
+}
+
 // String implements the stringer interface.
 func (bl *BooleanLiteral) String() string {
 	return string(bl.Token.Literal)
 }
 
+// NullLiteral represents the literal null value.
+type NullLiteral struct {
+	Token token.Token
+}
+
+func (nl *NullLiteral) expressionNode() {}
+
+// TokenLiteral implements the interface and returns the Expression literal.
+func (nl *NullLiteral) TokenLiteral() token.Literal {
+	return nl.Token.Literal
+}
+
+// Pos returns the position of the node token.
+func (nl *NullLiteral) Pos() token.Position {
+	return nl.Token.Pos
+}
+
+// String implements the stringer interface.
+func (nl *NullLiteral) String() string {
+	return string(nl.Token.Literal)
+}
+
 // IfExpression represents a conditional if expression.
 type IfExpression struct {
 	Token       token.Token
@@ -267,6 +383,11 @@ func (ie *IfExpression) TokenLiteral() token.Literal {
 	return ie.Token.Literal
 }
 
+// Pos returns the position of the node token.
+func (ie *IfExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
+
 // String implements the stringer interface
 func (ie *IfExpression) String() string {
 
@@ -290,6 +411,7 @@ func (ie *IfExpression) String() string {
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	Rbrace     token.Position // Position of the closing brace
 }
 
 func (bs *BlockStatement) statementNode() {}
@@ -299,6 +421,11 @@ func (bs *BlockStatement) TokenLiteral() token.Literal {
 	return bs.Token.Literal
 }
 
+// Pos returns the position of the node token.
+func (bs *BlockStatement) Pos() token.Position {
+	return bs.Token.Pos
+}
+
 // String implements the stringer interface.
 func (bs *BlockStatement) String() string {
 
@@ -312,10 +439,47 @@ func (bs *BlockStatement) String() string {
 }
 
 // FunctionLiteral represents nodes for expressions of the type fn <params> <block>
+// parameters may have default values in which case Defaults holds the default
+// expression at the parameter's position (nil for required parameters) and
+// the rest parameter ...rest collects extra arguments in an array.
+//
+// Destructured parameters fn([a, b]) are bound to a generated identifier and
+// Patterns holds the pattern at the parameter's position.
 type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
+	Defaults   []Expression
+	Patterns   []Expression
+	Rest       *Identifier
 	Body       *BlockStatement
+	Name       string // Name of the let binding the function is assigned to
+}
+
+// Pattern returns the destructuring pattern of the i-th parameter or nil.
+func (fl *FunctionLiteral) Pattern(i int) Expression {
+	if i < len(fl.Patterns) {
+		return fl.Patterns[i]
+	}
+	return nil
+}
+
+// Default returns the default value of the i-th parameter or nil.
+func (fl *FunctionLiteral) Default(i int) Expression {
+	if i < len(fl.Defaults) {
+		return fl.Defaults[i]
+	}
+	return nil
+}
+
+// NumDefaults returns the number of parameters with a default value.
+func (fl *FunctionLiteral) NumDefaults() int {
+	n := 0
+	for _, d := range fl.Defaults {
+		if d != nil {
+			n++
+		}
+	}
+	return n
 }
 
 func (fl *FunctionLiteral) expressionNode() {}
@@ -325,23 +489,59 @@ func (fl *FunctionLiteral) TokenLiteral() token.Literal {
 	return fl.Token.Literal
 }
 
+// Pos returns the position of the node token.
+func (fl *FunctionLiteral) Pos() token.Position {
+	return fl.Token.Pos
+}
+
 // String implements the stringer interface.
 func (fl *FunctionLiteral) String() string {
-	var out bytes.Buffer
+	return fl.Signature() + fl.Body.String()
+}
 
+// Signature returns the function keyword followed by the parameter list.
+func (fl *FunctionLiteral) Signature() string {
 	params := []string{}
 
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+	for i, p := range fl.Parameters {
+		param := p.String()
+		if pattern := fl.Pattern(i); pattern != nil {
+			param = pattern.String()
+		}
+		if d := fl.Default(i); d != nil {
+			param += " = " + d.String()
+		}
+		params = append(params, param)
+	}
+	if fl.Rest != nil {
+		params = append(params, "..."+fl.Rest.String())
 	}
 
-	out.WriteString(string(fl.TokenLiteral()))
-	out.WriteString("(")
-	out.WriteString(strings.Join(params, ", "))
-	out.WriteString(")")
-	out.WriteString(fl.Body.String())
+	return string(fl.TokenLiteral()) + "(" + strings.Join(params, ", ") + ")"
+}
 
-	return out.String()
+// SpreadExpression represents the spread operator ...xs that expands an
+// array in call arguments and array literals.
+type SpreadExpression struct {
+	Token token.Token
+	Value Expression
+}
+
+func (se *SpreadExpression) expressionNode() {}
+
+// TokenLiteral implements the node interface
+func (se *SpreadExpression) TokenLiteral() token.Literal {
+	return se.Token.Literal
+}
+
+// Pos returns the position of the node token.
+func (se *SpreadExpression) Pos() token.Position {
+	return se.Token.Pos
+}
+
+// String implements the stringer interface
+func (se *SpreadExpression) String() string {
+	return "..." + se.Value.String()
 }
 
 // CallExpression represents function calls.
@@ -349,6 +549,7 @@ type CallExpression struct {
 	Token     token.Token
 	Function  Expression
 	Arguments []Expression
+	Rparen    token.Position // Position of the closing parenthesis
 }
 
 func (ce *CallExpression) expressionNode() {}
@@ -358,6 +559,11 @@ func (ce *CallExpression) TokenLiteral() token.Literal {
 	return ce.Token.Literal
 }
 
+// Pos returns the position of the node token.
+func (ce *CallExpression) Pos() token.Position {
+	return ce.Token.Pos
+}
+
 // String implements the stringer interface.
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
@@ -377,11 +583,14 @@ func (ce *CallExpression) String() string {
 
 }
 
-// IndexExpression represents indexing expressions for index accessible ds.
+// IndexExpression represents indexing expressions for index accessible ds,
+// optional (safe navigation) index expressions a?.[k] evaluate to null when
+// the indexed value is null.
 type IndexExpression struct {
-	Token token.Token
-	Left  Expression
-	Index Expression
+	Token    token.Token
+	Left     Expression
+	Index    Expression
+	Optional bool
 }
 
 func (ie *IndexExpression) expressionNode() {}
@@ -391,6 +600,11 @@ func (ie *IndexExpression) TokenLiteral() token.Literal {
 	return ie.Token.Literal
 }
 
+// Pos returns the position of the node token.
+func (ie *IndexExpression) Pos() token.Position {
+	return ie.Token.Pos
+}
+
 // String implements the stringer interface
 func (ie *IndexExpression) String() string {
 
@@ -398,6 +612,9 @@ func (ie *IndexExpression) String() string {
 
 	out.WriteString("(")
 	out.WriteString(ie.Left.String())
+	if ie.Optional {
+		out.WriteString("?.")
+	}
 	out.WriteString("[")
 	out.WriteString(ie.Index.String())
 	out.WriteString("])")
@@ -405,10 +622,56 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// SliceExpression represents slicing expressions xs[start:end] on arrays and
+// strings, omitted bounds are nil.
+type SliceExpression struct {
+	Token    token.Token
+	Left     Expression
+	Start    Expression
+	End      Expression
+	Optional bool
+}
+
+func (se *SliceExpression) expressionNode() {}
+
+// TokenLiteral implements the node interface
+func (se *SliceExpression) TokenLiteral() token.Literal {
+	return se.Token.Literal
+}
+
+// Pos returns the position of the node token.
+func (se *SliceExpression) Pos() token.Position {
+	return se.Token.Pos
+}
+
+// String implements the stringer interface
+func (se *SliceExpression) String() string {
+
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	if se.Optional {
+		out.WriteString("?.")
+	}
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
 // HashmapLiteral represents a hashmap
 type HashmapLiteral struct {
-	Token token.Token
-	Pairs map[Expression]Expression
+	Token  token.Token
+	Pairs  map[Expression]Expression
+	Rbrace token.Position // Position of the closing brace
 }
 
 func (hl *HashmapLiteral) expressionNode() {}
@@ -418,6 +681,11 @@ func (hl *HashmapLiteral) TokenLiteral() token.Literal {
 	return hl.Token.Literal
 }
 
+// Pos returns the position of the node token.
+func (hl *HashmapLiteral) Pos() token.Position {
+	return hl.Token.Pos
+}
+
 // String implements the stringer interface
 func (hl *HashmapLiteral) String() string {
 	var out bytes.Buffer
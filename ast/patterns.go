@@ -0,0 +1,174 @@
+package ast
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/actuallyachraf/monkey-giggle/token"
+)
+
+// patterns.go implements the destructuring patterns used by let statements
+// and function parameters, patterns nest so elements and values are either
+// identifiers or other patterns.
+
+// ArrayPattern destructures arrays [a, b, ...rest]
+type ArrayPattern struct {
+	Token    token.Token
+	Elements []Expression
+	Rest     *Identifier
+}
+
+func (ap *ArrayPattern) expressionNode() {}
+
+// TokenLiteral implements the node interface
+func (ap *ArrayPattern) TokenLiteral() token.Literal {
+	return ap.Token.Literal
+}
+
+// Pos returns the position of the node token.
+func (ap *ArrayPattern) Pos() token.Position {
+	return ap.Token.Pos
+}
+
+// String implements the stringer interface
+func (ap *ArrayPattern) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// HashPattern destructures hashmaps {name, "age": years}, the shorthand
+// {name} binds the value of the "name" key to the identifier name.
+type HashPattern struct {
+	Token  token.Token
+	Keys   []*StringLiteral
+	Values []Expression
+}
+
+func (hp *HashPattern) expressionNode() {}
+
+// TokenLiteral implements the node interface
+func (hp *HashPattern) TokenLiteral() token.Literal {
+	return hp.Token.Literal
+}
+
+// Pos returns the position of the node token.
+func (hp *HashPattern) Pos() token.Position {
+	return hp.Token.Pos
+}
+
+// String implements the stringer interface
+func (hp *HashPattern) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for i, key := range hp.Keys {
+		if ident, ok := hp.Values[i].(*Identifier); ok && string(ident.Value) == key.Value {
+			pairs = append(pairs, key.Value)
+			continue
+		}
+		pairs = append(pairs, `"`+key.Value+`": `+hp.Values[i].String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// patternNames appends the identifiers bound by a destructuring pattern to names.
+func patternNames(pattern Expression, names []*Identifier) []*Identifier {
+	switch pattern := pattern.(type) {
+	case *Identifier:
+		names = append(names, pattern)
+	case *ArrayPattern:
+		for _, el := range pattern.Elements {
+			names = patternNames(el, names)
+		}
+		if pattern.Rest != nil {
+			names = append(names, pattern.Rest)
+		}
+	case *HashPattern:
+		for _, value := range pattern.Values {
+			names = patternNames(value, names)
+		}
+	}
+
+	return names
+}
+
+// MatchExpression represents pattern matching expressions
+// match (value) { pattern if guard => body, ... }
+type MatchExpression struct {
+	Token  token.Token
+	Value  Expression
+	Arms   []*MatchArm
+	Rbrace token.Position // Position of the closing brace
+}
+
+// MatchArm represents a single arm of a match expression, arms are tried in
+// order and the body of the first arm whose pattern matches and whose guard
+// (if any) is true gives the value of the match expression.
+type MatchArm struct {
+	Pattern Expression
+	Guard   Expression
+	Body    *BlockStatement
+}
+
+func (me *MatchExpression) expressionNode() {}
+
+// TokenLiteral implements the node interface
+func (me *MatchExpression) TokenLiteral() token.Literal {
+	return me.Token.Literal
+}
+
+// Pos returns the position of the node token.
+func (me *MatchExpression) Pos() token.Position {
+	return me.Token.Pos
+}
+
+// String implements the stringer interface
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	arms := []string{}
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.String())
+	}
+
+	out.WriteString("match (")
+	out.WriteString(me.Value.String())
+	out.WriteString(") { ")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString(" }")
+
+	return out.String()
+}
+
+// String implements the stringer interface
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(ma.Guard.String())
+	}
+	out.WriteString(" => ")
+	out.WriteString(ma.Body.String())
+
+	return out.String()
+}
@@ -0,0 +1,423 @@
+package ast
+
+import (
+	"fmt"
+	"sort"
+)
+
+// walk.go implements the traversal of syntax trees shared by the tools working
+// on them, children are visited in the order they appear in the source code.
+// Programs with syntax errors hold nil nodes which are skipped.
+
+// Visitor visits the nodes of a tree with Walk, the visitor w returned by
+// Visit visits the children of node then is called with nil. Children aren't
+// visited when w is nil.
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses a tree in depth first order.
+func Walk(v Visitor, node Node) {
+	if isNil(node) {
+		return
+	}
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	for _, child := range children(node) {
+		Walk(v, child)
+	}
+	v.Visit(nil)
+}
+
+// inspector is the visitor of Inspect.
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if node != nil && f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses a tree in depth first order calling f on every node, the
+// children of a node are skipped when f returns false.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// children returns the children of a node in source order.
+func children(node Node) []Node {
+	nodes := []Node{}
+	add := func(children ...Node) {
+		for _, child := range children {
+			if !isNil(child) {
+				nodes = append(nodes, child)
+			}
+		}
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, s := range n.Statements {
+			add(s)
+		}
+	case *LetStatement:
+		add(n.Name, n.Pattern, n.Value)
+	case *ReturnStatement:
+		add(n.ReturnValue)
+	case *ExpressionStatement:
+		add(n.Expression)
+	case *ThrowStatement:
+		add(n.Value)
+	case *BlockStatement:
+		for _, s := range n.Statements {
+			add(s)
+		}
+	case *PrefixExpression:
+		add(n.Right)
+	case *InfixExpression:
+		add(n.Left, n.Right)
+	case *IfExpression:
+		add(n.Condition, n.Consequence, n.Alternative)
+	case *FunctionLiteral:
+		for i, param := range n.Parameters {
+			add(param, n.Pattern(i), n.Default(i))
+		}
+		add(n.Rest, n.Body)
+	case *MacroLiteral:
+		for _, param := range n.Parameters {
+			add(param)
+		}
+		add(n.Body)
+	case *SpreadExpression:
+		add(n.Value)
+	case *CallExpression:
+		add(n.Function)
+		for _, arg := range n.Arguments {
+			add(arg)
+		}
+	case *IndexExpression:
+		add(n.Left, n.Index)
+	case *SliceExpression:
+		add(n.Left, n.Start, n.End)
+	case *ArrayLiteral:
+		for _, el := range n.Elements {
+			add(el)
+		}
+	case *HashmapLiteral:
+		for _, key := range sortedKeys(n) {
+			add(key, n.Pairs[key])
+		}
+	case *ArrayPattern:
+		for _, el := range n.Elements {
+			add(el)
+		}
+		add(n.Rest)
+	case *HashPattern:
+		for i, key := range n.Keys {
+			add(key)
+			if i < len(n.Values) {
+				add(n.Values[i])
+			}
+		}
+	case *MatchExpression:
+		add(n.Value)
+		for _, arm := range n.Arms {
+			add(arm.Pattern, arm.Guard, arm.Body)
+		}
+	case *TryExpression:
+		add(n.Block, n.Param, n.Catch, n.Finally)
+	}
+
+	return nodes
+}
+
+// sortedKeys returns the keys of a hashmap literal in source order.
+func sortedKeys(h *HashmapLiteral) []Expression {
+	keys := make([]Expression, 0, len(h.Pairs))
+	for key := range h.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i].Pos(), keys[j].Pos()
+		if a != b {
+			return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+		}
+		return keys[i].String() < keys[j].String()
+	})
+
+	return keys
+}
+
+// Rewrite returns a copy of a tree where every node is replaced by the result
+// of f, nodes are rewritten bottom-up : f is called with a copy of each node
+// whose children were already rewritten. The nodes of the given tree are never
+// modified unless f modifies them.
+//
+// Statements rewritten to nil are removed from their program or block, other
+// nodes rewritten to nil leave their field empty. Replacing a node by a node
+// that doesn't fit its field, a statement where an expression is expected for
+// instance, panics.
+func Rewrite(node Node, f func(Node) Node) Node {
+	if isNil(node) {
+		return nil
+	}
+	r := rewriter(f)
+
+	switch n := node.(type) {
+	case *Program:
+		c := *n
+		c.Statements = r.statements(n.Statements)
+		return f(&c)
+	case *LetStatement:
+		c := *n
+		c.Name = r.identifier(n.Name)
+		c.Pattern = r.expression(n.Pattern)
+		c.Value = r.expression(n.Value)
+		return f(&c)
+	case *ReturnStatement:
+		c := *n
+		c.ReturnValue = r.expression(n.ReturnValue)
+		return f(&c)
+	case *ExpressionStatement:
+		c := *n
+		c.Expression = r.expression(n.Expression)
+		return f(&c)
+	case *ThrowStatement:
+		c := *n
+		c.Value = r.expression(n.Value)
+		return f(&c)
+	case *BlockStatement:
+		c := *n
+		c.Statements = r.statements(n.Statements)
+		return f(&c)
+	case *PrefixExpression:
+		c := *n
+		c.Right = r.expression(n.Right)
+		return f(&c)
+	case *InfixExpression:
+		c := *n
+		c.Left = r.expression(n.Left)
+		c.Right = r.expression(n.Right)
+		return f(&c)
+	case *IfExpression:
+		c := *n
+		c.Condition = r.expression(n.Condition)
+		c.Consequence = r.block(n.Consequence)
+		c.Alternative = r.block(n.Alternative)
+		return f(&c)
+	case *FunctionLiteral:
+		c := *n
+		c.Parameters = make([]*Identifier, len(n.Parameters))
+		for i, param := range n.Parameters {
+			c.Parameters[i] = r.identifier(param)
+		}
+		c.Patterns = r.expressions(n.Patterns)
+		c.Defaults = r.expressions(n.Defaults)
+		c.Rest = r.identifier(n.Rest)
+		c.Body = r.block(n.Body)
+		return f(&c)
+	case *MacroLiteral:
+		c := *n
+		c.Parameters = make([]*Identifier, len(n.Parameters))
+		for i, param := range n.Parameters {
+			c.Parameters[i] = r.identifier(param)
+		}
+		c.Body = r.block(n.Body)
+		return f(&c)
+	case *SpreadExpression:
+		c := *n
+		c.Value = r.expression(n.Value)
+		return f(&c)
+	case *CallExpression:
+		c := *n
+		c.Function = r.expression(n.Function)
+		c.Arguments = r.expressions(n.Arguments)
+		return f(&c)
+	case *IndexExpression:
+		c := *n
+		c.Left = r.expression(n.Left)
+		c.Index = r.expression(n.Index)
+		return f(&c)
+	case *SliceExpression:
+		c := *n
+		c.Left = r.expression(n.Left)
+		c.Start = r.expression(n.Start)
+		c.End = r.expression(n.End)
+		return f(&c)
+	case *ArrayLiteral:
+		c := *n
+		c.Elements = r.expressions(n.Elements)
+		return f(&c)
+	case *HashmapLiteral:
+		c := *n
+		c.Pairs = make(map[Expression]Expression, len(n.Pairs))
+		for _, key := range sortedKeys(n) {
+			value := r.expression(n.Pairs[key])
+			if key = r.expression(key); key != nil {
+				c.Pairs[key] = value
+			}
+		}
+		return f(&c)
+	case *ArrayPattern:
+		c := *n
+		c.Elements = r.expressions(n.Elements)
+		c.Rest = r.identifier(n.Rest)
+		return f(&c)
+	case *HashPattern:
+		c := *n
+		c.Keys = make([]*StringLiteral, len(n.Keys))
+		for i, key := range n.Keys {
+			c.Keys[i] = r.stringLiteral(key)
+		}
+		c.Values = r.expressions(n.Values)
+		return f(&c)
+	case *MatchExpression:
+		c := *n
+		c.Value = r.expression(n.Value)
+		c.Arms = make([]*MatchArm, len(n.Arms))
+		for i, arm := range n.Arms {
+			c.Arms[i] = &MatchArm{
+				Pattern: r.expression(arm.Pattern),
+				Guard:   r.expression(arm.Guard),
+				Body:    r.block(arm.Body),
+			}
+		}
+		return f(&c)
+	case *TryExpression:
+		c := *n
+		c.Block = r.block(n.Block)
+		c.Param = r.identifier(n.Param)
+		c.Catch = r.block(n.Catch)
+		c.Finally = r.block(n.Finally)
+		return f(&c)
+	case *Identifier:
+		c := *n
+		return f(&c)
+	case *IntegerLiteral:
+		c := *n
+		return f(&c)
+	case *BigIntegerLiteral:
+		c := *n
+		return f(&c)
+	case *StringLiteral:
+		c := *n
+		return f(&c)
+	case *BooleanLiteral:
+		c := *n
+		return f(&c)
+	case *NullLiteral:
+		c := *n
+		return f(&c)
+	case *ImportExpression:
+		c := *n
+		return f(&c)
+	case *Comment:
+		c := *n
+		return f(&c)
+	default:
+		return f(node)
+	}
+}
+
+// rewriter rewrites the children of nodes checking the rewritten nodes fit.
+type rewriter func(Node) Node
+
+func (r rewriter) rewrite(node Node) Node {
+	if isNil(node) {
+		return nil
+	}
+	rewritten := Rewrite(node, r)
+	if isNil(rewritten) {
+		return nil
+	}
+	return rewritten
+}
+
+// misfit panics when a node is rewritten to a node that doesn't fit.
+func misfit(node Node, rewritten Node, expected string) {
+	panic(fmt.Sprintf("ast: %s rewritten to %s where %s is expected", kindOf(node), kindOf(rewritten), expected))
+}
+
+func (r rewriter) expression(e Expression) Expression {
+	rewritten := r.rewrite(e)
+	if rewritten == nil {
+		return nil
+	}
+	exp, ok := rewritten.(Expression)
+	if !ok {
+		misfit(e, rewritten, "an expression")
+	}
+	return exp
+}
+
+func (r rewriter) identifier(ident *Identifier) *Identifier {
+	rewritten := r.rewrite(ident)
+	if rewritten == nil {
+		return nil
+	}
+	i, ok := rewritten.(*Identifier)
+	if !ok {
+		misfit(ident, rewritten, "an Identifier")
+	}
+	return i
+}
+
+func (r rewriter) stringLiteral(lit *StringLiteral) *StringLiteral {
+	rewritten := r.rewrite(lit)
+	if rewritten == nil {
+		return nil
+	}
+	s, ok := rewritten.(*StringLiteral)
+	if !ok {
+		misfit(lit, rewritten, "a StringLiteral")
+	}
+	return s
+}
+
+func (r rewriter) block(block *BlockStatement) *BlockStatement {
+	rewritten := r.rewrite(block)
+	if rewritten == nil {
+		return nil
+	}
+	b, ok := rewritten.(*BlockStatement)
+	if !ok {
+		misfit(block, rewritten, "a BlockStatement")
+	}
+	return b
+}
+
+// expressions rewrites a list of expressions, lists of defaults and patterns
+// keep their nil entries.
+func (r rewriter) expressions(exps []Expression) []Expression {
+	if exps == nil {
+		return nil
+	}
+	rewritten := make([]Expression, len(exps))
+	for i, e := range exps {
+		rewritten[i] = r.expression(e)
+	}
+	return rewritten
+}
+
+// statements rewrites a list of statements dropping the ones rewritten to nil.
+func (r rewriter) statements(stmts []Statement) []Statement {
+	if stmts == nil {
+		return nil
+	}
+	rewritten := make([]Statement, 0, len(stmts))
+	for _, s := range stmts {
+		n := r.rewrite(s)
+		if n == nil {
+			continue
+		}
+		stmt, ok := n.(Statement)
+		if !ok {
+			misfit(s, n, "a statement")
+		}
+		rewritten = append(rewritten, stmt)
+	}
+	return rewritten
+}
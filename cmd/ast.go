@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/actuallyachraf/monkey-giggle/ast"
+	"github.com/actuallyachraf/monkey-giggle/format"
+	"github.com/actuallyachraf/monkey-giggle/lexer"
+	"github.com/actuallyachraf/monkey-giggle/parser"
+)
+
+// printAST prints the syntax tree of a source file as JSON, the syntax tree of
+// a .json file is printed back as source code instead.
+func printAST(file string) int {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if filepath.Ext(file) == ".json" {
+		program := &ast.Program{}
+		if err := json.Unmarshal(src, program); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+			return 1
+		}
+		fmt.Println(format.Node(program))
+		return 0
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.Parse()
+	if len(p.Errors()) != 0 {
+		for _, err := range p.SyntaxErrors() {
+			fmt.Fprintf(os.Stderr, "%s:%s: %s\n", file, err.Pos, err.Msg)
+		}
+		return 1
+	}
+
+	out, err := json.MarshalIndent(program, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Println(string(out))
+
+	return 0
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/actuallyachraf/monkey-giggle/dap"
+)
+
+// serveDAP serves the Debug Adapter Protocol over stdin and stdout.
+func serveDAP() int {
+	err := dap.NewServer(os.Stdin, os.Stdout).Serve()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
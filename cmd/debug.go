@@ -0,0 +1,24 @@
+package main
+
+import (
+	"os"
+
+	"github.com/actuallyachraf/monkey-giggle/debug"
+)
+
+// debugFile runs a source file in the debugger reading commands from stdin,
+// it's compiled without optimizations so every line can be stepped through
+// and every call keeps its frame in backtraces.
+func debugFile(file string) int {
+	bytecode, loader, ok := compile(file, false)
+	if !ok {
+		return 1
+	}
+
+	err := debug.New(bytecode, loader.Source, os.Stdin, os.Stdout).Run()
+	if err != nil {
+		return 1
+	}
+
+	return 0
+}
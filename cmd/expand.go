@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/actuallyachraf/monkey-giggle/format"
+	"github.com/actuallyachraf/monkey-giggle/lexer"
+	"github.com/actuallyachraf/monkey-giggle/macro"
+	"github.com/actuallyachraf/monkey-giggle/parser"
+)
+
+// expandFile prints the source code of a program once its macros expanded.
+func expandFile(file string) int {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.Parse()
+	if len(p.Errors()) != 0 {
+		for _, err := range p.SyntaxErrors() {
+			fmt.Fprintf(os.Stderr, "%s:%s: %s\n", file, err.Pos, err.Msg)
+		}
+		return 1
+	}
+
+	expanded, err := macro.Expand(program)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", expansionLocation(file, err), err)
+		return 1
+	}
+	fmt.Println(format.Node(expanded))
+
+	return 0
+}
+
+// expansionLocation returns the file:line:column location of a macro
+// expansion error, errors without a position are located at the file.
+func expansionLocation(file string, err error) string {
+	if merr, ok := err.(macro.Error); ok {
+		return file + ":" + merr.Pos.String()
+	}
+
+	return file
+}
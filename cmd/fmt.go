@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/actuallyachraf/monkey-giggle/format"
+	"github.com/actuallyachraf/monkey-giggle/parser"
+)
+
+// formatFiles formats source files in place, directories are searched for .gg
+// files. With -check the files are left untouched and the ones that aren't
+// formatted are listed, the exit status is 1 when there are any.
+func formatFiles(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	check := flags.Bool("check", false, "list the files that aren't formatted instead of formatting them")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: giggle fmt [-check] path...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	files, err := sourceFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	status := 0
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+
+		formatted, err := format.Source(src)
+		if err != nil {
+			if serr, ok := err.(parser.Error); ok {
+				fmt.Fprintf(os.Stderr, "%s:%s: %s\n", file, serr.Pos, serr.Msg)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+			}
+			status = 1
+			continue
+		}
+		if bytes.Equal(src, formatted) {
+			continue
+		}
+
+		if *check {
+			fmt.Println(file)
+			status = 1
+			continue
+		}
+		info, err := os.Stat(file)
+		if err == nil {
+			err = ioutil.WriteFile(file, formatted, info.Mode())
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+		}
+	}
+
+	return status
+}
+
+// sourceFiles lists the files of paths, directories are walked for .gg files.
+func sourceFiles(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && filepath.Ext(file) == ".gg" {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
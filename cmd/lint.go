@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/actuallyachraf/monkey-giggle/lint"
+	"github.com/actuallyachraf/monkey-giggle/parser"
+)
+
+// lintDiagnostic is the JSON form of a diagnostic.
+type lintDiagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// lintFiles lints source files, directories are searched for .gg files. The
+// diagnostics are printed one per line or as a JSON array with -json, the exit
+// status is 1 when there are any.
+func lintFiles(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the diagnostics as a JSON array")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: giggle lint [-json] path...")
+		flags.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "rules:")
+		for _, rule := range lint.Rules {
+			fmt.Fprintf(os.Stderr, "  %s\n    \t%s\n", rule.ID, rule.Doc)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	files, err := sourceFiles(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	status := 0
+	found := []lintDiagnostic{}
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+
+		diagnostics, err := lint.Source(src)
+		if err != nil {
+			if serr, ok := err.(parser.Error); ok {
+				fmt.Fprintf(os.Stderr, "%s:%s: %s\n", file, serr.Pos, serr.Msg)
+			} else {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+			}
+			status = 1
+			continue
+		}
+		for _, d := range diagnostics {
+			found = append(found, lintDiagnostic{file, d.Pos.Line, d.Pos.Column, d.Rule, d.Message})
+			if !*asJSON {
+				fmt.Printf("%s:%s\n", file, d)
+			}
+		}
+	}
+
+	if *asJSON {
+		out, err := json.MarshalIndent(found, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Println(string(out))
+	}
+	if len(found) > 0 {
+		status = 1
+	}
+
+	return status
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/actuallyachraf/monkey-giggle/lsp"
+)
+
+// serveLSP serves the Language Server Protocol over stdin and stdout.
+func serveLSP() int {
+	err := lsp.NewServer(os.Stdin, os.Stdout).Serve()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return 0
+}
@@ -9,6 +9,31 @@ import (
 )
 
 func main() {
+	if len(os.Args) == 3 && os.Args[1] == "run" {
+		os.Exit(run(os.Args[2]))
+	}
+	if len(os.Args) == 3 && os.Args[1] == "ast" {
+		os.Exit(printAST(os.Args[2]))
+	}
+	if len(os.Args) == 3 && os.Args[1] == "expand" {
+		os.Exit(expandFile(os.Args[2]))
+	}
+	if len(os.Args) == 3 && os.Args[1] == "debug" {
+		os.Exit(debugFile(os.Args[2]))
+	}
+	if len(os.Args) == 2 && os.Args[1] == "dap" {
+		os.Exit(serveDAP())
+	}
+	if len(os.Args) >= 2 && os.Args[1] == "fmt" {
+		os.Exit(formatFiles(os.Args[2:]))
+	}
+	if len(os.Args) >= 2 && os.Args[1] == "lint" {
+		os.Exit(lintFiles(os.Args[2:]))
+	}
+	if len(os.Args) == 2 && os.Args[1] == "lsp" {
+		os.Exit(serveLSP())
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
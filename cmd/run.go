@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/actuallyachraf/monkey-giggle/ast"
+	"github.com/actuallyachraf/monkey-giggle/compiler"
+	"github.com/actuallyachraf/monkey-giggle/lexer"
+	"github.com/actuallyachraf/monkey-giggle/macro"
+	"github.com/actuallyachraf/monkey-giggle/module"
+	"github.com/actuallyachraf/monkey-giggle/parser"
+	"github.com/actuallyachraf/monkey-giggle/vm"
+)
+
+// run compiles and executes a source file printing the value of its last
+// expression if any.
+func run(file string) int {
+	bytecode, _, ok := compile(file, true)
+	if !ok {
+		return 1
+	}
+
+	machine := vm.New(bytecode)
+	err := machine.Run()
+	if err != nil {
+		location := file
+		if rerr, ok := err.(*vm.RuntimeError); ok && rerr.Location() != "" {
+			location = rerr.Location()
+		}
+		fmt.Fprintf(os.Stderr, "%s: %s\n", location, err)
+		return 1
+	}
+
+	if last := machine.LastPoppedStackElem(); last != nil && last != vm.Null {
+		fmt.Println(last.Inspect())
+	}
+
+	return 0
+}
+
+// compile compiles a source file reporting errors on stderr, imported modules
+// are searched in the directory of the file first then in the default search
+// path. The loader used to load them is returned with the bytecode.
+func compile(file string, optimize bool) (compiler.Bytecode, *module.Loader, bool) {
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return compiler.Bytecode{}, nil, false
+	}
+
+	program := &ast.Program{}
+	if filepath.Ext(file) == ".json" {
+		// syntax trees exported by giggle ast
+		if err := json.Unmarshal(src, program); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+			return compiler.Bytecode{}, nil, false
+		}
+	} else {
+		p := parser.New(lexer.New(string(src)))
+		program = p.Parse()
+		if len(p.Errors()) != 0 {
+			for _, err := range p.SyntaxErrors() {
+				fmt.Fprintf(os.Stderr, "%s:%s: %s\n", file, err.Pos, err.Msg)
+			}
+			return compiler.Bytecode{}, nil, false
+		}
+	}
+	program, err = macro.Expand(program)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", expansionLocation(file, err), err)
+		return compiler.Bytecode{}, nil, false
+	}
+
+	paths := append([]string{filepath.Dir(file)}, module.DefaultPaths()...)
+	loader := module.NewLoader(paths...)
+	loader.Expand = macro.Expand
+	comp := compiler.New()
+	comp.SetLoader(loader)
+	comp.SetFile(file)
+	comp.SetFolding(optimize)
+	comp.SetPeephole(optimize)
+	comp.SetTailCalls(optimize)
+	err = comp.Compile(program)
+	if err != nil {
+		location := file
+		if cerr, ok := err.(*compiler.CompileError); ok && cerr.Location() != "" {
+			location = cerr.Location()
+		}
+		fmt.Fprintf(os.Stderr, "%s: compilation failed: %s\n", location, err)
+		return compiler.Bytecode{}, nil, false
+	}
+
+	return comp.Bytecode(), loader, true
+}
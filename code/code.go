@@ -76,6 +76,57 @@ const (
 	OpClosure
 	// OpGetFree is used to get free closure variables
 	OpGetFree
+	// OpJumpNull jumps to address if the top of the stack is null, the value
+	// is left on the stack
+	OpJumpNull
+	// OpJumpNotNull jumps to address if the top of the stack is not null, the
+	// value is left on the stack
+	OpJumpNotNull
+	// OpSlice pops the end and start bounds and the sequence and pushes the slice
+	OpSlice
+	// OpConcatArrays pops N arrays from the stack and pushes their concatenation
+	OpConcatArrays
+	// OpCallSpread pops an array of arguments and calls the function below it
+	OpCallSpread
+	// OpDup pushes a copy of the top of the stack
+	OpDup
+	// OpDestructureArray checks the top of the stack is an array of N elements
+	// (at least N when the second operand marks a rest pattern)
+	OpDestructureArray
+	// OpDestructureHash pops N keys and checks the hashmap below holds them
+	OpDestructureHash
+	// OpMatchArray pops a value and pushes whether it is an array of N elements
+	// (at least N when the second operand marks a rest pattern)
+	OpMatchArray
+	// OpMatchHash pops N keys and a value and pushes whether the value is a
+	// hashmap holding them
+	OpMatchHash
+	// OpTry activates the exception handler at index N of the function's
+	// handler table
+	OpTry
+	// OpEndTry deactivates the last activated exception handler
+	OpEndTry
+	// OpThrow pops a value and raises it as an exception
+	OpThrow
+	// OpImport pushes the module compiled in the constant at index N, the
+	// module code runs the first time it is imported
+	OpImport
+	// OpModule pops the exports of the module compiled in the constant at
+	// index N and pushes the module object
+	OpModule
+	// OpTailCall calls a function with N arguments in tail position, the
+	// callee replaces the frame of the caller when it can
+	OpTailCall
+	// OpWide prefixes an instruction whose operands are encoded twice as wide
+	// as its definition states
+	OpWide
+	// OpLessThan pops two elements from the stack pushes true if a < b
+	OpLessThan
+	// OpLessOrEqual pops two elements from the stack pushes true if a <= b
+	OpLessOrEqual
+	// OpTailCallSpread calls a function with an array of arguments in tail
+	// position, the callee replaces the frame of the caller when it can
+	OpTailCallSpread
 )
 
 // Definition represents information about opcodes.
@@ -85,37 +136,73 @@ type Definition struct {
 }
 
 var lookupTable = map[OpCode]Definition{
-	OpConstant:       {"OpConstant", []int{2}},
-	OpAdd:            {"OpAdd", []int{}},
-	OpSub:            {"OpSub", []int{}},
-	OpMul:            {"OpMul", []int{}},
-	OpDiv:            {"OpDiv", []int{}},
-	OpMod:            {"OpMod", []int{}},
-	OpPop:            {"OpPop", []int{}},
-	OpTrue:           {"OpTrue", []int{}},
-	OpFalse:          {"OpFalse", []int{}},
-	OpEqual:          {"OpEqual", []int{}},
-	OpNotEqual:       {"OpNotEqual", []int{}},
-	OpGreaterThan:    {"OpGreaterThan", []int{}},
-	OpGreaterOrEqual: {"OpGreaterThanOrEqual", []int{}},
-	OpNeg:            {"OpNeg", []int{}},
-	OpNot:            {"OpNot", []int{}},
-	OpJNE:            {"OpJumpIfNotEqual", []int{2}},
-	OpJump:           {"OpJump", []int{2}},
-	OpNull:           {"OpNull", []int{}},
-	OpGetGlobal:      {"OpGetGlobal", []int{2}},
-	OpSetGlobal:      {"OpSetGlobal", []int{2}},
-	OpArray:          {"OpArray", []int{2}},
-	OpHashTable:      {"OpHashTable", []int{2}},
-	OpIndex:          {"OpIndex", []int{}},
-	OpCall:           {"OpCall", []int{1}},
-	OpReturnValue:    {"OpReturnValue", []int{}},
-	OpReturn:         {"OpReturn", []int{}},
-	OpGetLocal:       {"OpGetLocal", []int{1}},
-	OpSetLocal:       {"OpSetLocal", []int{1}},
-	OpGetBuiltin:     {"OpGetBuiltin", []int{1}},
-	OpClosure:        {"OpClosure", []int{2, 1}},
-	OpGetFree:        {"OpGetFree", []int{1}},
+	OpConstant:         {"OpConstant", []int{2}},
+	OpAdd:              {"OpAdd", []int{}},
+	OpSub:              {"OpSub", []int{}},
+	OpMul:              {"OpMul", []int{}},
+	OpDiv:              {"OpDiv", []int{}},
+	OpMod:              {"OpMod", []int{}},
+	OpPop:              {"OpPop", []int{}},
+	OpTrue:             {"OpTrue", []int{}},
+	OpFalse:            {"OpFalse", []int{}},
+	OpEqual:            {"OpEqual", []int{}},
+	OpNotEqual:         {"OpNotEqual", []int{}},
+	OpGreaterThan:      {"OpGreaterThan", []int{}},
+	OpGreaterOrEqual:   {"OpGreaterThanOrEqual", []int{}},
+	OpNeg:              {"OpNeg", []int{}},
+	OpNot:              {"OpNot", []int{}},
+	OpJNE:              {"OpJumpIfNotEqual", []int{2}},
+	OpJump:             {"OpJump", []int{2}},
+	OpNull:             {"OpNull", []int{}},
+	OpGetGlobal:        {"OpGetGlobal", []int{2}},
+	OpSetGlobal:        {"OpSetGlobal", []int{2}},
+	OpArray:            {"OpArray", []int{2}},
+	OpHashTable:        {"OpHashTable", []int{2}},
+	OpIndex:            {"OpIndex", []int{}},
+	OpCall:             {"OpCall", []int{1}},
+	OpReturnValue:      {"OpReturnValue", []int{}},
+	OpReturn:           {"OpReturn", []int{}},
+	OpGetLocal:         {"OpGetLocal", []int{1}},
+	OpSetLocal:         {"OpSetLocal", []int{1}},
+	OpGetBuiltin:       {"OpGetBuiltin", []int{1}},
+	OpClosure:          {"OpClosure", []int{2, 1}},
+	OpGetFree:          {"OpGetFree", []int{1}},
+	OpJumpNull:         {"OpJumpNull", []int{2}},
+	OpJumpNotNull:      {"OpJumpNotNull", []int{2}},
+	OpSlice:            {"OpSlice", []int{}},
+	OpConcatArrays:     {"OpConcatArrays", []int{2}},
+	OpCallSpread:       {"OpCallSpread", []int{}},
+	OpDup:              {"OpDup", []int{}},
+	OpDestructureArray: {"OpDestructureArray", []int{2, 1}},
+	OpDestructureHash:  {"OpDestructureHash", []int{2}},
+	OpMatchArray:       {"OpMatchArray", []int{2, 1}},
+	OpMatchHash:        {"OpMatchHash", []int{2}},
+	OpTry:              {"OpTry", []int{2}},
+	OpEndTry:           {"OpEndTry", []int{}},
+	OpThrow:            {"OpThrow", []int{}},
+	OpImport:           {"OpImport", []int{2}},
+	OpModule:           {"OpModule", []int{2}},
+	OpTailCall:         {"OpTailCall", []int{1}},
+	OpWide:             {"OpWide", []int{}},
+	OpLessThan:         {"OpLessThan", []int{}},
+	OpLessOrEqual:      {"OpLessOrEqual", []int{}},
+	OpTailCallSpread:   {"OpTailCallSpread", []int{}},
+}
+
+// wideOps are the opcodes that can be prefixed by OpWide, these are the
+// opcodes whose operands index constants, locals and free variables or count
+// call arguments. Other operands are bounded by the size of the VM stack, the
+// number of globals or the size of a function and don't need wider encodings.
+var wideOps = map[OpCode]bool{
+	OpConstant: true,
+	OpGetLocal: true,
+	OpSetLocal: true,
+	OpGetFree:  true,
+	OpCall:     true,
+	OpTailCall: true,
+	OpClosure:  true,
+	OpImport:   true,
+	OpModule:   true,
 }
 
 // Lookup fetches the opcode definition.
@@ -128,6 +215,16 @@ func Lookup(op OpCode) (Definition, error) {
 	return def, nil
 }
 
+// Wide returns the definition of the opcode prefixed by OpWide.
+func (def Definition) Wide() Definition {
+	widths := make([]int, len(def.OperandWidths))
+	for i, w := range def.OperandWidths {
+		widths[i] = 2 * w
+	}
+
+	return Definition{Name: def.Name, OperandWidths: widths}
+}
+
 // Make creates an instruction sequence given an opcode and operands.
 func Make(op OpCode, operands ...int) []byte {
 	def, ok := lookupTable[op]
@@ -135,21 +232,86 @@ func Make(op OpCode, operands ...int) []byte {
 		return []byte{}
 	}
 
-	instLen := 1
+	return encode([]byte{byte(op)}, def, operands)
+}
+
+// MakeWide creates an instruction prefixed by OpWide.
+func MakeWide(op OpCode, operands ...int) []byte {
+	def, ok := lookupTable[op]
+	if !ok {
+		return []byte{}
+	}
+
+	return encode([]byte{byte(OpWide), byte(op)}, def.Wide(), operands)
+}
+
+// Encode creates an instruction like Make, operands that don't fit the widths
+// of the opcode definition are encoded with the OpWide prefix when the opcode
+// allows it. An error is returned when an operand doesn't fit either way.
+func Encode(op OpCode, operands ...int) ([]byte, error) {
+	def, err := Lookup(op)
+	if err != nil {
+		return nil, err
+	}
+	if fits(def, operands) {
+		return Make(op, operands...), nil
+	}
+	if !wideOps[op] {
+		return nil, limitError(def, operands)
+	}
+	if wide := def.Wide(); !fits(wide, operands) {
+		return nil, limitError(wide, operands)
+	}
+
+	return MakeWide(op, operands...), nil
+}
+
+// fits reports whether the operands can be encoded with the definition widths.
+func fits(def Definition, operands []int) bool {
+	for i, operand := range operands {
+		if operand < 0 || operand > maxOperand(def.OperandWidths[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// maxOperand returns the largest operand encoded on width bytes.
+func maxOperand(width int) int {
+	return 1<<(8*width) - 1
+}
+
+// limitError returns the error reporting the first operand that doesn't fit.
+func limitError(def Definition, operands []int) error {
+	for i, operand := range operands {
+		if max := maxOperand(def.OperandWidths[i]); operand < 0 || operand > max {
+			return fmt.Errorf("operand %d of %s exceeds the limit of %d", operand, def.Name, max)
+		}
+	}
+
+	return nil
+}
+
+// encode appends the operands encoded with the definition widths to prefix.
+func encode(prefix []byte, def Definition, operands []int) []byte {
+	instLen := len(prefix)
 
 	for _, w := range def.OperandWidths {
 		instLen += w
 	}
 
 	inst := make([]byte, instLen)
-	inst[0] = byte(op)
+	copy(inst, prefix)
 
-	offset := 1
+	offset := len(prefix)
 
 	for i, operand := range operands {
 		width := def.OperandWidths[i]
 
 		switch width {
+		case 4:
+			binary.BigEndian.PutUint32(inst[offset:], uint32(operand))
 		case 2:
 			binary.BigEndian.PutUint16(inst[offset:], uint16(operand))
 		case 1:
@@ -159,7 +321,6 @@ func Make(op OpCode, operands ...int) []byte {
 	}
 
 	return inst
-
 }
 
 // FormatInstruction returns a pretty printed instruction
@@ -188,28 +349,63 @@ func (inst Instructions) String() string {
 
 	i := 0
 	for i < len(inst) {
-		def, err := Lookup(OpCode(inst[i]))
+		op, operands, read, err := ReadInstruction(inst[i:])
 		if err != nil {
 			fmt.Fprintf(&out, "ERROR : %s\n", err)
+			i++
 			continue
 		}
-
-		operands, read := ReadOperands(def, inst[i+1:])
+		def, _ := Lookup(op)
 
 		fmt.Fprintf(&out, "%04d %s\n", i, inst.FormatInstruction(def, operands))
 
-		i += 1 + read
+		i += read
 
 	}
 
 	return out.String()
 }
 
+// ReadInstruction decodes the instruction at the start of ins, an OpWide
+// prefix is decoded along with the instruction it prefixes. It returns the
+// opcode, its operands and the number of bytes read.
+func ReadInstruction(ins Instructions) (OpCode, []int, int, error) {
+	op := OpCode(ins[0])
+	prefix := 1
+	wide := op == OpWide
+	if wide {
+		if len(ins) < 2 {
+			return op, nil, 0, fmt.Errorf("OpWide prefixes no instruction")
+		}
+		op = OpCode(ins[1])
+		prefix = 2
+	}
+
+	def, err := Lookup(op)
+	if err != nil {
+		return op, nil, 0, err
+	}
+	if wide {
+		if !wideOps[op] {
+			return op, nil, 0, fmt.Errorf("%s can't be prefixed by OpWide", def.Name)
+		}
+		def = def.Wide()
+	}
+	operands, read := ReadOperands(def, ins[prefix:])
+
+	return op, operands, prefix + read, nil
+}
+
 // ReadUint16 reads a big-endian encoded uint16 from an instruction slice
 func ReadUint16(ins Instructions) uint16 {
 	return binary.BigEndian.Uint16(ins)
 }
 
+// ReadUint32 reads a big-endian encoded uint32 from an instruction slice
+func ReadUint32(ins Instructions) uint32 {
+	return binary.BigEndian.Uint32(ins)
+}
+
 // ReadOperands parses definition operand width
 func ReadOperands(def Definition, ins Instructions) ([]int, int) {
 	operands := make([]int, len(def.OperandWidths))
@@ -218,6 +414,8 @@ func ReadOperands(def Definition, ins Instructions) ([]int, int) {
 
 	for i, width := range def.OperandWidths {
 		switch width {
+		case 4:
+			operands[i] = int(ReadUint32(ins[offset:]))
 		case 2:
 			operands[i] = int(ReadUint16(ins[offset:]))
 		case 1:
@@ -83,4 +83,57 @@ func TestOpcode(t *testing.T) {
 
 		}
 	})
+	t.Run("TestEncode", func(t *testing.T) {
+		tests := []struct {
+			op       OpCode
+			operands []int
+			expected []byte
+			err      string
+		}{
+			{OpConstant, []int{65535}, []byte{byte(OpConstant), 255, 255}, ""},
+			{OpConstant, []int{65536}, []byte{byte(OpWide), byte(OpConstant), 0, 1, 0, 0}, ""},
+			{OpGetLocal, []int{300}, []byte{byte(OpWide), byte(OpGetLocal), 1, 44}, ""},
+			{OpClosure, []int{2, 256}, []byte{byte(OpWide), byte(OpClosure), 0, 0, 0, 2, 1, 0}, ""},
+			{OpGetLocal, []int{65536}, nil, "operand 65536 of OpGetLocal exceeds the limit of 65535"},
+			{OpGetGlobal, []int{65536}, nil, "operand 65536 of OpGetGlobal exceeds the limit of 65535"},
+			{OpJump, []int{70000}, nil, "operand 70000 of OpJump exceeds the limit of 65535"},
+		}
+
+		for _, tt := range tests {
+			inst, err := Encode(tt.op, tt.operands...)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("expected error %q got %v", tt.err, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("Encode failed with error : %s", err)
+			}
+			if string(inst) != string(tt.expected) {
+				t.Errorf("wrong instruction expected %v got %v", tt.expected, inst)
+			}
+
+			op, operands, read, err := ReadInstruction(inst)
+			if err != nil {
+				t.Fatalf("ReadInstruction failed with error : %s", err)
+			}
+			if op != tt.op || read != len(inst) {
+				t.Errorf("wrong instruction read expected %d of %d bytes got %d of %d bytes", tt.op, len(inst), op, read)
+			}
+			for i, operand := range tt.operands {
+				if operands[i] != operand {
+					t.Errorf("wrong operand expected %d got %d", operand, operands[i])
+				}
+			}
+		}
+
+		wide := Instructions{}
+		wide = append(wide, MakeWide(OpConstant, 70000)...)
+		wide = append(wide, Make(OpPop)...)
+		expected := "0000 OpConstant 70000\n0006 OpPop\n"
+		if wide.String() != expected {
+			t.Errorf("wide instructions wrongly formatted want %s got %s", expected, wide.String())
+		}
+	})
 }
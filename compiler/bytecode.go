@@ -0,0 +1,57 @@
+package compiler
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+
+	"github.com/actuallyachraf/monkey-giggle/object"
+)
+
+// bytecode.go implements the serialization of compiled programs, the bytecode
+// is written with encoding/gob along with the handler tables and line tables
+// of its functions so a program runs and reports the source position of its
+// errors without being compiled again.
+
+// bytecodeVersion identifies the serialization format, it changes whenever
+// the instruction set or the compiled objects change.
+const bytecodeVersion = "giggle-bytecode/3"
+
+func init() {
+	// the types of the constants a compiler produces
+	gob.Register(&object.Integer{})
+	gob.Register(&object.BigInt{})
+	gob.Register(&object.String{})
+	gob.Register(&object.CompiledFunction{})
+	gob.Register(&object.CompiledModule{})
+}
+
+// Encode writes the serialized bytecode to w.
+func (b Bytecode) Encode(w io.Writer) error {
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(bytecodeVersion); err != nil {
+		return err
+	}
+
+	return enc.Encode(b)
+}
+
+// DecodeBytecode reads bytecode serialized by Encode.
+func DecodeBytecode(r io.Reader) (Bytecode, error) {
+	dec := gob.NewDecoder(r)
+
+	var version string
+	if err := dec.Decode(&version); err != nil {
+		return Bytecode{}, fmt.Errorf("invalid bytecode: %s", err)
+	}
+	if version != bytecodeVersion {
+		return Bytecode{}, fmt.Errorf("unsupported bytecode version %q", version)
+	}
+
+	var b Bytecode
+	if err := dec.Decode(&b); err != nil {
+		return Bytecode{}, fmt.Errorf("invalid bytecode: %s", err)
+	}
+
+	return b, nil
+}
@@ -7,7 +7,9 @@ import (
 
 	"github.com/actuallyachraf/monkey-giggle/ast"
 	"github.com/actuallyachraf/monkey-giggle/code"
+	"github.com/actuallyachraf/monkey-giggle/module"
 	"github.com/actuallyachraf/monkey-giggle/object"
+	"github.com/actuallyachraf/monkey-giggle/token"
 )
 
 // Compiler represents structs and defined constant objects
@@ -17,6 +19,78 @@ type Compiler struct {
 
 	scopes     []CompilationScope
 	scopeIndex int
+
+	// loader resolves imported modules, modules maps the file of every
+	// compiled module to the constant holding its code
+	loader  *module.Loader
+	modules map[string]int
+
+	// folding enables constant folding and the pruning of branches on
+	// constant conditions, peephole enables the peephole optimizer and
+	// tailCalls the rewriting of calls in tail position
+	folding   bool
+	peephole  bool
+	tailCalls bool
+
+	// matchDepth is the number of match expressions whose arms are being
+	// compiled
+	matchDepth int
+
+	// err holds the first instruction whose operands exceed the limits of
+	// the bytecode, it is returned once the program is compiled
+	err error
+
+	// file is the source file being compiled and position the position of
+	// the innermost node being compiled, emitted instructions are mapped to
+	// it in the line table of their function
+	file     string
+	position token.Position
+
+	// references holds the identifiers resolved while compiling when
+	// recordReferences is set
+	recordReferences bool
+	references       []Reference
+}
+
+// Reference is an occurrence of an identifier resolved by the compiler, Scope
+// is the scope of the symbol it resolves to and Definition the position of the
+// identifier defining it. Definitions reference themselves, builtins have no
+// definition.
+type Reference struct {
+	Name       string
+	Pos        token.Position
+	Definition token.Position
+	Scope      SymbolScope
+}
+
+// CompileError is an error raised while compiling a program, File and Pos
+// locate the node that raised it.
+type CompileError struct {
+	Err  error
+	File string
+	Pos  token.Position
+}
+
+func (e *CompileError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the raised error.
+func (e *CompileError) Unwrap() error {
+	return e.Err
+}
+
+// Location returns the file:line:column location of the node that raised the
+// error, unknown parts are omitted.
+func (e *CompileError) Location() string {
+	switch {
+	case !e.Pos.IsValid():
+		return e.File
+	case e.File == "":
+		return e.Pos.String()
+	default:
+		return e.File + ":" + e.Pos.String()
+	}
 }
 
 // CompilationScope represents scopes for functions
@@ -24,6 +98,18 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+
+	handlers  []object.ExceptionHandler
+	tries     []*tryContext
+	positions []object.SourcePosition
+}
+
+// tryContext represents a protected region being compiled, return statements
+// leaving a region with a finally block jump to it, returnJumps holds the
+// position of these jumps.
+type tryContext struct {
+	finally     *ast.BlockStatement
+	returnJumps []int
 }
 
 // EmittedInstruction represents an emitted compiler instruction
@@ -50,9 +136,56 @@ func New() *Compiler {
 		symbolTable: symTable,
 		scopes:      []CompilationScope{mainScope},
 		scopeIndex:  0,
+		loader:      module.NewLoader(module.DefaultPaths()...),
+		modules:     make(map[string]int),
+		folding:     true,
+		peephole:    true,
+		tailCalls:   true,
 	}
 }
 
+// SetLoader sets the loader used to resolve imported modules.
+func (c *Compiler) SetLoader(l *module.Loader) {
+	c.loader = l
+}
+
+// SetFolding enables or disables constant folding, folding is enabled by
+// default and disabling it compiles programs exactly as they are written.
+func (c *Compiler) SetFolding(enabled bool) {
+	c.folding = enabled
+}
+
+// SetPeephole enables or disables the peephole optimizer run over compiled
+// instructions, it is enabled by default.
+func (c *Compiler) SetPeephole(enabled bool) {
+	c.peephole = enabled
+}
+
+// SetTailCalls enables or disables the rewriting of calls in tail position
+// into tail calls reusing the frame of the caller, it is enabled by default.
+// Debuggers disable it to keep a frame for every call.
+func (c *Compiler) SetTailCalls(enabled bool) {
+	c.tailCalls = enabled
+}
+
+// SetFile sets the name of the source file being compiled, it is recorded
+// with the compiled functions to locate their instructions.
+func (c *Compiler) SetFile(file string) {
+	c.file = file
+}
+
+// SetReferences enables or disables the recording of the identifiers resolved
+// while compiling, it is disabled by default.
+func (c *Compiler) SetReferences(enabled bool) {
+	c.recordReferences = enabled
+}
+
+// References returns the identifiers resolved while compiling in the order
+// they were compiled, modules record their own references.
+func (c *Compiler) References() []Reference {
+	return c.references
+}
+
 // currentInstructions returns the instructions within the current scope
 func (c *Compiler) currentInstructions() code.Instructions {
 	return c.scopes[c.scopeIndex].instructions
@@ -68,16 +201,33 @@ func NewWithState(symTable *SymbolTable, constants []object.Object) *Compiler {
 }
 
 // Compile takes an AST Node and returns an equivalent compiler.
-func (c *Compiler) Compile(node ast.Node) error {
+func (c *Compiler) Compile(node ast.Node) (err error) {
+	if pos := node.Pos(); pos.IsValid() {
+		outer := c.position
+		c.position = pos
+		defer func() { c.position = outer }()
+	}
+	defer func() {
+		// errors are located at the innermost node raising them
+		if _, ok := err.(*CompileError); err != nil && !ok {
+			err = &CompileError{Err: err, File: c.file, Pos: c.position}
+		}
+	}()
 
 	switch node := node.(type) {
 	case *ast.Program:
+		if c.folding {
+			node = Fold(node)
+		}
 		for _, s := range node.Statements {
 			err := c.Compile(s)
 			if err != nil {
 				return err
 			}
 		}
+		if c.err != nil {
+			return c.err
+		}
 	case *ast.ExpressionStatement:
 		err := c.Compile(node.Expression)
 		if err != nil {
@@ -85,21 +235,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpPop)
 	case *ast.InfixExpression:
-		if node.Operator == "<" || node.Operator == "<=" {
-			err := c.Compile(node.Right)
-			if err != nil {
-				return err
-			}
-			err = c.Compile(node.Left)
-			if err != nil {
-				return err
-			}
-			if node.Operator == "<" {
-				c.emit(code.OpGreaterThan)
-			} else if node.Operator == "<=" {
-				c.emit(code.OpGreaterOrEqual)
-			}
-			return nil
+		if node.Operator == "??" {
+			return c.compileNullCoalescing(node)
 		}
 		err := c.Compile(node.Left)
 		if err != nil {
@@ -124,6 +261,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpGreaterThan)
 		case ">=":
 			c.emit(code.OpGreaterOrEqual)
+		case "<":
+			c.emit(code.OpLessThan)
+		case "<=":
+			c.emit(code.OpLessOrEqual)
 		case "==":
 			c.emit(code.OpEqual)
 		case "!=":
@@ -134,12 +275,17 @@ func (c *Compiler) Compile(node ast.Node) error {
 	case *ast.IntegerLiteral:
 		integer := &object.Integer{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(integer))
+	case *ast.BigIntegerLiteral:
+		integer := &object.BigInt{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(integer))
 	case *ast.BooleanLiteral:
 		if node.Value {
 			c.emit(code.OpTrue)
 		} else {
 			c.emit(code.OpFalse)
 		}
+	case *ast.NullLiteral:
+		c.emit(code.OpNull)
 	case *ast.PrefixExpression:
 		err := c.Compile(node.Right)
 		if err != nil {
@@ -154,6 +300,11 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return fmt.Errorf("Unknown operator %s", node.Operator)
 		}
 	case *ast.IfExpression:
+		if c.folding {
+			if cond, ok := literalValue(node.Condition); ok {
+				return c.compileConstantIf(node, object.Truthy(cond))
+			}
+		}
 		err := c.Compile(node.Condition)
 		if err != nil {
 			return err
@@ -185,6 +336,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 		afterAltPos := len(c.currentInstructions())
 		c.changeOperand(JMPPos, afterAltPos)
 
+	case *ast.MatchExpression:
+		return c.compileMatch(node)
 	case *ast.BlockStatement:
 		for _, s := range node.Statements {
 			err := c.Compile(s)
@@ -193,20 +346,23 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 	case *ast.LetStatement:
-		sym := c.symbolTable.Define(string(node.Name.Value))
+		if node.Pattern != nil {
+			err := c.Compile(node.Value)
+			if err != nil {
+				return err
+			}
+			return c.compilePattern(node.Pattern)
+		}
+		sym := c.define(node.Name)
 		err := c.Compile(node.Value)
 		if err != nil {
 			return err
 		}
-		if sym.Scope == GlobalScope {
-			c.emit(code.OpSetGlobal, sym.Index)
-		} else {
-			c.emit(code.OpSetLocal, sym.Index)
-		}
+		c.storeSymbol(sym)
 	case *ast.Identifier:
-		sym, ok := c.symbolTable.Resolve(string(node.Value))
+		sym, ok := c.resolve(node)
 		if !ok {
-			return fmt.Errorf("Undefined variable %s", node.Value)
+			return fmt.Errorf("identifier not found: %s", node.Value)
 		}
 		c.loadSymbol(sym)
 	case *ast.StringLiteral:
@@ -214,6 +370,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpConstant, c.addConstant(str))
 
 	case *ast.ArrayLiteral:
+		if hasSpread(node.Elements) {
+			return c.compileSpreadList(node.Elements)
+		}
 		for _, el := range node.Elements {
 			err := c.Compile(el)
 			if err != nil {
@@ -246,19 +405,71 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err != nil {
 			return err
 		}
+		// a?.[k] skips the indexing and leaves null on the stack
+		JNullPos := -1
+		if node.Optional {
+			JNullPos = c.emit(code.OpJumpNull, 9999)
+		}
 		err = c.Compile(node.Index)
 		if err != nil {
 			return err
 		}
 		c.emit(code.OpIndex)
+		if node.Optional {
+			c.changeOperand(JNullPos, len(c.currentInstructions()))
+		}
+	case *ast.SliceExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+		JNullPos := -1
+		if node.Optional {
+			JNullPos = c.emit(code.OpJumpNull, 9999)
+		}
+		// omitted bounds are pushed as null
+		for _, bound := range []ast.Expression{node.Start, node.End} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+			err := c.Compile(bound)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(code.OpSlice)
+		if node.Optional {
+			c.changeOperand(JNullPos, len(c.currentInstructions()))
+		}
 	case *ast.FunctionLiteral:
 		c.enterScope()
 
 		for _, p := range node.Parameters {
-			c.symbolTable.Define(string(p.Value))
+			c.define(p)
+		}
+		if node.Rest != nil {
+			c.define(node.Rest)
+		}
+
+		defaultOffsets, err := c.compileDefaults(node)
+		if err != nil {
+			return err
+		}
+		for i, p := range node.Parameters {
+			pattern := node.Pattern(i)
+			if pattern == nil {
+				continue
+			}
+			sym, _ := c.symbolTable.Resolve(string(p.Value))
+			c.loadSymbol(sym)
+			err := c.compilePattern(pattern)
+			if err != nil {
+				return err
+			}
 		}
 
-		err := c.Compile(node.Body)
+		err = c.Compile(node.Body)
 		if err != nil {
 			return err
 		}
@@ -272,13 +483,36 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		freeSymbols := c.symbolTable.FreeSyms
 		numLocals := c.symbolTable.numDefinitions
+		handlers := c.scopes[c.scopeIndex].handlers
+		positions := c.scopes[c.scopeIndex].positions
+		localNames := c.symbolTable.Names()
+		freeNames := c.symbolTable.FreeNames()
 		inst := c.leaveScope()
 
 		for _, s := range freeSymbols {
 			c.loadSymbol(s)
 		}
 
-		compiledFn := &object.CompiledFunction{Instructions: inst, NumLocals: numLocals, NumParams: len(node.Parameters)}
+		compiledFn := &object.CompiledFunction{
+			Instructions:   inst,
+			NumLocals:      numLocals,
+			NumParams:      len(node.Parameters),
+			NumDefaults:    node.NumDefaults(),
+			DefaultOffsets: defaultOffsets,
+			Variadic:       node.Rest != nil,
+			Handlers:       handlers,
+			Name:           node.Name,
+			File:           c.file,
+			Positions:      positions,
+			LocalNames:     localNames,
+			FreeNames:      freeNames,
+		}
+		if c.peephole {
+			optimizeFunction(compiledFn)
+		}
+		if c.tailCalls {
+			markTailCalls(compiledFn.Instructions)
+		}
 		fnIndex := c.addConstant(compiledFn)
 		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
 	case *ast.ReturnStatement:
@@ -286,12 +520,36 @@ func (c *Compiler) Compile(node ast.Node) error {
 		if err != nil {
 			return err
 		}
-		c.emit(code.OpReturnValue)
+		c.compileReturn()
+	case *ast.ThrowStatement:
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpThrow)
+	case *ast.TryExpression:
+		return c.compileTry(node)
+	case *ast.MacroLiteral:
+		return fmt.Errorf("macro literals must be expanded before compilation")
+	case *ast.ImportExpression:
+		constIndex, err := c.compileModule(node.Path)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpImport, constIndex)
 	case *ast.CallExpression:
 		err := c.Compile(node.Function)
 		if err != nil {
 			return err
 		}
+		if hasSpread(node.Arguments) {
+			err := c.compileSpreadList(node.Arguments)
+			if err != nil {
+				return err
+			}
+			c.emit(code.OpCallSpread)
+			return nil
+		}
 		for _, arg := range node.Arguments {
 			err := c.Compile(arg)
 			if err != nil {
@@ -299,22 +557,604 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 		c.emit(code.OpCall, len(node.Arguments))
+	case *ast.SpreadExpression:
+		return fmt.Errorf("spread operator is only allowed in call arguments and array literals")
 	}
 	return nil
 }
 
-// Bytecode represents a sequence of instructions and object table.
+// compileDefaults emits the prologue computing the default values of missing
+// parameters and returns the offsets where execution starts depending on the
+// number of parameters with defaults passed by the caller.
+func (c *Compiler) compileDefaults(node *ast.FunctionLiteral) ([]int, error) {
+	if node.NumDefaults() == 0 {
+		return nil, nil
+	}
+
+	offsets := []int{}
+	for i := range node.Parameters {
+		def := node.Default(i)
+		if def == nil {
+			continue
+		}
+		offsets = append(offsets, len(c.currentInstructions()))
+		err := c.Compile(def)
+		if err != nil {
+			return nil, err
+		}
+		c.emit(code.OpSetLocal, i)
+	}
+
+	return append(offsets, len(c.currentInstructions())), nil
+}
+
+// compilePattern binds the value on top of the stack to the identifiers of a
+// destructuring pattern, the shape of the value is checked at runtime and
+// elements are extracted with index and slice instructions. The value is
+// consumed by the last extraction so no trailing OpPop is emitted.
+func (c *Compiler) compilePattern(pattern ast.Expression) error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		sym := c.define(pattern)
+		c.storeSymbol(sym)
+	case *ast.ArrayPattern:
+		rest := 0
+		if pattern.Rest != nil {
+			rest = 1
+		}
+		c.emit(code.OpDestructureArray, len(pattern.Elements), rest)
+
+		numAccess := len(pattern.Elements) + rest
+		for i, el := range pattern.Elements {
+			if i < numAccess-1 {
+				c.emit(code.OpDup)
+			}
+			c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: int64(i)}))
+			c.emit(code.OpIndex)
+			err := c.compilePattern(el)
+			if err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil {
+			c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: int64(len(pattern.Elements))}))
+			c.emit(code.OpNull)
+			c.emit(code.OpSlice)
+			return c.compilePattern(pattern.Rest)
+		}
+		if numAccess == 0 {
+			c.emit(code.OpPop)
+		}
+	case *ast.HashPattern:
+		keys := make([]int, len(pattern.Keys))
+		for i, key := range pattern.Keys {
+			keys[i] = c.addConstant(&object.String{Value: key.Value})
+			c.emit(code.OpConstant, keys[i])
+		}
+		c.emit(code.OpDestructureHash, len(pattern.Keys))
+
+		for i, value := range pattern.Values {
+			if i < len(pattern.Values)-1 {
+				c.emit(code.OpDup)
+			}
+			c.emit(code.OpConstant, keys[i])
+			c.emit(code.OpIndex)
+			err := c.compilePattern(value)
+			if err != nil {
+				return err
+			}
+		}
+		if len(pattern.Keys) == 0 {
+			c.emit(code.OpPop)
+		}
+	default:
+		return fmt.Errorf("invalid destructuring pattern %s", pattern.String())
+	}
+
+	return nil
+}
+
+// compileMatch compiles match expressions to a sequence of tests, the matched
+// value is stored in a hidden binding and every test loads the sub-value it
+// checks from it so failing tests jump to the next arm with a clean stack.
+// When no arm matches the expression evaluates to null.
+func (c *Compiler) compileMatch(node *ast.MatchExpression) error {
+	err := c.Compile(node.Value)
+	if err != nil {
+		return err
+	}
+	subject := c.matchSubject()
+	c.storeSymbol(subject)
+	c.matchDepth++
+	defer func() { c.matchDepth-- }()
+
+	endJumps := []int{}
+	for _, arm := range node.Arms {
+		failJumps := []int{}
+		err := c.compileMatchPattern(arm.Pattern, subject, nil, &failJumps)
+		if err != nil {
+			return err
+		}
+		if arm.Guard != nil {
+			err := c.Compile(arm.Guard)
+			if err != nil {
+				return err
+			}
+			failJumps = append(failJumps, c.emit(code.OpJNE, 9999))
+		}
+
+		err = c.compileBlockValue(arm.Body)
+		if err != nil {
+			return err
+		}
+		endJumps = append(endJumps, c.emit(code.OpJump, 9999))
+
+		nextArmPos := len(c.currentInstructions())
+		for _, pos := range failJumps {
+			c.changeOperand(pos, nextArmPos)
+		}
+	}
+	c.emit(code.OpNull)
+
+	afterMatchPos := len(c.currentInstructions())
+	for _, pos := range endJumps {
+		c.changeOperand(pos, afterMatchPos)
+	}
+
+	return nil
+}
+
+// matchSubject returns the hidden symbol holding the value matched by a match
+// expression, matches nested in the arms of another match get their own symbol
+// and sibling matches of a scope share theirs.
+func (c *Compiler) matchSubject() Symbol {
+	name := fmt.Sprintf("$match%d", c.matchDepth)
+	if sym, ok := c.symbolTable.store[name]; ok && sym.Scope != FreeScope {
+		return sym
+	}
+
+	return c.symbolTable.Define(name)
+}
+
+// compileModule compiles an imported module with its own symbol table and
+// returns the index of the constant holding its code, every module is compiled
+// once and shares the constant pool of the program importing it.
+func (c *Compiler) compileModule(name string) (int, error) {
+	file, err := c.loader.Resolve(name)
+	if err != nil {
+		return 0, err
+	}
+	if constIndex, ok := c.modules[file]; ok {
+		return constIndex, nil
+	}
+
+	program, err := c.loader.Enter(name, file)
+	if err != nil {
+		return 0, err
+	}
+	defer c.loader.Leave()
+
+	mod := New()
+	mod.constants = c.constants
+	mod.loader = c.loader
+	mod.modules = c.modules
+	mod.folding = c.folding
+	mod.peephole = c.peephole
+	mod.tailCalls = c.tailCalls
+	mod.file = file
+
+	compiled := &object.CompiledModule{Name: name}
+	constIndex := mod.addConstant(compiled)
+
+	err = mod.Compile(program)
+	if err != nil {
+		return 0, err
+	}
+
+	// the module code ends by returning the module object built from the
+	// hashmap of its exports
+	exports := module.Exports(program)
+	for _, export := range exports {
+		sym, _ := mod.symbolTable.Resolve(export)
+		mod.emit(code.OpConstant, mod.addConstant(&object.String{Value: export}))
+		mod.loadSymbol(sym)
+	}
+	mod.emit(code.OpHashTable, 2*len(exports))
+	mod.emit(code.OpModule, constIndex)
+	mod.emit(code.OpReturnValue)
+	if mod.err != nil {
+		return 0, mod.err
+	}
+
+	compiled.Fn = &object.CompiledFunction{
+		Instructions: mod.currentInstructions(),
+		Handlers:     mod.scopes[mod.scopeIndex].handlers,
+		Name:         name,
+		File:         file,
+		Positions:    mod.scopes[mod.scopeIndex].positions,
+	}
+	if c.peephole {
+		optimizeFunction(compiled.Fn)
+	}
+	compiled.NumGlobals = mod.symbolTable.numDefinitions
+	compiled.GlobalNames = mod.symbolTable.Names()
+
+	c.constants = mod.constants
+	c.modules[file] = constIndex
+
+	return constIndex, nil
+}
+
+// compileBlockValue compiles a block whose value is left on the stack, blocks
+// that don't end with an expression evaluate to null.
+func (c *Compiler) compileBlockValue(block *ast.BlockStatement) error {
+	err := c.Compile(block)
+	if err != nil {
+		return err
+	}
+	if c.lastInstructionIs(code.OpPop) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+// compileConstantIf compiles a conditional whose condition is a literal, only
+// the code of the branch taken is kept. The other branch is still compiled and
+// discarded so its bindings are defined and its errors raised as they would be
+// without folding.
+func (c *Compiler) compileConstantIf(node *ast.IfExpression, taken bool) error {
+	if !taken {
+		err := c.compileDiscarded(node.Consequence)
+		if err != nil {
+			return err
+		}
+		if node.Alternative == nil {
+			c.emit(code.OpNull)
+			return nil
+		}
+		return c.compileBlockValue(node.Alternative)
+	}
+
+	err := c.compileBlockValue(node.Consequence)
+	if err != nil {
+		return err
+	}
+	if node.Alternative == nil {
+		return nil
+	}
+
+	return c.compileDiscarded(node.Alternative)
+}
+
+// compileDiscarded compiles a block for its symbols and errors only, the
+// instructions, constants and modules it emits are dropped.
+func (c *Compiler) compileDiscarded(block *ast.BlockStatement) error {
+	scope := c.scopes[c.scopeIndex]
+	returnJumps := make([]int, len(scope.tries))
+	for i, try := range scope.tries {
+		returnJumps[i] = len(try.returnJumps)
+	}
+	numConstants := len(c.constants)
+
+	err := c.Compile(block)
+	if err != nil {
+		return err
+	}
+
+	for i, try := range scope.tries {
+		try.returnJumps = try.returnJumps[:returnJumps[i]]
+	}
+	c.scopes[c.scopeIndex] = scope
+	c.constants = c.constants[:numConstants]
+	for file, index := range c.modules {
+		if index >= numConstants {
+			delete(c.modules, file)
+		}
+	}
+
+	return nil
+}
+
+// compileTry compiles try expressions, the finally block protects both the
+// try and catch blocks and is entered with the state of the protected code on
+// top of the stack : false when it completed with its value below, true when
+// it raised the exception below and null when it returned the value below.
+func (c *Compiler) compileTry(node *ast.TryExpression) error {
+	if node.Finally == nil {
+		return c.compileTryCatch(node)
+	}
+
+	handler := c.beginTry(node.Finally)
+	ctx := c.scopes[c.scopeIndex].tries[len(c.scopes[c.scopeIndex].tries)-1]
+	err := c.compileTryCatch(node)
+	if err != nil {
+		return err
+	}
+	c.endTry(handler)
+	c.emit(code.OpFalse)
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.setHandlerTarget(handler)
+	c.emit(code.OpTrue)
+
+	finallyPos := len(c.currentInstructions())
+	c.changeOperand(jumpPos, finallyPos)
+	for _, pos := range ctx.returnJumps {
+		c.changeOperand(pos, finallyPos)
+	}
+
+	err = c.Compile(node.Finally)
+	if err != nil {
+		return err
+	}
+
+	returnPos := -1
+	if len(ctx.returnJumps) > 0 {
+		returnPos = c.emit(code.OpJumpNull, 9999)
+	}
+	JNEPos := c.emit(code.OpJNE, 9999)
+	c.emit(code.OpThrow)
+	if returnPos != -1 {
+		c.changeOperand(returnPos, len(c.currentInstructions()))
+		c.emit(code.OpPop)
+		c.compileReturn()
+	}
+	c.changeOperand(JNEPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// compileTryCatch compiles the try block and its catch block if any.
+func (c *Compiler) compileTryCatch(node *ast.TryExpression) error {
+	if node.Catch == nil {
+		return c.compileBlockValue(node.Block)
+	}
+
+	handler := c.beginTry(nil)
+	err := c.compileBlockValue(node.Block)
+	if err != nil {
+		return err
+	}
+	c.endTry(handler)
+	jumpPos := c.emit(code.OpJump, 9999)
+
+	c.setHandlerTarget(handler)
+	sym := c.define(node.Param)
+	c.storeSymbol(sym)
+	err = c.compileBlockValue(node.Catch)
+	if err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// beginTry adds an exception handler to the current scope and activates it.
+func (c *Compiler) beginTry(finally *ast.BlockStatement) int {
+	scope := &c.scopes[c.scopeIndex]
+	handler := len(scope.handlers)
+	scope.handlers = append(scope.handlers, object.ExceptionHandler{Start: len(scope.instructions)})
+	scope.tries = append(scope.tries, &tryContext{finally: finally})
+
+	c.emit(code.OpTry, handler)
+
+	return handler
+}
+
+// endTry deactivates the last activated exception handler.
+func (c *Compiler) endTry(handler int) {
+	pos := c.emit(code.OpEndTry)
+
+	scope := &c.scopes[c.scopeIndex]
+	scope.handlers[handler].End = pos
+	scope.tries = scope.tries[:len(scope.tries)-1]
+}
+
+// setHandlerTarget makes the next emitted instruction the target of handler.
+func (c *Compiler) setHandlerTarget(handler int) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.handlers[handler].Target = len(scope.instructions)
+}
+
+// compileReturn returns the value on top of the stack, inside protected
+// regions the handlers are deactivated up to the closest finally block which
+// is entered in the returning state and resumes returning once it ran.
+func (c *Compiler) compileReturn() {
+	tries := c.scopes[c.scopeIndex].tries
+	for i := len(tries) - 1; i >= 0; i-- {
+		if tries[i].finally == nil {
+			continue
+		}
+		for j := len(tries) - 1; j >= i; j-- {
+			c.emit(code.OpEndTry)
+		}
+		c.emit(code.OpNull)
+		tries[i].returnJumps = append(tries[i].returnJumps, c.emit(code.OpJump, 9999))
+		return
+	}
+
+	c.emit(code.OpReturnValue)
+}
+
+// loadMatchPath pushes the sub-value of the matched value reached by indexing
+// it with the constants of path.
+func (c *Compiler) loadMatchPath(subject Symbol, path []int) {
+	c.loadSymbol(subject)
+	for _, idx := range path {
+		c.emit(code.OpConstant, idx)
+		c.emit(code.OpIndex)
+	}
+}
+
+// compileMatchPattern emits the tests of a match pattern against the sub-value
+// at path, the position of every jump taken when a test fails is appended to
+// failJumps. Identifiers are bound as the tests run.
+func (c *Compiler) compileMatchPattern(pattern ast.Expression, subject Symbol, path []int, failJumps *[]int) error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value == "_" {
+			return nil
+		}
+		c.loadMatchPath(subject, path)
+		sym := c.define(pattern)
+		c.storeSymbol(sym)
+	case *ast.IntegerLiteral, *ast.BigIntegerLiteral, *ast.StringLiteral, *ast.BooleanLiteral, *ast.NullLiteral:
+		c.loadMatchPath(subject, path)
+		err := c.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		c.emit(code.OpEqual)
+		*failJumps = append(*failJumps, c.emit(code.OpJNE, 9999))
+	case *ast.ArrayPattern:
+		rest := 0
+		if pattern.Rest != nil {
+			rest = 1
+		}
+		c.loadMatchPath(subject, path)
+		c.emit(code.OpMatchArray, len(pattern.Elements), rest)
+		*failJumps = append(*failJumps, c.emit(code.OpJNE, 9999))
+
+		for i, el := range pattern.Elements {
+			idx := c.addConstant(&object.Integer{Value: int64(i)})
+			err := c.compileMatchPattern(el, subject, append(path[:len(path):len(path)], idx), failJumps)
+			if err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			c.loadMatchPath(subject, path)
+			c.emit(code.OpConstant, c.addConstant(&object.Integer{Value: int64(len(pattern.Elements))}))
+			c.emit(code.OpNull)
+			c.emit(code.OpSlice)
+			sym := c.define(pattern.Rest)
+			c.storeSymbol(sym)
+		}
+	case *ast.HashPattern:
+		keys := make([]int, len(pattern.Keys))
+		c.loadMatchPath(subject, path)
+		for i, key := range pattern.Keys {
+			keys[i] = c.addConstant(&object.String{Value: key.Value})
+			c.emit(code.OpConstant, keys[i])
+		}
+		c.emit(code.OpMatchHash, len(pattern.Keys))
+		*failJumps = append(*failJumps, c.emit(code.OpJNE, 9999))
+
+		for i, value := range pattern.Values {
+			err := c.compileMatchPattern(value, subject, append(path[:len(path):len(path)], keys[i]), failJumps)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("invalid match pattern %s", pattern.String())
+	}
+
+	return nil
+}
+
+// hasSpread checks whether a list of expressions uses the spread operator
+func hasSpread(exps []ast.Expression) bool {
+	for _, e := range exps {
+		if _, ok := e.(*ast.SpreadExpression); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// compileSpreadList compiles a list of expressions containing spread operators
+// to a single array, consecutive plain elements are grouped in arrays which
+// are then concatenated with the spread ones.
+func (c *Compiler) compileSpreadList(exps []ast.Expression) error {
+	numArrays := 0
+	pending := 0
+
+	for _, e := range exps {
+		spread, ok := e.(*ast.SpreadExpression)
+		if !ok {
+			err := c.Compile(e)
+			if err != nil {
+				return err
+			}
+			pending++
+			continue
+		}
+		if pending > 0 {
+			c.emit(code.OpArray, pending)
+			numArrays++
+			pending = 0
+		}
+		err := c.Compile(spread.Value)
+		if err != nil {
+			return err
+		}
+		numArrays++
+	}
+	if pending > 0 {
+		c.emit(code.OpArray, pending)
+		numArrays++
+	}
+	c.emit(code.OpConcatArrays, numArrays)
+
+	return nil
+}
+
+// compileNullCoalescing compiles a ?? b, the right operand is only evaluated
+// when the left one is null.
+func (c *Compiler) compileNullCoalescing(node *ast.InfixExpression) error {
+	err := c.Compile(node.Left)
+	if err != nil {
+		return err
+	}
+	JNotNullPos := c.emit(code.OpJumpNotNull, 9999)
+	c.emit(code.OpPop)
+	err = c.Compile(node.Right)
+	if err != nil {
+		return err
+	}
+	c.changeOperand(JNotNullPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// Bytecode represents a sequence of instructions and object table, Handlers is
+// the exception handler table of the main program, Positions its line table,
+// File the source file it was compiled from and GlobalNames the names of its
+// global bindings by index.
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	Handlers     []object.ExceptionHandler
+	Positions    []object.SourcePosition
+	File         string
+	GlobalNames  []string
 }
 
 // Bytecode returns the generated bytecode.
 func (c *Compiler) Bytecode() Bytecode {
+	ins := c.currentInstructions()
+	handlers := c.scopes[c.scopeIndex].handlers
+	positions := c.scopes[c.scopeIndex].positions
+	if c.peephole {
+		var relocate func(int) int
+		ins, relocate = optimize(ins, nil, handlers, true)
+		handlers = relocateHandlers(handlers, relocate)
+		positions = relocatePositions(positions, relocate, len(ins))
+	}
 
 	return Bytecode{
-		Instructions: c.currentInstructions(),
+		Instructions: ins,
 		Constants:    c.constants,
+		Handlers:     handlers,
+		Positions:    positions,
+		File:         c.file,
+		GlobalNames:  c.symbolTable.Names(),
 	}
 }
 
@@ -326,14 +1166,29 @@ func (c *Compiler) addConstant(obj object.Object) int {
 
 // emit generates an instruction and add it to the bytecode
 func (c *Compiler) emit(op code.OpCode, operands ...int) int {
-	inst := code.Make(op, operands...)
+	inst := c.encode(op, operands...)
 	pos := c.addInstruction(inst)
 
 	c.setLastEmittedInstruction(op, pos)
+	c.addPosition(pos)
 
 	return pos
 }
 
+// encode creates an instruction, operands exceeding the limits of the bytecode
+// fail the compilation.
+func (c *Compiler) encode(op code.OpCode, operands ...int) []byte {
+	inst, err := code.Encode(op, operands...)
+	if err != nil {
+		if c.err == nil {
+			c.err = &CompileError{Err: fmt.Errorf("bytecode limit exceeded: %s", err), File: c.file, Pos: c.position}
+		}
+		return code.Make(op, operands...)
+	}
+
+	return inst
+}
+
 // lastInstructionIsPop checks if the last emitted instruction is OpPop
 func (c *Compiler) lastInstructionIs(op code.OpCode) bool {
 	if len(c.currentInstructions()) == 0 {
@@ -353,6 +1208,34 @@ func (c *Compiler) removeLastPop() {
 
 	c.scopes[c.scopeIndex].instructions = newInst
 	c.scopes[c.scopeIndex].lastInstruction = previous
+
+	positions := c.scopes[c.scopeIndex].positions
+	for len(positions) > 0 && positions[len(positions)-1].Offset >= last.Position {
+		positions = positions[:len(positions)-1]
+	}
+	c.scopes[c.scopeIndex].positions = positions
+}
+
+// addPosition maps the instruction at offset to the position being compiled
+// in the line table of the current scope, an entry is added only when the
+// position changes.
+func (c *Compiler) addPosition(offset int) {
+	if !c.position.IsValid() {
+		return
+	}
+
+	scope := &c.scopes[c.scopeIndex]
+	if n := len(scope.positions); n > 0 {
+		last := &scope.positions[n-1]
+		if last.Pos == c.position {
+			return
+		}
+		if last.Offset == offset {
+			last.Pos = c.position
+			return
+		}
+	}
+	scope.positions = append(scope.positions, object.SourcePosition{Offset: offset, Pos: c.position})
 }
 
 // setLastEmittedInstruction populates the last instruction from the current
@@ -377,7 +1260,7 @@ func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
 // changeOperand replaces an opcode operand's
 func (c *Compiler) changeOperand(opPos int, operand int) {
 	op := code.OpCode(c.currentInstructions()[opPos])
-	newInstruction := code.Make(op, operand)
+	newInstruction := c.encode(op, operand)
 
 	c.replaceInstruction(opPos, newInstruction)
 }
@@ -392,6 +1275,27 @@ func (c *Compiler) addInstruction(inst []byte) int {
 	return posNewInst
 }
 
+// define defines the symbol of an identifier binding a value.
+func (c *Compiler) define(ident *ast.Identifier) Symbol {
+	sym := c.symbolTable.DefineAt(string(ident.Value), ident.Pos())
+	if c.recordReferences {
+		c.references = append(c.references, Reference{Name: sym.Name, Pos: ident.Pos(), Definition: ident.Pos(), Scope: sym.Scope})
+	}
+
+	return sym
+}
+
+// resolve resolves the symbol an identifier refers to.
+func (c *Compiler) resolve(ident *ast.Identifier) (Symbol, bool) {
+	sym, ok := c.symbolTable.Resolve(string(ident.Value))
+	if ok && c.recordReferences {
+		def, _ := c.symbolTable.Definition(sym.Name)
+		c.references = append(c.references, Reference{Name: sym.Name, Pos: ident.Pos(), Definition: def, Scope: sym.Scope})
+	}
+
+	return sym, ok
+}
+
 // enterScope creates a new compiler scope and makes it the current working scope
 func (c *Compiler) enterScope() {
 	scope := CompilationScope{
@@ -423,6 +1327,15 @@ func (c *Compiler) replaceLastPopWithRet() {
 	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
 }
 
+// storeSymbol emits the opcode binding the top of the stack to a symbol
+func (c *Compiler) storeSymbol(sym Symbol) {
+	if sym.Scope == GlobalScope {
+		c.emit(code.OpSetGlobal, sym.Index)
+	} else {
+		c.emit(code.OpSetLocal, sym.Index)
+	}
+}
+
 // loadSymbol emits the proper symbol opcode
 func (c *Compiler) loadSymbol(sym Symbol) {
 	switch sym.Scope {
@@ -1,14 +1,19 @@
 package compiler
 
 import (
+	"bytes"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/actuallyachraf/monkey-giggle/ast"
 	"github.com/actuallyachraf/monkey-giggle/code"
 	"github.com/actuallyachraf/monkey-giggle/lexer"
+	"github.com/actuallyachraf/monkey-giggle/module"
 	"github.com/actuallyachraf/monkey-giggle/object"
 	"github.com/actuallyachraf/monkey-giggle/parser"
+	"github.com/actuallyachraf/monkey-giggle/token"
 )
 
 type compilerTestCase struct {
@@ -114,21 +119,21 @@ func TestCompiler(t *testing.T) {
 			},
 			{
 				input:             "1 < 2",
-				expectedConstants: []interface{}{2, 1},
+				expectedConstants: []interface{}{1, 2},
 				expectedInstructions: []code.Instructions{
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpConstant, 1),
-					code.Make(code.OpGreaterThan),
+					code.Make(code.OpLessThan),
 					code.Make(code.OpPop),
 				},
 			},
 			{
 				input:             "1 <= 2",
-				expectedConstants: []interface{}{2, 1},
+				expectedConstants: []interface{}{1, 2},
 				expectedInstructions: []code.Instructions{
 					code.Make(code.OpConstant, 0),
 					code.Make(code.OpConstant, 1),
-					code.Make(code.OpGreaterOrEqual),
+					code.Make(code.OpLessOrEqual),
 					code.Make(code.OpPop),
 				},
 			},
@@ -257,6 +262,39 @@ func TestCompiler(t *testing.T) {
 		}
 		runCompilerTests(t, tests)
 	})
+	t.Run("TestNullExpressions", func(t *testing.T) {
+		tests := []compilerTestCase{
+			{
+				input:             `null`,
+				expectedConstants: []interface{}{},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpNull),
+					code.Make(code.OpPop),
+				},
+			}, {
+				input:             `null ?? 1`,
+				expectedConstants: []interface{}{1},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpNull),
+					code.Make(code.OpJumpNotNull, 8),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+				},
+			}, {
+				input:             `{}?.[1]`,
+				expectedConstants: []interface{}{1},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpHashTable, 0),
+					code.Make(code.OpJumpNull, 10),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpIndex),
+					code.Make(code.OpPop),
+				},
+			},
+		}
+		runCompilerTests(t, tests)
+	})
 	t.Run("TestGlobalLetStatement", func(t *testing.T) {
 		tests := []compilerTestCase{
 			{
@@ -439,6 +477,117 @@ func TestCompiler(t *testing.T) {
 		}
 		runCompilerTests(t, tests)
 	})
+	t.Run("TestSliceExpression", func(t *testing.T) {
+		tests := []compilerTestCase{
+			{
+				input:             "[1,2,3][1:2]",
+				expectedConstants: []interface{}{1, 2, 3, 1, 2},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpArray, 3),
+					code.Make(code.OpConstant, 3),
+					code.Make(code.OpConstant, 4),
+					code.Make(code.OpSlice),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input:             `"abc"[:1]`,
+				expectedConstants: []interface{}{"abc", 1},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpNull),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpSlice),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input:             `"abc"[1:]`,
+				expectedConstants: []interface{}{"abc", 1},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpNull),
+					code.Make(code.OpSlice),
+					code.Make(code.OpPop),
+				},
+			},
+		}
+		runCompilerTests(t, tests)
+	})
+	t.Run("TestFunctionDefaultsAndSpread", func(t *testing.T) {
+		tests := []compilerTestCase{
+			{
+				input: "fn(a, b = 2) { a + b }",
+				expectedConstants: []interface{}{
+					2,
+					[]code.Instructions{
+						code.Make(code.OpConstant, 0),
+						code.Make(code.OpSetLocal, 1),
+						code.Make(code.OpGetLocal, 0),
+						code.Make(code.OpGetLocal, 1),
+						code.Make(code.OpAdd),
+						code.Make(code.OpReturnValue),
+					},
+				},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpPop),
+				},
+			}, {
+				input: "fn(a, ...rest) { rest }",
+				expectedConstants: []interface{}{
+					[]code.Instructions{
+						code.Make(code.OpGetLocal, 1),
+						code.Make(code.OpReturnValue),
+					},
+				},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpClosure, 0, 0),
+					code.Make(code.OpPop),
+				},
+			}, {
+				input:             "len(...[1], 2)",
+				expectedConstants: []interface{}{1, 2},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpGetBuiltin, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpArray, 1),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpArray, 1),
+					code.Make(code.OpConcatArrays, 2),
+					code.Make(code.OpCallSpread),
+					code.Make(code.OpPop),
+				},
+			},
+		}
+		runCompilerTests(t, tests)
+
+		program := parse("fn(a, b = 1, c = 2) { a }")
+		compiler := New()
+		if err := compiler.Compile(program); err != nil {
+			t.Fatalf("compiler error : %s", err)
+		}
+		fn, ok := compiler.Bytecode().Constants[2].(*object.CompiledFunction)
+		if !ok {
+			t.Fatalf("constant is not a function got %T", compiler.Bytecode().Constants[2])
+		}
+		if fn.NumParams != 3 || fn.NumDefaults != 2 || fn.Variadic {
+			t.Errorf("wrong function metadata : %+v", fn)
+		}
+		expectedOffsets := []int{0, 5, 10}
+		for i, offset := range expectedOffsets {
+			if fn.DefaultOffsets[i] != offset {
+				t.Errorf("wrong default offset %d expected %d got %d", i, offset, fn.DefaultOffsets[i])
+			}
+		}
+		if err := New().Compile(parse("...[1]")); err == nil {
+			t.Errorf("expected an error for spread outside of calls and arrays")
+		}
+	})
 	t.Run("TestFunctionLiteral", func(t *testing.T) {
 		tests := []compilerTestCase{
 			{
@@ -633,6 +782,232 @@ func TestCompiler(t *testing.T) {
 		}
 		runCompilerTests(t, tests)
 	})
+	t.Run("TestDestructuringLetStatement", func(t *testing.T) {
+		tests := []compilerTestCase{
+			{
+				input:             "let [a, ...b] = [1];",
+				expectedConstants: []interface{}{1, 0, 1},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpArray, 1),
+					code.Make(code.OpDestructureArray, 1, 1),
+					code.Make(code.OpDup),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpIndex),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpNull),
+					code.Make(code.OpSlice),
+					code.Make(code.OpSetGlobal, 1),
+				},
+			}, {
+				input:             `let {a} = {"a": 1};`,
+				expectedConstants: []interface{}{"a", 1, "a"},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpHashTable, 2),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpDestructureHash, 1),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpIndex),
+					code.Make(code.OpSetGlobal, 0),
+				},
+			},
+		}
+		runCompilerTests(t, tests)
+	})
+	t.Run("TestMatchExpression", func(t *testing.T) {
+		tests := []compilerTestCase{
+			{
+				input:             "match (1) { 1 => 10, x => x };",
+				expectedConstants: []interface{}{1, 1, 10},
+				expectedInstructions: []code.Instructions{
+					// 0000
+					code.Make(code.OpConstant, 0),
+					// 0003
+					code.Make(code.OpSetGlobal, 0),
+					// 0006
+					code.Make(code.OpGetGlobal, 0),
+					// 0009
+					code.Make(code.OpConstant, 1),
+					// 0012
+					code.Make(code.OpEqual),
+					// 0013
+					code.Make(code.OpJNE, 22),
+					// 0016
+					code.Make(code.OpConstant, 2),
+					// 0019
+					code.Make(code.OpJump, 35),
+					// 0022
+					code.Make(code.OpGetGlobal, 0),
+					// 0025
+					code.Make(code.OpSetGlobal, 1),
+					// 0028
+					code.Make(code.OpGetGlobal, 1),
+					// 0031
+					code.Make(code.OpJump, 35),
+					// 0034
+					code.Make(code.OpNull),
+					// 0035
+					code.Make(code.OpPop),
+				},
+			}, {
+				input:             "match ([1]) { [_] => 1 };",
+				expectedConstants: []interface{}{1, 0, 1},
+				expectedInstructions: []code.Instructions{
+					// 0000
+					code.Make(code.OpConstant, 0),
+					// 0003
+					code.Make(code.OpArray, 1),
+					// 0006
+					code.Make(code.OpSetGlobal, 0),
+					// 0009
+					code.Make(code.OpGetGlobal, 0),
+					// 0012
+					code.Make(code.OpMatchArray, 1, 0),
+					// 0016
+					code.Make(code.OpJNE, 25),
+					// 0019
+					code.Make(code.OpConstant, 2),
+					// 0022
+					code.Make(code.OpJump, 26),
+					// 0025
+					code.Make(code.OpNull),
+					// 0026
+					code.Make(code.OpPop),
+				},
+			},
+		}
+		runCompilerTests(t, tests)
+	})
+	t.Run("TestMatchSubjectSlots", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected []string
+		}{
+			{"match (1) { x => x }; match (2) { y => y }; match (3) { _ => 0 }", []string{"$match0", "x", "y"}},
+			{"match (1) { x => match (x) { y => y } }; match (2) { _ => match (3) { _ => 0 } }", []string{"$match0", "x", "$match1", "y"}},
+			{"let z = match (match (1) { _ => 2 }) { n => n }", []string{"z", "$match0", "n"}},
+		}
+
+		for _, tt := range tests {
+			compiler := New()
+			if err := compiler.Compile(parse(tt.input)); err != nil {
+				t.Fatalf("compiler error : %s", err)
+			}
+			if names := compiler.symbolTable.names; !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("wrong globals for %s expected %v got %v", tt.input, tt.expected, names)
+			}
+		}
+	})
+	t.Run("TestTryExpression", func(t *testing.T) {
+		tests := []compilerTestCase{
+			{
+				input:             "try { throw 1 } catch (e) { e };",
+				expectedConstants: []interface{}{1},
+				expectedInstructions: []code.Instructions{
+					// 0000
+					code.Make(code.OpTry, 0),
+					// 0003
+					code.Make(code.OpConstant, 0),
+					// 0006
+					code.Make(code.OpThrow),
+					// 0007
+					code.Make(code.OpNull),
+					// 0008
+					code.Make(code.OpEndTry),
+					// 0009
+					code.Make(code.OpJump, 18),
+					// 0012
+					code.Make(code.OpSetGlobal, 0),
+					// 0015
+					code.Make(code.OpGetGlobal, 0),
+					// 0018
+					code.Make(code.OpPop),
+				},
+			}, {
+				input:             "try { 1 } finally { 2 };",
+				expectedConstants: []interface{}{1, 2},
+				expectedInstructions: []code.Instructions{
+					// 0000
+					code.Make(code.OpTry, 0),
+					// 0003
+					code.Make(code.OpConstant, 0),
+					// 0006
+					code.Make(code.OpEndTry),
+					// 0007
+					code.Make(code.OpFalse),
+					// 0008
+					code.Make(code.OpJump, 12),
+					// 0011
+					code.Make(code.OpTrue),
+					// 0012
+					code.Make(code.OpConstant, 1),
+					// 0015
+					code.Make(code.OpPop),
+					// 0016
+					code.Make(code.OpJNE, 20),
+					// 0019
+					code.Make(code.OpThrow),
+					// 0020
+					code.Make(code.OpPop),
+				},
+			},
+		}
+		runCompilerTests(t, tests)
+
+		expectedHandlers := [][]object.ExceptionHandler{
+			{{Start: 0, End: 8, Target: 12}},
+			{{Start: 0, End: 6, Target: 11}},
+		}
+		for i, tt := range tests {
+			compiler := New()
+			compiler.SetPeephole(false)
+			err := compiler.Compile(parse(tt.input))
+			if err != nil {
+				t.Fatalf("compiler error : %s", err)
+			}
+			handlers := compiler.Bytecode().Handlers
+			if !reflect.DeepEqual(handlers, expectedHandlers[i]) {
+				t.Errorf("wrong handler table for %q expected %v got %v", tt.input, expectedHandlers[i], handlers)
+			}
+		}
+	})
+	t.Run("TestImportExpression", func(t *testing.T) {
+		compiler := New()
+		compiler.SetLoader(module.NewLoader("../module/testdata"))
+		err := compiler.Compile(parse(`import "math"; import "geometry/shapes"; import "math";`))
+		if err != nil {
+			t.Fatalf("compiler error : %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+		// geometry/shapes imports math which is compiled once
+		expectedInstructions := []code.Instructions{
+			code.Make(code.OpImport, 0),
+			code.Make(code.OpPop),
+			code.Make(code.OpImport, 11),
+			code.Make(code.OpPop),
+			code.Make(code.OpImport, 0),
+			code.Make(code.OpPop),
+		}
+		err = testInstructions(expectedInstructions, bytecode.Instructions)
+		if err != nil {
+			t.Fatalf("testInstructions failed : %s", err)
+		}
+
+		for i, name := range map[int]string{0: "math", 11: "geometry/shapes"} {
+			mod, ok := bytecode.Constants[i].(*object.CompiledModule)
+			if !ok || mod.Name != name {
+				t.Fatalf("constant %d is not the compiled module %s got %+v", i, name, bytecode.Constants[i])
+			}
+		}
+		math := bytecode.Constants[0].(*object.CompiledModule)
+		if math.NumGlobals != 5 {
+			t.Errorf("wrong number of module globals expected 5 got %d", math.NumGlobals)
+		}
+	})
 	t.Run("TestLetStatementWithScope", func(t *testing.T) {
 		tests := []compilerTestCase{
 			{
@@ -732,7 +1107,7 @@ func TestCompiler(t *testing.T) {
 					[]code.Instructions{
 						code.Make(code.OpGetBuiltin, 0),
 						code.Make(code.OpArray, 0),
-						code.Make(code.OpCall, 1),
+						code.Make(code.OpTailCall, 1),
 						code.Make(code.OpReturnValue),
 					},
 				},
@@ -775,45 +1150,627 @@ func TestCompiler(t *testing.T) {
 		}
 		runCompilerTests(t, tests)
 	})
-}
-func TestSymbolTable(t *testing.T) {
-	t.Run("TestDefine", func(t *testing.T) {
-		expected := map[string]Symbol{
-			"a": {Name: "a", Scope: GlobalScope, Index: 0},
-			"b": {Name: "b", Scope: GlobalScope, Index: 1},
-			"c": {Name: "c", Scope: LocalScope, Index: 0},
-			"d": {Name: "d", Scope: LocalScope, Index: 1},
-			"e": {Name: "e", Scope: LocalScope, Index: 0},
-			"f": {Name: "f", Scope: LocalScope, Index: 1},
-		}
-
-		global := NewSymbolTable()
-
-		a := global.Define("a")
-		if a != expected["a"] {
-			t.Errorf("expected a=%+v, got=%+v", expected["a"], a)
-		}
-
-		b := global.Define("b")
-		if b != expected["b"] {
-			t.Errorf("expected b=%+v, got=%+v", expected["b"], b)
-		}
-
-		firstLocal := NewEnclosedSymbolTable(global)
-
-		c := firstLocal.Define("c")
-		if c != expected["c"] {
-			t.Errorf("expected c=%+v, got=%+v", expected["c"], c)
-		}
-
-		d := firstLocal.Define("d")
-		if d != expected["d"] {
-			t.Errorf("expected d=%+v, got=%+v", expected["d"], d)
-		}
-
-		secondLocal := NewEnclosedSymbolTable(firstLocal)
-
-		e := secondLocal.Define("e")
+	t.Run("TestConstantFolding", func(t *testing.T) {
+		tests := []compilerTestCase{
+			{
+				input:             "2 * 60 * 60",
+				expectedConstants: []interface{}{7200},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input:             `"gig" + "gle"`,
+				expectedConstants: []interface{}{"giggle"},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input:             "!true; -(3 - 5); 1 < 2",
+				expectedConstants: []interface{}{2},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpFalse),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpTrue),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input:             "null ?? 5",
+				expectedConstants: []interface{}{5},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input:             "1 / 0; 1 + true; 9223372036854775807 + 1",
+				expectedConstants: []interface{}{1, 0, 1, 9223372036854775807, 1},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpDiv),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpTrue),
+					code.Make(code.OpAdd),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 3),
+					code.Make(code.OpConstant, 4),
+					code.Make(code.OpAdd),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input:             "if (1 < 2) { 10 } else { 20 }; if (!true) { 30 }; 3333",
+				expectedConstants: []interface{}{10, 3333},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpPop),
+					code.Make(code.OpNull),
+					code.Make(code.OpPop),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				// keys decide the evaluation order and are kept as written
+				input:             "{1 + 1: 2 * 3}",
+				expectedConstants: []interface{}{1, 1, 6},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpHashTable, 2),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input:             "let x = 2; x * (3 + 4)",
+				expectedConstants: []interface{}{2, 7},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpMul),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input: "fn() { 1 + 2 }",
+				expectedConstants: []interface{}{
+					3,
+					[]code.Instructions{
+						code.Make(code.OpConstant, 0),
+						code.Make(code.OpReturnValue),
+					},
+				},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpPop),
+				},
+			},
+		}
+
+		for _, tt := range tests {
+			program := parse(tt.input)
+			written := program.String()
+
+			compiler := New()
+			compiler.SetPeephole(false)
+			if err := compiler.Compile(program); err != nil {
+				t.Fatalf("compiler error : %s", err)
+			}
+			if program.String() != written {
+				t.Errorf("folding modified the program expected %q got %q", written, program.String())
+			}
+
+			bytecode := compiler.Bytecode()
+			if err := testInstructions(tt.expectedInstructions, bytecode.Instructions); err != nil {
+				t.Fatalf("testInstructions failed for %s : %s", tt.input, err)
+			}
+			if err := testConstants(t, tt.expectedConstants, bytecode.Constants); err != nil {
+				t.Fatalf("testConstants failed for %s : %s", tt.input, err)
+			}
+		}
+	})
+	t.Run("TestPeephole", func(t *testing.T) {
+		tests := []struct {
+			input        string
+			instructions []code.Instructions
+			function     []code.Instructions
+			offsets      []int
+			handlers     []object.ExceptionHandler
+		}{
+			{
+				// the value of the program is kept
+				input: "5; 6",
+				instructions: []code.Instructions{
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input: "let a = 1; a; if (a) { 5 }",
+				instructions: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetGlobal, 0),
+					code.Make(code.OpGetGlobal, 0),
+					code.Make(code.OpJNE, 18),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpJump, 19),
+					code.Make(code.OpNull),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				input: "if (true) { 1 } else { 2 }; if (false) { 3 } else { 4 }",
+				instructions: []code.Instructions{
+					code.Make(code.OpConstant, 3),
+					code.Make(code.OpPop),
+				},
+			},
+			{
+				// dead code after a return
+				input: "fn(x) { if (x) { return 1; } else { return 2; } }",
+				function: []code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpJNE, 9),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			{
+				// jumps to a return are replaced by the return
+				input: "fn(x) { if (x) { if (x) { 1 } else { 2 } } else { 3 } }",
+				function: []code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpJNE, 18),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpJNE, 14),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpReturnValue),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpReturnValue),
+					code.Make(code.OpConstant, 2),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			{
+				input: "fn(x) { x; 1; x }",
+				function: []code.Instructions{
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			{
+				// default parameter offsets are relocated
+				input: "fn(a = if (true) { 1 } else { 2 }) { a }",
+				function: []code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				offsets: []int{0, 5},
+			},
+			{
+				// exception handler ranges are relocated
+				input: "fn() { try { if (true) { 1 } else { 2 } } catch (e) { e } }",
+				function: []code.Instructions{
+					code.Make(code.OpTry, 0),
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpEndTry),
+					code.Make(code.OpReturnValue),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+				handlers: []object.ExceptionHandler{{Start: 0, End: 6, Target: 8}},
+			},
+		}
+
+		for _, tt := range tests {
+			compiler := New()
+			compiler.SetFolding(false)
+			if err := compiler.Compile(parse(tt.input)); err != nil {
+				t.Fatalf("compiler error : %s", err)
+			}
+			bytecode := compiler.Bytecode()
+
+			if tt.instructions != nil {
+				if err := testInstructions(tt.instructions, bytecode.Instructions); err != nil {
+					t.Errorf("wrong instructions for %s : %s", tt.input, err)
+				}
+				continue
+			}
+
+			fn, ok := bytecode.Constants[len(bytecode.Constants)-1].(*object.CompiledFunction)
+			if !ok {
+				t.Fatalf("last constant of %s is not a function got %T", tt.input, bytecode.Constants[len(bytecode.Constants)-1])
+			}
+			if err := testInstructions(tt.function, fn.Instructions); err != nil {
+				t.Errorf("wrong function instructions for %s : %s", tt.input, err)
+			}
+			if tt.offsets != nil && !reflect.DeepEqual(fn.DefaultOffsets, tt.offsets) {
+				t.Errorf("wrong default offsets for %s expected %v got %v", tt.input, tt.offsets, fn.DefaultOffsets)
+			}
+			if !reflect.DeepEqual(fn.Handlers, tt.handlers) {
+				t.Errorf("wrong handler table for %s expected %v got %v", tt.input, tt.handlers, fn.Handlers)
+			}
+		}
+	})
+	t.Run("TestBytecodeLimits", func(t *testing.T) {
+		var locals strings.Builder
+		locals.WriteString("fn() { ")
+		for i := 0; i < 300; i++ {
+			fmt.Fprintf(&locals, "let %s = 0; ", identifier(i))
+		}
+		locals.WriteString(identifier(299) + " }")
+
+		compiler := New()
+		compiler.SetPeephole(false)
+		if err := compiler.Compile(parse(locals.String())); err != nil {
+			t.Fatalf("compiler error : %s", err)
+		}
+		constants := compiler.Bytecode().Constants
+		fn := constants[len(constants)-1].(*object.CompiledFunction)
+		if fn.NumLocals != 300 {
+			t.Errorf("wrong number of locals expected 300 got %d", fn.NumLocals)
+		}
+		tail := concatInstructions([]code.Instructions{
+			code.MakeWide(code.OpSetLocal, 299),
+			code.MakeWide(code.OpGetLocal, 299),
+			code.Make(code.OpReturnValue),
+		})
+		if !bytes.HasSuffix(fn.Instructions, tail) {
+			t.Errorf("locals past 255 aren't wide got\n%s", fn.Instructions)
+		}
+
+		var globals strings.Builder
+		for i := 0; i <= 65536; i++ {
+			fmt.Fprintf(&globals, "let %s = 0;", identifier(i))
+		}
+		var jumps strings.Builder
+		jumps.WriteString("let x = 1; if (x) {")
+		for i := 0; i < 20000; i++ {
+			jumps.WriteString("x;")
+		}
+		jumps.WriteString("}")
+
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{globals.String(), "bytecode limit exceeded: operand 65536 of OpSetGlobal exceeds the limit of 65535"},
+			{jumps.String(), "bytecode limit exceeded: operand 80014 of OpJumpIfNotEqual exceeds the limit of 65535"},
+		}
+		for _, tt := range tests {
+			compiler := New()
+			err := compiler.Compile(parse(tt.input))
+			if err == nil {
+				t.Fatalf("expected compiler error %q got none", tt.expected)
+			}
+			if err.Error() != tt.expected {
+				t.Errorf("wrong compiler error expected %q got %q", tt.expected, err)
+			}
+		}
+	})
+	t.Run("TestLineTable", func(t *testing.T) {
+		pos := func(offset, line, column int) object.SourcePosition {
+			return object.SourcePosition{Offset: offset, Pos: token.Position{Line: line, Column: column}}
+		}
+		tests := []struct {
+			input    string
+			optimize bool
+			main     []object.SourcePosition
+			function []object.SourcePosition
+			name     string
+		}{
+			{
+				input: "let a = 1;\nlet f = fn(x) {\n  x / a\n};\nf(2)",
+				main: []object.SourcePosition{
+					pos(0, 1, 9), pos(3, 1, 1), pos(6, 2, 9), pos(10, 2, 1),
+					pos(13, 5, 1), pos(16, 5, 3), pos(19, 5, 2), pos(21, 5, 1),
+				},
+				function: []object.SourcePosition{pos(0, 3, 3), pos(2, 3, 7), pos(5, 3, 5), pos(6, 3, 3)},
+				name:     "f",
+			},
+			{
+				input: "let f = fn(x) {\n  x;\n  if (true) { 1 } else { 2 };\n  x / 2\n};",
+				function: []object.SourcePosition{
+					pos(0, 2, 3), pos(3, 3, 7), pos(4, 3, 3), pos(7, 3, 15), pos(10, 3, 3),
+					pos(13, 3, 26), pos(16, 3, 3), pos(17, 4, 3), pos(19, 4, 7), pos(22, 4, 5), pos(23, 4, 3),
+				},
+				name: "f",
+			},
+			{
+				// entries of removed instructions are dropped or relocated
+				input:    "let f = fn(x) {\n  x;\n  if (true) { 1 } else { 2 };\n  x / 2\n};",
+				optimize: true,
+				function: []object.SourcePosition{pos(0, 4, 3), pos(2, 4, 7), pos(5, 4, 5), pos(6, 4, 3)},
+				name:     "f",
+			},
+		}
+
+		for _, tt := range tests {
+			compiler := New()
+			compiler.SetFolding(tt.optimize)
+			compiler.SetPeephole(tt.optimize)
+			compiler.SetFile("main.gg")
+			if err := compiler.Compile(parse(tt.input)); err != nil {
+				t.Fatalf("compiler error : %s", err)
+			}
+			bytecode := compiler.Bytecode()
+
+			if tt.main != nil && !reflect.DeepEqual(bytecode.Positions, tt.main) {
+				t.Errorf("wrong line table for %q expected %v got %v", tt.input, tt.main, bytecode.Positions)
+			}
+			if bytecode.File != "main.gg" {
+				t.Errorf("wrong file expected main.gg got %q", bytecode.File)
+			}
+			for _, constant := range bytecode.Constants {
+				fn, ok := constant.(*object.CompiledFunction)
+				if !ok {
+					continue
+				}
+				if !reflect.DeepEqual(fn.Positions, tt.function) {
+					t.Errorf("wrong function line table for %q expected %v got %v", tt.input, tt.function, fn.Positions)
+				}
+				if fn.Name != tt.name || fn.File != "main.gg" {
+					t.Errorf("wrong function name or file expected %s in main.gg got %s in %s", tt.name, fn.Name, fn.File)
+				}
+			}
+		}
+	})
+	t.Run("TestBytecodeEncoding", func(t *testing.T) {
+		compiler := New()
+		compiler.SetFile("main.gg")
+		compiler.SetLoader(module.NewLoader("../module/testdata"))
+		err := compiler.Compile(parse(`import "math"; let greet = fn(name) { "hello " + name }; greet("you")`))
+		if err != nil {
+			t.Fatalf("compiler error : %s", err)
+		}
+		bytecode := compiler.Bytecode()
+
+		var buf bytes.Buffer
+		if err := bytecode.Encode(&buf); err != nil {
+			t.Fatalf("Encode failed with error : %s", err)
+		}
+		decoded, err := DecodeBytecode(&buf)
+		if err != nil {
+			t.Fatalf("DecodeBytecode failed with error : %s", err)
+		}
+
+		if err := testInstructions([]code.Instructions{bytecode.Instructions}, decoded.Instructions); err != nil {
+			t.Errorf("wrong decoded instructions : %s", err)
+		}
+		if decoded.File != bytecode.File || !reflect.DeepEqual(decoded.Positions, bytecode.Positions) {
+			t.Errorf("wrong decoded line table expected %s %v got %s %v", bytecode.File, bytecode.Positions, decoded.File, decoded.Positions)
+		}
+		if len(decoded.Constants) != len(bytecode.Constants) {
+			t.Fatalf("wrong number of decoded constants expected %d got %d", len(bytecode.Constants), len(decoded.Constants))
+		}
+		for i, constant := range bytecode.Constants {
+			switch constant := constant.(type) {
+			case *object.CompiledFunction:
+				fn, ok := decoded.Constants[i].(*object.CompiledFunction)
+				if !ok || fn.Name != constant.Name || !reflect.DeepEqual(fn.Positions, constant.Positions) ||
+					fn.Instructions.String() != constant.Instructions.String() {
+					t.Errorf("wrong decoded function %d expected %+v got %+v", i, constant, decoded.Constants[i])
+				}
+			case *object.CompiledModule:
+				mod, ok := decoded.Constants[i].(*object.CompiledModule)
+				if !ok || mod.Name != constant.Name || mod.NumGlobals != constant.NumGlobals ||
+					mod.Fn.File != constant.Fn.File || mod.Fn.Instructions.String() != constant.Fn.Instructions.String() {
+					t.Errorf("wrong decoded module %d expected %+v got %+v", i, constant, decoded.Constants[i])
+				}
+			default:
+				if decoded.Constants[i].Inspect() != constant.Inspect() {
+					t.Errorf("wrong decoded constant %d expected %s got %s", i, constant.Inspect(), decoded.Constants[i].Inspect())
+				}
+			}
+		}
+
+		if _, err := DecodeBytecode(strings.NewReader("giggle")); err == nil {
+			t.Errorf("expected an error decoding invalid bytecode")
+		}
+	})
+	t.Run("TestTailCalls", func(t *testing.T) {
+		tests := []compilerTestCase{
+			{
+				input: "fn(f) { f(1) }",
+				expectedConstants: []interface{}{
+					1,
+					[]code.Instructions{
+						code.Make(code.OpGetLocal, 0),
+						code.Make(code.OpConstant, 0),
+						code.Make(code.OpTailCall, 1),
+						code.Make(code.OpReturnValue),
+					},
+				},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpPop),
+				},
+			}, {
+				input: "fn(f) { return f(1); }",
+				expectedConstants: []interface{}{
+					1,
+					[]code.Instructions{
+						code.Make(code.OpGetLocal, 0),
+						code.Make(code.OpConstant, 0),
+						code.Make(code.OpTailCall, 1),
+						code.Make(code.OpReturnValue),
+					},
+				},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpPop),
+				},
+			}, {
+				input: "fn(f) { f(...[1]) }",
+				expectedConstants: []interface{}{
+					1,
+					[]code.Instructions{
+						code.Make(code.OpGetLocal, 0),
+						code.Make(code.OpConstant, 0),
+						code.Make(code.OpArray, 1),
+						code.Make(code.OpConcatArrays, 1),
+						code.Make(code.OpTailCallSpread),
+						code.Make(code.OpReturnValue),
+					},
+				},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpClosure, 1, 0),
+					code.Make(code.OpPop),
+				},
+			}, {
+				// calls whose value is used aren't in tail position
+				input: "fn(f) { f(1) + 1 }",
+				expectedConstants: []interface{}{
+					1,
+					1,
+					[]code.Instructions{
+						code.Make(code.OpGetLocal, 0),
+						code.Make(code.OpConstant, 0),
+						code.Make(code.OpCall, 1),
+						code.Make(code.OpConstant, 1),
+						code.Make(code.OpAdd),
+						code.Make(code.OpReturnValue),
+					},
+				},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpClosure, 2, 0),
+					code.Make(code.OpPop),
+				},
+			}, {
+				// branches jumping to the return are in tail position
+				input: "fn(f) { if (f) { f(1) } else { 2 } }",
+				expectedConstants: []interface{}{
+					1,
+					2,
+					[]code.Instructions{
+						code.Make(code.OpGetLocal, 0),
+						code.Make(code.OpJNE, 15),
+						code.Make(code.OpGetLocal, 0),
+						code.Make(code.OpConstant, 0),
+						code.Make(code.OpTailCall, 1),
+						code.Make(code.OpJump, 18),
+						code.Make(code.OpConstant, 1),
+						code.Make(code.OpReturnValue),
+					},
+				},
+				expectedInstructions: []code.Instructions{
+					code.Make(code.OpClosure, 2, 0),
+					code.Make(code.OpPop),
+				},
+			},
+		}
+
+		runCompilerTests(t, tests)
+
+		// debuggers keep a frame for every call
+		comp := New()
+		comp.SetTailCalls(false)
+		if err := comp.Compile(parse("fn(f) { f(1) }")); err != nil {
+			t.Fatalf("compiler error : %s", err)
+		}
+		fn := comp.Bytecode().Constants[1].(*object.CompiledFunction)
+		expected := concatInstructions([]code.Instructions{
+			code.Make(code.OpGetLocal, 0),
+			code.Make(code.OpConstant, 0),
+			code.Make(code.OpCall, 1),
+			code.Make(code.OpReturnValue),
+		})
+		if !bytes.Equal(fn.Instructions, expected) {
+			t.Errorf("wrong instructions expected %s got %s", expected, fn.Instructions)
+		}
+	})
+	t.Run("TestReferences", func(t *testing.T) {
+		input := "let a = 1;\nlet f = fn(b) { a + b + len([]) };\nf(a)"
+		comp := New()
+		comp.SetReferences(true)
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error : %s", err)
+		}
+
+		pos := func(line, column int) token.Position { return token.Position{Line: line, Column: column} }
+		expected := []Reference{
+			{Name: "a", Pos: pos(1, 5), Definition: pos(1, 5), Scope: GlobalScope},
+			{Name: "f", Pos: pos(2, 5), Definition: pos(2, 5), Scope: GlobalScope},
+			{Name: "b", Pos: pos(2, 12), Definition: pos(2, 12), Scope: LocalScope},
+			{Name: "a", Pos: pos(2, 17), Definition: pos(1, 5), Scope: GlobalScope},
+			{Name: "b", Pos: pos(2, 21), Definition: pos(2, 12), Scope: LocalScope},
+			{Name: "len", Pos: pos(2, 25), Scope: BuiltinScope},
+			{Name: "f", Pos: pos(3, 1), Definition: pos(2, 5), Scope: GlobalScope},
+			{Name: "a", Pos: pos(3, 3), Definition: pos(1, 5), Scope: GlobalScope},
+		}
+		if !reflect.DeepEqual(comp.References(), expected) {
+			t.Errorf("wrong references expected %+v got %+v", expected, comp.References())
+		}
+	})
+	t.Run("TestCompileErrorLocation", func(t *testing.T) {
+		comp := New()
+		comp.SetFile("main.gg")
+		err := comp.Compile(parse("let a = 1;\nlet b = fn() { a + c };"))
+		cerr, ok := err.(*CompileError)
+		if !ok {
+			t.Fatalf("expected a CompileError got %T (%v)", err, err)
+		}
+		if cerr.Error() != "identifier not found: c" || cerr.Location() != "main.gg:2:20" {
+			t.Errorf("wrong compile error got %s: %s", cerr.Location(), cerr)
+		}
+	})
+}
+func TestSymbolTable(t *testing.T) {
+	t.Run("TestDefine", func(t *testing.T) {
+		expected := map[string]Symbol{
+			"a": {Name: "a", Scope: GlobalScope, Index: 0},
+			"b": {Name: "b", Scope: GlobalScope, Index: 1},
+			"c": {Name: "c", Scope: LocalScope, Index: 0},
+			"d": {Name: "d", Scope: LocalScope, Index: 1},
+			"e": {Name: "e", Scope: LocalScope, Index: 0},
+			"f": {Name: "f", Scope: LocalScope, Index: 1},
+		}
+
+		global := NewSymbolTable()
+
+		a := global.Define("a")
+		if a != expected["a"] {
+			t.Errorf("expected a=%+v, got=%+v", expected["a"], a)
+		}
+
+		b := global.Define("b")
+		if b != expected["b"] {
+			t.Errorf("expected b=%+v, got=%+v", expected["b"], b)
+		}
+
+		firstLocal := NewEnclosedSymbolTable(global)
+
+		c := firstLocal.Define("c")
+		if c != expected["c"] {
+			t.Errorf("expected c=%+v, got=%+v", expected["c"], c)
+		}
+
+		d := firstLocal.Define("d")
+		if d != expected["d"] {
+			t.Errorf("expected d=%+v, got=%+v", expected["d"], d)
+		}
+
+		secondLocal := NewEnclosedSymbolTable(firstLocal)
+
+		e := secondLocal.Define("e")
 		if e != expected["e"] {
 			t.Errorf("expected e=%+v, got=%+v", expected["e"], e)
 		}
@@ -986,6 +1943,19 @@ func TestCompilerScope(t *testing.T) {
 	}
 
 }
+
+// identifier returns the i-th identifier of generated programs.
+func identifier(i int) string {
+	name := []byte{'v'}
+	for {
+		name = append(name, byte('a'+i%26))
+		i /= 26
+		if i == 0 {
+			return string(name)
+		}
+	}
+}
+
 func parse(input string) *ast.Program {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -999,6 +1969,9 @@ func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 
 	for _, tt := range tests {
 		compiler := New()
+		// the expected instructions are those of the program as written
+		compiler.SetFolding(false)
+		compiler.SetPeephole(false)
 		program := parse(tt.input)
 		err := compiler.Compile(program)
 
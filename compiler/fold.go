@@ -0,0 +1,151 @@
+package compiler
+
+import (
+	"strconv"
+
+	"github.com/actuallyachraf/monkey-giggle/ast"
+	"github.com/actuallyachraf/monkey-giggle/object"
+	"github.com/actuallyachraf/monkey-giggle/token"
+)
+
+// fold.go implements constant folding, an optimization pass over the AST run
+// before compilation that replaces expressions whose operands are literals by
+// the literal they evaluate to : arithmetic, comparisons, string
+// concatenation, boolean negation and null coalescing.
+//
+// Operators are applied with the helpers of package object so folded values
+// are the values the VM would compute, expressions that fail at runtime such
+// as divisions by zero or type mismatches are left untouched to keep raising
+// their error. Results that don't fit in a literal (big integers) aren't folded.
+
+// Fold returns a copy of the program with constant expressions folded, the
+// nodes of the given program are never modified.
+//
+// Hashmap keys are kept as written since their text decides the order pairs
+// are evaluated in, the nodes of a key are found by position as the copies
+// made by ast.Rewrite keep the position of the nodes they copy.
+func Fold(program *ast.Program) *ast.Program {
+	keys := map[token.Position]bool{}
+	ast.Inspect(program, func(node ast.Node) bool {
+		if hashmap, ok := node.(*ast.HashmapLiteral); ok {
+			for key := range hashmap.Pairs {
+				ast.Inspect(key, func(n ast.Node) bool {
+					keys[n.Pos()] = true
+					return true
+				})
+			}
+		}
+		return true
+	})
+
+	folded := ast.Rewrite(program, func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.PrefixExpression:
+			if !keys[node.Pos()] {
+				return foldPrefix(node)
+			}
+		case *ast.InfixExpression:
+			if !keys[node.Pos()] {
+				return foldInfix(node)
+			}
+		}
+		return node
+	})
+
+	return folded.(*ast.Program)
+}
+
+// foldPrefix folds a prefix expression whose operand is a literal.
+func foldPrefix(pe *ast.PrefixExpression) ast.Expression {
+	right, ok := literalValue(pe.Right)
+	if !ok {
+		return pe
+	}
+
+	switch pe.Operator {
+	case "!":
+		return literal(&object.Boolean{Value: !object.Truthy(right)}, pe)
+	case "-":
+		val, err := object.Negate(right)
+		if err != nil {
+			return pe
+		}
+		return literal(val, pe)
+	default:
+		return pe
+	}
+}
+
+// foldInfix folds an infix expression whose operands are literals.
+func foldInfix(ie *ast.InfixExpression) ast.Expression {
+	left, ok := literalValue(ie.Left)
+	if !ok {
+		return ie
+	}
+	if ie.Operator == "??" {
+		if left.Type() == object.NULL {
+			return ie.Right
+		}
+		return ie.Left
+	}
+
+	right, ok := literalValue(ie.Right)
+	if !ok {
+		return ie
+	}
+
+	switch ie.Operator {
+	case "==", "!=", "<", ">", "<=", ">=":
+		res, err := object.CompareOp(string(ie.Operator), left, right)
+		if err != nil {
+			return ie
+		}
+		return literal(&object.Boolean{Value: res}, ie)
+	default:
+		res, err := object.BinaryOp(string(ie.Operator), left, right)
+		if err != nil {
+			return ie
+		}
+		return literal(res, ie)
+	}
+}
+
+// literalValue returns the value of a literal expression.
+func literalValue(e ast.Expression) (object.Object, bool) {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return &object.Integer{Value: e.Value}, true
+	case *ast.BigIntegerLiteral:
+		return &object.BigInt{Value: e.Value}, true
+	case *ast.StringLiteral:
+		return &object.String{Value: e.Value}, true
+	case *ast.BooleanLiteral:
+		return &object.Boolean{Value: e.Value}, true
+	case *ast.NullLiteral:
+		return &object.Null{}, true
+	default:
+		return nil, false
+	}
+}
+
+// literal returns the literal expression holding a folded value at the
+// position of the original expression, the original expression is returned
+// when the value has no literal. Results promoted to big integers are left
+// unfolded.
+func literal(val object.Object, original ast.Expression) ast.Expression {
+	pos := original.Pos()
+	switch val := val.(type) {
+	case *object.Integer:
+		lit := strconv.FormatInt(val.Value, 10)
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: token.Literal(lit), Pos: pos}, Value: val.Value}
+	case *object.String:
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: token.Literal(val.Value), Pos: pos}, Value: val.Value}
+	case *object.Boolean:
+		if val.Value {
+			return &ast.BooleanLiteral{Token: token.Token{Type: token.TRUE, Literal: "true", Pos: pos}, Value: true}
+		}
+		return &ast.BooleanLiteral{Token: token.Token{Type: token.FALSE, Literal: "false", Pos: pos}, Value: false}
+	default:
+		return original
+	}
+}
@@ -0,0 +1,322 @@
+package compiler
+
+import (
+	"sort"
+
+	"github.com/actuallyachraf/monkey-giggle/code"
+	"github.com/actuallyachraf/monkey-giggle/object"
+)
+
+// peephole.go implements a peephole optimizer run over the instructions of
+// every compiled function, it rewrites short instruction sequences :
+//
+//   - jumps to an OpJump are threaded to the final target and jumps to an
+//     OpReturnValue or OpReturn are replaced by the return itself.
+//   - jumps to the next instruction are removed.
+//   - OpTrue followed by OpJNE is removed, OpFalse or OpNull followed by OpJNE
+//     becomes an OpJump.
+//   - an instruction pushing a value without side effects followed by OpPop
+//     is removed.
+//   - instructions following an OpJump, a return or an OpThrow are removed
+//     until the next instruction reachable by a jump.
+//
+// The rewrites are applied until none applies, instructions are then encoded
+// again and every position (jump operands, default parameter offsets and
+// exception handler ranges) is relocated.
+
+// jumpOps are the opcodes whose operand is the position of an instruction.
+var jumpOps = map[code.OpCode]bool{
+	code.OpJump:        true,
+	code.OpJNE:         true,
+	code.OpJumpNull:    true,
+	code.OpJumpNotNull: true,
+}
+
+// terminalOps are the opcodes after which execution never falls through.
+var terminalOps = map[code.OpCode]bool{
+	code.OpJump:        true,
+	code.OpReturnValue: true,
+	code.OpReturn:      true,
+	code.OpThrow:       true,
+}
+
+// pureOps are the opcodes pushing a value without any other side effect.
+var pureOps = map[code.OpCode]bool{
+	code.OpConstant:   true,
+	code.OpTrue:       true,
+	code.OpFalse:      true,
+	code.OpNull:       true,
+	code.OpGetGlobal:  true,
+	code.OpGetLocal:   true,
+	code.OpGetFree:    true,
+	code.OpGetBuiltin: true,
+	code.OpDup:        true,
+}
+
+// instruction is a decoded instruction, pos is its position in the original
+// instructions and the operands of jumps are original positions until the
+// instructions are encoded again.
+type instruction struct {
+	op       code.OpCode
+	operands []int
+	pos      int
+}
+
+// peephole holds the instructions being optimized.
+type peephole struct {
+	ins []instruction
+	// entries are positions entered otherwise than by falling through or
+	// jumping, they must stay instruction boundaries
+	entries map[int]bool
+	// keepLastPop keeps the final OpPop of the main program which holds the
+	// value of the program
+	keepLastPop bool
+}
+
+// optimizeFunction optimizes the instructions of a compiled function.
+func optimizeFunction(fn *object.CompiledFunction) {
+	ins, relocate := optimize(fn.Instructions, fn.DefaultOffsets, fn.Handlers, false)
+
+	fn.Instructions = ins
+	for i, offset := range fn.DefaultOffsets {
+		fn.DefaultOffsets[i] = relocate(offset)
+	}
+	fn.Handlers = relocateHandlers(fn.Handlers, relocate)
+	fn.Positions = relocatePositions(fn.Positions, relocate, len(ins))
+}
+
+// relocateHandlers returns the handler table with relocated positions.
+func relocateHandlers(handlers []object.ExceptionHandler, relocate func(int) int) []object.ExceptionHandler {
+	if handlers == nil {
+		return nil
+	}
+
+	relocated := make([]object.ExceptionHandler, len(handlers))
+	for i, h := range handlers {
+		relocated[i] = object.ExceptionHandler{
+			Start:  relocate(h.Start),
+			End:    relocate(h.End),
+			Target: relocate(h.Target),
+		}
+	}
+
+	return relocated
+}
+
+// relocatePositions returns the line table with relocated offsets, entries of
+// removed instructions move to the next remaining instruction where they are
+// superseded by the entry of that instruction if any.
+func relocatePositions(positions []object.SourcePosition, relocate func(int) int, size int) []object.SourcePosition {
+	if positions == nil {
+		return nil
+	}
+
+	relocated := make([]object.SourcePosition, 0, len(positions))
+	for _, p := range positions {
+		offset := relocate(p.Offset)
+		if offset >= size {
+			break
+		}
+		if n := len(relocated); n > 0 && relocated[n-1].Offset == offset {
+			relocated = relocated[:n-1]
+		}
+		if n := len(relocated); n > 0 && relocated[n-1].Pos == p.Pos {
+			continue
+		}
+		relocated = append(relocated, object.SourcePosition{Offset: offset, Pos: p.Pos})
+	}
+
+	return relocated
+}
+
+// optimize returns the optimized instructions and the function relocating
+// positions of the original instructions, offsets and handlers hold the
+// positions that must stay instruction boundaries.
+func optimize(ins code.Instructions, offsets []int, handlers []object.ExceptionHandler, keepLastPop bool) (code.Instructions, func(int) int) {
+	p := &peephole{
+		entries:     make(map[int]bool),
+		keepLastPop: keepLastPop,
+	}
+	for _, offset := range offsets {
+		p.entries[offset] = true
+	}
+	for _, h := range handlers {
+		p.entries[h.Start] = true
+		p.entries[h.End] = true
+		p.entries[h.Target] = true
+	}
+
+	for i := 0; i < len(ins); {
+		op, operands, read, err := code.ReadInstruction(ins[i:])
+		if err != nil {
+			// instructions that can't be decoded are left untouched
+			return ins, func(pos int) int { return pos }
+		}
+		p.ins = append(p.ins, instruction{op: op, operands: operands, pos: i})
+		i += read
+	}
+
+	for p.rewrite() {
+	}
+
+	return p.encode()
+}
+
+// labels returns the positions of the instructions that can be entered other
+// than by falling through from the previous instruction, a position whose
+// instruction was removed labels the next remaining instruction.
+func (p *peephole) labels() map[int]bool {
+	labels := make(map[int]bool, len(p.entries))
+	label := func(pos int) {
+		if j := p.at(pos); j != -1 {
+			labels[p.ins[j].pos] = true
+		}
+	}
+	for pos := range p.entries {
+		label(pos)
+	}
+	for _, in := range p.ins {
+		if jumpOps[in.op] {
+			label(in.operands[0])
+		}
+	}
+
+	return labels
+}
+
+// at returns the index of the instruction at an original position, -1 when
+// the position is past the last instruction.
+func (p *peephole) at(pos int) int {
+	i := sort.Search(len(p.ins), func(i int) bool { return p.ins[i].pos >= pos })
+	if i == len(p.ins) {
+		return -1
+	}
+
+	return i
+}
+
+// rewrite applies one round of rewrites and reports whether any applied.
+func (p *peephole) rewrite() bool {
+	labels := p.labels()
+	changed := false
+	kept := make([]instruction, 0, len(p.ins))
+
+	for i := 0; i < len(p.ins); i++ {
+		in := p.ins[i]
+
+		if jumpOps[in.op] {
+			if target := p.threadJump(in.operands[0]); target != in.operands[0] {
+				in.operands = []int{target}
+				changed = true
+			}
+			if in.op == code.OpJump {
+				if j := p.at(in.operands[0]); j != -1 && (p.ins[j].op == code.OpReturnValue || p.ins[j].op == code.OpReturn) {
+					in = instruction{op: p.ins[j].op, operands: []int{}, pos: in.pos}
+					changed = true
+				}
+			}
+			if in.op == code.OpJump && p.isNext(i, in.operands[0]) {
+				changed = true
+				continue
+			}
+		}
+
+		if i+1 < len(p.ins) && !labels[p.ins[i+1].pos] {
+			next := p.ins[i+1]
+			switch {
+			case in.op == code.OpTrue && next.op == code.OpJNE:
+				i++
+				changed = true
+				continue
+			case (in.op == code.OpFalse || in.op == code.OpNull) && next.op == code.OpJNE:
+				kept = append(kept, instruction{op: code.OpJump, operands: next.operands, pos: in.pos})
+				i++
+				changed = true
+				continue
+			case pureOps[in.op] && next.op == code.OpPop && !(p.keepLastPop && i+2 == len(p.ins)):
+				i++
+				changed = true
+				continue
+			}
+		}
+
+		kept = append(kept, in)
+
+		if terminalOps[in.op] {
+			// skip the unreachable instructions following a terminal one
+			for i+1 < len(p.ins) && !labels[p.ins[i+1].pos] {
+				i++
+				changed = true
+			}
+		}
+	}
+
+	p.ins = kept
+
+	return changed
+}
+
+// threadJump returns the final target of a chain of jumps.
+func (p *peephole) threadJump(target int) int {
+	seen := map[int]bool{}
+	for !seen[target] {
+		seen[target] = true
+		j := p.at(target)
+		if j == -1 || p.ins[j].op != code.OpJump {
+			break
+		}
+		target = p.ins[j].operands[0]
+	}
+
+	return target
+}
+
+// isNext reports whether execution continues at the instruction following
+// the i-th one when jumping to target.
+func (p *peephole) isNext(i int, target int) bool {
+	j := p.at(target)
+	if j == -1 {
+		return i+1 == len(p.ins)
+	}
+
+	return j == i+1
+}
+
+// encode encodes the optimized instructions and returns them with the function
+// relocating original positions, a position whose instruction was removed is
+// relocated to the next remaining instruction.
+func (p *peephole) encode() (code.Instructions, func(int) int) {
+	// jumps are never wide, their width doesn't depend on relocated operands
+	positions := make(map[int]int, len(p.ins))
+	offset := 0
+	for _, in := range p.ins {
+		positions[in.pos] = offset
+		offset += len(in.encode(in.operands))
+	}
+	size := offset
+
+	relocate := func(pos int) int {
+		if j := p.at(pos); j != -1 {
+			return positions[p.ins[j].pos]
+		}
+		return size
+	}
+
+	ins := make(code.Instructions, 0, size)
+	for _, in := range p.ins {
+		operands := in.operands
+		if jumpOps[in.op] {
+			operands = []int{relocate(in.operands[0])}
+		}
+		ins = append(ins, in.encode(operands)...)
+	}
+
+	return ins, relocate
+}
+
+// encode encodes the instruction with the given operands, operands were
+// decoded from valid instructions and always fit.
+func (in instruction) encode(operands []int) []byte {
+	inst, _ := code.Encode(in.op, operands...)
+	return inst
+}
@@ -1,5 +1,7 @@
 package compiler
 
+import "github.com/actuallyachraf/monkey-giggle/token"
+
 // SymbolScope represents the scope of a symbol
 type SymbolScope string
 
@@ -27,6 +29,12 @@ type SymbolTable struct {
 	FreeSyms       []Symbol
 	store          map[string]Symbol
 	numDefinitions int
+	// definitions maps the names defined with a position to the position
+	// of the identifier defining them
+	definitions map[string]token.Position
+	// names holds the name of every definition by index, shadowed
+	// definitions included
+	names []string
 }
 
 // NewSymbolTable creates a new symbol table instance.
@@ -35,6 +43,7 @@ func NewSymbolTable() *SymbolTable {
 		FreeSyms:       []Symbol{},
 		store:          make(map[string]Symbol),
 		numDefinitions: 0,
+		definitions:    make(map[string]token.Position),
 	}
 }
 
@@ -57,10 +66,50 @@ func (s *SymbolTable) Define(name string) Symbol {
 
 	s.store[name] = sym
 	s.numDefinitions++
+	s.names = append(s.names, name)
+	delete(s.definitions, name)
+
+	return sym
+}
+
+// DefineAt defines a new symbol for an identifier at a position of the source.
+func (s *SymbolTable) DefineAt(name string, pos token.Position) Symbol {
+	sym := s.Define(name)
+	s.definitions[name] = pos
 
 	return sym
 }
 
+// Definition returns the position of the identifier defining the symbol a
+// name resolves to, builtins and symbols defined without a position have none.
+func (s *SymbolTable) Definition(name string) (token.Position, bool) {
+	for table := s; table != nil; table = table.Outer {
+		sym, ok := table.store[name]
+		if !ok || sym.Scope == FreeScope {
+			continue
+		}
+		pos, ok := table.definitions[name]
+		return pos, ok
+	}
+
+	return token.Position{}, false
+}
+
+// Names returns the names of the symbols defined in the table by index.
+func (s *SymbolTable) Names() []string {
+	return s.names
+}
+
+// FreeNames returns the names of the free symbols by index.
+func (s *SymbolTable) FreeNames() []string {
+	names := make([]string, len(s.FreeSyms))
+	for i, sym := range s.FreeSyms {
+		names[i] = sym.Name
+	}
+
+	return names
+}
+
 // Resolve a symbol by it's name
 func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
 	obj, ok := s.store[name]
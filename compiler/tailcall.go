@@ -0,0 +1,62 @@
+package compiler
+
+import (
+	"github.com/actuallyachraf/monkey-giggle/code"
+)
+
+// tailcall.go marks the calls in tail position of compiled functions, a call
+// is in tail position when the function returns its value right away, either
+// because the next instruction is an OpReturnValue or because it jumps to one
+// (the last expression of the branches of a conditional or a match).
+//
+// Such calls are rewritten to OpTailCall and OpTailCallSpread which have the
+// same width as OpCall and OpCallSpread, no position moves and the rewrite can
+// run after the peephole optimizer.
+
+// tailCalls maps call opcodes to their tail call variant.
+var tailCalls = map[code.OpCode]code.OpCode{
+	code.OpCall:       code.OpTailCall,
+	code.OpCallSpread: code.OpTailCallSpread,
+}
+
+// markTailCalls rewrites the calls in tail position of a function's
+// instructions to tail calls.
+func markTailCalls(ins code.Instructions) {
+	for i := 0; i < len(ins); {
+		op, _, read, err := code.ReadInstruction(ins[i:])
+		if err != nil {
+			return
+		}
+		next := i + read
+
+		if tail, ok := tailCalls[op]; ok && returnsAt(ins, next) {
+			at := i
+			if code.OpCode(ins[i]) == code.OpWide {
+				// the opcode follows the prefix of wide calls
+				at++
+			}
+			ins[at] = byte(tail)
+		}
+
+		i = next
+	}
+}
+
+// returnsAt reports whether execution continuing at pos reaches an
+// OpReturnValue through unconditional jumps only.
+func returnsAt(ins code.Instructions, pos int) bool {
+	seen := map[int]bool{}
+	for pos < len(ins) && !seen[pos] {
+		seen[pos] = true
+		switch code.OpCode(ins[pos]) {
+		case code.OpReturnValue:
+			return true
+		case code.OpJump:
+			pos = int(code.ReadUint16(ins[pos+1:]))
+		default:
+			return false
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,498 @@
+// Package dap implements a Debug Adapter Protocol server for giggle programs,
+// the server launches a program in the VM with a debugger attached and lets
+// editors set breakpoints, step through the program and inspect its frames.
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/actuallyachraf/monkey-giggle/compiler"
+	"github.com/actuallyachraf/monkey-giggle/framing"
+	"github.com/actuallyachraf/monkey-giggle/lexer"
+	"github.com/actuallyachraf/monkey-giggle/macro"
+	"github.com/actuallyachraf/monkey-giggle/module"
+	"github.com/actuallyachraf/monkey-giggle/object"
+	"github.com/actuallyachraf/monkey-giggle/parser"
+	"github.com/actuallyachraf/monkey-giggle/vm"
+)
+
+// threadID is the identifier of the only thread of giggle programs.
+const threadID = 1
+
+// resumeActions maps the requests resuming the program to their action.
+var resumeActions = map[string]vm.Action{
+	"continue": vm.Continue,
+	"next":     vm.StepOver,
+	"stepIn":   vm.StepIn,
+	"stepOut":  vm.StepOut,
+}
+
+// Server is a Debug Adapter Protocol server debugging a single program.
+type Server struct {
+	in *bufio.Reader
+
+	// mu guards the output and the state shared with the program
+	mu  sync.Mutex
+	out io.Writer
+	seq int
+
+	machine  *vm.VM
+	debugger *vm.Debugger
+	// launched and configured are set by the launch and configurationDone
+	// requests, the program starts once both were received
+	launched   bool
+	configured bool
+	running    bool
+	stopped    bool
+	// resume passes the action resuming the stopped program
+	resume chan vm.Action
+
+	// references maps the variables references handed to the client since
+	// the last stop to the variables they reference
+	references []func() []Variable
+}
+
+// NewServer creates a new server reading requests from in and writing
+// responses and events to out.
+func NewServer(in io.Reader, out io.Writer) *Server {
+	s := &Server{
+		in:     bufio.NewReader(in),
+		out:    out,
+		resume: make(chan vm.Action),
+	}
+	s.debugger = vm.NewDebugger(s.stop)
+
+	return s
+}
+
+// Serve handles requests until the client disconnects or the input ends.
+func (s *Server) Serve() error {
+	for {
+		content, err := framing.Read(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req Request
+		err = json.Unmarshal(content, &req)
+		if err != nil {
+			return fmt.Errorf("invalid message: %s", err)
+		}
+		if req.Type != "request" {
+			continue
+		}
+		if req.Command == "disconnect" {
+			s.respond(req, nil)
+			s.abort()
+			return nil
+		}
+
+		body, err := s.handle(req)
+		if err != nil {
+			s.respondError(req, err)
+			continue
+		}
+		s.respond(req, body)
+
+		// the program runs again after the response so it precedes the
+		// events of the next stop
+		if action, ok := resumeActions[req.Command]; ok {
+			s.resume <- action
+		}
+		switch req.Command {
+		case "initialize":
+			s.event("initialized", nil)
+		case "launch", "configurationDone":
+			s.start()
+		}
+	}
+}
+
+// handle executes a request and returns the body of its response.
+func (s *Server) handle(req Request) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return Capabilities{SupportsConfigurationDoneRequest: true}, nil
+	case "launch":
+		var args LaunchArguments
+		if err := decode(req, &args); err != nil {
+			return nil, err
+		}
+		return nil, s.launch(args)
+	case "configurationDone":
+		s.mu.Lock()
+		s.configured = true
+		s.mu.Unlock()
+		return nil, nil
+	case "setBreakpoints":
+		var args SetBreakpointsArguments
+		if err := decode(req, &args); err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(args), nil
+	case "threads":
+		return map[string][]Thread{"threads": {{ID: threadID, Name: "main"}}}, nil
+	case "stackTrace":
+		var args StackTraceArguments
+		if err := decode(req, &args); err != nil {
+			return nil, err
+		}
+		return s.stackTrace(args)
+	case "scopes":
+		var args ScopesArguments
+		if err := decode(req, &args); err != nil {
+			return nil, err
+		}
+		return s.scopes(args)
+	case "variables":
+		var args VariablesArguments
+		if err := decode(req, &args); err != nil {
+			return nil, err
+		}
+		return s.variables(args)
+	case "continue":
+		return map[string]bool{"allThreadsContinued": true}, s.resumed()
+	case "next", "stepIn", "stepOut":
+		return nil, s.resumed()
+	default:
+		return nil, fmt.Errorf("unsupported request %s", req.Command)
+	}
+}
+
+// launch compiles the program to debug, it's compiled without optimizations
+// so every line can be stepped through.
+func (s *Server) launch(args LaunchArguments) error {
+	if args.Program == "" {
+		return fmt.Errorf("launch requires a program")
+	}
+	file, err := filepath.Abs(args.Program)
+	if err != nil {
+		return err
+	}
+	src, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.Parse()
+	if errs := p.SyntaxErrors(); len(errs) != 0 {
+		return fmt.Errorf("%s:%s: %s", file, errs[0].Pos, errs[0].Msg)
+	}
+
+	program, err = macro.Expand(program)
+	if err != nil {
+		if merr, ok := err.(macro.Error); ok {
+			return fmt.Errorf("%s:%s: %s", file, merr.Pos, err)
+		}
+		return fmt.Errorf("%s: %s", file, err)
+	}
+
+	paths := append([]string{filepath.Dir(file)}, module.DefaultPaths()...)
+	loader := module.NewLoader(paths...)
+	loader.Expand = macro.Expand
+	comp := compiler.New()
+	comp.SetLoader(loader)
+	comp.SetFile(file)
+	comp.SetFolding(false)
+	comp.SetPeephole(false)
+	comp.SetTailCalls(false)
+	err = comp.Compile(program)
+	if err != nil {
+		location := file
+		if cerr, ok := err.(*compiler.CompileError); ok && cerr.Location() != "" {
+			location = cerr.Location()
+		}
+		return fmt.Errorf("%s: compilation failed: %s", location, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.launched {
+		return fmt.Errorf("a program was already launched")
+	}
+	s.machine = vm.New(comp.Bytecode())
+	s.debugger.StopOnEntry = args.StopOnEntry
+	s.machine.SetDebugger(s.debugger)
+	s.launched = true
+
+	return nil
+}
+
+// start runs the program once it's launched and configured.
+func (s *Server) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.launched || !s.configured || s.running {
+		return
+	}
+	s.running = true
+
+	go s.run()
+}
+
+// run runs the program and reports its end.
+func (s *Server) run() {
+	err := s.machine.Run()
+	if err == vm.ErrAborted {
+		return
+	}
+
+	exitCode := 0
+	switch {
+	case err != nil:
+		exitCode = 1
+		location := ""
+		if rerr, ok := err.(*vm.RuntimeError); ok && rerr.Location() != "" {
+			location = rerr.Location() + ": "
+		}
+		s.event("output", OutputEvent{Category: "stderr", Output: location + err.Error() + "\n"})
+	default:
+		if last := s.machine.LastPoppedStackElem(); last != nil && last != vm.Null {
+			s.event("output", OutputEvent{Category: "stdout", Output: last.Inspect() + "\n"})
+		}
+	}
+	s.event("exited", ExitedEvent{ExitCode: exitCode})
+	s.event("terminated", nil)
+}
+
+// stop reports a stop to the client and waits for the request resuming the
+// program.
+func (s *Server) stop(stop vm.Stop) vm.Action {
+	s.mu.Lock()
+	s.stopped = true
+	s.references = nil
+	s.mu.Unlock()
+
+	s.event("stopped", StoppedEvent{Reason: string(stop.Reason), ThreadID: threadID, AllThreadsStopped: true})
+
+	return <-s.resume
+}
+
+// resumed marks the stopped program as running before it's resumed.
+func (s *Server) resumed() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stopped {
+		return fmt.Errorf("the program is not stopped")
+	}
+	s.stopped = false
+
+	return nil
+}
+
+// abort ends the program if it's stopped.
+func (s *Server) abort() {
+	s.mu.Lock()
+	stopped := s.stopped
+	s.stopped = false
+	s.mu.Unlock()
+
+	if stopped {
+		s.resume <- vm.Abort
+	}
+}
+
+// setBreakpoints replaces the breakpoints of a source file.
+func (s *Server) setBreakpoints(args SetBreakpointsArguments) interface{} {
+	// programs are compiled with absolute paths
+	file, err := filepath.Abs(args.Source.Path)
+	if err != nil {
+		file = args.Source.Path
+	}
+
+	s.debugger.ClearBreakpoints(file)
+	breakpoints := make([]Breakpoint, len(args.Breakpoints))
+	for i, bp := range args.Breakpoints {
+		s.debugger.SetBreakpoint(file, bp.Line)
+		breakpoints[i] = Breakpoint{Verified: true, Line: bp.Line}
+	}
+
+	return map[string][]Breakpoint{"breakpoints": breakpoints}
+}
+
+// stackTrace returns the call frames of the stopped program, frames are
+// identified by their index starting from the innermost one plus one.
+func (s *Server) stackTrace(args StackTraceArguments) (interface{}, error) {
+	if err := s.checkStopped(); err != nil {
+		return nil, err
+	}
+
+	trace := s.machine.StackTrace()
+	frames := []StackFrame{}
+	for i := args.StartFrame; i < len(trace); i++ {
+		if args.Levels > 0 && len(frames) == args.Levels {
+			break
+		}
+		frame := StackFrame{
+			ID:     i + 1,
+			Name:   trace[i].Function,
+			Line:   trace[i].Pos.Line,
+			Column: trace[i].Pos.Column,
+		}
+		switch {
+		case i == len(trace)-1:
+			frame.Name = "<main>"
+		case frame.Name == "":
+			frame.Name = "<anonymous>"
+		}
+		if trace[i].File != "" {
+			frame.Source = &Source{Name: filepath.Base(trace[i].File), Path: trace[i].File}
+		}
+		frames = append(frames, frame)
+	}
+
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(trace)}, nil
+}
+
+// scopes returns the scopes of a frame : its local bindings, its free
+// variables and the global bindings.
+func (s *Server) scopes(args ScopesArguments) (interface{}, error) {
+	if err := s.checkStopped(); err != nil {
+		return nil, err
+	}
+
+	frame := args.FrameID - 1
+	if frame < 0 || frame >= len(s.machine.StackTrace()) {
+		return nil, fmt.Errorf("unknown frame %d", args.FrameID)
+	}
+	scopes := []Scope{
+		{Name: "Locals", VariablesReference: s.reference(func() []Variable { return s.toVariables(s.machine.Locals(frame)) })},
+		{Name: "Free variables", VariablesReference: s.reference(func() []Variable { return s.toVariables(s.machine.FreeVariables(frame)) })},
+		{Name: "Globals", VariablesReference: s.reference(func() []Variable { return s.toVariables(s.machine.Globals()) })},
+	}
+
+	return map[string][]Scope{"scopes": scopes}, nil
+}
+
+// variables returns the variables of a scope or the elements of a value.
+func (s *Server) variables(args VariablesArguments) (interface{}, error) {
+	if err := s.checkStopped(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	index := args.VariablesReference - 1
+	if index < 0 || index >= len(s.references) {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("unknown variables reference %d", args.VariablesReference)
+	}
+	variables := s.references[index]
+	s.mu.Unlock()
+
+	return map[string][]Variable{"variables": variables()}, nil
+}
+
+// checkStopped returns an error unless the program is stopped.
+func (s *Server) checkStopped() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stopped {
+		return fmt.Errorf("the program is not stopped")
+	}
+
+	return nil
+}
+
+// reference registers the variables of a reference and returns it.
+func (s *Server) reference(variables func() []Variable) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.references = append(s.references, variables)
+
+	return len(s.references)
+}
+
+// toVariables converts named values to variables.
+func (s *Server) toVariables(vars []vm.Variable) []Variable {
+	variables := make([]Variable, len(vars))
+	for i, v := range vars {
+		variables[i] = s.variable(v.Name, v.Value)
+	}
+
+	return variables
+}
+
+// variable converts a value to a variable, the elements of arrays and
+// hashmaps are given a reference.
+func (s *Server) variable(name string, val object.Object) Variable {
+	v := Variable{Name: name, Value: val.Inspect(), Type: string(val.Type())}
+
+	switch val := val.(type) {
+	case *object.Array:
+		if len(val.Elements) > 0 {
+			v.VariablesReference = s.reference(func() []Variable {
+				elements := make([]Variable, len(val.Elements))
+				for i, elem := range val.Elements {
+					elements[i] = s.variable(fmt.Sprintf("[%d]", i), elem)
+				}
+				return elements
+			})
+		}
+	case *object.HashMap:
+		if len(val.Pairs) > 0 {
+			v.VariablesReference = s.reference(func() []Variable {
+				pairs := make([]Variable, 0, len(val.Pairs))
+				for _, pair := range val.Pairs {
+					pairs = append(pairs, s.variable(pair.Key.Inspect(), pair.Value))
+				}
+				sort.Slice(pairs, func(i, j int) bool { return pairs[i].Name < pairs[j].Name })
+				return pairs
+			})
+		}
+	}
+
+	return v
+}
+
+// respond sends the successful response of a request.
+func (s *Server) respond(req Request, body interface{}) {
+	s.send(&Response{Type: "response", RequestSeq: req.Seq, Success: true, Command: req.Command, Body: body})
+}
+
+// respondError sends the failed response of a request.
+func (s *Server) respondError(req Request, err error) {
+	s.send(&Response{Type: "response", RequestSeq: req.Seq, Success: false, Command: req.Command, Message: err.Error()})
+}
+
+// event sends an event.
+func (s *Server) event(name string, body interface{}) {
+	s.send(&Event{Type: "event", Event: name, Body: body})
+}
+
+// send numbers and writes a response or an event.
+func (s *Server) send(msg interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	switch msg := msg.(type) {
+	case *Response:
+		msg.Seq = s.seq
+	case *Event:
+		msg.Seq = s.seq
+	}
+	framing.Write(s.out, msg)
+}
+
+// decode decodes the arguments of a request.
+func decode(req Request, args interface{}) error {
+	if len(req.Arguments) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(req.Arguments, args); err != nil {
+		return fmt.Errorf("invalid arguments for %s: %s", req.Command, err)
+	}
+
+	return nil
+}
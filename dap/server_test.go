@@ -0,0 +1,357 @@
+package dap
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/actuallyachraf/monkey-giggle/framing"
+)
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	program := filepath.Join(dir, "main.gg")
+	source := `let make = fn(k) {
+  fn(v) {
+    let r = [v, k];
+    r
+  }
+};
+let f = make(3);
+let x = f(1);
+len(x)`
+	if err := ioutil.WriteFile(program, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	failing := filepath.Join(dir, "failing.gg")
+	if err := ioutil.WriteFile(failing, []byte("let f = fn(x) {\n  x / 0\n};\nf(1)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	macros := filepath.Join(dir, "macros.gg")
+	source = `let unless = macro(cond, then) { quote(if (!unquote(cond)) { unquote(then) }) };
+let {four} = import "twice";
+unless(false, 42) + four`
+	if err := ioutil.WriteFile(macros, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	twice := "let twice = macro(x) { quote(unquote(x) * 2) };\nexport let four = twice(2);"
+	if err := ioutil.WriteFile(filepath.Join(dir, "twice.gg"), []byte(twice), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("TestSession", func(t *testing.T) {
+		c := newClient(t)
+
+		c.request("initialize", map[string]string{"adapterID": "giggle"})
+		var capabilities Capabilities
+		c.expectResponse("initialize", &capabilities)
+		if !capabilities.SupportsConfigurationDoneRequest {
+			t.Errorf("expected configurationDone to be supported")
+		}
+		c.expectEvent("initialized", nil)
+
+		c.request("launch", LaunchArguments{Program: program})
+		c.expectResponse("launch", nil)
+
+		c.request("setBreakpoints", SetBreakpointsArguments{Source: Source{Path: program}, Breakpoints: []SourceBreakpoint{{Line: 4}}})
+		var breakpoints struct{ Breakpoints []Breakpoint }
+		c.expectResponse("setBreakpoints", &breakpoints)
+		if len(breakpoints.Breakpoints) != 1 || !breakpoints.Breakpoints[0].Verified || breakpoints.Breakpoints[0].Line != 4 {
+			t.Errorf("wrong breakpoints got %+v", breakpoints.Breakpoints)
+		}
+
+		c.request("configurationDone", nil)
+		c.expectResponse("configurationDone", nil)
+		c.expectStop("breakpoint")
+
+		c.request("threads", nil)
+		var threads struct{ Threads []Thread }
+		c.expectResponse("threads", &threads)
+		if len(threads.Threads) != 1 || threads.Threads[0].ID != threadID {
+			t.Errorf("wrong threads got %+v", threads.Threads)
+		}
+
+		c.expectStackTrace([]StackFrame{
+			{ID: 1, Name: "<anonymous>", Source: &Source{Name: "main.gg", Path: program}, Line: 4, Column: 5},
+			{ID: 2, Name: "<main>", Source: &Source{Name: "main.gg", Path: program}, Line: 8, Column: 10},
+		})
+
+		c.request("scopes", ScopesArguments{FrameID: 1})
+		var scopes struct{ Scopes []Scope }
+		c.expectResponse("scopes", &scopes)
+		names := []string{}
+		for _, scope := range scopes.Scopes {
+			names = append(names, scope.Name)
+		}
+		if len(names) != 3 || names[0] != "Locals" || names[1] != "Free variables" || names[2] != "Globals" {
+			t.Fatalf("wrong scopes got %v", names)
+		}
+
+		locals := c.expectVariables(scopes.Scopes[0].VariablesReference, []Variable{
+			{Name: "v", Value: "1", Type: "INTEGER"},
+			{Name: "r", Value: "[1, 3]", Type: "ARRAY", VariablesReference: -1},
+		})
+		c.expectVariables(locals[1].VariablesReference, []Variable{
+			{Name: "[0]", Value: "1", Type: "INTEGER"},
+			{Name: "[1]", Value: "3", Type: "INTEGER"},
+		})
+		c.expectVariables(scopes.Scopes[1].VariablesReference, []Variable{
+			{Name: "k", Value: "3", Type: "INTEGER"},
+		})
+
+		c.request("next", nil)
+		c.expectResponse("next", nil)
+		c.expectStop("step")
+		c.expectStackTrace([]StackFrame{
+			{ID: 1, Name: "<main>", Source: &Source{Name: "main.gg", Path: program}, Line: 9, Column: 1},
+		})
+
+		c.request("stepIn", nil)
+		c.expectResponse("stepIn", nil)
+		var output OutputEvent
+		c.expectEvent("output", &output)
+		if output.Category != "stdout" || output.Output != "2\n" {
+			t.Errorf("wrong output got %+v", output)
+		}
+		var exited ExitedEvent
+		c.expectEvent("exited", &exited)
+		if exited.ExitCode != 0 {
+			t.Errorf("wrong exit code expected 0 got %d", exited.ExitCode)
+		}
+		c.expectEvent("terminated", nil)
+
+		c.request("disconnect", nil)
+		c.expectResponse("disconnect", nil)
+		c.close()
+	})
+	t.Run("TestStepping", func(t *testing.T) {
+		c := newClient(t)
+
+		c.request("launch", LaunchArguments{Program: program, StopOnEntry: true})
+		c.expectResponse("launch", nil)
+		c.request("configurationDone", nil)
+		c.expectResponse("configurationDone", nil)
+		c.expectStop("entry")
+
+		lines := []int{}
+		for _, step := range []string{"next", "stepIn", "next", "stepIn", "stepOut"} {
+			c.request(step, nil)
+			c.expectResponse(step, nil)
+			c.expectStop("step")
+			c.request("stackTrace", StackTraceArguments{ThreadID: threadID, Levels: 1})
+			var trace struct{ StackFrames []StackFrame }
+			c.expectResponse("stackTrace", &trace)
+			lines = append(lines, trace.StackFrames[0].Line)
+		}
+		expected := []int{7, 2, 8, 3, 9}
+		for i := range expected {
+			if lines[i] != expected[i] {
+				t.Fatalf("wrong stepped lines expected %v got %v", expected, lines)
+			}
+		}
+
+		// disconnecting aborts the stopped program
+		c.request("disconnect", nil)
+		c.expectResponse("disconnect", nil)
+		c.close()
+	})
+	t.Run("TestMacros", func(t *testing.T) {
+		c := newClient(t)
+
+		// macros of the program and of the modules it imports are expanded
+		c.request("launch", LaunchArguments{Program: macros})
+		c.expectResponse("launch", nil)
+		c.request("configurationDone", nil)
+		c.expectResponse("configurationDone", nil)
+
+		var output OutputEvent
+		c.expectEvent("output", &output)
+		if output.Category != "stdout" || output.Output != "46\n" {
+			t.Errorf("wrong output got %+v", output)
+		}
+		var exited ExitedEvent
+		c.expectEvent("exited", &exited)
+		if exited.ExitCode != 0 {
+			t.Errorf("wrong exit code expected 0 got %d", exited.ExitCode)
+		}
+		c.expectEvent("terminated", nil)
+		c.close()
+	})
+	t.Run("TestErrors", func(t *testing.T) {
+		c := newClient(t)
+
+		c.request("stackTrace", StackTraceArguments{ThreadID: threadID})
+		c.expectError("stackTrace", "the program is not stopped")
+		c.request("continue", nil)
+		c.expectError("continue", "the program is not stopped")
+		c.request("attach", nil)
+		c.expectError("attach", "unsupported request attach")
+		c.request("launch", LaunchArguments{})
+		c.expectError("launch", "launch requires a program")
+
+		c.request("launch", LaunchArguments{Program: failing})
+		c.expectResponse("launch", nil)
+		c.request("launch", LaunchArguments{Program: failing})
+		c.expectError("launch", "a program was already launched")
+		c.request("configurationDone", nil)
+		c.expectResponse("configurationDone", nil)
+
+		var output OutputEvent
+		c.expectEvent("output", &output)
+		if output.Category != "stderr" || output.Output != failing+":2:5: division by zero\n" {
+			t.Errorf("wrong output got %+v", output)
+		}
+		var exited ExitedEvent
+		c.expectEvent("exited", &exited)
+		if exited.ExitCode != 1 {
+			t.Errorf("wrong exit code expected 1 got %d", exited.ExitCode)
+		}
+		c.expectEvent("terminated", nil)
+		c.close()
+	})
+}
+
+// client is a scripted client of a server running in the background.
+type client struct {
+	t    *testing.T
+	conn *framing.Client
+	seq  int
+}
+
+// message holds the fields of responses and events.
+type message struct {
+	Type    string
+	Command string
+	Event   string
+	Success bool
+	Message string
+	Body    json.RawMessage
+}
+
+// newClient starts a server and returns a client connected to it.
+func newClient(t *testing.T) *client {
+	conn := framing.NewClient(func(in io.Reader, out io.Writer) error {
+		return NewServer(in, out).Serve()
+	})
+
+	return &client{t: t, conn: conn}
+}
+
+// request sends a request.
+func (c *client) request(command string, args interface{}) {
+	c.seq++
+	req := map[string]interface{}{"seq": c.seq, "type": "request", "command": command}
+	if args != nil {
+		req["arguments"] = args
+	}
+	if err := c.conn.Send(req); err != nil {
+		c.t.Fatalf("failed to send %s : %s", command, err)
+	}
+}
+
+// next reads the next message.
+func (c *client) next() message {
+	var msg message
+	if err := c.conn.Receive(&msg); err != nil {
+		c.t.Fatalf("failed to read a message : %s", err)
+	}
+
+	return msg
+}
+
+// decode decodes the body of a message.
+func (c *client) decode(msg message, body interface{}) {
+	if body == nil {
+		return
+	}
+	if err := json.Unmarshal(msg.Body, body); err != nil {
+		c.t.Fatalf("invalid body %s : %s", msg.Body, err)
+	}
+}
+
+// expectResponse reads the successful response of a command.
+func (c *client) expectResponse(command string, body interface{}) {
+	msg := c.next()
+	if msg.Type != "response" || msg.Command != command || !msg.Success {
+		c.t.Fatalf("expected a successful %s response got %+v", command, msg)
+	}
+	c.decode(msg, body)
+}
+
+// expectError reads the failed response of a command.
+func (c *client) expectError(command string, expected string) {
+	msg := c.next()
+	if msg.Type != "response" || msg.Command != command || msg.Success || msg.Message != expected {
+		c.t.Fatalf("expected a failed %s response with message %q got %+v", command, expected, msg)
+	}
+}
+
+// expectEvent reads an event.
+func (c *client) expectEvent(event string, body interface{}) {
+	msg := c.next()
+	if msg.Type != "event" || msg.Event != event {
+		c.t.Fatalf("expected a %s event got %+v", event, msg)
+	}
+	c.decode(msg, body)
+}
+
+// expectStop reads a stopped event.
+func (c *client) expectStop(reason string) {
+	var stopped StoppedEvent
+	c.expectEvent("stopped", &stopped)
+	if stopped.Reason != reason || stopped.ThreadID != threadID {
+		c.t.Fatalf("expected a stop for %s got %+v", reason, stopped)
+	}
+}
+
+// expectStackTrace requests the stack trace and checks its frames.
+func (c *client) expectStackTrace(expected []StackFrame) {
+	c.request("stackTrace", StackTraceArguments{ThreadID: threadID})
+	var trace struct {
+		StackFrames []StackFrame
+		TotalFrames int
+	}
+	c.expectResponse("stackTrace", &trace)
+
+	if len(trace.StackFrames) != len(expected) || trace.TotalFrames != len(expected) {
+		c.t.Fatalf("wrong number of frames expected %d got %+v", len(expected), trace)
+	}
+	for i, frame := range trace.StackFrames {
+		if frame.ID != expected[i].ID || frame.Name != expected[i].Name || frame.Line != expected[i].Line || frame.Column != expected[i].Column || *frame.Source != *expected[i].Source {
+			c.t.Errorf("wrong frame expected %+v got %+v", expected[i], frame)
+		}
+	}
+}
+
+// expectVariables requests variables and checks them, an expected reference
+// of -1 stands for any non zero reference.
+func (c *client) expectVariables(reference int, expected []Variable) []Variable {
+	c.request("variables", VariablesArguments{VariablesReference: reference})
+	var variables struct{ Variables []Variable }
+	c.expectResponse("variables", &variables)
+
+	if len(variables.Variables) != len(expected) {
+		c.t.Fatalf("wrong variables expected %+v got %+v", expected, variables.Variables)
+	}
+	for i, v := range variables.Variables {
+		e := expected[i]
+		if e.VariablesReference == -1 && v.VariablesReference != 0 {
+			e.VariablesReference = v.VariablesReference
+		}
+		if v != e {
+			c.t.Errorf("wrong variable expected %+v got %+v", e, v)
+		}
+	}
+
+	return variables.Variables
+}
+
+// close ends the input of the server and waits for it to return.
+func (c *client) close() {
+	if err := c.conn.Close(); err != nil {
+		c.t.Errorf("Serve failed with error : %s", err)
+	}
+}
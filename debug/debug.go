@@ -0,0 +1,325 @@
+// Package debug implements the text interface of the giggle debugger, a
+// session runs a program in the VM and reads commands whenever the debugger
+// stops to set breakpoints, step through the program and inspect its frames.
+package debug
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/actuallyachraf/monkey-giggle/compiler"
+	"github.com/actuallyachraf/monkey-giggle/object"
+	"github.com/actuallyachraf/monkey-giggle/vm"
+)
+
+// PROMPT marks the debugger prompt.
+const PROMPT = "(debug) "
+
+// listContext is the number of source lines listed around the current one.
+const listContext = 3
+
+const help = `commands :
+  break [file:]line   set a breakpoint, in the file of the selected frame by default
+  clear [file:]line   remove a breakpoint
+  breakpoints         list the breakpoints
+  continue, c         run until the next breakpoint
+  step, s             run until the next line, entering calls
+  next, n             run until the next line, stepping over calls
+  out, o              run until the calling function resumes
+  bt                  print the call frames
+  frame n             select the n-th call frame
+  list, l             list the source around the selected frame
+  locals              print the local bindings of the selected frame
+  free                print the free variables of the selected frame
+  globals             print the global bindings
+  stack               print the operand stack of the selected frame
+  print name, p name  print a binding of the selected frame
+  quit, q             abort the program
+  help, h             print this help
+`
+
+// Session is a debugging session of a compiled program.
+type Session struct {
+	vm       *vm.VM
+	debugger *vm.Debugger
+
+	in  *bufio.Scanner
+	out io.Writer
+
+	// source returns the source of a file, sources caches its lines
+	source  func(file string) ([]byte, error)
+	sources map[string][]string
+
+	// selected is the index of the inspected frame starting from the
+	// innermost one
+	selected int
+}
+
+// New creates a new session running bytecode, commands are read from in and
+// the output written to out. Source files are read using source.
+func New(bytecode compiler.Bytecode, source func(file string) ([]byte, error), in io.Reader, out io.Writer) *Session {
+	s := &Session{
+		vm:      vm.New(bytecode),
+		in:      bufio.NewScanner(in),
+		out:     out,
+		source:  source,
+		sources: make(map[string][]string),
+	}
+	s.debugger = vm.NewDebugger(s.stop)
+	s.debugger.StopOnEntry = true
+	s.vm.SetDebugger(s.debugger)
+
+	return s
+}
+
+// Run runs the program until it ends or is aborted, the error that ended the
+// program is returned if any.
+func (s *Session) Run() error {
+	err := s.vm.Run()
+	switch {
+	case err == vm.ErrAborted:
+		fmt.Fprintln(s.out, "program aborted")
+	case err != nil:
+		location := ""
+		if rerr, ok := err.(*vm.RuntimeError); ok && rerr.Location() != "" {
+			location = rerr.Location() + ": "
+		}
+		fmt.Fprintf(s.out, "program failed: %s%s\n", location, err)
+	default:
+		fmt.Fprintln(s.out, "program exited")
+		if last := s.vm.LastPoppedStackElem(); last != nil && last != vm.Null {
+			fmt.Fprintln(s.out, last.Inspect())
+		}
+	}
+
+	return err
+}
+
+// stop reports a stop of the debugger and runs commands until one resumes
+// execution, the end of the input aborts the program.
+func (s *Session) stop(stop vm.Stop) vm.Action {
+	s.selected = 0
+	fmt.Fprintf(s.out, "%s at %s in %s\n", stop.Reason, location(stop.StackFrame), s.function(0))
+	s.printLine(stop.File, stop.Pos.Line)
+
+	for {
+		fmt.Fprint(s.out, PROMPT)
+		if !s.in.Scan() {
+			fmt.Fprintln(s.out)
+			return vm.Abort
+		}
+
+		fields := strings.Fields(s.in.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if action, ok := s.execute(fields[0], fields[1:]); ok {
+			return action
+		}
+	}
+}
+
+// execute runs a command and returns the action resuming execution if the
+// command resumes it.
+func (s *Session) execute(cmd string, args []string) (vm.Action, bool) {
+	switch cmd {
+	case "continue", "c":
+		return vm.Continue, true
+	case "step", "s":
+		return vm.StepIn, true
+	case "next", "n":
+		return vm.StepOver, true
+	case "out", "o":
+		return vm.StepOut, true
+	case "quit", "q":
+		return vm.Abort, true
+	case "break", "b", "clear":
+		file, line, err := s.parseLocation(args)
+		if err != nil {
+			fmt.Fprintln(s.out, err)
+			break
+		}
+		if cmd == "clear" {
+			s.debugger.ClearBreakpoint(file, line)
+			fmt.Fprintf(s.out, "breakpoint cleared at %s:%d\n", file, line)
+		} else {
+			s.debugger.SetBreakpoint(file, line)
+			fmt.Fprintf(s.out, "breakpoint set at %s:%d\n", file, line)
+		}
+	case "breakpoints":
+		for _, bp := range s.debugger.Breakpoints() {
+			fmt.Fprintf(s.out, "%s:%d\n", bp.File, bp.Line)
+		}
+	case "bt":
+		for i, frame := range s.vm.StackTrace() {
+			marker := " "
+			if i == s.selected {
+				marker = "*"
+			}
+			fmt.Fprintf(s.out, "%s %d %s at %s\n", marker, i, s.function(i), location(frame))
+		}
+	case "frame":
+		n := -1
+		if len(args) == 1 {
+			n, _ = strconv.Atoi(args[0])
+		}
+		if n < 0 || n >= len(s.vm.StackTrace()) {
+			fmt.Fprintln(s.out, "usage : frame n with n the index of a frame listed by bt")
+			break
+		}
+		s.selected = n
+		frame := s.vm.StackTrace()[n]
+		fmt.Fprintf(s.out, "%d %s at %s\n", n, s.function(n), location(frame))
+	case "list", "l":
+		frame := s.vm.StackTrace()[s.selected]
+		s.list(frame.File, frame.Pos.Line)
+	case "locals":
+		s.printVariables(s.vm.Locals(s.selected))
+	case "free":
+		s.printVariables(s.vm.FreeVariables(s.selected))
+	case "globals":
+		s.printVariables(s.vm.Globals())
+	case "stack":
+		for _, obj := range s.vm.OperandStack(s.selected) {
+			fmt.Fprintln(s.out, obj.Inspect())
+		}
+	case "print", "p":
+		if len(args) != 1 {
+			fmt.Fprintln(s.out, "usage : print name")
+			break
+		}
+		val, ok := s.lookup(args[0])
+		if !ok {
+			fmt.Fprintf(s.out, "no binding named %s\n", args[0])
+			break
+		}
+		fmt.Fprintln(s.out, val.Inspect())
+	case "help", "h":
+		fmt.Fprint(s.out, help)
+	default:
+		fmt.Fprintf(s.out, "unknown command %s, type help for the list of commands\n", cmd)
+	}
+
+	return vm.Continue, false
+}
+
+// parseLocation parses the [file:]line argument of breakpoint commands.
+func (s *Session) parseLocation(args []string) (string, int, error) {
+	if len(args) != 1 {
+		return "", 0, fmt.Errorf("usage : break [file:]line")
+	}
+
+	file := s.vm.StackTrace()[s.selected].File
+	spec := args[0]
+	if i := strings.LastIndex(spec, ":"); i != -1 {
+		file, spec = spec[:i], spec[i+1:]
+	}
+	line, err := strconv.Atoi(spec)
+	if err != nil || line <= 0 {
+		return "", 0, fmt.Errorf("invalid line %s", spec)
+	}
+
+	return file, line, nil
+}
+
+// lookup returns the value of a binding visible from the selected frame.
+func (s *Session) lookup(name string) (object.Object, bool) {
+	scopes := [][]vm.Variable{
+		s.vm.Locals(s.selected),
+		s.vm.FreeVariables(s.selected),
+		s.vm.Globals(),
+	}
+	for _, vars := range scopes {
+		// later bindings shadow earlier ones
+		for i := len(vars) - 1; i >= 0; i-- {
+			if vars[i].Name == name {
+				return vars[i].Value, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// printVariables prints named values.
+func (s *Session) printVariables(vars []vm.Variable) {
+	for _, v := range vars {
+		fmt.Fprintf(s.out, "%s = %s\n", v.Name, v.Value.Inspect())
+	}
+}
+
+// printLine prints a line of a source file.
+func (s *Session) printLine(file string, line int) {
+	lines := s.lines(file)
+	if line < 1 || line > len(lines) {
+		return
+	}
+	fmt.Fprintf(s.out, "%d\t%s\n", line, lines[line-1])
+}
+
+// list prints the source lines around a line, the line itself is marked.
+func (s *Session) list(file string, line int) {
+	lines := s.lines(file)
+	if line < 1 || line > len(lines) {
+		fmt.Fprintln(s.out, "no source available")
+		return
+	}
+
+	first, last := line-listContext, line+listContext
+	if first < 1 {
+		first = 1
+	}
+	if last > len(lines) {
+		last = len(lines)
+	}
+	for i := first; i <= last; i++ {
+		marker := "  "
+		if i == line {
+			marker = "=>"
+		}
+		fmt.Fprintf(s.out, "%s %d\t%s\n", marker, i, lines[i-1])
+	}
+}
+
+// lines returns the source lines of a file, none if it can't be read.
+func (s *Session) lines(file string) []string {
+	if lines, ok := s.sources[file]; ok {
+		return lines
+	}
+
+	var lines []string
+	if src, err := s.source(file); err == nil {
+		lines = strings.Split(strings.TrimRight(string(src), "\n"), "\n")
+	}
+	s.sources[file] = lines
+
+	return lines
+}
+
+// location formats the location of a frame.
+func location(frame vm.StackFrame) string {
+	if !frame.Pos.IsValid() {
+		return frame.File
+	}
+	if frame.File == "" {
+		return frame.Pos.String()
+	}
+
+	return frame.File + ":" + frame.Pos.String()
+}
+
+// function returns the display name of the function of the i-th frame.
+func (s *Session) function(i int) string {
+	trace := s.vm.StackTrace()
+	switch {
+	case i == len(trace)-1:
+		return "<main>"
+	case trace[i].Function == "":
+		return "<anonymous>"
+	default:
+		return trace[i].Function
+	}
+}
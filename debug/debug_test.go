@@ -0,0 +1,127 @@
+package debug
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/actuallyachraf/monkey-giggle/compiler"
+	"github.com/actuallyachraf/monkey-giggle/lexer"
+	"github.com/actuallyachraf/monkey-giggle/parser"
+)
+
+func TestDebug(t *testing.T) {
+	source := `let make = fn(k) {
+  fn(v) {
+    let r = v + k;
+    r * 2
+  }
+};
+let f = make(3);
+let x = 100 + f(1);
+f(x)`
+
+	tests := []struct {
+		input    string
+		commands string
+		expected string
+	}{
+		{
+			source,
+			"break 4\nc\nbt\nlocals\nfree\nframe 1\nstack\nlist\np x\nframe 0\np k\nclear 4\nn\nn\n",
+			`entry at main.gg:1:12 in <main>
+1	let make = fn(k) {
+(debug) breakpoint set at main.gg:4
+(debug) breakpoint at main.gg:4:5 in <anonymous>
+4	    r * 2
+(debug) * 0 <anonymous> at main.gg:4:5
+  1 <main> at main.gg:8:16
+(debug) v = 1
+r = 4
+(debug) k = 3
+(debug) 1 <main> at main.gg:8:16
+(debug) 100
+(debug)    5	  }
+   6	};
+   7	let f = make(3);
+=> 8	let x = 100 + f(1);
+   9	f(x)
+(debug) no binding named x
+(debug) 0 <anonymous> at main.gg:4:5
+(debug) 3
+(debug) breakpoint cleared at main.gg:4
+(debug) step at main.gg:9:1 in <main>
+9	f(x)
+(debug) program exited
+222
+`,
+		},
+		{
+			source,
+			"s\ns\ns\ns\nout\np x\nbreakpoints\nq\n",
+			`entry at main.gg:1:12 in <main>
+1	let make = fn(k) {
+(debug) step at main.gg:7:9 in <main>
+7	let f = make(3);
+(debug) step at main.gg:2:3 in make
+2	  fn(v) {
+(debug) step at main.gg:8:9 in <main>
+8	let x = 100 + f(1);
+(debug) step at main.gg:3:13 in <anonymous>
+3	    let r = v + k;
+(debug) step at main.gg:9:1 in <main>
+9	f(x)
+(debug) 108
+(debug) (debug) program aborted
+`,
+		},
+		{
+			"let f = fn(x) {\n  x / 0\n};\nf(1)",
+			"break nope\nbreak 2\nwat\nc\nlocals\n",
+			`entry at main.gg:1:9 in <main>
+1	let f = fn(x) {
+(debug) invalid line nope
+(debug) breakpoint set at main.gg:2
+(debug) unknown command wat, type help for the list of commands
+(debug) breakpoint at main.gg:2:3 in f
+2	  x / 0
+(debug) x = 1
+(debug) 
+program aborted
+`,
+		},
+		{
+			"let f = fn(x) {\n  x / 0\n};\nf(1)",
+			"c\n",
+			`entry at main.gg:1:9 in <main>
+1	let f = fn(x) {
+(debug) program failed: main.gg:2:5: division by zero
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		comp := compiler.New()
+		comp.SetFile("main.gg")
+		comp.SetFolding(false)
+		comp.SetPeephole(false)
+		if err := comp.Compile(p.Parse()); err != nil {
+			t.Fatalf("compiler error : %s", err)
+		}
+		sources := func(file string) ([]byte, error) {
+			if file != "main.gg" {
+				return nil, fmt.Errorf("no such file %s", file)
+			}
+			return []byte(tt.input), nil
+		}
+
+		var out bytes.Buffer
+		New(comp.Bytecode(), sources, strings.NewReader(tt.commands), &out).Run()
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong session output for %q expected :\n%s\ngot :\n%s", tt.commands, tt.expected, out.String())
+		}
+	}
+}
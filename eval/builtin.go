@@ -2,10 +2,12 @@ package eval
 
 import "github.com/actuallyachraf/monkey-giggle/object"
 
-var builtins = map[string]*object.BuiltIn{
-	"len":    object.GetBuiltInByName("len"),
-	"head":   object.GetBuiltInByName("head"),
-	"tail":   object.GetBuiltInByName("tail"),
-	"last":   object.GetBuiltInByName("last"),
-	"append": object.GetBuiltInByName("append"),
+// builtins indexes the built-in functions by name, they are the functions of
+// object.Builtins the compiler resolves in its builtin scope.
+var builtins = make(map[string]*object.BuiltIn, len(object.Builtins))
+
+func init() {
+	for _, def := range object.Builtins {
+		builtins[def.Name] = def.Fn
+	}
 }
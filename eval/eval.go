@@ -2,6 +2,7 @@ package eval
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/actuallyachraf/monkey-giggle/ast"
 	"github.com/actuallyachraf/monkey-giggle/object"
@@ -31,7 +32,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return Eval(node.Expression, env)
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
@@ -40,69 +41,110 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			fmt.Println("Nil node value !")
 		}
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
+		if node.Pattern != nil {
+			if err := bindPattern(node.Pattern, val, env); err != nil {
+				return err
+			}
+			return nil
+		}
 		env.Set(string(node.Name.Value), val)
 
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.BigIntegerLiteral:
+		return &object.BigInt{Value: node.Value}
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 	case *ast.BooleanLiteral:
 		return nativeBoolToBoolean(node.Value)
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
+		if len(elements) == 1 && isAbrupt(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
+	case *ast.NullLiteral:
+		return NULL
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
+		if node.Optional && left == NULL {
+			return NULL
+		}
 		index := Eval(node.Index, env)
-		if isError(index) {
+		if isAbrupt(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
+	case *ast.SliceExpression:
+		return evalSliceExpression(node, env)
 	case *ast.HashmapLiteral:
 		return evalHashmapLiteral(node, env)
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
+		// the right operand of ?? is only evaluated when the left one is null
+		if node.Operator == "??" {
+			if left != NULL {
+				return left
+			}
+			return Eval(node.Right, env)
+		}
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 		return evalInfixExpression(node.Operator, left, right)
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+	case *ast.TryExpression:
+		return evalTryExpression(node, env)
+	case *ast.ImportExpression:
+		return evalImportExpression(node, env)
+	case *ast.ThrowStatement:
+		val := Eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		return object.Throw(val)
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return &object.Function{Parameters: params, Defaults: node.Defaults, Patterns: node.Patterns, Rest: node.Rest, Body: body, Env: env}
+	case *ast.MacroLiteral:
+		return &object.Macro{Parameters: node.Parameters, Body: node.Body, Env: env}
 	case *ast.CallExpression:
+		if isCall(node, "quote") {
+			return quote(node.Arguments[0], env)
+		}
 		function := Eval(node.Function, env)
-		if isError(function) {
+		if isAbrupt(function) {
 			return function
 		}
 		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		if len(args) == 1 && isAbrupt(args[0]) {
 			return args[0]
 		}
 		return applyFunction(function, args)
+	case *ast.SpreadExpression:
+		return newError("spread operator is only allowed in call arguments and array literals")
 	}
 	return nil
 }
@@ -153,108 +195,44 @@ func evalPrefixExpression(operator token.Literal, right object.Object) object.Ob
 	case "-":
 		return evalMinusOperatorExpression(right)
 	default:
-		return newError("unknwon operator :%s%s", operator, right.Type())
+		return newError("unknown operator: %s%s", operator, right.Type())
 	}
 }
 
 // evalInfixExpression is called when we need to evaluate infixed expression
 // of the type val op val.
 func evalInfixExpression(operator token.Literal, left object.Object, right object.Object) object.Object {
-	// order matters here if the operator is == we need to evaluate whether it's
-	// operating on integer operands before assuming left and right are both boolean.
-	// edge case (1 == 2) == true => false
-	// this bug is artefact of the fact that we also compare pointer values since the TRUE/FALSE booleans
-	// have long-life pointers during repl runtime.
-	switch {
-	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
-	case left.Type() == object.INTEGER && right.Type() == object.INTEGER:
-		return evalIntegerExpression(operator, left, right)
-	case left.Type() == object.STRING && right.Type() == object.STRING:
-		return evalStringExpression(operator, left, right)
-	case operator == "==":
-		return nativeBoolToBoolean(left == right)
-	case operator == "!=":
-		return nativeBoolToBoolean(left != right)
-	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-
-	}
-}
-
-// evalIntegerExpression evaluates infix expression where both operands are integers.
-func evalIntegerExpression(operator token.Literal, left object.Object, right object.Object) object.Object {
-
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
-
-	switch operator {
-	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
-	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
-	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
-	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
-	case "%":
-		return &object.Integer{Value: leftVal % rightVal}
-	case "<":
-		return nativeBoolToBoolean(leftVal < rightVal)
-	case ">":
-		return nativeBoolToBoolean(leftVal > rightVal)
-	case "<=":
-		return nativeBoolToBoolean(leftVal <= rightVal)
-	case ">=":
-		return nativeBoolToBoolean(leftVal >= rightVal)
-	case "==":
-		return nativeBoolToBoolean(leftVal == rightVal)
-	case "!=":
-		return nativeBoolToBoolean(leftVal != rightVal)
-	default:
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
-}
-
-// evalStringExpression evaluates infix expression where both operands are strings.
-func evalStringExpression(operator token.Literal, left object.Object, right object.Object) object.Object {
-	leftVal := left.(*object.String).Value
-	rightVal := right.(*object.String).Value
-
 	switch operator {
-	case "+":
-		return &object.String{Value: leftVal + rightVal}
+	case "==", "!=", "<", ">", "<=", ">=":
+		res, err := object.CompareOp(string(operator), left, right)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return nativeBoolToBoolean(res)
 	default:
-		return newError("unknown operator for string type %s %s %s", operator, leftVal, rightVal)
+		res, err := object.BinaryOp(string(operator), left, right)
+		if err != nil {
+			return newError("%s", err)
+		}
+		return res
 	}
 }
 
 // evalBangOperatorExpression is used to evaluate expressions prefixed by the
 // bang operator.
 func evalBangOperatorExpression(right object.Object) object.Object {
-	switch right {
-	case TRUE:
-		return FALSE
-	case FALSE:
-		return TRUE
-	case NULL:
-		return TRUE
-	default:
-		return FALSE
-	}
+	return nativeBoolToBoolean(!isTruth(right))
 }
 
 // evalMinusOperatorExpression is used to evaluate expressions prefixed by the
 // minus operator
 func evalMinusOperatorExpression(right object.Object) object.Object {
-
-	if right.Type() != object.INTEGER {
-		return newError("unknown operator: -%s", right.Type())
+	value, err := object.Negate(right)
+	if err != nil {
+		return newError("%s", err)
 	}
 
-	value := right.(*object.Integer).Value
-
-	return &object.Integer{Value: -value}
+	return value
 }
 
 // evalExpressions evaluations expressions that appear as arguments.
@@ -263,8 +241,21 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	var res []object.Object
 
 	for _, e := range exps {
+		if spread, ok := e.(*ast.SpreadExpression); ok {
+			evaled := Eval(spread.Value, env)
+			if isAbrupt(evaled) {
+				return []object.Object{evaled}
+			}
+			array, ok := evaled.(*object.Array)
+			if !ok {
+				return []object.Object{newError("spread operator requires ARRAY got %s", evaled.Type())}
+			}
+			res = append(res, array.Elements...)
+			continue
+		}
+
 		evaled := Eval(e, env)
-		if isError(evaled) {
+		if isAbrupt(evaled) {
 			return []object.Object{evaled}
 		}
 
@@ -277,6 +268,9 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 // evalIfExpression is used to evaluate conditionnal branches.
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(ie.Condition, env)
+	if isAbrupt(condition) {
+		return condition
+	}
 
 	if isTruth(condition) {
 		return Eval(ie.Consequence, env)
@@ -288,65 +282,182 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Obje
 
 }
 
-// evalIndexExpression evaluates expressions in the indexing op
-func evalIndexExpression(left, index object.Object) object.Object {
-	switch {
-	case left.Type() == object.ARRAY && index.Type() == object.INTEGER:
-		return evalArrayIndexExpression(left, index)
-	case left.Type() == object.HASH:
-		return evalHashmapIndexExpression(left, index)
-	default:
+// evalTryExpression evaluates the try block, errors it raises are caught by
+// the catch block and the finally block runs last whatever happened, errors
+// and return statements in the finally block take precedence.
+func evalTryExpression(te *ast.TryExpression, env *object.Environment) object.Object {
+	result := Eval(te.Block, env)
+
+	if err, ok := result.(*object.Error); ok && te.Catch != nil {
+		env.Set(string(te.Param.Value), err.Caught())
+		result = Eval(te.Catch, env)
+	}
+
+	if te.Finally != nil {
+		final := Eval(te.Finally, env)
+		if final != nil && (final.Type() == object.RETURN || final.Type() == object.ERROR) {
+			return final
+		}
+	}
+
+	if result == nil {
 		return NULL
 	}
+	return result
 }
 
-// evalArrayIndexExpression evaluates expression in array indexes
-func evalArrayIndexExpression(array, index object.Object) object.Object {
-	arrayObj := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-	max := int64(len(arrayObj.Elements) - 1)
+// evalMatchExpression evaluates the body of the first arm whose pattern matches
+// the value and whose guard holds, it evaluates to null when no arm matches.
+func evalMatchExpression(me *ast.MatchExpression, env *object.Environment) object.Object {
+	val := Eval(me.Value, env)
+	if isAbrupt(val) {
+		return val
+	}
 
-	if idx < 0 || idx > max {
-		return NULL
+	for _, arm := range me.Arms {
+		if !matchPattern(arm.Pattern, val, env) {
+			continue
+		}
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, env)
+			if isAbrupt(guard) {
+				return guard
+			}
+			if !isTruth(guard) {
+				continue
+			}
+		}
+
+		result := Eval(arm.Body, env)
+		if result == nil {
+			return NULL
+		}
+		return result
 	}
 
-	return arrayObj.Elements[idx]
+	return NULL
+}
+
+// matchPattern checks whether a value matches a match pattern, identifiers
+// are bound in env as the pattern is checked.
+func matchPattern(pattern ast.Expression, val object.Object, env *object.Environment) bool {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			env.Set(string(pattern.Value), val)
+		}
+		return true
+	case *ast.IntegerLiteral, *ast.BigIntegerLiteral, *ast.StringLiteral, *ast.BooleanLiteral, *ast.NullLiteral:
+		return object.Compare(val, Eval(pattern, env)) == 0
+	case *ast.ArrayPattern:
+		if object.CheckArrayShape(val, len(pattern.Elements), pattern.Rest != nil) != nil {
+			return false
+		}
+		array := val.(*object.Array)
+		for i, el := range pattern.Elements {
+			if !matchPattern(el, array.Elements[i], env) {
+				return false
+			}
+		}
+		if pattern.Rest != nil && pattern.Rest.Value != "_" {
+			rest := make([]object.Object, len(array.Elements)-len(pattern.Elements))
+			copy(rest, array.Elements[len(pattern.Elements):])
+			env.Set(string(pattern.Rest.Value), &object.Array{Elements: rest})
+		}
+		return true
+	case *ast.HashPattern:
+		keys := make([]object.Object, len(pattern.Keys))
+		for i, key := range pattern.Keys {
+			keys[i] = &object.String{Value: key.Value}
+		}
+		if object.CheckHashShape(val, keys) != nil {
+			return false
+		}
+		hash, _ := object.AsHash(val)
+		for i, value := range pattern.Values {
+			pair := hash.Pairs[keys[i].(object.Hashable).HashKey()]
+			if !matchPattern(value, pair.Value, env) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
 }
 
-// evalHashmapIndexExpression evaluates expression in hashmap keys
-func evalHashmapIndexExpression(hash, index object.Object) object.Object {
+// evalIndexExpression evaluates expressions in the indexing op
+func evalIndexExpression(left, index object.Object) object.Object {
+	val, err := object.Index(left, index)
+	if err != nil {
+		return newError("%s", err)
+	}
+	if val == nil {
+		return NULL
+	}
 
-	hashObj := hash.(*object.HashMap)
+	return val
+}
 
-	key, ok := index.(object.Hashable)
-	if !ok {
-		return newError("not valid key for hashmap literal : %s", index.Type())
+// evalSliceExpression evaluates slices of arrays and strings
+func evalSliceExpression(node *ast.SliceExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isAbrupt(left) {
+		return left
 	}
-	pair, ok := hashObj.Pairs[key.HashKey()]
-	if !ok {
+	if node.Optional && left == NULL {
 		return NULL
 	}
-	return pair.Value
+
+	var start, end object.Object
+	if node.Start != nil {
+		start = Eval(node.Start, env)
+		if isAbrupt(start) {
+			return start
+		}
+	}
+	if node.End != nil {
+		end = Eval(node.End, env)
+		if isAbrupt(end) {
+			return end
+		}
+	}
+
+	slice, err := object.Slice(left, start, end)
+	if err != nil {
+		return newError("%s", err)
+	}
+
+	return slice
 }
 
 // evalHashmapLiteral evaluates hashmap literals
 func evalHashmapLiteral(node *ast.HashmapLiteral, env *object.Environment) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 
-	for k, v := range node.Pairs {
+	// pairs are evaluated in the order the compiler emits them
+	keys := make([]ast.Expression, 0, len(node.Pairs))
+	for k := range node.Pairs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+
+	for _, k := range keys {
+		v := node.Pairs[k]
 		key := Eval(k, env)
-		if isError(key) {
+		if isAbrupt(key) {
 			return key
 		}
-		hashKey, ok := key.(object.Hashable)
-		if !ok {
-			return newError("not valid key for hashmap literal : %s", key.Type())
+		hashed, err := object.HashKeyOf(key)
+		if err != nil {
+			return newError("%s", err)
 		}
 		val := Eval(v, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
-		hashed := hashKey.HashKey()
 		pairs[hashed] = object.HashPair{Key: key, Value: val}
 	}
 
@@ -358,7 +469,10 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 
 	switch fn := fn.(type) {
 	case *object.Function:
-		extendedEnv := extendFunctionEnv(fn, args)
+		extendedEnv, err := extendFunctionEnv(fn, args)
+		if err != nil {
+			return err
+		}
 		evaled := Eval(fn.Body, extendedEnv)
 		return unwrapReturnValue(evaled)
 	case *object.BuiltIn:
@@ -371,15 +485,103 @@ func applyFunction(fn object.Object, args []object.Object) object.Object {
 	}
 }
 
-// extendFunctionEnv from current environment
-func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
+// extendFunctionEnv from current environment, missing parameters are bound
+// to their default value and extra arguments to the rest parameter.
+func extendFunctionEnv(fn *object.Function, args []object.Object) (*object.Environment, *object.Error) {
 	env := object.NewEnclosedEnvironment(fn.Env)
 
+	numParams := len(fn.Parameters)
+	numDefaults := 0
+	for _, d := range fn.Defaults {
+		if d != nil {
+			numDefaults++
+		}
+	}
+	if err := object.CheckArity(numParams, numDefaults, fn.Rest != nil, len(args)); err != nil {
+		return nil, newError("%s", err)
+	}
+
 	for paramIdx, param := range fn.Parameters {
-		env.Set(string(param.Value), args[paramIdx])
+		if paramIdx < len(args) {
+			env.Set(string(param.Value), args[paramIdx])
+		} else {
+			env.Set(string(param.Value), NULL)
+		}
+	}
+	for paramIdx := len(args); paramIdx < numParams; paramIdx++ {
+		param := fn.Parameters[paramIdx]
+		// defaults are evaluated in order so they can refer to earlier parameters
+		val := Eval(fn.Defaults[paramIdx], env)
+		if err, ok := val.(*object.Error); ok {
+			return nil, err
+		}
+		env.Set(string(param.Value), val)
+	}
+
+	for paramIdx, param := range fn.Parameters {
+		if paramIdx >= len(fn.Patterns) || fn.Patterns[paramIdx] == nil {
+			continue
+		}
+		val, _ := env.Get(string(param.Value))
+		if err := bindPattern(fn.Patterns[paramIdx], val, env); err != nil {
+			return nil, err
+		}
 	}
 
-	return env
+	if fn.Rest != nil {
+		rest := []object.Object{}
+		if len(args) > numParams {
+			rest = append(rest, args[numParams:]...)
+		}
+		env.Set(string(fn.Rest.Value), &object.Array{Elements: rest})
+	}
+
+	return env, nil
+}
+
+// bindPattern binds the identifiers of a destructuring pattern to the parts
+// of val after checking its shape.
+func bindPattern(pattern ast.Expression, val object.Object, env *object.Environment) *object.Error {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		env.Set(string(pattern.Value), val)
+	case *ast.ArrayPattern:
+		err := object.CheckArrayShape(val, len(pattern.Elements), pattern.Rest != nil)
+		if err != nil {
+			return newError("%s", err)
+		}
+		array := val.(*object.Array)
+		for i, el := range pattern.Elements {
+			if err := bindPattern(el, array.Elements[i], env); err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil {
+			rest := make([]object.Object, len(array.Elements)-len(pattern.Elements))
+			copy(rest, array.Elements[len(pattern.Elements):])
+			env.Set(string(pattern.Rest.Value), &object.Array{Elements: rest})
+		}
+	case *ast.HashPattern:
+		keys := make([]object.Object, len(pattern.Keys))
+		for i, key := range pattern.Keys {
+			keys[i] = &object.String{Value: key.Value}
+		}
+		err := object.CheckHashShape(val, keys)
+		if err != nil {
+			return newError("%s", err)
+		}
+		hash, _ := object.AsHash(val)
+		for i, value := range pattern.Values {
+			pair := hash.Pairs[keys[i].(object.Hashable).HashKey()]
+			if err := bindPattern(value, pair.Value, env); err != nil {
+				return err
+			}
+		}
+	default:
+		return newError("invalid destructuring pattern %s", pattern.String())
+	}
+
+	return nil
 }
 
 // unwrapReturnValue unwraps the return value to a return statement
@@ -403,14 +605,7 @@ func nativeBoolToBoolean(in bool) *object.Boolean {
 
 // isTruth returns whether a given object is a true expression or not.
 func isTruth(obj object.Object) bool {
-	switch obj {
-	case NULL:
-		return false
-	case FALSE:
-		return false
-	default:
-		return true
-	}
+	return object.Truthy(obj)
 }
 
 // newError creates a new error message
@@ -418,10 +613,11 @@ func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
-// isError checks if a given object is an error
-func isError(obj object.Object) bool {
+// isAbrupt checks if a given object stops the evaluation of the enclosing
+// expression, errors and return values propagate up to the enclosing function.
+func isAbrupt(obj object.Object) bool {
 	if obj != nil {
-		return obj.Type() == object.ERROR
+		return obj.Type() == object.ERROR || obj.Type() == object.RETURN
 	}
 
 	return false
@@ -3,7 +3,9 @@ package eval
 import (
 	"testing"
 
+	"github.com/actuallyachraf/monkey-giggle/ast"
 	"github.com/actuallyachraf/monkey-giggle/lexer"
+	"github.com/actuallyachraf/monkey-giggle/module"
 	"github.com/actuallyachraf/monkey-giggle/object"
 	"github.com/actuallyachraf/monkey-giggle/parser"
 )
@@ -51,6 +53,13 @@ func TestEval(t *testing.T) {
 			{"(1 < 2) == false", false},
 			{"(1 > 2) == true", false},
 			{"(1 > 2) == false", true},
+			{`"a" < "b"`, true},
+			{`"b" < "a"`, false},
+			{`"abc" <= "abc"`, true},
+			{`"abd" > "abc"`, true},
+			{`"ab" >= "abc"`, false},
+			{`"foo" == "foo"`, true},
+			{`"foo" != "bar"`, true},
 		}
 
 		for _, tt := range tests {
@@ -117,6 +126,57 @@ func TestEval(t *testing.T) {
 			testIntegerObject(t, evaluated, tt.expected)
 		}
 	})
+	t.Run("TestEvalBigIntegerExpression", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"9223372036854775807 + 1", "9223372036854775808"},
+			{"-9223372036854775807 - 2", "-9223372036854775809"},
+			{"9223372036854775807 * 9223372036854775807", "85070591730234615847396907784232501249"},
+			{"(9223372036854775807 + 1) - 1", "9223372036854775807"},
+			{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+			{"9223372036854775807 + 1 > 9223372036854775807", "true"},
+		}
+
+		for _, tt := range tests {
+			evaled := testEval(tt.input)
+			if evaled.Inspect() != tt.expected {
+				t.Errorf("wrong value for %q expected %s got %s", tt.input, tt.expected, evaled.Inspect())
+			}
+		}
+		if _, ok := testEval("9223372036854775807 + 1").(*object.BigInt); !ok {
+			t.Errorf("overflowing result is not a BigInt")
+		}
+		if _, ok := testEval("(9223372036854775807 + 1) - 1").(*object.Integer); !ok {
+			t.Errorf("big integer result that fits is not demoted to Integer")
+		}
+	})
+	t.Run("TestEvalNullExpression", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected interface{}
+		}{
+			{"null", nil},
+			{"null ?? 1", 1},
+			{"2 ?? 1", 2},
+			{"null ?? null ?? 3", 3},
+			{`let h = {"a": {"b": 1}}; h["x"]?.["b"]`, nil},
+			{`let h = {"a": {"b": 1}}; h["a"]?.["b"]`, 1},
+			{`let h = {"a": {"b": 1}}; h["x"]?.["b"] ?? 42`, 42},
+			{`null?.[0]?.[1]`, nil},
+			{`1 ?? foobar`, 1},
+		}
+
+		for _, tt := range tests {
+			evaled := testEval(tt.input)
+			if integer, ok := tt.expected.(int); ok {
+				testIntegerObject(t, evaled, int64(integer))
+			} else {
+				testNullObject(t, evaled)
+			}
+		}
+	})
 	t.Run("TestEvalIfElseExpression", func(t *testing.T) {
 		tests := []struct {
 			input    string
@@ -219,6 +279,14 @@ func TestEval(t *testing.T) {
 				"foobar",
 				"identifier not found: foobar",
 			},
+			{
+				"10 / 0",
+				"division by zero",
+			},
+			{
+				"10 % 0",
+				"division by zero",
+			},
 		}
 
 		for _, tt := range tests {
@@ -294,6 +362,155 @@ func TestEval(t *testing.T) {
 			testIntegerObject(t, testEval(tt.input), tt.expected)
 		}
 	})
+	t.Run("TestEvalFunctionDefaultsAndSpread", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"let f = fn(a, b = 2) { a + b }; f(1)", "3"},
+			{"let f = fn(a, b = 2) { a + b }; f(1, 5)", "6"},
+			{"let f = fn(a = 1, b = a + 1) { a * b }; f()", "2"},
+			{"let f = fn(a = 1, b = a + 1) { a * b }; f(3)", "12"},
+			{"let f = fn(a, ...rest) { rest }; f(1)", "[]"},
+			{"let f = fn(a, ...rest) { rest }; f(1, 2, 3)", "[2, 3]"},
+			{"let f = fn(a, b = 10, ...rest) { [a, b, len(rest)] }; f(1, 2, 3, 4)", "[1, 2, 2]"},
+			{"let f = fn(a, b) { a - b }; f(...[5], 3)", "2"},
+			{"let sum = fn(...xs) { if (len(xs) == 0) { 0 } else { head(xs) + sum(...tail(xs)) } }; sum(1, 2, 3, 4)", "10"},
+			{"let xs = [2, 3]; [1, ...xs, 4, ...[]]", "[1, 2, 3, 4]"},
+			{"fn(a) { a }()", "ERROR :wrong number of parameters : want 1, got 0"},
+			{"fn(a, b = 1) { a }(1, 2, 3)", "ERROR :wrong number of parameters : want 1 to 2, got 3"},
+			{"fn(a, ...rest) { a }()", "ERROR :wrong number of parameters : want at least 1, got 0"},
+			{"len(...1)", "ERROR :spread operator requires ARRAY got INTEGER"},
+		}
+
+		for _, tt := range tests {
+			evaled := testEval(tt.input)
+			if evaled.Inspect() != tt.expected {
+				t.Errorf("wrong value for %q expected %s got %s", tt.input, tt.expected, evaled.Inspect())
+			}
+		}
+	})
+	t.Run("TestEvalDestructuring", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"let [a, b] = [1, 2]; a + b", "3"},
+			{"let [a, ...rest] = [1, 2, 3]; rest", "[2, 3]"},
+			{"let [[a, b], c] = [[1, 2], 3]; a + b + c", "6"},
+			{`let {name, age} = {"name": "giggle", "age": 3}; name`, "giggle"},
+			{`let {"tags": [first, ...others]} = {"tags": ["a", "b"]}; first + others[0]`, "ab"},
+			{"let f = fn([a, b]) { a * b }; f([3, 4])", "12"},
+			{"let f = fn([a, b] = [5, 6]) { a - b }; f()", "-1"},
+			{`let [a, b] = 1;`, "ERROR :cannot destructure INTEGER as ARRAY"},
+			{`let [a, b] = [1];`, "ERROR :cannot destructure ARRAY of 1 elements into 2"},
+			{`let {a} = {"b": 1};`, "ERROR :missing key a in HASH destructuring"},
+			{`fn([a]) { a }(2)`, "ERROR :cannot destructure INTEGER as ARRAY"},
+		}
+
+		for _, tt := range tests {
+			evaled := testEval(tt.input)
+			if evaled.Inspect() != tt.expected {
+				t.Errorf("wrong value for %q expected %s got %s", tt.input, tt.expected, evaled.Inspect())
+			}
+		}
+	})
+	t.Run("TestEvalMatchExpression", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"match (1) { 1 => 10, _ => 20 }", "10"},
+			{"match (3) { 1 => 10 }", "null"},
+			{"match (-1) { -1 => true, _ => false }", "true"},
+			{`match (1) { "1" => 1, true => 2, n => n + 2 }`, "3"},
+			{"match (null) { null => 1, _ => 2 }", "1"},
+			{"match ([1, [2, 3]]) { [1, [a, 4]] => a, [1, [a, b]] => a * b }", "6"},
+			{"match ([1, 2, 3]) { [a, ...rest] => rest }", "[2, 3]"},
+			{"match (1) { [a] => a, {a} => a, _ => 0 }", "0"},
+			{`match ({"type": "square", "side": 3}) { {"type": "circle", r} => r, {"type": "square", side} => side * side }`, "9"},
+			{"match (5) { n if n < 0 => -1, n if n > 0 => 1, _ => 0 }", "1"},
+			{"match (2) { _ => {} }", "null"},
+			{"let f = fn(n) { match (n) { 0 => 1, _ => n * f(n - 1) } }; f(5)", "120"},
+			{"match (1) { n if n + true => 1 }", "ERROR :type mismatch: INTEGER + BOOLEAN"},
+		}
+
+		for _, tt := range tests {
+			evaled := testEval(tt.input)
+			if evaled.Inspect() != tt.expected {
+				t.Errorf("wrong value for %q expected %s got %s", tt.input, tt.expected, evaled.Inspect())
+			}
+		}
+	})
+	t.Run("TestEvalExceptions", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"try { 1 } catch (e) { 2 }", "1"},
+			{"try { throw 5; 1 } catch (e) { e + 1 }", "6"},
+			{"try { len(1) } catch (e) { e }", "argument to `len` not supported, got INTEGER"},
+			{"try { } catch (e) { 2 }", "null"},
+			{`let f = fn(x) { if (x == 0) { throw "bottom" } 1 + f(x - 1) }; 10 + try { f(5) } catch (e) { len(e) }`, "16"},
+			{"try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e * 10 }", "20"},
+			{"let r = try { 1 } finally { let done = true; }; [r, done]", "[1, true]"},
+			{"let r = try { throw 1 } catch (e) { e + 1 } finally { let done = e; }; [r, done]", "[2, 1]"},
+			{`try { try { throw "x" } finally { let cleaned = true; } } catch (e) { [e, cleaned] }`, "[x, true]"},
+			{"let f = fn() { try { return 1; } finally { 3 }; 5 }; f()", "1"},
+			{"let f = fn() { try { return 1; } finally { return 2; } }; f()", "2"},
+			{`let f = fn() { try { return 1; } finally { throw "late" } }; try { f() } catch (e) { e }`, "late"},
+			{`throw "boom";`, "ERROR :uncaught exception: boom"},
+			{`try { throw [1] } finally { 2 }`, "ERROR :uncaught exception: [1]"},
+		}
+
+		for _, tt := range tests {
+			evaled := testEval(tt.input)
+			if evaled.Inspect() != tt.expected {
+				t.Errorf("wrong value for %q expected %s got %s", tt.input, tt.expected, evaled.Inspect())
+			}
+		}
+	})
+	t.Run("TestEvalModules", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{`let math = import "math"; math["square"](3)`, "9"},
+			{`let {answer, one, two} = import "math"; answer + one + two`, "45"},
+			{`let base = 1; let counter = import "counter"; counter["addBase"](base)`, "11"},
+			{`let shapes = import "geometry/shapes"; shapes["area"](4)`, "16"},
+			{`(import "math") == (import "math")`, "true"},
+			{`import "math"`, "module(math)"},
+			{`match (import "math") { {square} => square(5) }`, "25"},
+			{`try { import "thrower" } catch (e) { e }`, "module failed"},
+			{`(import "math")["secret"]`, "ERROR :module math has no export secret"},
+			{`import "missing"`, "ERROR :module not found: missing"},
+			{`import "cycle_a"`, "ERROR :import cycle: cycle_a -> cycle_b -> cycle_a"},
+		}
+
+		for _, tt := range tests {
+			env := object.NewEnvWithLoader(module.NewLoader("../module/testdata"))
+			evaled := Eval(parse(tt.input), env)
+			if evaled.Inspect() != tt.expected {
+				t.Errorf("wrong value for %q expected %s got %s", tt.input, tt.expected, evaled.Inspect())
+			}
+		}
+	})
+	t.Run("TestEvalModuleState", func(t *testing.T) {
+		// evaluations don't share their loader nor their imported modules
+		first := object.NewEnvWithLoader(module.NewLoader("../module/testdata"))
+		second := object.NewEnvWithLoader(module.NewLoader("../module/testdata"))
+		firstMath := Eval(parse(`import "math"`), first)
+		if again := Eval(parse(`import "math"`), first); again != firstMath {
+			t.Errorf("module imported twice by an evaluation was evaluated twice")
+		}
+		if other := Eval(parse(`import "math"`), second); other == firstMath {
+			t.Errorf("separate evaluations share their imported modules")
+		}
+		if evaled := testEval(`import "math"`); evaled.Inspect() != "ERROR :module not found: math" {
+			t.Errorf("evaluation used the loader of another evaluation got %s", evaled.Inspect())
+		}
+	})
 	t.Run("TestEvalEnclosedEnv", func(t *testing.T) {
 		input := `
 		let first = 10;
@@ -350,6 +567,9 @@ func TestEval(t *testing.T) {
 			{`head([1,2,3])`, 1},
 			{`tail([1,2,3])`, []int{2, 3}},
 			{`append([],1)`, []int{1}},
+			{`sort([3,1,2])`, []int{1, 2, 3}},
+			{`sort([])`, []int{}},
+			{`sort(1)`, "argument to `sort` must be ARRAY got INTEGER"},
 		}
 
 		for _, tt := range tests {
@@ -446,6 +666,14 @@ func TestEval(t *testing.T) {
 			},
 			{
 				"[1, 2, 3][-1]",
+				3,
+			},
+			{
+				"[1, 2, 3][-3]",
+				1,
+			},
+			{
+				"[1, 2, 3][-4]",
 				nil,
 			},
 		}
@@ -460,6 +688,42 @@ func TestEval(t *testing.T) {
 			}
 		}
 	})
+	t.Run("TestEvalSliceExpression", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"[1, 2, 3, 4][1:3]", "[2, 3]"},
+			{"[1, 2, 3, 4][:2]", "[1, 2]"},
+			{"[1, 2, 3, 4][2:]", "[3, 4]"},
+			{"[1, 2, 3, 4][:]", "[1, 2, 3, 4]"},
+			{"[1, 2, 3, 4][-2:]", "[3, 4]"},
+			{"[1, 2, 3, 4][:-1]", "[1, 2, 3]"},
+			{"[1, 2, 3, 4][3:1]", "[]"},
+			{"[1, 2, 3, 4][-10:10]", "[1, 2, 3, 4]"},
+			{`"hello"[1]`, "e"},
+			{`"hello"[-1]`, "o"},
+			{`"hello"[5]`, "null"},
+			{`"hello"[1:3]`, "el"},
+			{`"hello"[:-2]`, "hel"},
+			{`"héllo"[1]`, "é"},
+			{`"héllo"[-4]`, "é"},
+			{`"日本語"[2]`, "語"},
+			{`"héllo"[1:3]`, "él"},
+			{`"日本語"[:-1]`, "日本"},
+			{`len("héllo")`, "5"},
+			{`null?.[1:]`, "null"},
+			{`[1, 2]["a":]`, "ERROR :slice bounds must be INTEGER got STRING"},
+			{`5[1:]`, "ERROR :slice operator not supported: INTEGER"},
+		}
+
+		for _, tt := range tests {
+			evaled := testEval(tt.input)
+			if evaled.Inspect() != tt.expected {
+				t.Errorf("wrong value for %q expected %s got %s", tt.input, tt.expected, evaled.Inspect())
+			}
+		}
+	})
 	t.Run("TestEvalHashmapLiteral", func(t *testing.T) {
 		input := `let two = "two";
 	{
@@ -544,15 +808,52 @@ func TestEval(t *testing.T) {
 			}
 		}
 	})
+	t.Run("TestQuoteUnquote", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{`quote(5)`, `5`},
+			{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+			{`quote(unquote(4 + 4))`, `8`},
+			{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+			{`let x = 8; quote(x + unquote(x))`, `(x + 8)`},
+			{`quote(unquote(true == false))`, `false`},
+			{`quote(unquote("giggle"))`, `giggle`},
+			{`quote(unquote([1, 2]))`, `[1, 2]`},
+			{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+			{`let q = quote(4 + 4); quote(unquote(4 + 4) + unquote(q))`, `(8 + (4 + 4))`},
+		}
+
+		for _, tt := range tests {
+			evaluated := testEval(tt.input)
+			quote, ok := evaluated.(*object.Quote)
+			if !ok {
+				t.Fatalf("expected *object.Quote for %q got %T (%+v)", tt.input, evaluated, evaluated)
+			}
+			if quote.Node.String() != tt.expected {
+				t.Errorf("wrong quoted node for %q expected %s got %s", tt.input, tt.expected, quote.Node.String())
+			}
+		}
+
+		err, ok := testEval(`quote(unquote(fn(x) { x }))`).(*object.Error)
+		if !ok || err.Message != "unquote of FUNCTION not supported" {
+			t.Errorf("expected unquote of a function to fail got %v", err)
+		}
+	})
 }
 
 func testEval(input string) object.Object {
+	env := object.NewEnv()
+
+	return Eval(parse(input), env)
+}
+
+func parse(input string) *ast.Program {
 	l := lexer.New(input)
 	p := parser.New(l)
-	program := p.Parse()
-	env := object.NewEnv()
 
-	return Eval(program, env)
+	return p.Parse()
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
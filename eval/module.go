@@ -0,0 +1,44 @@
+package eval
+
+import (
+	"github.com/actuallyachraf/monkey-giggle/ast"
+	"github.com/actuallyachraf/monkey-giggle/module"
+	"github.com/actuallyachraf/monkey-giggle/object"
+)
+
+// evalImportExpression evaluates an imported module in its own environment
+// the first time it is imported by the evaluation env belongs to and returns
+// the module object.
+func evalImportExpression(ie *ast.ImportExpression, env *object.Environment) object.Object {
+	modules := env.Modules()
+	file, err := modules.Loader.Resolve(ie.Path)
+	if err != nil {
+		return newError("%s", err)
+	}
+	if mod, ok := modules.Get(file); ok {
+		return mod
+	}
+
+	program, err := modules.Loader.Enter(ie.Path, file)
+	if err != nil {
+		return newError("%s", err)
+	}
+	defer modules.Loader.Leave()
+
+	modEnv := object.NewModuleEnv(env)
+	result := Eval(program, modEnv)
+	if isAbrupt(result) {
+		return result
+	}
+
+	exports := &object.HashMap{Pairs: make(map[object.HashKey]object.HashPair)}
+	for _, name := range module.Exports(program) {
+		key := &object.String{Value: name}
+		val, _ := modEnv.Get(name)
+		exports.Pairs[key.HashKey()] = object.HashPair{Key: key, Value: val}
+	}
+	mod := &object.Module{Name: ie.Path, Exports: exports}
+	modules.Set(file, mod)
+
+	return mod
+}
@@ -0,0 +1,87 @@
+package eval
+
+import (
+	"strconv"
+
+	"github.com/actuallyachraf/monkey-giggle/ast"
+	"github.com/actuallyachraf/monkey-giggle/object"
+	"github.com/actuallyachraf/monkey-giggle/token"
+)
+
+// isCall reports whether a node is a call to the named function with a single
+// argument, quote and unquote calls are recognized by name.
+func isCall(node ast.Node, name string) bool {
+	call, ok := node.(*ast.CallExpression)
+	if !ok || len(call.Arguments) != 1 {
+		return false
+	}
+	ident, ok := call.Function.(*ast.Identifier)
+
+	return ok && string(ident.Value) == name
+}
+
+// quote returns the syntax tree of an expression as a quote, the unquote calls
+// it holds are evaluated and replaced by the tree of their value.
+func quote(node ast.Node, env *object.Environment) object.Object {
+	var err object.Object
+	node = ast.Rewrite(node, func(node ast.Node) ast.Node {
+		if err != nil || !isCall(node, "unquote") {
+			return node
+		}
+		call := node.(*ast.CallExpression)
+		val := Eval(call.Arguments[0], env)
+		if isAbrupt(val) {
+			err = val
+			return node
+		}
+		exp, ok := toExpression(val, call.Pos())
+		if !ok {
+			err = newError("unquote of %s not supported", val.Type())
+			return node
+		}
+		return exp
+	})
+	if err != nil {
+		return err
+	}
+
+	return &object.Quote{Node: node}
+}
+
+// toExpression returns the syntax tree of a value, integers, strings, booleans,
+// null, arrays of them and quotes have one. Literals take the position of the
+// unquote call.
+func toExpression(val object.Object, pos token.Position) (ast.Expression, bool) {
+	switch val := val.(type) {
+	case *object.Quote:
+		exp, ok := val.Node.(ast.Expression)
+		return exp, ok
+	case *object.Integer:
+		lit := strconv.FormatInt(val.Value, 10)
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: token.Literal(lit), Pos: pos}, Value: val.Value}, true
+	case *object.BigInt:
+		lit := val.Value.String()
+		return &ast.BigIntegerLiteral{Token: token.Token{Type: token.INT, Literal: token.Literal(lit), Pos: pos}, Value: val.Value}, true
+	case *object.String:
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: token.Literal(val.Value), Pos: pos}, Value: val.Value}, true
+	case *object.Boolean:
+		if val.Value {
+			return &ast.BooleanLiteral{Token: token.Token{Type: token.TRUE, Literal: "true", Pos: pos}, Value: true}, true
+		}
+		return &ast.BooleanLiteral{Token: token.Token{Type: token.FALSE, Literal: "false", Pos: pos}, Value: false}, true
+	case *object.Null:
+		return &ast.NullLiteral{Token: token.Token{Type: token.NULL, Literal: "null", Pos: pos}}, true
+	case *object.Array:
+		lit := &ast.ArrayLiteral{Token: token.Token{Type: token.LBRACKET, Literal: "[", Pos: pos}, Elements: []ast.Expression{}}
+		for _, el := range val.Elements {
+			exp, ok := toExpression(el, pos)
+			if !ok {
+				return nil, false
+			}
+			lit.Elements = append(lit.Elements, exp)
+		}
+		return lit, true
+	default:
+		return nil, false
+	}
+}
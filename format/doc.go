@@ -0,0 +1,186 @@
+package format
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// doc.go implements the layout engine of the formatter : source code is
+// described by a document made of text, line breaks and groups, a group is
+// printed on a single line when it fits in the page width and otherwise its
+// lines are broken and its nested content is indented.
+
+// doc is a document, it is one of text, concat, nest, *group, line or
+// breakParent.
+type doc interface{}
+
+// text is printed as is, it never holds a newline.
+type text string
+
+// concat prints documents one after the other.
+type concat []doc
+
+// nest indents the lines broken in a document by one level.
+type nest struct {
+	doc doc
+}
+
+// group prints a document flat when it fits the page width, broken groups
+// hold hard lines and are never flat.
+type group struct {
+	doc    doc
+	broken bool
+}
+
+// line is a possible line break, flat lines are printed as a space (or
+// nothing for soft lines) while hard lines are always broken.
+type line int
+
+const (
+	spaceLine line = iota
+	softLine
+	hardLine
+	// blankLine is a hard line followed by an empty line
+	blankLine
+)
+
+// breakParent forces the groups holding it to break.
+type breakParent struct{}
+
+const (
+	// width is the page width groups are fitted in
+	width = 80
+	// indentation is the text of an indentation level
+	indentation = "    "
+)
+
+// newGroup creates a group, the group is broken if it holds a hard line.
+func newGroup(docs ...doc) *group {
+	d := concat(docs)
+	return &group{doc: d, broken: hasBreak(d)}
+}
+
+// hasBreak reports whether a document holds a hard line or a breakParent.
+func hasBreak(d doc) bool {
+	switch d := d.(type) {
+	case concat:
+		for _, child := range d {
+			if hasBreak(child) {
+				return true
+			}
+		}
+	case nest:
+		return hasBreak(d.doc)
+	case *group:
+		return d.broken
+	case line:
+		return d == hardLine || d == blankLine
+	case breakParent:
+		return true
+	}
+
+	return false
+}
+
+// command is a document to print with its indentation level and mode.
+type command struct {
+	indent int
+	flat   bool
+	doc    doc
+}
+
+// render prints a document.
+func render(d doc) string {
+	var out []byte
+	col := 0
+	stack := []command{{doc: d}}
+
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch d := c.doc.(type) {
+		case text:
+			out = append(out, d...)
+			col += utf8.RuneCountInString(string(d))
+		case concat:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, command{c.indent, c.flat, d[i]})
+			}
+		case nest:
+			stack = append(stack, command{c.indent + 1, c.flat, d.doc})
+		case *group:
+			flat := c.flat || !d.broken && fits(width-col, command{c.indent, true, d.doc}, stack)
+			stack = append(stack, command{c.indent, flat, d.doc})
+		case line:
+			if c.flat && d == spaceLine {
+				out = append(out, ' ')
+				col++
+				continue
+			}
+			if c.flat && d == softLine {
+				continue
+			}
+			out = trimSpaces(out)
+			if d == blankLine {
+				out = append(out, '\n')
+			}
+			out = append(out, '\n')
+			out = append(out, strings.Repeat(indentation, c.indent)...)
+			col = c.indent * len(indentation)
+		}
+	}
+
+	return string(trimSpaces(out))
+}
+
+// fits reports whether a flat document and the documents that follow it up
+// to the next line break fit in w columns.
+func fits(w int, next command, rest []command) bool {
+	stack := []command{next}
+
+	for w >= 0 {
+		if len(stack) == 0 {
+			if len(rest) == 0 {
+				return true
+			}
+			stack = append(stack, rest[len(rest)-1])
+			rest = rest[:len(rest)-1]
+			continue
+		}
+
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch d := c.doc.(type) {
+		case text:
+			w -= utf8.RuneCountInString(string(d))
+		case concat:
+			for i := len(d) - 1; i >= 0; i-- {
+				stack = append(stack, command{c.indent, c.flat, d[i]})
+			}
+		case nest:
+			stack = append(stack, command{c.indent + 1, c.flat, d.doc})
+		case *group:
+			stack = append(stack, command{c.indent, c.flat && !d.broken, d.doc})
+		case line:
+			if !c.flat || d == hardLine || d == blankLine {
+				return true
+			}
+			if d == spaceLine {
+				w--
+			}
+		}
+	}
+
+	return false
+}
+
+// trimSpaces removes the spaces ending the last line printed.
+func trimSpaces(out []byte) []byte {
+	for len(out) > 0 && out[len(out)-1] == ' ' {
+		out = out[:len(out)-1]
+	}
+
+	return out
+}
@@ -0,0 +1,635 @@
+// Package format implements the canonical layout of giggle source code, the
+// layout only depends on the syntax tree so formatting is idempotent, the
+// comments and the blank lines separating statements are kept.
+package format
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/actuallyachraf/monkey-giggle/ast"
+	"github.com/actuallyachraf/monkey-giggle/lexer"
+	"github.com/actuallyachraf/monkey-giggle/parser"
+	"github.com/actuallyachraf/monkey-giggle/token"
+)
+
+// Layout rules :
+// - blocks are indented by four spaces and kept on a single line when they
+//   hold a single statement and fit in 80 columns.
+// - arrays, hashmaps and call arguments that don't fit are broken with an
+//   element per line, a function passed as last argument is broken instead.
+// - operators are surrounded by spaces and parentheses are only kept where
+//   precedence requires them, chains of operators that don't fit are broken
+//   after each operator of the lowest precedence with the operands indented.
+// - let, return and throw statements end with a semicolon, expression
+//   statements too unless they end a block or the program or are if, match or
+//   try expressions the next statement can't continue.
+// - at most one blank line separates statements, comments are printed before
+//   the statement, list element or match arm that follows them or at the end
+//   of the line of the one they end. Comments between two blocks of an if or
+//   a try expression end the first block.
+
+// Source formats source code, source code with syntax errors isn't formatted
+// and the first parser.Error is returned.
+func Source(src []byte) ([]byte, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.Parse()
+	if errs := p.SyntaxErrors(); len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	pr := &printer{lines: strings.Split(string(src), "\n"), comments: program.Comments}
+	out := render(pr.statements(program.Statements, token.Position{}))
+	if out == "" {
+		return []byte{}, nil
+	}
+
+	return []byte(out + "\n"), nil
+}
+
+// Node formats a node of the syntax tree, comments are not printed.
+func Node(node ast.Node) string {
+	p := &printer{}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		return render(p.statements(node.Statements, token.Position{}))
+	case *ast.BlockStatement:
+		return render(newGroup(p.block(node)))
+	case ast.Statement:
+		return render(p.statement(node, nil))
+	case ast.Expression:
+		return render(p.expression(node))
+	default:
+		return node.String()
+	}
+}
+
+// printer builds the documents of nodes.
+type printer struct {
+	// lines are the lines of the source code, nil when formatting nodes
+	lines []string
+	// comments are the comments left to print
+	comments []*ast.Comment
+}
+
+// statements builds the document of a list of statements, the comments
+// before end are printed with them. Comments left are all printed when end is
+// invalid.
+func (p *printer) statements(stmts []ast.Statement, end token.Position) doc {
+	parts := concat{}
+	separate := func(pos token.Position) {
+		switch {
+		case len(parts) == 0:
+		case p.blankBefore(pos):
+			parts = append(parts, blankLine)
+		default:
+			parts = append(parts, hardLine)
+		}
+	}
+
+	for i, stmt := range stmts {
+		for c := p.nextComment(stmt.Pos(), false); c != nil; c = p.nextComment(stmt.Pos(), false) {
+			separate(c.Pos())
+			parts = append(parts, comment(c))
+		}
+
+		var next ast.Statement
+		boundary := end
+		if i+1 < len(stmts) {
+			next = stmts[i+1]
+			boundary = next.Pos()
+		}
+		separate(stmt.Pos())
+		parts = append(parts, p.statement(stmt, next))
+
+		// comments ending the lines of the statement follow it
+		for c, n := p.nextComment(boundary, true), 0; c != nil; c, n = p.nextComment(boundary, true), n+1 {
+			if n == 0 {
+				parts = append(parts, text(" "), comment(c))
+			} else {
+				parts = append(parts, hardLine, comment(c))
+			}
+		}
+	}
+
+	for c := p.nextComment(end, false); c != nil; c = p.nextComment(end, false) {
+		separate(c.Pos())
+		parts = append(parts, comment(c))
+	}
+
+	return parts
+}
+
+// nextComment returns the next comment to print if it is before pos, with
+// trailing set only comments ending a line of code are returned.
+func (p *printer) nextComment(pos token.Position, trailing bool) *ast.Comment {
+	if len(p.comments) == 0 {
+		return nil
+	}
+	c := p.comments[0]
+	if pos.IsValid() && !before(c.Pos(), pos) {
+		return nil
+	}
+	if trailing && !p.endsLine(c) {
+		return nil
+	}
+	p.comments = p.comments[1:]
+
+	return c
+}
+
+// endsLine reports whether a comment follows code on its line.
+func (p *printer) endsLine(c *ast.Comment) bool {
+	pos := c.Pos()
+	if pos.Line < 1 || pos.Line > len(p.lines) {
+		return false
+	}
+	line := p.lines[pos.Line-1]
+	if pos.Column-1 > len(line) {
+		return false
+	}
+
+	return strings.TrimSpace(line[:pos.Column-1]) != ""
+}
+
+// blankBefore reports whether the line before pos is blank in the source.
+func (p *printer) blankBefore(pos token.Position) bool {
+	if pos.Line < 2 || pos.Line-1 > len(p.lines) {
+		return false
+	}
+
+	return strings.TrimSpace(p.lines[pos.Line-2]) == ""
+}
+
+// comment builds the document of a comment, nothing can follow a comment on
+// its line.
+func comment(c *ast.Comment) doc {
+	return concat{text(c.Token.Literal), breakParent{}}
+}
+
+// statement builds the document of a statement followed by next or nil.
+func (p *printer) statement(stmt ast.Statement, next ast.Statement) doc {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		d := concat{}
+		if stmt.Exported {
+			d = append(d, text("export "))
+		}
+		d = append(d, text("let "))
+		if stmt.Pattern != nil {
+			d = append(d, p.expression(stmt.Pattern))
+		} else {
+			d = append(d, p.expression(stmt.Name))
+		}
+		return append(d, text(" = "), p.expression(stmt.Value), text(";"))
+	case *ast.ReturnStatement:
+		return concat{text("return "), p.expression(stmt.ReturnValue), text(";")}
+	case *ast.ThrowStatement:
+		return concat{text("throw "), p.expression(stmt.Value), text(";")}
+	case *ast.ExpressionStatement:
+		d := p.expression(stmt.Expression)
+		if needsSemicolon(stmt, next) {
+			return concat{d, text(";")}
+		}
+		return d
+	case *ast.BlockStatement:
+		return newGroup(p.block(stmt))
+	default:
+		return text(stmt.String())
+	}
+}
+
+// needsSemicolon reports whether an expression statement followed by next
+// ends with a semicolon.
+func needsSemicolon(stmt *ast.ExpressionStatement, next ast.Statement) bool {
+	if next == nil {
+		return false
+	}
+
+	switch stmt.Expression.(type) {
+	case *ast.IfExpression, *ast.MatchExpression, *ast.TryExpression:
+		// the next statement continues the expression when it starts with
+		// an infix operator
+		start := Node(next)
+		return strings.HasPrefix(start, "(") || strings.HasPrefix(start, "[") || strings.HasPrefix(start, "-")
+	default:
+		return true
+	}
+}
+
+// block builds the document of a block, the lines of the block belong to the
+// group of the expression holding it.
+func (p *printer) block(block *ast.BlockStatement) doc {
+	return p.blockBefore(block, nil)
+}
+
+// blockBefore builds the document of a block followed by the next block of
+// its expression, the comments between the blocks end the first one.
+func (p *printer) blockBefore(block *ast.BlockStatement, next *ast.BlockStatement) doc {
+	if block == nil {
+		return text("{}")
+	}
+
+	end := block.Rbrace
+	if next != nil && next.Pos().IsValid() {
+		end = next.Pos()
+	}
+	body := p.statements(block.Statements, end)
+	if len(body.(concat)) == 0 {
+		return text("{}")
+	}
+
+	return concat{text("{"), nest{concat{spaceLine, body}}, spaceLine, text("}")}
+}
+
+// precedences maps infix operators to their precedence.
+var precedences = map[token.Literal]int{
+	"??": parser.COALESCE,
+	"==": parser.EQUALS,
+	"!=": parser.EQUALS,
+	"<":  parser.LESSGREATER,
+	">":  parser.LESSGREATER,
+	"<=": parser.LESSGREATER,
+	">=": parser.LESSGREATER,
+	"+":  parser.SUM,
+	"-":  parser.SUM,
+	"*":  parser.PRODUCT,
+	"/":  parser.PRODUCT,
+	"%":  parser.PRODUCT,
+}
+
+// precedence returns the precedence of an expression used as an operand,
+// expressions that aren't operations are never parenthesized.
+func precedence(exp ast.Expression) int {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return precedences[exp.Operator]
+	case *ast.PrefixExpression:
+		return parser.PREFIX
+	case *ast.SpreadExpression:
+		return parser.LOWEST
+	default:
+		return parser.INDEX + 1
+	}
+}
+
+// operand builds the document of an operand, operands of lower precedence than
+// min are parenthesized.
+func (p *printer) operand(exp ast.Expression, min int) doc {
+	if precedence(exp) < min {
+		return concat{text("("), p.expression(exp), text(")")}
+	}
+
+	return p.expression(exp)
+}
+
+// expression builds the document of an expression.
+func (p *printer) expression(exp ast.Expression) doc {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		return text(exp.Value)
+	case *ast.IntegerLiteral:
+		return text(strconv.FormatInt(exp.Value, 10))
+	case *ast.BigIntegerLiteral:
+		return text(exp.Value.String())
+	case *ast.StringLiteral:
+		return text(`"` + exp.Value + `"`)
+	case *ast.BooleanLiteral:
+		return text(strconv.FormatBool(exp.Value))
+	case *ast.NullLiteral:
+		return text("null")
+	case *ast.PrefixExpression:
+		return concat{text(exp.Operator), p.operand(exp.Right, parser.PREFIX)}
+	case *ast.InfixExpression:
+		return p.infix(exp)
+	case *ast.SpreadExpression:
+		return concat{text("..."), p.expression(exp.Value)}
+	case *ast.ArrayLiteral:
+		return p.list("[", p.expressions(exp.Elements, exp.Rbracket), "]", false)
+	case *ast.HashmapLiteral:
+		return p.list("{", p.pairs(exp), "}", false)
+	case *ast.CallExpression:
+		function := p.operand(exp.Function, parser.CALL)
+		args := p.expressions(exp.Arguments, exp.Rparen)
+		hug := false
+		if n := len(exp.Arguments); n > 0 {
+			_, hug = exp.Arguments[n-1].(*ast.FunctionLiteral)
+		}
+		return concat{function, p.list("(", args, ")", hug)}
+	case *ast.IndexExpression:
+		open := "["
+		if exp.Optional {
+			open = "?.["
+		}
+		return concat{p.operand(exp.Left, parser.INDEX), text(open), p.expression(exp.Index), text("]")}
+	case *ast.SliceExpression:
+		open := "["
+		if exp.Optional {
+			open = "?.["
+		}
+		d := concat{p.operand(exp.Left, parser.INDEX), text(open)}
+		if exp.Start != nil {
+			d = append(d, p.expression(exp.Start))
+		}
+		d = append(d, text(":"))
+		if exp.End != nil {
+			d = append(d, p.expression(exp.End))
+		}
+		return append(d, text("]"))
+	case *ast.FunctionLiteral:
+		return newGroup(p.parameters(exp), text(" "), p.block(exp.Body))
+	case *ast.MacroLiteral:
+		params := []element{}
+		for _, param := range exp.Parameters {
+			params = append(params, element{doc: p.expression(param)})
+		}
+		return newGroup(text("macro"), p.list("(", params, ")", false), text(" "), p.block(exp.Body))
+	case *ast.IfExpression:
+		if exp.Alternative == nil {
+			return newGroup(text("if ("), p.expression(exp.Condition), text(") "), p.block(exp.Consequence))
+		}
+		return newGroup(
+			text("if ("), p.expression(exp.Condition), text(") "), p.blockBefore(exp.Consequence, exp.Alternative),
+			text(" else "), p.block(exp.Alternative),
+		)
+	case *ast.MatchExpression:
+		return p.match(exp)
+	case *ast.TryExpression:
+		next := exp.Finally
+		if exp.Catch != nil {
+			next = exp.Catch
+		}
+		d := []doc{text("try "), p.blockBefore(exp.Block, next)}
+		if exp.Catch != nil {
+			d = append(d, text(" catch ("), p.expression(exp.Param), text(") "), p.blockBefore(exp.Catch, exp.Finally))
+		}
+		if exp.Finally != nil {
+			d = append(d, text(" finally "), p.block(exp.Finally))
+		}
+		return newGroup(d...)
+	case *ast.ImportExpression:
+		return text(`import "` + exp.Path + `"`)
+	case *ast.ArrayPattern:
+		elements := []element{}
+		for _, el := range exp.Elements {
+			elements = append(elements, element{doc: p.expression(el)})
+		}
+		if exp.Rest != nil {
+			elements = append(elements, element{doc: concat{text("..."), p.expression(exp.Rest)}})
+		}
+		return p.list("[", elements, "]", false)
+	case *ast.HashPattern:
+		fields := []element{}
+		for i, key := range exp.Keys {
+			if ident, ok := exp.Values[i].(*ast.Identifier); ok && string(ident.Value) == key.Value {
+				fields = append(fields, element{doc: p.expression(ident)})
+				continue
+			}
+			fields = append(fields, element{doc: concat{p.expression(key), text(": "), p.expression(exp.Values[i])}})
+		}
+		return p.list("{", fields, "}", false)
+	default:
+		return text(exp.String())
+	}
+}
+
+// infix builds the document of a chain of operations of the same precedence,
+// chains that don't fit are broken after every operator with the operands
+// indented. Chains holding an operand that spans several lines are never
+// broken so the operand starts on the line of its operator.
+func (p *printer) infix(exp *ast.InfixExpression) doc {
+	prec := precedences[exp.Operator]
+	operators := []token.Literal{}
+	operands := []doc{p.operand(exp.Right, prec+1)}
+	for {
+		operators = append(operators, exp.Operator)
+		left, ok := exp.Left.(*ast.InfixExpression)
+		if !ok || precedences[left.Operator] != prec {
+			break
+		}
+		exp = left
+		operands = append(operands, p.operand(exp.Right, prec+1))
+	}
+	operands = append(operands, p.operand(exp.Left, prec))
+
+	d := concat{operands[len(operands)-1]}
+	for i := len(operators) - 1; i >= 0; i-- {
+		d = append(d, text(" "+operators[i]), spaceLine, operands[i])
+	}
+	if hasBreak(d) {
+		for i := 2; i < len(d); i += 3 {
+			d[i] = text(" ")
+		}
+		return d
+	}
+
+	return newGroup(d[0], nest{d[1:]})
+}
+
+// element is an element of a delimited list, comments are the comments
+// printed before it and trailing the comments printed after its separator.
+type element struct {
+	comments concat
+	doc      doc
+	trailing concat
+}
+
+// element builds an element of a list starting at pos and followed by the
+// element or the closing delimiter at next, build builds its document once
+// the comments before it are taken.
+func (p *printer) element(pos, next token.Position, build func() doc) element {
+	el := element{}
+	if pos.IsValid() {
+		for c := p.nextComment(pos, false); c != nil; c = p.nextComment(pos, false) {
+			el.comments = append(el.comments, comment(c), hardLine)
+		}
+	}
+	el.doc = build()
+	if next.IsValid() {
+		for c := p.nextComment(next, true); c != nil; c = p.nextComment(next, true) {
+			if len(el.trailing) == 0 {
+				el.trailing = append(el.trailing, text(" "), comment(c))
+			} else {
+				el.trailing = append(el.trailing, hardLine, comment(c))
+			}
+		}
+	}
+
+	return el
+}
+
+// expressions builds the elements of a list of expressions closed at end.
+func (p *printer) expressions(exps []ast.Expression, end token.Position) []element {
+	elements := make([]element, len(exps))
+	for i, exp := range exps {
+		next := end
+		if i+1 < len(exps) {
+			next = exps[i+1].Pos()
+		}
+		elements[i] = p.element(exp.Pos(), next, func() doc { return p.expression(exp) })
+	}
+
+	return p.closeList(elements, end)
+}
+
+// closeList adds the comments left before the closing delimiter at end to
+// the last element of a list.
+func (p *printer) closeList(elements []element, end token.Position) []element {
+	if len(elements) == 0 || !end.IsValid() {
+		return elements
+	}
+	last := &elements[len(elements)-1]
+	for c := p.nextComment(end, false); c != nil; c = p.nextComment(end, false) {
+		last.trailing = append(last.trailing, hardLine, comment(c))
+	}
+
+	return elements
+}
+
+// pairs builds the elements of the pairs of a hashmap in the order of the
+// source.
+func (p *printer) pairs(hash *ast.HashmapLiteral) []element {
+	keys := make([]ast.Expression, 0, len(hash.Pairs))
+	for key := range hash.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Pos() != keys[j].Pos() {
+			return before(keys[i].Pos(), keys[j].Pos())
+		}
+		return keys[i].String() < keys[j].String()
+	})
+
+	elements := make([]element, len(keys))
+	for i, key := range keys {
+		next := hash.Rbrace
+		if i+1 < len(keys) {
+			next = keys[i+1].Pos()
+		}
+		elements[i] = p.element(key.Pos(), next, func() doc {
+			return concat{p.expression(key), text(": "), p.expression(hash.Pairs[key])}
+		})
+	}
+
+	return p.closeList(elements, hash.Rbrace)
+}
+
+// list builds the document of a delimited list, lists that don't fit are
+// broken with an element per line. A hugged list keeps its elements on the
+// line of the delimiters and lets the last element break, lists holding
+// comments are never hugged.
+func (p *printer) list(open string, elements []element, close string, hug bool) doc {
+	if len(elements) == 0 {
+		return text(open + close)
+	}
+
+	docs := make([]doc, len(elements))
+	for i, el := range elements {
+		docs[i] = el.doc
+		if len(el.comments) > 0 || len(el.trailing) > 0 {
+			hug = false
+		}
+	}
+	if hug && !hasBreak(concat(docs[:len(docs)-1])) {
+		d := concat{text(open)}
+		for _, el := range docs[:len(docs)-1] {
+			d = append(d, el, text(", "))
+		}
+		return append(d, docs[len(docs)-1], text(close))
+	}
+
+	items := concat{}
+	for i, el := range elements {
+		if i > 0 {
+			items = append(items, spaceLine)
+		}
+		items = append(items, el.comments, el.doc)
+		if i+1 < len(elements) {
+			items = append(items, text(","))
+		}
+		items = append(items, el.trailing)
+	}
+
+	return newGroup(text(open), nest{concat{softLine, items}}, softLine, text(close))
+}
+
+// parameters builds the document of the keyword and the parameters of a
+// function.
+func (p *printer) parameters(fn *ast.FunctionLiteral) doc {
+	params := []element{}
+	for i, param := range fn.Parameters {
+		d := p.expression(param)
+		if pattern := fn.Pattern(i); pattern != nil {
+			d = p.expression(pattern)
+		}
+		if def := fn.Default(i); def != nil {
+			d = concat{d, text(" = "), p.expression(def)}
+		}
+		params = append(params, element{doc: d})
+	}
+	if fn.Rest != nil {
+		params = append(params, element{doc: concat{text("..."), p.expression(fn.Rest)}})
+	}
+
+	return concat{text("fn"), p.list("(", params, ")", false)}
+}
+
+// match builds the document of a match expression, arms are always printed
+// on their own line.
+func (p *printer) match(exp *ast.MatchExpression) doc {
+	head := concat{text("match ("), p.expression(exp.Value), text(") ")}
+	if len(exp.Arms) == 0 {
+		return append(head, text("{}"))
+	}
+
+	arms := concat{}
+	for i, arm := range exp.Arms {
+		next := exp.Rbrace
+		if i+1 < len(exp.Arms) {
+			next = exp.Arms[i+1].Pattern.Pos()
+		}
+		el := p.element(arm.Pattern.Pos(), next, func() doc {
+			d := concat{p.expression(arm.Pattern)}
+			if arm.Guard != nil {
+				d = append(d, text(" if "), p.expression(arm.Guard))
+			}
+			return append(d, text(" => "), p.armBody(arm.Body))
+		})
+		if i > 0 {
+			arms = append(arms, hardLine)
+		}
+		arms = append(arms, el.comments, el.doc)
+		if i+1 < len(exp.Arms) {
+			arms = append(arms, text(","))
+		}
+		arms = append(arms, el.trailing)
+	}
+	if exp.Rbrace.IsValid() {
+		for c := p.nextComment(exp.Rbrace, false); c != nil; c = p.nextComment(exp.Rbrace, false) {
+			arms = append(arms, hardLine, comment(c))
+		}
+	}
+
+	return append(head, text("{"), nest{concat{hardLine, arms}}, hardLine, text("}"))
+}
+
+// armBody builds the document of the body of a match arm, bodies written as
+// a single expression have no closing brace.
+func (p *printer) armBody(body *ast.BlockStatement) doc {
+	if body.Rbrace.IsValid() || len(body.Statements) != 1 {
+		return newGroup(p.block(body))
+	}
+	stmt, ok := body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		return newGroup(p.block(body))
+	}
+
+	return p.expression(stmt.Expression)
+}
+
+// before reports whether a position is strictly before another.
+func before(a, b token.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
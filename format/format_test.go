@@ -0,0 +1,227 @@
+package format
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/actuallyachraf/monkey-giggle/ast"
+	"github.com/actuallyachraf/monkey-giggle/lexer"
+	"github.com/actuallyachraf/monkey-giggle/parser"
+	"github.com/actuallyachraf/monkey-giggle/stdlib"
+	"github.com/actuallyachraf/monkey-giggle/token"
+)
+
+func TestFormat(t *testing.T) {
+	t.Run("TestLayout", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"let   a=1+2*3", "let a = 1 + 2 * 3;\n"},
+			{"let b = ((1 + 2)) * 3;", "let b = (1 + 2) * 3;\n"},
+			{"1 - (2 - 3); (1 - 2) - 3", "1 - (2 - 3);\n1 - 2 - 3\n"},
+			{"-(a + b) * !c", "-(a + b) * !c\n"},
+			{"(-f)(1)[0]", "(-f)(1)[0]\n"},
+			{"a ?? ((b ?? c) == d)", "a ?? (b ?? c) == d\n"},
+			{"xs?.[0][1:][:2]?.[a:b]", "xs?.[0][1:][:2]?.[a:b]\n"},
+			{"f(...xs, [1,2], {\"a\":1, \"b\" : 2})", "f(...xs, [1, 2], {\"a\": 1, \"b\": 2})\n"},
+			{"export let id = fn(x) {x};", "export let id = fn(x) { x };\n"},
+			{"let f = fn([a, b], {c, \"d\": [e]}, x = 1, ...rest) { return a; };", "let f = fn([a, b], {c, \"d\": [e]}, x = 1, ...rest) { return a; };\n"},
+			{"let [a, [b], ...c] = xs; let {a, \"b\": b, \"c\": d} = h;", "let [a, [b], ...c] = xs;\nlet {a, b, \"c\": d} = h;\n"},
+			{"let f = fn() {}; let g = fn() { let x = 1; x };", "let f = fn() {};\nlet g = fn() {\n    let x = 1;\n    x\n};\n"},
+			{"if (x) { 1 } else { 2 }\nlet y = 3", "if (x) { 1 } else { 2 }\nlet y = 3;\n"},
+			{"if (x) { 1 }; -y", "if (x) { 1 };\n-y\n"},
+			{"try { throw \"x\" } catch (e) { e } finally { null }", "try { throw \"x\"; } catch (e) { e } finally { null }\n"},
+			{"let m = import \"std/strings\"", "let m = import \"std/strings\";\n"},
+			{"let n = 18446744073709551616", "let n = 18446744073709551616;\n"},
+			{
+				"match (x) { 1 => \"one\", -2 => { \"minus two\" }, [y, ...ys] if y > 0 => y, _ => null, }",
+				"match (x) {\n    1 => \"one\",\n    -2 => { \"minus two\" },\n    [y, ...ys] if y > 0 => y,\n    _ => null\n}\n",
+			},
+			{
+				"let xs = [\"alpha\", \"beta\", \"gamma\", \"delta\", \"epsilon\", \"zeta\", \"eta\", \"theta\", \"iota\"];",
+				"let xs = [\n    \"alpha\",\n    \"beta\",\n    \"gamma\",\n    \"delta\",\n    \"epsilon\",\n    \"zeta\",\n    \"eta\",\n    \"theta\",\n    \"iota\"\n];\n",
+			},
+			{
+				"map(numbers, fn(number) { if (number > threshold) { number * factor } else { number } })",
+				"map(numbers, fn(number) {\n    if (number > threshold) { number * factor } else { number }\n})\n",
+			},
+			{
+				"let f = fn(a) { fn(b) { if (a > b) { [a, b, a + b, a * b, a - b, a / b, a % b, b % a] } else { null } } };",
+				"let f = fn(a) {\n    fn(b) {\n        if (a > b) {\n            [a, b, a + b, a * b, a - b, a / b, a % b, b % a]\n        } else {\n            null\n        }\n    }\n};\n",
+			},
+			{
+				"let total = firstOperandValue + secondOperandValue + thirdOperandValue + fourthOperandValue;",
+				"let total = firstOperandValue +\n    secondOperandValue +\n    thirdOperandValue +\n    fourthOperandValue;\n",
+			},
+			{
+				"let t = aaaaaaaaaaaaaaaa * bbbbbbbbbbbbbbbbbb + cccccccccccccccccccc * dddddddddddddddddddd + 1;",
+				"let t = aaaaaaaaaaaaaaaa * bbbbbbbbbbbbbbbbbb +\n    cccccccccccccccccccc * dddddddddddddddddddd +\n    1;\n",
+			},
+			{
+				"let found = findFrom(xs[:mid], pred, offset) ?? findFrom(xs[mid:], pred, offset + mid);",
+				"let found = findFrom(xs[:mid], pred, offset) ??\n    findFrom(xs[mid:], pred, offset + mid);\n",
+			},
+			// operands spanning several lines start on the line of their operator
+			{"x ?? match (y) { _ => 1 }", "x ?? match (y) {\n    _ => 1\n}\n"},
+			{"", ""},
+		}
+
+		for _, tt := range tests {
+			formatted, err := Source([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("failed to format %q with error : %s", tt.input, err)
+			}
+			if string(formatted) != tt.expected {
+				t.Errorf("wrong layout for %q expected\n%s\ngot\n%s", tt.input, tt.expected, formatted)
+			}
+		}
+	})
+	t.Run("TestComments", func(t *testing.T) {
+		input := `// header
+
+let a = 1; // one
+let f = fn(x) { x // identity
+};
+
+
+// f doubles
+let g = fn(x) {
+  // doubled
+  let y = x * 2;
+
+  y // result
+  // done
+};
+g(a) // trailing
+// end`
+		expected := `// header
+
+let a = 1; // one
+let f = fn(x) {
+    x // identity
+};
+
+// f doubles
+let g = fn(x) {
+    // doubled
+    let y = x * 2;
+
+    y // result
+    // done
+};
+g(a) // trailing
+// end
+`
+		formatted, err := Source([]byte(input))
+		if err != nil {
+			t.Fatalf("failed to format with error : %s", err)
+		}
+		if string(formatted) != expected {
+			t.Errorf("wrong layout expected\n%s\ngot\n%s", expected, formatted)
+		}
+
+		// comments inside expressions stay with the nearest element or arm
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{
+				"let xs = [1, // one\n  // before two\n  2];",
+				"let xs = [\n    1, // one\n    // before two\n    2\n];\n",
+			},
+			{
+				"let h = {\"a\": 1, // a\n  // before b\n  \"b\": 2\n  // last\n};",
+				"let h = {\n    \"a\": 1, // a\n    // before b\n    \"b\": 2\n    // last\n};\n",
+			},
+			{
+				"match (x) {\n  // zero\n  0 => \"zero\", // z\n  _ => \"many\" // default\n}",
+				"match (x) {\n    // zero\n    0 => \"zero\", // z\n    _ => \"many\" // default\n}\n",
+			},
+			{
+				"if (x) { 1 } // after if\nelse { 2 }",
+				"if (x) {\n    1 // after if\n} else {\n    2\n}\n",
+			},
+			{
+				"f(1, // arg\n  2) // call\nlet ys = [1, 2]; // ys",
+				"f(\n    1, // arg\n    2\n); // call\nlet ys = [1, 2]; // ys\n",
+			},
+		}
+		for _, tt := range tests {
+			formatted, err := Source([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("failed to format %q with error : %s", tt.input, err)
+			}
+			if string(formatted) != tt.expected {
+				t.Errorf("wrong layout for %q expected\n%s\ngot\n%s", tt.input, tt.expected, formatted)
+			}
+			if again, _ := Source(formatted); string(again) != string(formatted) {
+				t.Errorf("formatting isn't idempotent got\n%s\nthen\n%s", formatted, again)
+			}
+		}
+	})
+	t.Run("TestIdempotence", func(t *testing.T) {
+		files, err := fs.Glob(stdlib.FS, "*.gg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			src, err := fs.ReadFile(stdlib.FS, file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the standard library is kept formatted
+			formatted, err := Source(src)
+			if err != nil {
+				t.Fatalf("failed to format %s with error : %s", file, err)
+			}
+			if string(formatted) != string(src) {
+				t.Errorf("%s isn't formatted got\n%s", file, formatted)
+			}
+		}
+
+		input := "let f = fn(a, b) { let c = [a, b, \"a long string to break the array\", \"another one\"]; match (c) { [x, ...xs] => { x }, _ => null } }; f(1, 2) // call"
+		first, err := Source([]byte(input))
+		if err != nil {
+			t.Fatalf("failed to format with error : %s", err)
+		}
+		second, err := Source(first)
+		if err != nil {
+			t.Fatalf("failed to format with error : %s", err)
+		}
+		if string(first) != string(second) {
+			t.Errorf("formatting isn't idempotent got\n%s\nthen\n%s", first, second)
+		}
+
+		// formatting keeps the syntax tree
+		before := parser.New(lexer.New(input)).Parse()
+		after := parser.New(lexer.New(string(first))).Parse()
+		if Node(before) != Node(after) || len(after.Comments) != 1 {
+			t.Errorf("formatting changed the program got\n%s", first)
+		}
+	})
+	t.Run("TestNode", func(t *testing.T) {
+		program := parser.New(lexer.New("let x = 1; // one\nx + 2")).Parse()
+		if got := Node(program); got != "let x = 1;\nx + 2" {
+			t.Errorf("wrong program layout got %q", got)
+		}
+		exp := &ast.InfixExpression{
+			Operator: "*",
+			Left:     &ast.InfixExpression{Operator: "+", Left: &ast.Identifier{Value: "a"}, Right: &ast.Identifier{Value: "b"}},
+			Right:    &ast.IntegerLiteral{Value: 2},
+		}
+		if got := Node(exp); got != "(a + b) * 2" {
+			t.Errorf("wrong expression layout got %q", got)
+		}
+	})
+	t.Run("TestSyntaxError", func(t *testing.T) {
+		_, err := Source([]byte("let x = 1;\nlet = 2;"))
+		serr, ok := err.(parser.Error)
+		if !ok {
+			t.Fatalf("expected a parser.Error got %T (%v)", err, err)
+		}
+		if serr.Pos != (token.Position{Line: 2, Column: 5}) {
+			t.Errorf("wrong error position got %s", serr.Pos)
+		}
+	})
+}
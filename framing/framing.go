@@ -0,0 +1,120 @@
+// Package framing implements the base protocol shared by the language server
+// and the debug adapter, messages are JSON objects preceded by a header whose
+// Content-Length field gives their size in bytes.
+package framing
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// MaxLength is the size of the largest message accepted, larger messages are
+// rejected before their content is allocated.
+const MaxLength = 64 << 20
+
+// Read reads a message and returns its JSON content.
+func Read(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || length < 0 {
+				return nil, fmt.Errorf("invalid Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("missing Content-Length header")
+	}
+	if length > MaxLength {
+		return nil, fmt.Errorf("message of %d bytes exceeds the limit of %d bytes", length, MaxLength)
+	}
+
+	content := make([]byte, length)
+	_, err := io.ReadFull(r, content)
+
+	return content, err
+}
+
+// Write writes a message encoded in JSON.
+func Write(w io.Writer, msg interface{}) error {
+	content, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Content-Length: %d\r\n\r\n%s", len(content), content)
+
+	return err
+}
+
+// cut slices s around the first instance of sep.
+func cut(s, sep string) (string, string, bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+
+	return s, "", false
+}
+
+// Client is connected to a server running in the same process, it is used to
+// drive servers from tests and tools.
+type Client struct {
+	in   *bufio.Reader
+	out  *io.PipeWriter
+	done chan error
+}
+
+// NewClient starts serve with the input and output of a new client.
+func NewClient(serve func(in io.Reader, out io.Writer) error) *Client {
+	requests, requestWriter := io.Pipe()
+	responseReader, responses := io.Pipe()
+
+	c := &Client{in: bufio.NewReader(responseReader), out: requestWriter, done: make(chan error, 1)}
+	go func() {
+		c.done <- serve(requests, responses)
+		responses.Close()
+	}()
+
+	return c
+}
+
+// Send sends a message to the server.
+func (c *Client) Send(msg interface{}) error {
+	return Write(c.out, msg)
+}
+
+// Receive reads the next message of the server and decodes it into msg.
+func (c *Client) Receive(msg interface{}) error {
+	content, err := Read(c.in)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, msg); err != nil {
+		return fmt.Errorf("invalid message %s : %s", content, err)
+	}
+
+	return nil
+}
+
+// Close ends the input of the server and returns the error of serve once it
+// returns, messages sent meanwhile are discarded.
+func (c *Client) Close() error {
+	c.out.Close()
+	go io.Copy(ioutil.Discard, c.in)
+
+	return <-c.done
+}
@@ -0,0 +1,89 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFraming(t *testing.T) {
+	t.Run("TestRead", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"Content-Length: 2\r\n\r\n{}", "{}"},
+			{"content-length:7\r\nContent-Type: application/json\r\n\r\n[1,2,3]", "[1,2,3]"},
+			{"Content-Length: 4\n\nnull", "null"},
+		}
+		for _, tt := range tests {
+			content, err := Read(bufio.NewReader(strings.NewReader(tt.input)))
+			if err != nil {
+				t.Fatalf("failed to read %q with error : %s", tt.input, err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("wrong content expected %s got %s", tt.expected, content)
+			}
+		}
+
+		errors := []struct {
+			input    string
+			expected string
+		}{
+			{"Content-Type: application/json\r\n\r\n{}", "missing Content-Length header"},
+			{"Content-Length: two\r\n\r\n{}", `invalid Content-Length " two"`},
+			{"Content-Length: -1\r\n\r\n{}", `invalid Content-Length " -1"`},
+			{"Content-Length: 1099511627776\r\n\r\n{}", "message of 1099511627776 bytes exceeds the limit of 67108864 bytes"},
+			{"Content-Length: 10\r\n\r\n{}", "unexpected EOF"},
+		}
+		for _, tt := range errors {
+			_, err := Read(bufio.NewReader(strings.NewReader(tt.input)))
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("wrong error for %q expected %q got %v", tt.input, tt.expected, err)
+			}
+		}
+	})
+	t.Run("TestWrite", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := Write(&buf, map[string]int{"seq": 1}); err != nil {
+			t.Fatalf("failed to write with error : %s", err)
+		}
+		if expected := "Content-Length: 9\r\n\r\n{\"seq\":1}"; buf.String() != expected {
+			t.Errorf("wrong message expected %q got %q", expected, buf.String())
+		}
+	})
+	t.Run("TestClient", func(t *testing.T) {
+		// the server echoes every message
+		c := NewClient(func(in io.Reader, out io.Writer) error {
+			r := bufio.NewReader(in)
+			for {
+				content, err := Read(r)
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if err := Write(out, json.RawMessage(content)); err != nil {
+					return err
+				}
+			}
+		})
+		if err := c.Send([]string{"giggle"}); err != nil {
+			t.Fatalf("failed to send with error : %s", err)
+		}
+		var msg []string
+		if err := c.Receive(&msg); err != nil {
+			t.Fatalf("failed to receive with error : %s", err)
+		}
+		if len(msg) != 1 || msg[0] != "giggle" {
+			t.Errorf("wrong message got %v", msg)
+		}
+		if err := c.Close(); err != nil {
+			t.Errorf("serve failed with error : %s", err)
+		}
+	})
+}
@@ -1,3 +1,3 @@
 module github.com/actuallyachraf/monkey-giggle
 
-go 1.14
+go 1.16
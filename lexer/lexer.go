@@ -3,20 +3,29 @@
 // and turn it into a token representation.
 package lexer
 
-import "github.com/actuallyachraf/monkey-giggle/token"
+import (
+	"strings"
+
+	"github.com/actuallyachraf/monkey-giggle/token"
+)
 
 // Lexer represents a lexical analysis engine.
 type Lexer struct {
-	input   string // represents the input string (TODO:replace with io.Reader)
-	pos     int    // current position in input (current char)
-	readPos int    // next position in input
-	ch      byte   // current char
+	input     string // represents the input string (TODO:replace with io.Reader)
+	pos       int    // current position in input (current char)
+	readPos   int    // next position in input
+	ch        byte   // current char
+	line      int    // line of the current char
+	lineStart int    // position in input where the current line starts
+
+	comments []token.Token // comments skipped so far
 }
 
 // New creates a new instance of lexer.
 func New(input string) *Lexer {
 	l := &Lexer{
 		input: input,
+		line:  1,
 	}
 	l.readChar()
 	return l
@@ -24,6 +33,10 @@ func New(input string) *Lexer {
 
 // readChar reads a single byte from the string and update positions.a
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.lineStart = l.readPos
+	}
 	if l.readPos >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -40,12 +53,18 @@ func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 	l.skipWhitespace()
 
+	pos := l.position()
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
 			ch := l.ch
 			l.readChar()
 			tok = token.NewLiteral(token.EQ, string(ch)+string(l.ch))
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			tok = token.NewLiteral(token.ARROW, string(ch)+string(l.ch))
 		} else {
 			tok = token.New(token.ASSIGN, l.ch)
 		}
@@ -105,6 +124,26 @@ func (l *Lexer) NextToken() token.Token {
 		} else {
 			tok = token.New(token.GT, l.ch)
 		}
+	case '.':
+		if l.peekChar() == '.' && l.peekCharAt(1) == '.' {
+			l.readChar()
+			l.readChar()
+			tok = token.NewLiteral(token.ELLIPSIS, "...")
+		} else {
+			tok = token.New(token.ILLEGAL, l.ch)
+		}
+	case '?':
+		if l.peekChar() == '?' {
+			ch := l.ch
+			l.readChar()
+			tok = token.NewLiteral(token.NULLISH, string(ch)+string(l.ch))
+		} else if l.peekChar() == '.' {
+			ch := l.ch
+			l.readChar()
+			tok = token.NewLiteral(token.OPTCHAIN, string(ch)+string(l.ch))
+		} else {
+			tok = token.New(token.ILLEGAL, l.ch)
+		}
 	case 0:
 		tok = token.Token{Type: token.EOF, Literal: token.Literal("")}
 
@@ -112,10 +151,12 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = token.Literal(l.readIdentifier())
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Type = token.INT
 			tok.Literal = token.Literal(l.readNumber())
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = token.New(token.ILLEGAL, l.ch)
@@ -125,9 +166,15 @@ func (l *Lexer) NextToken() token.Token {
 	// move to the next char
 	l.readChar()
 
+	tok.Pos = pos
 	return tok
 }
 
+// position returns the position of the current char.
+func (l *Lexer) position() token.Position {
+	return token.Position{Line: l.line, Column: l.pos - l.lineStart + 1}
+}
+
 // readIdentifier reads the next identifier
 func (l *Lexer) readIdentifier() string {
 
@@ -139,11 +186,36 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[pos:l.pos]
 }
 
-// skipWhitespace is used to escape whitespace between keywords and literal identifiers.
+// skipWhitespace is used to escape whitespace and comments between keywords
+// and literal identifiers.
 func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r':
+			l.readChar()
+		case l.ch == '/' && l.peekChar() == '/':
+			l.readComment()
+		default:
+			return
+		}
+	}
+}
+
+// readComment reads a comment up to the end of the line and records it.
+func (l *Lexer) readComment() {
+	pos := l.position()
+	start := l.pos
+	for l.ch != '\n' && l.ch != 0 {
 		l.readChar()
 	}
+
+	text := strings.TrimRight(l.input[start:l.pos], " \t\r")
+	l.comments = append(l.comments, token.Token{Type: token.COMMENT, Literal: token.Literal(text), Pos: pos})
+}
+
+// Comments returns the comments skipped so far in the order they appear.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
 }
 
 // readNumber is used to read a whole number (composed of multiplie digits).
@@ -179,6 +251,14 @@ func (l *Lexer) peekChar() byte {
 
 }
 
+// peekCharAt reads the char n positions past the next one.
+func (l *Lexer) peekCharAt(n int) byte {
+	if l.readPos+n >= len(l.input) {
+		return 0
+	}
+	return l.input[l.readPos+n]
+}
+
 // isLetter checks whether the current char is valid ASCII letter
 func isLetter(ch byte) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
@@ -66,6 +66,10 @@ func TestLexer(t *testing.T) {
 				  "foo bar"
 				  [1,2];
 				  {"foo":"bar"}
+				  null ?? a?.[1]
+				  fn(...rest)
+				  match (x) { _ => 1 }
+				  try throw catch finally import export
 				  `
 		tests := []struct {
 			expectedType    token.Type
@@ -165,6 +169,33 @@ func TestLexer(t *testing.T) {
 			{token.COLON, ":"},
 			{token.STRING, "bar"},
 			{token.RBRACE, "}"},
+			{token.NULL, "null"},
+			{token.NULLISH, "??"},
+			{token.IDENT, "a"},
+			{token.OPTCHAIN, "?."},
+			{token.LBRACKET, "["},
+			{token.INT, "1"},
+			{token.RBRACKET, "]"},
+			{token.FUNCTION, "fn"},
+			{token.LPAREN, "("},
+			{token.ELLIPSIS, "..."},
+			{token.IDENT, "rest"},
+			{token.RPAREN, ")"},
+			{token.MATCH, "match"},
+			{token.LPAREN, "("},
+			{token.IDENT, "x"},
+			{token.RPAREN, ")"},
+			{token.LBRACE, "{"},
+			{token.IDENT, "_"},
+			{token.ARROW, "=>"},
+			{token.INT, "1"},
+			{token.RBRACE, "}"},
+			{token.TRY, "try"},
+			{token.THROW, "throw"},
+			{token.CATCH, "catch"},
+			{token.FINALLY, "finally"},
+			{token.IMPORT, "import"},
+			{token.EXPORT, "export"},
 			{token.EOF, ""},
 		}
 		l := New(input)
@@ -181,4 +212,67 @@ func TestLexer(t *testing.T) {
 			}
 		}
 	})
+	t.Run("TestTokenPositions", func(t *testing.T) {
+		input := "let x = 5;\n  x == \"a\";\n\n\tfn"
+
+		tests := []struct {
+			expectedLiteral token.Literal
+			expectedPos     token.Position
+		}{
+			{"let", token.Position{Line: 1, Column: 1}},
+			{"x", token.Position{Line: 1, Column: 5}},
+			{"=", token.Position{Line: 1, Column: 7}},
+			{"5", token.Position{Line: 1, Column: 9}},
+			{";", token.Position{Line: 1, Column: 10}},
+			{"x", token.Position{Line: 2, Column: 3}},
+			{"==", token.Position{Line: 2, Column: 5}},
+			{"a", token.Position{Line: 2, Column: 8}},
+			{";", token.Position{Line: 2, Column: 11}},
+			{"fn", token.Position{Line: 4, Column: 2}},
+			{"", token.Position{Line: 4, Column: 4}},
+		}
+		l := New(input)
+
+		for i, tt := range tests {
+			tok := l.NextToken()
+			if tok.Literal != tt.expectedLiteral {
+				t.Fatalf("tests[%d] - wrong token literal : expected %q, got %q", i, tt.expectedLiteral, tok.Literal)
+			}
+			if tok.Pos != tt.expectedPos {
+				t.Fatalf("tests[%d] - wrong token position : expected %s, got %s", i, tt.expectedPos, tok.Pos)
+			}
+		}
+	})
+	t.Run("TestComments", func(t *testing.T) {
+		input := "// header\nlet x = 5 / 2; // halved  \n// end"
+
+		l := New(input)
+		types := []token.Type{}
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			types = append(types, tok.Type)
+		}
+		expected := []token.Type{token.LET, token.IDENT, token.ASSIGN, token.INT, token.DIV, token.INT, token.SEMICOLON}
+		if len(types) != len(expected) {
+			t.Fatalf("wrong tokens expected %v got %v", expected, types)
+		}
+		for i := range expected {
+			if types[i] != expected[i] {
+				t.Fatalf("wrong tokens expected %v got %v", expected, types)
+			}
+		}
+
+		comments := []token.Token{
+			{Type: token.COMMENT, Literal: "// header", Pos: token.Position{Line: 1, Column: 1}},
+			{Type: token.COMMENT, Literal: "// halved", Pos: token.Position{Line: 2, Column: 16}},
+			{Type: token.COMMENT, Literal: "// end", Pos: token.Position{Line: 3, Column: 1}},
+		}
+		if len(l.Comments()) != len(comments) {
+			t.Fatalf("wrong comments expected %v got %v", comments, l.Comments())
+		}
+		for i, c := range l.Comments() {
+			if c != comments[i] {
+				t.Errorf("wrong comment expected %v got %v", comments[i], c)
+			}
+		}
+	})
 }
@@ -0,0 +1,490 @@
+// Package lint reports common mistakes in giggle programs, programs are
+// walked with the scoping rules of the compiler using a compiler.SymbolTable
+// to resolve identifiers to the bindings defining them.
+//
+// Diagnostics on a line are suppressed by a comment ending the line or by a
+// comment alone on the line before it :
+//
+//	let x = 1; // lint:ignore unused-binding
+//	// lint:ignore wrong-arity shadowed-binding
+//	let len = fn(a) { a }(1, 2);
+//
+// A lint:ignore comment without rule IDs suppresses every rule.
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/actuallyachraf/monkey-giggle/ast"
+	"github.com/actuallyachraf/monkey-giggle/compiler"
+	"github.com/actuallyachraf/monkey-giggle/lexer"
+	"github.com/actuallyachraf/monkey-giggle/object"
+	"github.com/actuallyachraf/monkey-giggle/parser"
+	"github.com/actuallyachraf/monkey-giggle/token"
+)
+
+// Rule IDs.
+const (
+	UnusedBinding       = "unused-binding"
+	ShadowedBinding     = "shadowed-binding"
+	UnreachableCode     = "unreachable-code"
+	WrongArity          = "wrong-arity"
+	BuiltinArgumentType = "builtin-argument-type"
+)
+
+// Rules describes the rules by ID.
+var Rules = []struct {
+	ID  string
+	Doc string
+}{
+	{UnusedBinding, "let bindings and destructured or matched identifiers that are never used, exported bindings and names starting with _ are ignored"},
+	{ShadowedBinding, "bindings that hide a binding of an enclosing scope, an earlier binding of the same scope or a builtin"},
+	{UnreachableCode, "statements following a return, a throw or an if expression whose branches both return or throw"},
+	{WrongArity, "calls to builtins and functions bound by let with a number of arguments they don't accept"},
+	{BuiltinArgumentType, "builtins called with a literal argument of a type they don't accept"},
+}
+
+// ignoreDirective starts the comments suppressing diagnostics.
+const ignoreDirective = "// lint:ignore"
+
+// Diagnostic is a mistake found in a program, Rule is the ID of the rule
+// reporting it.
+type Diagnostic struct {
+	Rule    string
+	Pos     token.Position
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s (%s)", d.Pos, d.Message, d.Rule)
+}
+
+// Source lints source code and returns the diagnostics that aren't suppressed
+// ordered by position, source code with syntax errors isn't linted and the
+// first parser.Error is returned.
+func Source(src []byte) ([]Diagnostic, error) {
+	p := parser.New(lexer.New(string(src)))
+	program := p.Parse()
+	if errs := p.SyntaxErrors(); len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	l := newLinter()
+	ast.Walk(l, program)
+	l.reportUnused()
+
+	ignored := suppressions(strings.Split(string(src), "\n"), program.Comments)
+	diagnostics := []Diagnostic{}
+	for _, d := range l.diagnostics {
+		if rules, ok := ignored[d.Pos.Line]; ok && (len(rules) == 0 || rules[d.Rule]) {
+			continue
+		}
+		diagnostics = append(diagnostics, d)
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Pos, diagnostics[j].Pos
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+
+	return diagnostics, nil
+}
+
+// suppressions maps lines to the rules suppressed on them, an empty set
+// suppresses every rule.
+func suppressions(lines []string, comments []*ast.Comment) map[int]map[string]bool {
+	ignored := map[int]map[string]bool{}
+	for _, c := range comments {
+		text := string(c.Token.Literal)
+		if !strings.HasPrefix(text, ignoreDirective) {
+			continue
+		}
+		rest := text[len(ignoreDirective):]
+		if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+			continue
+		}
+
+		rules := map[string]bool{}
+		for _, rule := range strings.Fields(rest) {
+			rules[rule] = true
+		}
+
+		// comments alone on their line apply to the next line
+		line := c.Pos().Line
+		if pos := c.Pos(); line <= len(lines) && strings.TrimSpace(lines[line-1][:pos.Column-1]) == "" {
+			line++
+		}
+		ignored[line] = rules
+	}
+
+	return ignored
+}
+
+// bindingKind tells how a binding was defined.
+type bindingKind int
+
+const (
+	letBinding bindingKind = iota
+	patternBinding
+	parameterBinding
+	matchBinding
+	catchBinding
+)
+
+// binding is a name defined by a program.
+type binding struct {
+	name     string
+	pos      token.Position
+	kind     bindingKind
+	exported bool
+	used     bool
+	// fn is the function bound by a let statement
+	fn *ast.FunctionLiteral
+}
+
+// linter walks a program and collects diagnostics.
+type linter struct {
+	symbols  *compiler.SymbolTable
+	bindings map[token.Position]*binding
+	// order holds the bindings in the order they are defined
+	order []*binding
+	// defining holds the let bindings whose value is being walked, uses of
+	// a binding in its own value don't count
+	defining map[token.Position]bool
+
+	diagnostics []Diagnostic
+}
+
+// newLinter creates a linter with the builtins defined.
+func newLinter() *linter {
+	symbols := compiler.NewSymbolTable()
+	for i, builtin := range object.Builtins {
+		symbols.DefineBuiltIn(i, builtin.Name)
+	}
+
+	return &linter{
+		symbols:  symbols,
+		bindings: make(map[token.Position]*binding),
+		defining: make(map[token.Position]bool),
+	}
+}
+
+// report records a diagnostic.
+func (l *linter) report(rule string, pos token.Position, format string, args ...interface{}) {
+	l.diagnostics = append(l.diagnostics, Diagnostic{Rule: rule, Pos: pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// Visit implements ast.Visitor, nodes binding names or opening scopes are
+// walked by the linter and other nodes have their children walked by ast.Walk.
+func (l *linter) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.Program:
+		l.statements(node.Statements)
+	case *ast.BlockStatement:
+		l.statements(node.Statements)
+	case *ast.LetStatement:
+		l.let(node)
+	case *ast.Identifier:
+		l.resolve(node)
+	case *ast.FunctionLiteral:
+		l.function(node)
+	case *ast.CallExpression:
+		l.call(node)
+	case *ast.MatchExpression:
+		ast.Walk(l, node.Value)
+		arms := map[token.Position]bool{}
+		for _, arm := range node.Arms {
+			l.pattern(arm.Pattern, matchBinding, arms)
+			ast.Walk(l, arm.Guard)
+			ast.Walk(l, arm.Body)
+		}
+	case *ast.TryExpression:
+		ast.Walk(l, node.Block)
+		if node.Catch != nil {
+			l.define(node.Param, catchBinding, nil)
+			ast.Walk(l, node.Catch)
+		}
+		ast.Walk(l, node.Finally)
+	case *ast.MacroLiteral:
+		// macros are expanded before programs run
+	case nil:
+	default:
+		return l
+	}
+
+	return nil
+}
+
+// statements walks a list of statements reporting the first statement that
+// can't be reached.
+func (l *linter) statements(stmts []ast.Statement) {
+	terminated := false
+	for _, stmt := range stmts {
+		if terminated {
+			l.report(UnreachableCode, stmt.Pos(), "unreachable code")
+			terminated = false
+		}
+		ast.Walk(l, stmt)
+		if terminates(stmt) {
+			terminated = true
+		}
+	}
+}
+
+// terminates reports whether control never flows past a statement.
+func terminates(stmt ast.Statement) bool {
+	switch stmt := stmt.(type) {
+	case *ast.ReturnStatement, *ast.ThrowStatement:
+		return true
+	case *ast.ExpressionStatement:
+		exp, ok := stmt.Expression.(*ast.IfExpression)
+		return ok && exp.Alternative != nil && blockTerminates(exp.Consequence) && blockTerminates(exp.Alternative)
+	default:
+		return false
+	}
+}
+
+// blockTerminates reports whether control never flows past a block.
+func blockTerminates(block *ast.BlockStatement) bool {
+	for _, stmt := range block.Statements {
+		if terminates(stmt) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// let walks a let statement, the value is walked before the bindings of
+// patterns are defined and after the name of other bindings is.
+func (l *linter) let(stmt *ast.LetStatement) {
+	if stmt.Pattern != nil {
+		ast.Walk(l, stmt.Value)
+		l.pattern(stmt.Pattern, patternBinding, nil)
+		return
+	}
+	b := l.define(stmt.Name, letBinding, nil)
+	b.exported = stmt.Exported
+	b.fn, _ = stmt.Value.(*ast.FunctionLiteral)
+	l.defining[b.pos] = true
+	ast.Walk(l, stmt.Value)
+	delete(l.defining, b.pos)
+}
+
+// function walks a function literal in its own scope, parameters are defined
+// before their default values are walked.
+func (l *linter) function(fn *ast.FunctionLiteral) {
+	l.symbols = compiler.NewEnclosedSymbolTable(l.symbols)
+	defer func() { l.symbols = l.symbols.Outer }()
+
+	for i, param := range fn.Parameters {
+		if fn.Pattern(i) == nil {
+			l.define(param, parameterBinding, nil)
+		}
+	}
+	if fn.Rest != nil {
+		l.define(fn.Rest, parameterBinding, nil)
+	}
+	for i := range fn.Parameters {
+		ast.Walk(l, fn.Default(i))
+	}
+	for i := range fn.Parameters {
+		if pattern := fn.Pattern(i); pattern != nil {
+			l.pattern(pattern, parameterBinding, nil)
+		}
+	}
+
+	ast.Walk(l, fn.Body)
+}
+
+// pattern defines the identifiers of a destructuring or match pattern, the
+// bindings of the arms of a match are collected in arms.
+func (l *linter) pattern(pattern ast.Expression, kind bindingKind, arms map[token.Position]bool) {
+	ast.Inspect(pattern, func(node ast.Node) bool {
+		ident, ok := node.(*ast.Identifier)
+		if !ok || ident.Value == "_" && kind == matchBinding {
+			return true
+		}
+		b := l.define(ident, kind, arms)
+		if arms != nil {
+			arms[b.pos] = true
+		}
+		return true
+	})
+}
+
+// define defines the binding of an identifier reporting the binding it
+// shadows, the bindings of other arms of the same match aren't shadowed.
+func (l *linter) define(ident *ast.Identifier, kind bindingKind, arms map[token.Position]bool) *binding {
+	name := string(ident.Value)
+	if !strings.HasPrefix(name, "_") && !strings.HasPrefix(name, "$") {
+		if pos, ok := l.symbols.Definition(name); ok {
+			shadowed := l.bindings[pos]
+			// match arms and catch clauses rebind their names by design
+			rebound := shadowed != nil && (shadowed.kind == catchBinding && kind == catchBinding || arms[pos])
+			if !rebound {
+				l.report(ShadowedBinding, ident.Pos(), "%s shadows the binding defined at line %d", name, pos.Line)
+			}
+		} else if sym, ok := l.symbols.Resolve(name); ok && sym.Scope == compiler.BuiltinScope {
+			l.report(ShadowedBinding, ident.Pos(), "%s shadows the builtin %s", name, name)
+		}
+	}
+
+	l.symbols.DefineAt(name, ident.Pos())
+	b := &binding{name: name, pos: ident.Pos(), kind: kind}
+	l.bindings[b.pos] = b
+	l.order = append(l.order, b)
+
+	return b
+}
+
+// resolve marks the binding an identifier refers to as used and returns it,
+// builtins and unknown identifiers return nil.
+func (l *linter) resolve(ident *ast.Identifier) *binding {
+	if _, ok := l.symbols.Resolve(string(ident.Value)); !ok {
+		return nil
+	}
+	pos, ok := l.symbols.Definition(string(ident.Value))
+	if !ok {
+		return nil
+	}
+	b := l.bindings[pos]
+	if b != nil && !l.defining[pos] {
+		b.used = true
+	}
+
+	return b
+}
+
+// reportUnused reports the bindings that are never used.
+func (l *linter) reportUnused() {
+	for _, b := range l.order {
+		if b.used || b.exported || b.kind == parameterBinding || b.kind == catchBinding {
+			continue
+		}
+		if strings.HasPrefix(b.name, "_") || strings.HasPrefix(b.name, "$") {
+			continue
+		}
+		if b.kind == matchBinding {
+			l.report(UnusedBinding, b.pos, "%s is never used, match it with _ instead", b.name)
+			continue
+		}
+		l.report(UnusedBinding, b.pos, "%s is never used", b.name)
+	}
+}
+
+// builtinParameters holds the types accepted by the parameters of builtins,
+// a nil list accepts any type.
+var builtinParameters = map[string][][]object.Type{
+	"len":    {{object.STRING, object.ARRAY}},
+	"head":   {{object.ARRAY}},
+	"tail":   {{object.ARRAY}},
+	"last":   {{object.ARRAY}},
+	"append": {{object.ARRAY}, nil},
+	"concat": {{object.ARRAY}, {object.ARRAY}},
+	"sort":   {{object.ARRAY}},
+}
+
+// call walks a call expression checking the arguments passed to builtins and
+// to functions bound by let or called where they are defined.
+func (l *linter) call(call *ast.CallExpression) {
+	ast.Walk(l, call.Function)
+	for _, arg := range call.Arguments {
+		ast.Walk(l, arg)
+	}
+	for _, arg := range call.Arguments {
+		if _, ok := arg.(*ast.SpreadExpression); ok {
+			return
+		}
+	}
+
+	switch callee := call.Function.(type) {
+	case *ast.FunctionLiteral:
+		l.arity(call, "function", callee)
+	case *ast.Identifier:
+		name := string(callee.Value)
+		sym, ok := l.symbols.Resolve(name)
+		if !ok {
+			return
+		}
+		if sym.Scope == compiler.BuiltinScope {
+			l.builtin(call, name)
+			return
+		}
+		pos, _ := l.symbols.Definition(name)
+		if b := l.bindings[pos]; b != nil && b.fn != nil {
+			l.arity(call, name, b.fn)
+		}
+	}
+}
+
+// arity reports calls to fn with a number of arguments it doesn't accept.
+func (l *linter) arity(call *ast.CallExpression, name string, fn *ast.FunctionLiteral) {
+	max := len(fn.Parameters)
+	min := max - fn.NumDefaults()
+	got := len(call.Arguments)
+	if got >= min && (got <= max || fn.Rest != nil) {
+		return
+	}
+
+	switch {
+	case min == max && fn.Rest == nil:
+		l.report(WrongArity, call.Function.Pos(), "%s expects %d arguments got %d", name, max, got)
+	case got < min:
+		l.report(WrongArity, call.Function.Pos(), "%s expects at least %d arguments got %d", name, min, got)
+	default:
+		l.report(WrongArity, call.Function.Pos(), "%s expects at most %d arguments got %d", name, max, got)
+	}
+}
+
+// builtin checks the number of arguments of a builtin call and the types of
+// its literal arguments.
+func (l *linter) builtin(call *ast.CallExpression, name string) {
+	params, ok := builtinParameters[name]
+	if !ok {
+		return
+	}
+	if len(call.Arguments) != len(params) {
+		l.report(WrongArity, call.Function.Pos(), "%s expects %d arguments got %d", name, len(params), len(call.Arguments))
+		return
+	}
+
+	for i, arg := range call.Arguments {
+		typ, ok := literalType(arg)
+		if !ok || params[i] == nil {
+			continue
+		}
+		accepted := false
+		for _, t := range params[i] {
+			accepted = accepted || t == typ
+		}
+		if !accepted {
+			l.report(BuiltinArgumentType, arg.Pos(), "argument to `%s` not supported, got %s", name, typ)
+		}
+	}
+}
+
+// literalType returns the type of the value of a literal.
+func literalType(exp ast.Expression) (object.Type, bool) {
+	switch exp.(type) {
+	case *ast.IntegerLiteral:
+		return object.INTEGER, true
+	case *ast.BigIntegerLiteral:
+		return object.BIGINT, true
+	case *ast.StringLiteral:
+		return object.STRING, true
+	case *ast.BooleanLiteral:
+		return object.BOOLEAN, true
+	case *ast.NullLiteral:
+		return object.NULL, true
+	case *ast.ArrayLiteral:
+		return object.ARRAY, true
+	case *ast.HashmapLiteral:
+		return object.HASH, true
+	case *ast.FunctionLiteral:
+		return object.FUNCTION, true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,141 @@
+package lint
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/actuallyachraf/monkey-giggle/parser"
+	"github.com/actuallyachraf/monkey-giggle/stdlib"
+	"github.com/actuallyachraf/monkey-giggle/token"
+)
+
+func TestLint(t *testing.T) {
+	type diagnostic struct {
+		rule    string
+		line    int
+		column  int
+		message string
+	}
+	check := func(t *testing.T, input string, expected []diagnostic) {
+		t.Helper()
+		diagnostics, err := Source([]byte(input))
+		if err != nil {
+			t.Fatalf("failed to lint %q with error : %s", input, err)
+		}
+		if len(diagnostics) != len(expected) {
+			t.Fatalf("wrong number of diagnostics for %q expected %d got %v", input, len(expected), diagnostics)
+		}
+		for i, d := range expected {
+			got := diagnostics[i]
+			if got.Rule != d.rule || got.Pos != (token.Position{Line: d.line, Column: d.column}) || got.Message != d.message {
+				t.Errorf("wrong diagnostic for %q expected %s:%d:%d %s got %s", input, d.rule, d.line, d.column, d.message, got)
+			}
+		}
+	}
+
+	t.Run("TestUnusedBinding", func(t *testing.T) {
+		check(t, "let a = 1;\nlet b = 2;\nb", []diagnostic{
+			{UnusedBinding, 1, 5, "a is never used"},
+		})
+		check(t, "let [x, ...xs] = [1, 2];\nlet {y, \"z\": z} = {};\nx + z", []diagnostic{
+			{UnusedBinding, 1, 12, "xs is never used"},
+			{UnusedBinding, 2, 6, "y is never used"},
+		})
+		check(t, "match (1) { [x] => 1, y => y, _ => 0 }", []diagnostic{
+			{UnusedBinding, 1, 14, "x is never used, match it with _ instead"},
+		})
+		// recursive calls don't use the binding
+		check(t, "let loop = fn(n) { loop(n - 1) };", []diagnostic{
+			{UnusedBinding, 1, 5, "loop is never used"},
+		})
+		check(t, "export let a = 1; let _b = 2; let f = fn(x, [y], ...z) { try { 1 } catch (e) { 2 } }; f(1, [2]);", nil)
+		// uses in nested functions
+		check(t, "let g = fn() { 1 }; let f = fn() { fn() { g() } }; f()", nil)
+	})
+	t.Run("TestShadowedBinding", func(t *testing.T) {
+		check(t, "let a = 1;\nlet f = fn(a) { a };\nf(a)", []diagnostic{
+			{ShadowedBinding, 2, 12, "a shadows the binding defined at line 1"},
+		})
+		// the value of a let refers to the binding it defines
+		check(t, "let x = 1;\nlet x = x + 1;\nx", []diagnostic{
+			{UnusedBinding, 1, 5, "x is never used"},
+			{ShadowedBinding, 2, 5, "x shadows the binding defined at line 1"},
+		})
+		check(t, "let len = fn(x) { 0 };\nlen(1)", []diagnostic{
+			{ShadowedBinding, 1, 5, "len shadows the builtin len"},
+		})
+		// match arms and catch clauses rebind their names
+		check(t, "let f = fn(v) { match (v) { [x] => x, {x} => x } };\nf(1);\ntry { 1 } catch (e) { e };\ntry { 2 } catch (e) { e }", nil)
+		check(t, "let x = 1;\nmatch (x) { x => x }", []diagnostic{
+			{ShadowedBinding, 2, 13, "x shadows the binding defined at line 1"},
+		})
+	})
+	t.Run("TestUnreachableCode", func(t *testing.T) {
+		check(t, "let f = fn(x) {\n  return x;\n  let y = 1;\n  y\n};\nf(1)", []diagnostic{
+			{UnreachableCode, 3, 3, "unreachable code"},
+		})
+		check(t, "let f = fn(x) {\n  if (x) { return 1; } else { throw \"no\" }\n  2\n};\nf(1)", []diagnostic{
+			{UnreachableCode, 3, 3, "unreachable code"},
+		})
+		check(t, "let f = fn(x) { if (x) { return 1; } 2 };\nf(1)", nil)
+	})
+	t.Run("TestWrongArity", func(t *testing.T) {
+		check(t, "let add = fn(a, b) { a + b };\nadd(1);\nadd(1, 2);\nadd(1, 2, 3)", []diagnostic{
+			{WrongArity, 2, 1, "add expects 2 arguments got 1"},
+			{WrongArity, 4, 1, "add expects 2 arguments got 3"},
+		})
+		check(t, "let f = fn(a, b = 1) { a + b };\nf();\nf(1, 2, 3);\nlet g = fn(a, ...xs) { xs };\ng();\ng(1, 2, 3)", []diagnostic{
+			{WrongArity, 2, 1, "f expects at least 1 arguments got 0"},
+			{WrongArity, 3, 1, "f expects at most 2 arguments got 3"},
+			{WrongArity, 5, 1, "g expects at least 1 arguments got 0"},
+		})
+		check(t, "len(\"a\", \"b\");\nfn(x) { x }();\nlet xs = [1];\nlen(...xs)", []diagnostic{
+			{WrongArity, 1, 1, "len expects 1 arguments got 2"},
+			{WrongArity, 2, 1, "function expects 1 arguments got 0"},
+		})
+	})
+	t.Run("TestBuiltinArgumentType", func(t *testing.T) {
+		check(t, "len(1);\nhead(\"abc\");\nappend([], {});\nconcat([1], null);\nlen(\"abc\") + len([1])", []diagnostic{
+			{BuiltinArgumentType, 1, 5, "argument to `len` not supported, got INTEGER"},
+			{BuiltinArgumentType, 2, 6, "argument to `head` not supported, got STRING"},
+			{BuiltinArgumentType, 4, 13, "argument to `concat` not supported, got NULL"},
+		})
+	})
+	t.Run("TestSuppression", func(t *testing.T) {
+		input := `let a = 1; // lint:ignore unused-binding
+// lint:ignore
+let b = len(1);
+let c = len(2); // lint:ignore unused-binding
+// lint:ignore wrong-arity
+let d = 1;`
+		check(t, input, []diagnostic{
+			{BuiltinArgumentType, 4, 13, "argument to `len` not supported, got INTEGER"},
+			{UnusedBinding, 6, 5, "d is never used"},
+		})
+	})
+	t.Run("TestStandardLibrary", func(t *testing.T) {
+		files, err := fs.Glob(stdlib.FS, "*.gg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			src, err := fs.ReadFile(stdlib.FS, file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			diagnostics, err := Source(src)
+			if err != nil {
+				t.Fatalf("failed to lint %s with error : %s", file, err)
+			}
+			for _, d := range diagnostics {
+				t.Errorf("%s:%s", file, d)
+			}
+		}
+	})
+	t.Run("TestSyntaxError", func(t *testing.T) {
+		_, err := Source([]byte("let = 2;"))
+		if _, ok := err.(parser.Error); !ok {
+			t.Fatalf("expected a parser.Error got %T (%v)", err, err)
+		}
+	})
+}
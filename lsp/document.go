@@ -0,0 +1,419 @@
+package lsp
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/actuallyachraf/monkey-giggle/ast"
+	"github.com/actuallyachraf/monkey-giggle/compiler"
+	"github.com/actuallyachraf/monkey-giggle/lexer"
+	"github.com/actuallyachraf/monkey-giggle/macro"
+	"github.com/actuallyachraf/monkey-giggle/module"
+	"github.com/actuallyachraf/monkey-giggle/object"
+	"github.com/actuallyachraf/monkey-giggle/parser"
+	"github.com/actuallyachraf/monkey-giggle/token"
+)
+
+// document.go analyzes the documents opened by the client : documents are
+// parsed then compiled with the references of identifiers recorded, the
+// compiler resolves every identifier to the identifier defining it which
+// answers definition, references and hover requests. The function literals
+// of the document delimit the scopes used to complete identifiers.
+
+// document is an open document and the result of its analysis.
+type document struct {
+	uri   string
+	file  string
+	lines []string
+
+	program     *ast.Program
+	diagnostics []Diagnostic
+	references  []compiler.Reference
+	// functions are the function literals of the document and bindings
+	// maps the definition of let bindings holding a function to the function
+	functions []*ast.FunctionLiteral
+	bindings  map[token.Position]*ast.FunctionLiteral
+}
+
+// newDocument analyzes the text of a document.
+func newDocument(uri string, text string) *document {
+	d := &document{
+		uri:         uri,
+		file:        uriToPath(uri),
+		lines:       strings.Split(text, "\n"),
+		diagnostics: []Diagnostic{},
+		bindings:    make(map[token.Position]*ast.FunctionLiteral),
+	}
+
+	p := parser.New(lexer.New(text))
+	d.program = p.Parse()
+	for _, err := range p.SyntaxErrors() {
+		d.addDiagnostic(err.Pos, err.Msg)
+	}
+
+	err := d.compile()
+	if err != nil && len(d.diagnostics) == 0 {
+		// errors of the program are only meaningful once it parses
+		cerr, ok := err.(*compiler.CompileError)
+		merr, expansion := err.(macro.Error)
+		switch {
+		case expansion:
+			d.addDiagnostic(merr.Pos, merr.Msg)
+		case ok && cerr.File == d.file:
+			d.addDiagnostic(cerr.Pos, cerr.Err.Error())
+		case ok && cerr.Location() != "":
+			d.addDiagnostic(token.Position{Line: 1, Column: 1}, cerr.Location()+": "+cerr.Err.Error())
+		default:
+			d.addDiagnostic(token.Position{Line: 1, Column: 1}, err.Error())
+		}
+	}
+
+	ast.Inspect(d.program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FunctionLiteral:
+			d.functions = append(d.functions, node)
+		case *ast.LetStatement:
+			if fn, ok := node.Value.(*ast.FunctionLiteral); ok && node.Name != nil {
+				d.bindings[node.Name.Pos()] = fn
+			}
+		}
+		return true
+	})
+
+	return d
+}
+
+// compile expands and compiles the program recording the references of
+// identifiers, the references resolved before an error are kept.
+func (d *document) compile() (err error) {
+	comp := compiler.New()
+	paths := append([]string{filepath.Dir(d.file)}, module.DefaultPaths()...)
+	loader := module.NewLoader(paths...)
+	loader.Expand = macro.Expand
+	comp.SetLoader(loader)
+	comp.SetFile(d.file)
+	comp.SetFolding(false)
+	comp.SetPeephole(false)
+	comp.SetReferences(true)
+
+	defer func() {
+		// programs with syntax errors hold incomplete nodes the compiler
+		// doesn't expect
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+		d.references = comp.References()
+	}()
+
+	program, err := macro.Expand(d.program)
+	if err != nil {
+		return err
+	}
+
+	return comp.Compile(program)
+}
+
+// addDiagnostic reports an error at the word starting at pos.
+func (d *document) addDiagnostic(pos token.Position, msg string) {
+	d.diagnostics = append(d.diagnostics, Diagnostic{
+		Range:    d.toRange(pos, d.wordLength(pos)),
+		Severity: severityError,
+		Source:   "giggle",
+		Message:  msg,
+	})
+}
+
+// referenceAt returns the reference at a position of the document.
+func (d *document) referenceAt(pos Position) (compiler.Reference, bool) {
+	at := d.fromPosition(pos)
+	for _, ref := range d.references {
+		if ref.Pos.Line == at.Line && ref.Pos.Column <= at.Column && at.Column <= ref.Pos.Column+len(ref.Name) {
+			return ref, true
+		}
+	}
+
+	return compiler.Reference{}, false
+}
+
+// definition returns the location of the definition of the identifier at a
+// position.
+func (d *document) definition(pos Position) (*Location, bool) {
+	ref, ok := d.referenceAt(pos)
+	if !ok || !ref.Definition.IsValid() {
+		return nil, false
+	}
+
+	return &Location{URI: d.uri, Range: d.toRange(ref.Definition, len(ref.Name))}, true
+}
+
+// referencesOf returns the locations of the references to the binding of the
+// identifier at a position.
+func (d *document) referencesOf(pos Position, includeDeclaration bool) []Location {
+	locations := []Location{}
+	ref, ok := d.referenceAt(pos)
+	if !ok || !ref.Definition.IsValid() {
+		return locations
+	}
+
+	for _, r := range d.references {
+		if r.Definition != ref.Definition || (!includeDeclaration && r.Pos == r.Definition) {
+			continue
+		}
+		locations = append(locations, Location{URI: d.uri, Range: d.toRange(r.Pos, len(r.Name))})
+	}
+
+	return locations
+}
+
+// hover describes the identifier at a position, builtins are described by
+// their signature and bindings by their definition.
+func (d *document) hover(pos Position) (*Hover, bool) {
+	ref, ok := d.referenceAt(pos)
+	if !ok {
+		return nil, false
+	}
+
+	var value string
+	switch {
+	case ref.Scope == compiler.BuiltinScope:
+		signature, doc, ok := describeBuiltin(ref.Name)
+		if !ok {
+			return nil, false
+		}
+		value = fmt.Sprintf("```giggle\n%s\n```\n%s", signature, doc)
+	case ref.Definition.IsValid():
+		declaration := ref.Name
+		if fn, ok := d.bindings[ref.Definition]; ok {
+			declaration = fmt.Sprintf("let %s = %s", ref.Name, fn.Signature())
+		}
+		value = fmt.Sprintf("```giggle\n%s\n```\n%s binding defined at line %d", declaration, scopeName(ref.Scope), ref.Definition.Line)
+	default:
+		return nil, false
+	}
+
+	r := d.toRange(ref.Pos, len(ref.Name))
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: value}, Range: &r}, true
+}
+
+// completion returns the builtins and the bindings visible at a position,
+// bindings are visible after their definition in the function defining them.
+func (d *document) completion(pos Position) []CompletionItem {
+	at := d.fromPosition(pos)
+	items := map[string]CompletionItem{}
+
+	for _, builtin := range object.Builtins {
+		items[builtin.Name] = CompletionItem{Label: builtin.Name, Kind: completionFunction, Detail: builtin.Signature}
+	}
+	for _, ref := range d.references {
+		if ref.Pos != ref.Definition || !before(ref.Pos, at) || strings.HasPrefix(ref.Name, "$") {
+			continue
+		}
+		if fn := d.enclosingFunction(ref.Pos); fn != nil && !contains(fn, at) {
+			continue
+		}
+		item := CompletionItem{Label: ref.Name, Kind: completionVariable, Detail: scopeName(ref.Scope) + " binding"}
+		if fn, ok := d.bindings[ref.Definition]; ok {
+			item.Kind = completionFunction
+			item.Detail = fn.Signature()
+		}
+		// later definitions shadow earlier ones
+		items[ref.Name] = item
+	}
+
+	completions := make([]CompletionItem, 0, len(items))
+	for _, item := range items {
+		completions = append(completions, item)
+	}
+	sort.Slice(completions, func(i, j int) bool { return completions[i].Label < completions[j].Label })
+
+	return completions
+}
+
+// enclosingFunction returns the innermost function literal containing a
+// position, nil at the top level.
+func (d *document) enclosingFunction(pos token.Position) *ast.FunctionLiteral {
+	var enclosing *ast.FunctionLiteral
+	for _, fn := range d.functions {
+		if contains(fn, pos) && (enclosing == nil || before(enclosing.Pos(), fn.Pos())) {
+			enclosing = fn
+		}
+	}
+
+	return enclosing
+}
+
+// symbols returns the let bindings of the document, the bindings of a function
+// are the children of the binding holding it.
+func (d *document) symbols() []DocumentSymbol {
+	return d.blockSymbols(d.program.Statements)
+}
+
+// blockSymbols returns the let bindings of a list of statements.
+func (d *document) blockSymbols(statements []ast.Statement) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	for _, s := range statements {
+		let, ok := s.(*ast.LetStatement)
+		if !ok {
+			continue
+		}
+
+		if let.Name == nil {
+			// destructuring bindings are listed by identifier
+			ast.Inspect(let.Pattern, func(node ast.Node) bool {
+				if ident, ok := node.(*ast.Identifier); ok && ident.Pos().IsValid() {
+					r := d.toRange(ident.Pos(), len(ident.Value))
+					symbols = append(symbols, DocumentSymbol{Name: string(ident.Value), Kind: symbolVariable, Range: r, SelectionRange: r})
+				}
+				return true
+			})
+			continue
+		}
+
+		name := d.toRange(let.Name.Pos(), len(let.Name.Value))
+		symbol := DocumentSymbol{
+			Name:           string(let.Name.Value),
+			Kind:           symbolVariable,
+			Range:          Range{Start: d.toPosition(let.Pos()), End: name.End},
+			SelectionRange: name,
+		}
+		if fn, ok := let.Value.(*ast.FunctionLiteral); ok && fn.Body != nil {
+			symbol.Kind = symbolFunction
+			symbol.Range.End = d.toRange(fn.Body.Rbrace, 1).End
+			symbol.Children = d.blockSymbols(fn.Body.Statements)
+		}
+		symbols = append(symbols, symbol)
+	}
+
+	return symbols
+}
+
+// toPosition converts a position of the source to a position of the protocol.
+func (d *document) toPosition(pos token.Position) Position {
+	line := pos.Line - 1
+	if line < 0 || line >= len(d.lines) {
+		return Position{Line: line}
+	}
+	text := d.lines[line]
+	col := pos.Column - 1
+	if col > len(text) {
+		col = len(text)
+	}
+	if col < 0 {
+		col = 0
+	}
+
+	return Position{Line: line, Character: len(utf16.Encode([]rune(text[:col])))}
+}
+
+// toRange returns the range of length bytes starting at a position of the
+// source.
+func (d *document) toRange(pos token.Position, length int) Range {
+	end := pos
+	end.Column += length
+
+	return Range{Start: d.toPosition(pos), End: d.toPosition(end)}
+}
+
+// fromPosition converts a position of the protocol to a position of the
+// source.
+func (d *document) fromPosition(pos Position) token.Position {
+	if pos.Line < 0 || pos.Line >= len(d.lines) {
+		return token.Position{Line: pos.Line + 1, Column: 1}
+	}
+
+	text := d.lines[pos.Line]
+	units := 0
+	col := 0
+	for col < len(text) && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(text[col:])
+		units += len(utf16.Encode([]rune{r}))
+		col += size
+	}
+
+	return token.Position{Line: pos.Line + 1, Column: col + 1}
+}
+
+// wordLength returns the length of the identifier or number starting at a
+// position of the source, one for other tokens.
+func (d *document) wordLength(pos token.Position) int {
+	line := pos.Line - 1
+	if line < 0 || line >= len(d.lines) {
+		return 0
+	}
+	text := d.lines[line]
+	start := pos.Column - 1
+	if start < 0 || start >= len(text) {
+		return 0
+	}
+
+	end := start
+	for end < len(text) && isWordChar(text[end]) {
+		end++
+	}
+	if end == start {
+		return 1
+	}
+
+	return end - start
+}
+
+// isWordChar reports whether a byte is part of identifiers or numbers.
+func isWordChar(ch byte) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || '0' <= ch && ch <= '9' || ch == '_'
+}
+
+// before reports whether a position is strictly before another.
+func before(a, b token.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
+
+// contains reports whether a position is within a function literal, from
+// its keyword to the closing brace of its body.
+func contains(fn *ast.FunctionLiteral, pos token.Position) bool {
+	if fn.Body == nil || !fn.Body.Rbrace.IsValid() {
+		return !before(pos, fn.Pos())
+	}
+
+	return !before(pos, fn.Pos()) && !before(fn.Body.Rbrace, pos)
+}
+
+// scopeName returns the name of a symbol scope used in descriptions.
+func scopeName(scope compiler.SymbolScope) string {
+	switch scope {
+	case compiler.GlobalScope:
+		return "global"
+	case compiler.LocalScope:
+		return "local"
+	case compiler.FreeScope:
+		return "captured"
+	default:
+		return "builtin"
+	}
+}
+
+// describeBuiltin returns the signature and the documentation of the builtin
+// function named name.
+func describeBuiltin(name string) (string, string, bool) {
+	for _, builtin := range object.Builtins {
+		if builtin.Name == name {
+			return builtin.Signature, builtin.Doc, true
+		}
+	}
+
+	return "", "", false
+}
+
+// uriToPath returns the path of a file URI, other URIs are returned as is.
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return uri
+	}
+
+	return filepath.FromSlash(u.Path)
+}
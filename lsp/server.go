@@ -0,0 +1,232 @@
+// Package lsp implements a Language Server Protocol server for giggle
+// programs, the server reports the syntax and compilation errors of the
+// documents opened in an editor and answers definition, references, hover,
+// completion and document symbol requests.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/actuallyachraf/monkey-giggle/framing"
+)
+
+// textDocumentSyncFull synchronizes documents by sending their full content.
+const textDocumentSyncFull = 1
+
+// Server is a Language Server Protocol server communicating over a pair of
+// streams, requests are handled one at a time.
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	documents map[string]*document
+	// shutdown is set by the shutdown request, exit follows
+	shutdown bool
+}
+
+// requestError is the error of a request and its JSON-RPC error code.
+type requestError struct {
+	code int
+	msg  string
+}
+
+func (e *requestError) Error() string {
+	return e.msg
+}
+
+// NewServer creates a new server reading messages from in and writing
+// responses and notifications to out.
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		documents: make(map[string]*document),
+	}
+}
+
+// Serve handles messages until the client exits or the input ends.
+func (s *Server) Serve() error {
+	for {
+		content, err := framing.Read(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req Request
+		err = json.Unmarshal(content, &req)
+		if err != nil {
+			err = s.write(ErrorResponse{JSONRPC: "2.0", Error: ResponseError{Code: codeParseError, Message: fmt.Sprintf("invalid message: %s", err)}})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+
+		result, err := s.handle(req)
+		if req.ID == nil {
+			// notifications have no response
+			continue
+		}
+		if err != nil {
+			rerr, ok := err.(*requestError)
+			if !ok {
+				rerr = &requestError{code: codeInvalidParams, msg: err.Error()}
+			}
+			err = s.write(ErrorResponse{JSONRPC: "2.0", ID: req.ID, Error: ResponseError{Code: rerr.code, Message: rerr.msg}})
+		} else {
+			err = s.write(Response{JSONRPC: "2.0", ID: req.ID, Result: result})
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handle executes a request or a notification and returns its result.
+func (s *Server) handle(req Request) (interface{}, error) {
+	if s.shutdown {
+		return nil, &requestError{code: codeInvalidRequest, msg: "the server is shut down"}
+	}
+
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":       textDocumentSyncFull,
+				"definitionProvider":     true,
+				"referencesProvider":     true,
+				"hoverProvider":          true,
+				"completionProvider":     map[string]interface{}{},
+				"documentSymbolProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "giggle"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := decode(req, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.open(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := decode(req, &params); err != nil {
+			return nil, err
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		return nil, s.open(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := decode(req, &params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return nil, s.publish(params.TextDocument.URI, []Diagnostic{})
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		doc, err := s.decodeDocument(req, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		if location, ok := doc.definition(params.Position); ok {
+			return location, nil
+		}
+		return nil, nil
+	case "textDocument/references":
+		var params ReferenceParams
+		doc, err := s.decodeDocument(req, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return doc.referencesOf(params.Position, params.Context.IncludeDeclaration), nil
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		doc, err := s.decodeDocument(req, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		if hover, ok := doc.hover(params.Position); ok {
+			return hover, nil
+		}
+		return nil, nil
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		doc, err := s.decodeDocument(req, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return doc.completion(params.Position), nil
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		doc, err := s.decodeDocument(req, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return doc.symbols(), nil
+	default:
+		return nil, &requestError{code: codeMethodNotFound, msg: fmt.Sprintf("unsupported method %s", req.Method)}
+	}
+}
+
+// open analyzes the content of a document and publishes its diagnostics.
+func (s *Server) open(uri string, text string) error {
+	doc := newDocument(uri, text)
+	s.documents[uri] = doc
+
+	return s.publish(uri, doc.diagnostics)
+}
+
+// publish sends the diagnostics of a document.
+func (s *Server) publish(uri string, diagnostics []Diagnostic) error {
+	return s.write(Notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics},
+	})
+}
+
+// decodeDocument decodes the parameters of a request on a document and
+// returns the document, the document must be open.
+func (s *Server) decodeDocument(req Request, params interface{}, id *TextDocumentIdentifier) (*document, error) {
+	if err := decode(req, params); err != nil {
+		return nil, err
+	}
+	doc, ok := s.documents[id.URI]
+	if !ok {
+		return nil, fmt.Errorf("document %s is not open", id.URI)
+	}
+
+	return doc, nil
+}
+
+// write sends a message to the client.
+func (s *Server) write(msg interface{}) error {
+	return framing.Write(s.out, msg)
+}
+
+// decode decodes the parameters of a request.
+func decode(req Request, params interface{}) error {
+	if len(req.Params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(req.Params, params); err != nil {
+		return fmt.Errorf("invalid parameters for %s: %s", req.Method, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,375 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/actuallyachraf/monkey-giggle/framing"
+)
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	uri := "file://" + filepath.ToSlash(filepath.Join(dir, "main.gg"))
+	source := `let make = fn(k) {
+  let add = fn(v) { v + k };
+  add
+};
+let f = make(3);
+len([f(1), f(2)])`
+
+	t.Run("TestDiagnostics", func(t *testing.T) {
+		c := newClient(t)
+		c.initialize()
+
+		c.notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, Text: source}})
+		c.expectDiagnostics(uri, nil)
+
+		c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+			TextDocument:   TextDocumentItem{URI: uri, Version: 2},
+			ContentChanges: []TextDocumentContentChangeEvent{{Text: "let x = 1;\nlet y = x + zed;"}},
+		})
+		c.expectDiagnostics(uri, []Diagnostic{
+			{Range: Range{Start: Position{1, 12}, End: Position{1, 15}}, Severity: severityError, Source: "giggle", Message: "identifier not found: zed"},
+		})
+
+		c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+			TextDocument:   TextDocumentItem{URI: uri, Version: 3},
+			ContentChanges: []TextDocumentContentChangeEvent{{Text: "let x = 1;\nlet = 2;"}},
+		})
+		c.expectDiagnostics(uri, []Diagnostic{
+			{Range: Range{Start: Position{1, 4}, End: Position{1, 5}}, Severity: severityError, Source: "giggle", Message: "expected next token to be IDENT, got ASSIGN instead"},
+			{Range: Range{Start: Position{1, 4}, End: Position{1, 5}}, Severity: severityError, Source: "giggle", Message: "no prefix parse func found for token type ASSIGN"},
+		})
+
+		c.notify("textDocument/didClose", DidCloseTextDocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+		c.expectDiagnostics(uri, nil)
+		c.exit()
+	})
+	t.Run("TestNavigation", func(t *testing.T) {
+		c := newClient(t)
+		c.initialize()
+		c.notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, Text: source}})
+		c.expectDiagnostics(uri, nil)
+
+		var location *Location
+		c.request("textDocument/definition", TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{5, 12}})
+		c.expectResult(&location)
+		if location == nil || location.URI != uri || location.Range != (Range{Start: Position{4, 4}, End: Position{4, 5}}) {
+			t.Errorf("wrong definition of f got %+v", location)
+		}
+
+		// captured variables are defined by the parameter of the enclosing
+		// function
+		c.request("textDocument/definition", TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{1, 24}})
+		c.expectResult(&location)
+		if location == nil || location.Range != (Range{Start: Position{0, 14}, End: Position{0, 15}}) {
+			t.Errorf("wrong definition of k got %+v", location)
+		}
+
+		// builtins aren't defined in the document
+		c.request("textDocument/definition", TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{5, 1}})
+		c.expectResult(&location)
+		if location != nil {
+			t.Errorf("expected no definition of len got %+v", location)
+		}
+
+		var locations []Location
+		c.request("textDocument/references", ReferenceParams{
+			TextDocumentPositionParams: TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{4, 4}},
+			Context:                    ReferenceContext{IncludeDeclaration: true},
+		})
+		c.expectResult(&locations)
+		expectRanges(t, locations, []Range{
+			{Start: Position{4, 4}, End: Position{4, 5}},
+			{Start: Position{5, 5}, End: Position{5, 6}},
+			{Start: Position{5, 11}, End: Position{5, 12}},
+		})
+
+		c.request("textDocument/references", ReferenceParams{
+			TextDocumentPositionParams: TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{2, 3}},
+		})
+		c.expectResult(&locations)
+		expectRanges(t, locations, []Range{
+			{Start: Position{2, 2}, End: Position{2, 5}},
+		})
+
+		c.exit()
+	})
+	t.Run("TestHover", func(t *testing.T) {
+		c := newClient(t)
+		c.initialize()
+		c.notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, Text: source}})
+		c.expectDiagnostics(uri, nil)
+
+		tests := []struct {
+			pos      Position
+			expected string
+		}{
+			{Position{5, 0}, "```giggle\nlen(value)\n```\nreturns the number of characters of a string or the number of elements of an array"},
+			{Position{4, 9}, "```giggle\nlet make = fn(k)\n```\nglobal binding defined at line 1"},
+			{Position{2, 2}, "```giggle\nlet add = fn(v)\n```\nlocal binding defined at line 2"},
+			{Position{1, 24}, "```giggle\nk\n```\ncaptured binding defined at line 1"},
+		}
+		for _, tt := range tests {
+			var hover *Hover
+			c.request("textDocument/hover", TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: tt.pos})
+			c.expectResult(&hover)
+			if hover == nil || hover.Contents.Kind != "markdown" || hover.Contents.Value != tt.expected {
+				t.Errorf("wrong hover at %+v expected %q got %+v", tt.pos, tt.expected, hover)
+			}
+		}
+
+		var hover *Hover
+		c.request("textDocument/hover", TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{3, 0}})
+		c.expectResult(&hover)
+		if hover != nil {
+			t.Errorf("expected no hover got %+v", hover)
+		}
+
+		c.exit()
+	})
+	t.Run("TestCompletion", func(t *testing.T) {
+		c := newClient(t)
+		c.initialize()
+		c.notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, Text: source}})
+		c.expectDiagnostics(uri, nil)
+
+		tests := []struct {
+			pos      Position
+			expected []string
+		}{
+			{Position{2, 2}, []string{"add", "append", "concat", "head", "k", "last", "len", "make", "sort", "tail"}},
+			{Position{5, 0}, []string{"append", "concat", "f", "head", "last", "len", "make", "sort", "tail"}},
+		}
+		for _, tt := range tests {
+			var items []CompletionItem
+			c.request("textDocument/completion", TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: tt.pos})
+			c.expectResult(&items)
+			labels := []string{}
+			for _, item := range items {
+				labels = append(labels, item.Label)
+			}
+			if strings.Join(labels, " ") != strings.Join(tt.expected, " ") {
+				t.Errorf("wrong completion at %+v expected %v got %v", tt.pos, tt.expected, labels)
+			}
+			for _, item := range items {
+				if item.Label == "make" && (item.Kind != completionFunction || item.Detail != "fn(k)") {
+					t.Errorf("wrong completion of make got %+v", item)
+				}
+			}
+		}
+
+		c.exit()
+	})
+	t.Run("TestDocumentSymbols", func(t *testing.T) {
+		c := newClient(t)
+		c.initialize()
+		c.notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, Text: source}})
+		c.expectDiagnostics(uri, nil)
+
+		var symbols []DocumentSymbol
+		c.request("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+		c.expectResult(&symbols)
+
+		expected := []DocumentSymbol{
+			{
+				Name:           "make",
+				Kind:           symbolFunction,
+				Range:          Range{Start: Position{0, 0}, End: Position{3, 1}},
+				SelectionRange: Range{Start: Position{0, 4}, End: Position{0, 8}},
+				Children: []DocumentSymbol{{
+					Name:           "add",
+					Kind:           symbolFunction,
+					Range:          Range{Start: Position{1, 2}, End: Position{1, 27}},
+					SelectionRange: Range{Start: Position{1, 6}, End: Position{1, 9}},
+				}},
+			},
+			{
+				Name:           "f",
+				Kind:           symbolVariable,
+				Range:          Range{Start: Position{4, 0}, End: Position{4, 5}},
+				SelectionRange: Range{Start: Position{4, 4}, End: Position{4, 5}},
+			},
+		}
+		got, _ := json.Marshal(symbols)
+		want, _ := json.Marshal(expected)
+		if string(got) != string(want) {
+			t.Errorf("wrong symbols expected %s got %s", want, got)
+		}
+
+		c.exit()
+	})
+	t.Run("TestUnicode", func(t *testing.T) {
+		c := newClient(t)
+		c.initialize()
+		// columns are counted in UTF-16 code units by the protocol
+		c.notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, Text: `let s = "héllo😀"; let t = s + u;`}})
+		c.expectDiagnostics(uri, []Diagnostic{
+			{Range: Range{Start: Position{0, 31}, End: Position{0, 32}}, Severity: severityError, Source: "giggle", Message: "identifier not found: u"},
+		})
+
+		var location *Location
+		c.request("textDocument/definition", TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{0, 27}})
+		c.expectResult(&location)
+		if location == nil || location.Range != (Range{Start: Position{0, 4}, End: Position{0, 5}}) {
+			t.Errorf("wrong definition of s got %+v", location)
+		}
+
+		c.exit()
+	})
+	t.Run("TestErrors", func(t *testing.T) {
+		c := newClient(t)
+
+		c.request("textDocument/hover", TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}})
+		c.expectError(codeInvalidParams, "document "+uri+" is not open")
+		c.request("workspace/symbol", nil)
+		c.expectError(codeMethodNotFound, "unsupported method workspace/symbol")
+
+		c.request("shutdown", nil)
+		c.expectResult(nil)
+		c.request("initialize", nil)
+		c.expectError(codeInvalidRequest, "the server is shut down")
+		c.exit()
+	})
+}
+
+// expectRanges checks the ranges of locations.
+func expectRanges(t *testing.T, locations []Location, expected []Range) {
+	t.Helper()
+	if len(locations) != len(expected) {
+		t.Fatalf("wrong locations expected %+v got %+v", expected, locations)
+	}
+	for i, location := range locations {
+		if location.Range != expected[i] {
+			t.Errorf("wrong location expected %+v got %+v", expected[i], location.Range)
+		}
+	}
+}
+
+// client is a scripted client of a server running in the background.
+type client struct {
+	t    *testing.T
+	conn *framing.Client
+	id   int
+}
+
+// message holds the fields of responses and notifications.
+type message struct {
+	ID     *int
+	Method string
+	Params json.RawMessage
+	Result json.RawMessage
+	Error  *ResponseError
+}
+
+// newClient starts a server and returns a client connected to it.
+func newClient(t *testing.T) *client {
+	conn := framing.NewClient(func(in io.Reader, out io.Writer) error {
+		return NewServer(in, out).Serve()
+	})
+
+	return &client{t: t, conn: conn}
+}
+
+// initialize initializes the server.
+func (c *client) initialize() {
+	c.request("initialize", map[string]interface{}{"processId": nil, "capabilities": map[string]interface{}{}})
+	var result struct {
+		Capabilities struct {
+			TextDocumentSync   int
+			DefinitionProvider bool
+		}
+	}
+	c.expectResult(&result)
+	if result.Capabilities.TextDocumentSync != textDocumentSyncFull || !result.Capabilities.DefinitionProvider {
+		c.t.Fatalf("wrong capabilities got %+v", result)
+	}
+	c.notify("initialized", map[string]interface{}{})
+}
+
+// request sends a request.
+func (c *client) request(method string, params interface{}) {
+	c.id++
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "id": c.id, "method": method, "params": params})
+}
+
+// notify sends a notification.
+func (c *client) notify(method string, params interface{}) {
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// send sends a message.
+func (c *client) send(msg map[string]interface{}) {
+	if msg["params"] == nil {
+		delete(msg, "params")
+	}
+	if err := c.conn.Send(msg); err != nil {
+		c.t.Fatalf("failed to send %s : %s", msg["method"], err)
+	}
+}
+
+// next reads the next message.
+func (c *client) next() message {
+	var msg message
+	if err := c.conn.Receive(&msg); err != nil {
+		c.t.Fatalf("failed to read a message : %s", err)
+	}
+
+	return msg
+}
+
+// expectResult reads the successful response of the last request.
+func (c *client) expectResult(result interface{}) {
+	msg := c.next()
+	if msg.ID == nil || *msg.ID != c.id || msg.Error != nil {
+		c.t.Fatalf("expected a successful response to request %d got %+v", c.id, msg)
+	}
+	if result == nil {
+		if string(msg.Result) != "null" {
+			c.t.Fatalf("expected a null result got %s", msg.Result)
+		}
+		return
+	}
+	if err := json.Unmarshal(msg.Result, result); err != nil {
+		c.t.Fatalf("invalid result %s : %s", msg.Result, err)
+	}
+}
+
+// expectError reads the failed response of the last request.
+func (c *client) expectError(code int, expected string) {
+	msg := c.next()
+	if msg.ID == nil || *msg.ID != c.id || msg.Error == nil || msg.Error.Code != code || msg.Error.Message != expected {
+		c.t.Fatalf("expected error %d %q for request %d got %+v", code, expected, c.id, msg)
+	}
+}
+
+// expectDiagnostics reads the diagnostics published for a document.
+func (c *client) expectDiagnostics(uri string, expected []Diagnostic) {
+	msg := c.next()
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("expected diagnostics got %+v", msg)
+	}
+	var params PublishDiagnosticsParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.t.Fatalf("invalid diagnostics %s : %s", msg.Params, err)
+	}
+	if params.URI != uri || params.Diagnostics == nil || len(params.Diagnostics) != len(expected) {
+		c.t.Fatalf("wrong diagnostics for %s expected %+v got %+v", uri, expected, params)
+	}
+	for i, diagnostic := range params.Diagnostics {
+		if diagnostic != expected[i] {
+			c.t.Errorf("wrong diagnostic expected %+v got %+v", expected[i], diagnostic)
+		}
+	}
+}
+
+// exit stops the server and waits for it to return.
+func (c *client) exit() {
+	c.notify("exit", nil)
+	if err := c.conn.Close(); err != nil {
+		c.t.Errorf("Serve failed with error : %s", err)
+	}
+}
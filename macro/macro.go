@@ -0,0 +1,292 @@
+// Package macro implements the expansion of macros, a phase run on programs
+// before they are compiled or evaluated.
+//
+// Macros are defined by top-level let statements binding a macro literal and
+// called like functions, their body is evaluated with the syntax trees of the
+// arguments bound to their parameters and returns the quoted tree the call
+// expands to :
+//
+//	let unless = macro(cond, then, otherwise) {
+//	    quote(if (!unquote(cond)) { unquote(then) } else { unquote(otherwise) })
+//	};
+//
+// quote(exp) evaluates to the syntax tree of exp where unquote(exp) calls are
+// replaced by the tree of their value, integers, strings, booleans, null,
+// arrays and quotes can be unquoted.
+//
+// Expansion is hygienic : the names bound in quoted code (let bindings,
+// function parameters, match and catch bindings) are renamed to names used
+// nowhere else in the program so they never capture or shadow the names of
+// the code passed to the macro. Unquoted code and the free names of quoted
+// code are kept as they are.
+package macro
+
+import (
+	"fmt"
+
+	"github.com/actuallyachraf/monkey-giggle/ast"
+	"github.com/actuallyachraf/monkey-giggle/eval"
+	"github.com/actuallyachraf/monkey-giggle/object"
+	"github.com/actuallyachraf/monkey-giggle/token"
+)
+
+// MaxDepth is the maximum number of nested expansions, macros expanding to
+// calls of themselves would expand forever.
+const MaxDepth = 100
+
+// Error is an error raised by the expansion of macros, Pos is the position of
+// the macro call or definition.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e Error) Error() string {
+	return e.Msg
+}
+
+// Expand returns a copy of a program where macro definitions are removed and
+// macro calls are replaced by their expansion, the given program is never
+// modified.
+func Expand(program *ast.Program) (*ast.Program, error) {
+	return New().Expand(program)
+}
+
+// Expander expands the macro calls of successive programs, macros defined by
+// a program can be called by the programs expanded after it as in the REPL.
+// used holds the names of the programs to generate fresh ones.
+type Expander struct {
+	env    *object.Environment
+	macros map[string]*object.Macro
+	used   map[string]bool
+	depth  int
+	err    error
+}
+
+// New returns an expander without macros.
+func New() *Expander {
+	return &Expander{
+		env:    object.NewEnv(),
+		macros: make(map[string]*object.Macro),
+		used:   make(map[string]bool),
+	}
+}
+
+// Expand returns a copy of a program where macro definitions are removed and
+// macro calls are replaced by their expansion.
+func (e *Expander) Expand(program *ast.Program) (*ast.Program, error) {
+	e.depth, e.err = 0, nil
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok {
+			e.used[string(ident.Value)] = true
+		}
+		return true
+	})
+
+	statements := []ast.Statement{}
+	for _, stmt := range program.Statements {
+		if let, ok := stmt.(*ast.LetStatement); ok && let.Name != nil {
+			if lit, ok := let.Value.(*ast.MacroLiteral); ok {
+				if let.Exported {
+					return nil, Error{Pos: let.Pos(), Msg: fmt.Sprintf("macro %s can't be exported", let.Name.Value)}
+				}
+				e.macros[string(let.Name.Value)] = eval.Eval(lit, e.env).(*object.Macro)
+				continue
+			}
+		}
+		statements = append(statements, stmt)
+	}
+
+	var err error
+	for _, stmt := range statements {
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			if lit, ok := node.(*ast.MacroLiteral); ok && err == nil {
+				err = Error{Pos: lit.Pos(), Msg: "macros must be defined by top-level let statements"}
+			}
+			return err == nil
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	expanded := ast.Rewrite(&ast.Program{Statements: statements, Comments: program.Comments}, e.expand)
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	return expanded.(*ast.Program), nil
+}
+
+// fail records the first expansion error.
+func (e *Expander) fail(pos token.Position, format string, args ...interface{}) {
+	if e.err == nil {
+		e.err = Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+	}
+}
+
+// expand replaces a macro call by its expansion, calls in the expansion are
+// expanded in turn.
+func (e *Expander) expand(node ast.Node) ast.Node {
+	call, ok := node.(*ast.CallExpression)
+	if !ok || e.err != nil {
+		return node
+	}
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return node
+	}
+	name := string(ident.Value)
+	m, ok := e.macros[name]
+	if !ok {
+		return node
+	}
+
+	if e.depth == MaxDepth {
+		e.fail(call.Pos(), "expansion of macro %s exceeds %d nested expansions", name, MaxDepth)
+		return node
+	}
+	if len(call.Arguments) != len(m.Parameters) {
+		e.fail(call.Pos(), "macro %s expects %d arguments got %d", name, len(m.Parameters), len(call.Arguments))
+		return node
+	}
+
+	env := object.NewEnclosedEnvironment(m.Env)
+	for i, param := range m.Parameters {
+		env.Set(string(param.Value), &object.Quote{Node: call.Arguments[i]})
+	}
+	result := eval.Eval(e.hygiene(m.Body), env)
+	if ret, ok := result.(*object.ReturnValue); ok {
+		result = ret.Value
+	}
+	switch result := result.(type) {
+	case *object.Quote:
+		e.depth++
+		defer func() { e.depth-- }()
+		return ast.Rewrite(result.Node, e.expand)
+	case *object.Error:
+		e.fail(call.Pos(), "macro %s failed: %s", name, result.Message)
+	case nil:
+		e.fail(call.Pos(), "macro %s must return a quote got nothing", name)
+	default:
+		e.fail(call.Pos(), "macro %s must return a quote got %s", name, result.Type())
+	}
+
+	return node
+}
+
+// hygiene returns a copy of the body of a macro where the names bound in
+// quoted code are renamed to fresh names.
+func (e *Expander) hygiene(body *ast.BlockStatement) *ast.BlockStatement {
+	return ast.Rewrite(body, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || !isCall(call, "quote") {
+			return node
+		}
+		call.Arguments[0] = e.rename(call.Arguments[0])
+		return call
+	}).(*ast.BlockStatement)
+}
+
+// rename renames the names bound by quoted code, the identifiers of unquoted
+// code are evaluated by the macro and kept.
+func (e *Expander) rename(template ast.Expression) ast.Expression {
+	kept := map[token.Position]bool{}
+	renamed := map[token.Literal]token.Literal{}
+	bind := func(node ast.Node) {
+		ast.Inspect(node, func(node ast.Node) bool {
+			if ident, ok := node.(*ast.Identifier); ok {
+				e.bind(ident.Value, renamed)
+			}
+			return true
+		})
+	}
+
+	ast.Inspect(template, func(node ast.Node) bool {
+		if isCall(node, "unquote") {
+			ast.Inspect(node, func(node ast.Node) bool {
+				if ident, ok := node.(*ast.Identifier); ok && ident.Pos().IsValid() {
+					kept[ident.Pos()] = true
+				}
+				return true
+			})
+			return false
+		}
+
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			bind(node.Name)
+			bind(node.Pattern)
+		case *ast.FunctionLiteral:
+			for i, param := range node.Parameters {
+				bind(param)
+				bind(node.Pattern(i))
+			}
+			bind(node.Rest)
+		case *ast.MatchExpression:
+			for _, arm := range node.Arms {
+				bind(arm.Pattern)
+			}
+		case *ast.TryExpression:
+			bind(node.Param)
+		}
+		return true
+	})
+	if len(renamed) == 0 {
+		return template
+	}
+
+	return ast.Rewrite(template, func(node ast.Node) ast.Node {
+		ident, ok := node.(*ast.Identifier)
+		if !ok || kept[ident.Pos()] {
+			return node
+		}
+		if name, ok := renamed[ident.Value]; ok {
+			ident.Value = name
+			ident.Token.Literal = name
+		}
+		return ident
+	}).(ast.Expression)
+}
+
+// bind generates a fresh name for a name bound by quoted code, generated and
+// wildcard names are kept.
+func (e *Expander) bind(name token.Literal, renamed map[token.Literal]token.Literal) {
+	if _, ok := renamed[name]; ok || name == "_" || name[0] == '$' {
+		return
+	}
+
+	for i := 0; ; i++ {
+		fresh := string(name) + "_" + suffix(i)
+		if !e.used[fresh] {
+			e.used[fresh] = true
+			renamed[name] = token.Literal(fresh)
+			return
+		}
+	}
+}
+
+// suffix returns the i-th suffix of generated names, names are made of
+// letters since identifiers can't hold digits.
+func suffix(i int) string {
+	s := []byte{}
+	for {
+		s = append([]byte{byte('a' + i%26)}, s...)
+		i /= 26
+		if i == 0 {
+			return string(s)
+		}
+	}
+}
+
+// isCall reports whether a node is a call to the named function with a single
+// argument.
+func isCall(node ast.Node, name string) bool {
+	call, ok := node.(*ast.CallExpression)
+	if !ok || len(call.Arguments) != 1 {
+		return false
+	}
+	ident, ok := call.Function.(*ast.Identifier)
+
+	return ok && string(ident.Value) == name
+}
@@ -0,0 +1,122 @@
+package macro
+
+import (
+	"testing"
+
+	"github.com/actuallyachraf/monkey-giggle/ast"
+	"github.com/actuallyachraf/monkey-giggle/format"
+	"github.com/actuallyachraf/monkey-giggle/lexer"
+	"github.com/actuallyachraf/monkey-giggle/parser"
+	"github.com/actuallyachraf/monkey-giggle/token"
+)
+
+func TestMacro(t *testing.T) {
+	parse := func(t *testing.T, input string) *ast.Program {
+		t.Helper()
+		p := parser.New(lexer.New(input))
+		program := p.Parse()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("failed to parse %q with errors %v", input, p.Errors())
+		}
+		return program
+	}
+	check := func(t *testing.T, input string, expected string) {
+		t.Helper()
+		expanded, err := Expand(parse(t, input))
+		if err != nil {
+			t.Fatalf("failed to expand %q with error : %s", input, err)
+		}
+		if got := format.Node(expanded); got != expected {
+			t.Errorf("wrong expansion of %q expected\n%s\ngot\n%s", input, expected, got)
+		}
+	}
+	checkError := func(t *testing.T, input string, line int, column int, expected string) {
+		t.Helper()
+		_, err := Expand(parse(t, input))
+		merr, ok := err.(Error)
+		if !ok {
+			t.Fatalf("expected expansion of %q to fail got %v", input, err)
+		}
+		if merr.Pos != (token.Position{Line: line, Column: column}) || merr.Msg != expected {
+			t.Errorf("wrong error for %q expected %d:%d: %s got %s: %s", input, line, column, expected, merr.Pos, merr.Msg)
+		}
+	}
+
+	t.Run("TestExpand", func(t *testing.T) {
+		check(t, `
+let unless = macro(cond, then, otherwise) {
+    quote(if (!unquote(cond)) { unquote(then) } else { unquote(otherwise) })
+};
+unless(10 > 5, "no", "yes");`, `if (!(10 > 5)) { "no" } else { "yes" }`)
+		check(t, `
+let twice = macro(x) { quote(unquote(x) + unquote(x)) };
+let y = 2;
+twice(y * 3)`, "let y = 2;\ny * 3 + y * 3")
+		check(t, `
+let constant = macro() { let x = 1 + 2; quote(unquote(x) * 2) };
+constant()`, `3 * 2`)
+		check(t, `
+let reverse = macro(a, b) { quote(unquote(b) - unquote(a)) };
+fn(x) { reverse(x, 10) }`, `fn(x) { 10 - x }`)
+	})
+	t.Run("TestNestedExpansion", func(t *testing.T) {
+		check(t, `
+let inc = macro(x) { quote(unquote(x) + 1) };
+let incTwice = macro(x) { quote(inc(inc(unquote(x)))) };
+incTwice(1)`, `1 + 1 + 1`)
+		check(t, `
+let inc = macro(x) { quote(unquote(x) + 1) };
+inc(inc(1))`, `1 + 1 + 1`)
+	})
+	t.Run("TestHygiene", func(t *testing.T) {
+		check(t, `
+let swap = macro(a, b) { quote(fn() { let tmp = unquote(a); [unquote(b), tmp] }()) };
+let tmp = 1;
+let other = 2;
+swap(other, tmp)`, "let tmp = 1;\nlet other = 2;\nfn() {\n    let tmp_a = other;\n    [tmp, tmp_a]\n}()")
+		check(t, `
+let apply = macro(f) { quote(fn(x, [y, ...ys]) { unquote(f)(x) }) };
+let x_a = 1;
+apply(fn(v) { x_a + v })`, "let x_a = 1;\nfn(x_b, [y_a, ...ys_a]) { fn(v) { x_a + v }(x_b) }")
+		check(t, `
+let guard = macro(body) { quote(try { unquote(body) } catch (e) { match (e) { msg => msg } }) };
+let e = "kept";
+guard(e)`, `let e = "kept";
+try {
+    e
+} catch (e_a) {
+    match (e_a) {
+        msg_a => msg_a
+    }
+}`)
+	})
+	t.Run("TestExpanderState", func(t *testing.T) {
+		e := New()
+		if _, err := e.Expand(parse(t, `let inc = macro(x) { quote(unquote(x) + 1) };`)); err != nil {
+			t.Fatalf("failed to expand macro definition with error : %s", err)
+		}
+		expanded, err := e.Expand(parse(t, `inc(2)`))
+		if err != nil {
+			t.Fatalf("failed to expand macro call with error : %s", err)
+		}
+		if got := format.Node(expanded); got != `2 + 1` {
+			t.Errorf("wrong expansion of a macro defined by a previous program got %s", got)
+		}
+
+		program := parse(t, `let inc = macro(x) { quote(unquote(x) + 1) }; inc(2)`)
+		if _, err := Expand(program); err != nil {
+			t.Fatalf("failed to expand with error : %s", err)
+		}
+		if len(program.Statements) != 2 || format.Node(program.Statements[1]) != `inc(2)` {
+			t.Errorf("expansion modified the given program got %s", format.Node(program))
+		}
+	})
+	t.Run("TestErrors", func(t *testing.T) {
+		checkError(t, "let m = macro(x) { quote(x) };\nm(1, 2)", 2, 2, "macro m expects 1 arguments got 2")
+		checkError(t, "let m = macro() { 1 };\nm()", 2, 2, "macro m must return a quote got INTEGER")
+		checkError(t, "let m = macro() { len(1) };\nm()", 2, 2, "macro m failed: argument to `len` not supported, got INTEGER")
+		checkError(t, "let m = macro() { quote(m()) };\nm()", 1, 26, "expansion of macro m exceeds 100 nested expansions")
+		checkError(t, "export let m = macro() { quote(1) };", 1, 8, "macro m can't be exported")
+		checkError(t, "let f = fn() { let m = macro() { quote(1) }; };", 1, 24, "macros must be defined by top-level let statements")
+	})
+}
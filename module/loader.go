@@ -0,0 +1,158 @@
+// Package module implements the resolution and loading of giggle modules,
+// modules are source files found in the directories of a search path and
+// imported by their slash separated path relative to one of these directories
+// without the file extension. Modules whose path starts with std/ are loaded
+// from the embedded standard library instead.
+package module
+
+import (
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/actuallyachraf/monkey-giggle/ast"
+	"github.com/actuallyachraf/monkey-giggle/lexer"
+	"github.com/actuallyachraf/monkey-giggle/parser"
+	"github.com/actuallyachraf/monkey-giggle/stdlib"
+)
+
+// Extension is the file extension of giggle source files.
+const Extension = ".gg"
+
+// PathEnv is the environment variable holding the module search path.
+const PathEnv = "GIGGLE_PATH"
+
+// StdPrefix is the path prefix of the standard library modules.
+const StdPrefix = "std/"
+
+// Loader resolves module paths and parses module sources, it keeps track of
+// the modules being loaded to detect import cycles.
+type Loader struct {
+	Paths []string
+	Std   fs.FS
+	// Expand rewrites the programs of modules once parsed when set, it
+	// expands macros.
+	Expand func(*ast.Program) (*ast.Program, error)
+
+	programs map[string]*ast.Program
+	loading  []string
+}
+
+// NewLoader creates a new loader searching modules in paths.
+func NewLoader(paths ...string) *Loader {
+	return &Loader{
+		Paths:    paths,
+		Std:      stdlib.FS,
+		programs: make(map[string]*ast.Program),
+		loading:  []string{},
+	}
+}
+
+// DefaultPaths returns the default search path : the current directory
+// followed by the directories listed in the GIGGLE_PATH environment variable.
+func DefaultPaths() []string {
+	paths := []string{"."}
+	if env := os.Getenv(PathEnv); env != "" {
+		paths = append(paths, filepath.SplitList(env)...)
+	}
+
+	return paths
+}
+
+// Resolve returns the absolute path of the file holding a module, the first
+// directory of the search path holding the module wins. Standard library
+// modules resolve to their path in the embedded library.
+func (l *Loader) Resolve(name string) (string, error) {
+	if name == "" || path.IsAbs(name) || path.Clean(name) != name || strings.HasPrefix(name, "..") {
+		return "", fmt.Errorf("invalid module path %q", name)
+	}
+
+	if strings.HasPrefix(name, StdPrefix) {
+		file := name + Extension
+		info, err := fs.Stat(l.Std, strings.TrimPrefix(file, StdPrefix))
+		if err != nil || info.IsDir() {
+			return "", fmt.Errorf("module not found: %s", name)
+		}
+		return file, nil
+	}
+
+	for _, dir := range l.Paths {
+		file := filepath.Join(dir, filepath.FromSlash(name)+Extension)
+		info, err := os.Stat(file)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		return filepath.Abs(file)
+	}
+
+	return "", fmt.Errorf("module not found: %s", name)
+}
+
+// Enter marks a module as being loaded and returns its parsed program, entering
+// a module that is already being loaded is an import cycle. Programs are
+// parsed once and cached by file.
+func (l *Loader) Enter(name string, file string) (*ast.Program, error) {
+	for i, loading := range l.loading {
+		if loading == name {
+			cycle := append(l.loading[i:len(l.loading):len(l.loading)], name)
+			return nil, fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	program, ok := l.programs[file]
+	if !ok {
+		src, err := l.Source(file)
+		if err != nil {
+			return nil, err
+		}
+		p := parser.New(lexer.New(string(src)))
+		program = p.Parse()
+		if len(p.Errors()) != 0 {
+			return nil, fmt.Errorf("module %s: %s", name, strings.Join(p.Errors(), "; "))
+		}
+		if l.Expand != nil {
+			if program, err = l.Expand(program); err != nil {
+				return nil, fmt.Errorf("module %s: %s", name, err)
+			}
+		}
+		l.programs[file] = program
+	}
+
+	l.loading = append(l.loading, name)
+
+	return program, nil
+}
+
+// Source returns the source of a module file.
+func (l *Loader) Source(file string) ([]byte, error) {
+	if strings.HasPrefix(file, StdPrefix) {
+		return fs.ReadFile(l.Std, strings.TrimPrefix(file, StdPrefix))
+	}
+
+	return ioutil.ReadFile(file)
+}
+
+// Leave marks the last entered module as loaded.
+func (l *Loader) Leave() {
+	l.loading = l.loading[:len(l.loading)-1]
+}
+
+// Exports returns the names exported by a module program.
+func Exports(program *ast.Program) []string {
+	names := []string{}
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || !let.Exported {
+			continue
+		}
+		for _, ident := range let.Names() {
+			names = append(names, string(ident.Value))
+		}
+	}
+
+	return names
+}
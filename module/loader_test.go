@@ -0,0 +1,96 @@
+package module
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoader(t *testing.T) {
+	t.Run("TestResolve", func(t *testing.T) {
+		l := NewLoader("does-not-exist", "testdata")
+
+		file, err := l.Resolve("geometry/shapes")
+		if err != nil {
+			t.Fatalf("failed to resolve module : %s", err)
+		}
+		expected, _ := filepath.Abs(filepath.Join("testdata", "geometry", "shapes.gg"))
+		if file != expected {
+			t.Errorf("wrong module file expected %s got %s", expected, file)
+		}
+
+		tests := []struct {
+			name     string
+			expected string
+		}{
+			{"missing", "module not found: missing"},
+			{"geometry", "module not found: geometry"},
+			{"", `invalid module path ""`},
+			{"../testdata/math", `invalid module path "../testdata/math"`},
+			{"/math", `invalid module path "/math"`},
+			{"./math", `invalid module path "./math"`},
+			{"std/missing", "module not found: std/missing"},
+		}
+		file, err = l.Resolve("std/collections")
+		if err != nil || file != "std/collections.gg" {
+			t.Errorf("wrong standard module file expected std/collections.gg got %s (%v)", file, err)
+		}
+		if _, err := l.Enter("std/collections", file); err != nil {
+			t.Errorf("failed to enter standard module : %s", err)
+		}
+		l.Leave()
+
+		for _, tt := range tests {
+			_, err := l.Resolve(tt.name)
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("wrong error for %q expected %q got %v", tt.name, tt.expected, err)
+			}
+		}
+	})
+	t.Run("TestEnter", func(t *testing.T) {
+		l := NewLoader("testdata")
+
+		enter := func(name string) error {
+			file, err := l.Resolve(name)
+			if err != nil {
+				return err
+			}
+			_, err = l.Enter(name, file)
+			return err
+		}
+
+		if err := enter("cycle_a"); err != nil {
+			t.Fatalf("failed to enter module : %s", err)
+		}
+		if err := enter("cycle_b"); err != nil {
+			t.Fatalf("failed to enter module : %s", err)
+		}
+		err := enter("cycle_a")
+		if err == nil || err.Error() != "import cycle: cycle_a -> cycle_b -> cycle_a" {
+			t.Errorf("expected import cycle error got %v", err)
+		}
+		l.Leave()
+		l.Leave()
+		if err := enter("cycle_a"); err != nil {
+			t.Errorf("failed to enter module after leaving it : %s", err)
+		}
+
+		err = enter("broken")
+		if err == nil || err.Error() != "module broken: expected next token to be IDENT, got ASSIGN instead; no prefix parse func found for token type ASSIGN" {
+			t.Errorf("expected parser error got %v", err)
+		}
+	})
+	t.Run("TestExports", func(t *testing.T) {
+		l := NewLoader("testdata")
+		file, _ := l.Resolve("math")
+		program, err := l.Enter("math", file)
+		if err != nil {
+			t.Fatalf("failed to enter module : %s", err)
+		}
+
+		expected := []string{"square", "answer", "one", "two"}
+		if exports := Exports(program); !reflect.DeepEqual(exports, expected) {
+			t.Errorf("wrong exports expected %v got %v", expected, exports)
+		}
+	})
+}
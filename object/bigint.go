@@ -0,0 +1,182 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/big"
+)
+
+// ErrDivisionByZero is returned when the right operand of a division or modulo is zero.
+var ErrDivisionByZero = errors.New("division by zero")
+
+// BigInt represents arbitrary precision integers, integer arithmetic that
+// overflows 64 bits is promoted to a BigInt.
+type BigInt struct {
+	Value *big.Int
+}
+
+// Inspect implements the object interface
+func (b *BigInt) Inspect() string {
+	return b.Value.String()
+}
+
+// Type returns the big integer type enum.
+func (b *BigInt) Type() Type {
+	return BIGINT
+}
+
+// HashKey for big integers is the fnv hash of the sign and magnitude, since
+// big integers are always normalized a value that fits in an int64 is never
+// hashed as a BigInt.
+func (b *BigInt) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte{byte(b.Value.Sign() + 1)})
+	h.Write(b.Value.Bytes())
+
+	return HashKey{Type: b.Type(), Value: h.Sum64()}
+}
+
+// IsNumeric checks whether an object is an integer or a big integer.
+func IsNumeric(obj Object) bool {
+	switch obj.(type) {
+	case *Integer, *BigInt:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewBigInt returns the smallest integer object able to hold v, an Integer
+// if it fits in 64 bits and a BigInt otherwise.
+func NewBigInt(v *big.Int) Object {
+	if v.IsInt64() {
+		return &Integer{Value: v.Int64()}
+	}
+	return &BigInt{Value: v}
+}
+
+// toBig converts a numeric object to a big.Int.
+func toBig(obj Object) *big.Int {
+	switch obj := obj.(type) {
+	case *Integer:
+		return big.NewInt(obj.Value)
+	case *BigInt:
+		return obj.Value
+	default:
+		return nil
+	}
+}
+
+// ArithmeticOp applies one of the + - * / % operators to two numeric objects,
+// results that overflow int64 are promoted to BigInt.
+func ArithmeticOp(operator string, left, right Object) (Object, error) {
+	l, lok := left.(*Integer)
+	r, rok := right.(*Integer)
+	if lok && rok {
+		if res, ok, err := checkedIntegerOp(operator, l.Value, r.Value); ok || err != nil {
+			return res, err
+		}
+	}
+
+	leftVal, rightVal := toBig(left), toBig(right)
+	if leftVal == nil || rightVal == nil {
+		return nil, fmt.Errorf("unsupported types for arithmetic %s %s %s", left.Type(), operator, right.Type())
+	}
+
+	result := new(big.Int)
+	switch operator {
+	case "+":
+		result.Add(leftVal, rightVal)
+	case "-":
+		result.Sub(leftVal, rightVal)
+	case "*":
+		result.Mul(leftVal, rightVal)
+	case "/":
+		if rightVal.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		result.Quo(leftVal, rightVal)
+	case "%":
+		if rightVal.Sign() == 0 {
+			return nil, ErrDivisionByZero
+		}
+		result.Rem(leftVal, rightVal)
+	default:
+		return nil, fmt.Errorf("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+
+	return NewBigInt(result), nil
+}
+
+// checkedIntegerOp computes the operation on native integers, ok is false when
+// the result overflows and must be computed using big integers.
+func checkedIntegerOp(operator string, a, b int64) (Object, bool, error) {
+	var result int64
+
+	switch operator {
+	case "+":
+		result = a + b
+		if (b > 0 && result < a) || (b < 0 && result > a) {
+			return nil, false, nil
+		}
+	case "-":
+		result = a - b
+		if (b < 0 && result < a) || (b > 0 && result > a) {
+			return nil, false, nil
+		}
+	case "*":
+		if a == 0 || b == 0 {
+			return &Integer{Value: 0}, true, nil
+		}
+		result = a * b
+		if (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) || result/b != a {
+			return nil, false, nil
+		}
+	case "/":
+		if b == 0 {
+			return nil, false, ErrDivisionByZero
+		}
+		if a == math.MinInt64 && b == -1 {
+			return nil, false, nil
+		}
+		result = a / b
+	case "%":
+		if b == 0 {
+			return nil, false, ErrDivisionByZero
+		}
+		result = a % b
+	default:
+		return nil, false, fmt.Errorf("unknown operator: %s %s %s", INTEGER, operator, INTEGER)
+	}
+
+	return &Integer{Value: result}, true, nil
+}
+
+// Negate returns the negation of a numeric object, -math.MinInt64 is promoted
+// to a BigInt.
+func Negate(obj Object) (Object, error) {
+	switch obj := obj.(type) {
+	case *Integer:
+		if obj.Value == math.MinInt64 {
+			return NewBigInt(new(big.Int).Neg(big.NewInt(obj.Value))), nil
+		}
+		return &Integer{Value: -obj.Value}, nil
+	case *BigInt:
+		return NewBigInt(new(big.Int).Neg(obj.Value)), nil
+	default:
+		return nil, fmt.Errorf("unknown operator: -%s", obj.Type())
+	}
+}
+
+// CompareNumeric is the three way comparison of two numeric objects.
+func CompareNumeric(a, b Object) int {
+	ai, aok := a.(*Integer)
+	bi, bok := b.(*Integer)
+	if aok && bok {
+		return compareInts(ai.Value, bi.Value)
+	}
+
+	return toBig(a).Cmp(toBig(b))
+}
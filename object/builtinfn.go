@@ -1,14 +1,22 @@
 package object
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
 
-// Builtins indexes built-in functions
+// Builtins indexes built-in functions, Signature and Doc document their use.
 var Builtins = []struct {
-	Name string
-	Fn   *BuiltIn
+	Name      string
+	Signature string
+	Doc       string
+	Fn        *BuiltIn
 }{
 	{
-		Name: "len",
+		Name:      "len",
+		Signature: "len(value)",
+		Doc:       "returns the number of characters of a string or the number of elements of an array",
 		Fn: &BuiltIn{
 			func(args ...Object) Object {
 				if len(args) != 1 {
@@ -16,7 +24,7 @@ var Builtins = []struct {
 				}
 				switch arg := args[0].(type) {
 				case *String:
-					return &Integer{Value: int64(len(arg.Value))}
+					return &Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
 				case *Array:
 					return &Integer{Value: int64(len(arg.Elements))}
 				default:
@@ -26,7 +34,9 @@ var Builtins = []struct {
 			},
 		},
 	}, {
-		Name: "head",
+		Name:      "head",
+		Signature: "head(array)",
+		Doc:       "returns the first element of an array, null if it's empty",
 
 		Fn: &BuiltIn{func(args ...Object) Object {
 			if len(args) != 1 {
@@ -43,7 +53,9 @@ var Builtins = []struct {
 		},
 		},
 	}, {
-		Name: "tail",
+		Name:      "tail",
+		Signature: "tail(array)",
+		Doc:       "returns the elements of an array but the first, null if it's empty",
 		Fn: &BuiltIn{
 			Fn: func(args ...Object) Object {
 				if len(args) != 1 {
@@ -63,7 +75,9 @@ var Builtins = []struct {
 			},
 		},
 	}, {
-		Name: "last",
+		Name:      "last",
+		Signature: "last(array)",
+		Doc:       "returns the last element of an array, null if it's empty",
 		Fn: &BuiltIn{
 			Fn: func(args ...Object) Object {
 				if len(args) != 1 {
@@ -81,7 +95,9 @@ var Builtins = []struct {
 			},
 		},
 	}, {
-		Name: "append",
+		Name:      "append",
+		Signature: "append(array, value)",
+		Doc:       "returns a new array with value added at the end of array",
 		Fn: &BuiltIn{
 			Fn: func(args ...Object) Object {
 				if len(args) != 2 {
@@ -100,7 +116,9 @@ var Builtins = []struct {
 			},
 		},
 	}, {
-		Name: "concat",
+		Name:      "concat",
+		Signature: "concat(first, second)",
+		Doc:       "returns a new array with the elements of both arrays",
 		Fn: &BuiltIn{
 			Fn: func(args ...Object) Object {
 				if len(args) != 2 {
@@ -119,6 +137,29 @@ var Builtins = []struct {
 				return &Array{Elements: newElemens}
 			},
 		},
+	}, {
+		Name:      "sort",
+		Signature: "sort(array)",
+		Doc:       "returns a new array with the elements sorted in ascending order",
+		Fn: &BuiltIn{
+			Fn: func(args ...Object) Object {
+				if len(args) != 1 {
+					return newError("wrong number of arguments, expected %d got %d", 1, len(args))
+				}
+				if args[0].Type() != ARRAY {
+					return newError("argument to `sort` must be ARRAY got %s", args[0].Type())
+				}
+				arr := args[0].(*Array)
+				newElems := make([]Object, len(arr.Elements))
+				copy(newElems, arr.Elements)
+				// elements are ordered using the total order defined by Compare
+				sort.SliceStable(newElems, func(i, j int) bool {
+					return Compare(newElems[i], newElems[j]) < 0
+				})
+
+				return &Array{Elements: newElems}
+			},
+		},
 	},
 }
 
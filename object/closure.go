@@ -2,10 +2,13 @@ package object
 
 import "fmt"
 
-// Closure represents compiled closures
+// Closure represents compiled closures, Globals are the globals of the module
+// the closure was created in and GlobalNames their names by index.
 type Closure struct {
 	Fn            *CompiledFunction
 	FreeVariables []Object
+	Globals       []Object
+	GlobalNames   []string
 }
 
 // Type implements the object interface
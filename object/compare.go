@@ -0,0 +1,82 @@
+package object
+
+import "strings"
+
+// compare.go defines the total order used to sort heterogeneous values.
+//
+// Values are first ranked by their type :
+//
+//	NULL < BOOLEAN < INTEGER < STRING < ARRAY < HASH < everything else
+//
+// then values of the same type are compared by value, booleans order false
+// before true, integers and big integers numerically, strings lexicographically
+// (byte-wise) and arrays element by element with shorter prefixes first.
+// Values of the same rank that have no natural order (hashmaps, functions...)
+// compare equal so a stable sort keeps them in their original order.
+
+// typeRank returns the position of an object's type in the total order.
+func typeRank(obj Object) int {
+	switch obj.(type) {
+	case *Null:
+		return 0
+	case *Boolean:
+		return 1
+	case *Integer, *BigInt:
+		return 2
+	case *String:
+		return 3
+	case *Array:
+		return 4
+	case *HashMap:
+		return 5
+	default:
+		return 6
+	}
+}
+
+// Compare returns -1 if a orders before b, 1 if a orders after b and 0 if they
+// are equivalent under the total order described above.
+func Compare(a, b Object) int {
+	rankA, rankB := typeRank(a), typeRank(b)
+	if rankA != rankB {
+		return compareInts(int64(rankA), int64(rankB))
+	}
+
+	switch a := a.(type) {
+	case *Boolean:
+		b := b.(*Boolean)
+		if a.Value == b.Value {
+			return 0
+		}
+		if !a.Value {
+			return -1
+		}
+		return 1
+	case *Integer, *BigInt:
+		return CompareNumeric(a, b)
+	case *String:
+		return strings.Compare(a.Value, b.(*String).Value)
+	case *Array:
+		b := b.(*Array)
+		for i := 0; i < len(a.Elements) && i < len(b.Elements); i++ {
+			if c := Compare(a.Elements[i], b.Elements[i]); c != 0 {
+				return c
+			}
+		}
+		return compareInts(int64(len(a.Elements)), int64(len(b.Elements)))
+	default:
+		return 0
+	}
+}
+
+// compareInts is the three way comparison of two integers.
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,58 @@
+package object
+
+import "fmt"
+
+// destructure.go implements the shape checks performed before destructuring
+// values in let statements and function parameters.
+
+// CheckArrayShape checks that obj is an array that can be destructured into
+// n elements, with a rest pattern the array must hold at least n elements.
+func CheckArrayShape(obj Object, n int, rest bool) error {
+	array, ok := obj.(*Array)
+	if !ok {
+		return fmt.Errorf("cannot destructure %s as ARRAY", obj.Type())
+	}
+
+	length := len(array.Elements)
+	if rest && length < n {
+		return fmt.Errorf("cannot destructure ARRAY of %d elements into at least %d", length, n)
+	}
+	if !rest && length != n {
+		return fmt.Errorf("cannot destructure ARRAY of %d elements into %d", length, n)
+	}
+
+	return nil
+}
+
+// AsHash returns the hashmap destructured by hashmap patterns, modules are
+// destructured as the hashmap of their exports.
+func AsHash(obj Object) (*HashMap, bool) {
+	switch obj := obj.(type) {
+	case *HashMap:
+		return obj, true
+	case *Module:
+		return obj.Exports, true
+	default:
+		return nil, false
+	}
+}
+
+// CheckHashShape checks that obj is a hashmap holding every key.
+func CheckHashShape(obj Object, keys []Object) error {
+	hash, ok := AsHash(obj)
+	if !ok {
+		return fmt.Errorf("cannot destructure %s as HASH", obj.Type())
+	}
+
+	for _, key := range keys {
+		hashKey, ok := key.(Hashable)
+		if !ok {
+			return fmt.Errorf("invalid key for hashmap type : %s", key.Type())
+		}
+		if _, ok := hash.Pairs[hashKey.HashKey()]; !ok {
+			return fmt.Errorf("missing key %s in HASH destructuring", key.Inspect())
+		}
+	}
+
+	return nil
+}
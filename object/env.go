@@ -1,27 +1,73 @@
 package object
 
+import "github.com/actuallyachraf/monkey-giggle/module"
+
 // Environment represents binding maps for let statements.
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store   map[string]Object
+	outer   *Environment
+	modules *Modules
+}
+
+// Modules holds the state of imports shared by the environments of an
+// evaluation, Loader resolves imported modules and evaluated modules are
+// cached by file so their code runs once.
+type Modules struct {
+	Loader *module.Loader
+	cache  map[string]*Module
+}
+
+// Get returns the module evaluated from a file.
+func (m *Modules) Get(file string) (*Module, bool) {
+	mod, ok := m.cache[file]
+	return mod, ok
+}
+
+// Set caches the module evaluated from a file.
+func (m *Modules) Set(file string, mod *Module) {
+	m.cache[file] = mod
 }
 
-// NewEnv creates a new environment instance
+// NewEnv creates a new environment instance, modules are resolved with the
+// default search path.
 func NewEnv() *Environment {
+	return NewEnvWithLoader(module.NewLoader(module.DefaultPaths()...))
+}
+
+// NewEnvWithLoader creates a new environment instance whose modules are
+// resolved by a loader.
+func NewEnvWithLoader(l *module.Loader) *Environment {
 	return &Environment{
-		store: make(map[string]Object),
-		outer: nil,
+		store:   make(map[string]Object),
+		outer:   nil,
+		modules: &Modules{Loader: l, cache: make(map[string]*Module)},
+	}
+}
+
+// NewModuleEnv creates the top level environment of a module imported from
+// env, it shares the imports of env.
+func NewModuleEnv(env *Environment) *Environment {
+	return &Environment{
+		store:   make(map[string]Object),
+		outer:   nil,
+		modules: env.modules,
 	}
 }
 
 // NewEnclosedEnvironment creates an environment that extends an outer one.
 func NewEnclosedEnvironment(outerEnv *Environment) *Environment {
 	return &Environment{
-		store: make(map[string]Object),
-		outer: outerEnv,
+		store:   make(map[string]Object),
+		outer:   outerEnv,
+		modules: outerEnv.modules,
 	}
 }
 
+// Modules returns the imports of the evaluation the environment belongs to.
+func (env *Environment) Modules() *Modules {
+	return env.modules
+}
+
 // Get an object by it's binding identifier
 func (env *Environment) Get(name string) (Object, bool) {
 	obj, ok := env.store[name]
@@ -1,8 +1,10 @@
 package object
 
-// Error represents an error (a string with the error message).
+// Error represents an error (a string with the error message), errors raised
+// by a throw statement hold the thrown value.
 type Error struct {
 	Message string
+	Value   Object
 }
 
 // Type implements the Object interface.
@@ -14,3 +16,18 @@ func (e *Error) Type() Type {
 func (e *Error) Inspect() string {
 	return "ERROR :" + e.Message
 }
+
+// Throw returns the error raised when throwing a value.
+func Throw(val Object) *Error {
+	return &Error{Message: "uncaught exception: " + val.Inspect(), Value: val}
+}
+
+// Caught returns the value bound by a catch block when the error is caught,
+// that is the thrown value or the error message for runtime errors.
+func (e *Error) Caught() Object {
+	if e.Value != nil {
+		return e.Value
+	}
+
+	return &String{Value: e.Message}
+}
@@ -3,16 +3,21 @@ package object
 import (
 	"bytes"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/actuallyachraf/monkey-giggle/ast"
 	"github.com/actuallyachraf/monkey-giggle/code"
+	"github.com/actuallyachraf/monkey-giggle/token"
 )
 
 // Function represents a function literal each function gets a local environment.
 // to enforce scope rules and prevent variable shadowing.
 type Function struct {
 	Parameters []*ast.Identifier
+	Defaults   []ast.Expression
+	Patterns   []ast.Expression
+	Rest       *ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
 }
@@ -41,6 +46,25 @@ func (f *Function) Inspect() string {
 	return out.String()
 }
 
+// CheckArity checks that a function with numParams positional parameters, the
+// numDefaults last of which have a default value, and a rest parameter when
+// variadic accepts numArgs arguments.
+func CheckArity(numParams, numDefaults int, variadic bool, numArgs int) error {
+	required := numParams - numDefaults
+	if numArgs >= required && (numArgs <= numParams || variadic) {
+		return nil
+	}
+
+	switch {
+	case numDefaults == 0 && !variadic:
+		return fmt.Errorf("wrong number of parameters : want %d, got %d", numParams, numArgs)
+	case variadic:
+		return fmt.Errorf("wrong number of parameters : want at least %d, got %d", required, numArgs)
+	default:
+		return fmt.Errorf("wrong number of parameters : want %d to %d, got %d", required, numParams, numArgs)
+	}
+}
+
 // BuiltInFunc defines functions that are part of the language and operate
 // on native objects.
 type BuiltInFunc func(args ...Object) Object
@@ -60,11 +84,70 @@ func (b *BuiltIn) Inspect() string {
 	return "built-in function"
 }
 
-// CompiledFunction unlike function holds compiled bytecode instructions
+// ExceptionHandler marks the instructions in [Start, End) as protected, an
+// exception raised while they run unwinds the stack and jumps to Target with
+// the caught value on top of the stack.
+type ExceptionHandler struct {
+	Start  int
+	End    int
+	Target int
+}
+
+// CompiledFunction unlike function holds compiled bytecode instructions,
+// NumParams counts the positional parameters including the NumDefaults last
+// ones that have a default value and Variadic marks functions with a rest
+// parameter stored in the local slot right after the positional ones.
+//
+// The default values are computed by a prologue at the start of Instructions,
+// DefaultOffsets[i] is the offset where execution starts when the caller
+// passed the first i parameters with a default, the last entry being the
+// start of the function body.
+//
+// Handlers is the exception handler table of the function, OpTry operands
+// index it.
+//
+// Name is the name of the binding the function was defined with, File the
+// source file it was compiled from and Positions its line table, LocalNames
+// and FreeNames are the names of its local bindings and free variables by
+// index.
 type CompiledFunction struct {
-	Instructions code.Instructions
-	NumLocals    int
-	NumParams    int
+	Instructions   code.Instructions
+	NumLocals      int
+	NumParams      int
+	NumDefaults    int
+	DefaultOffsets []int
+	Variadic       bool
+	Handlers       []ExceptionHandler
+	Name           string
+	File           string
+	Positions      []SourcePosition
+	LocalNames     []string
+	FreeNames      []string
+}
+
+// SourcePosition maps the instructions starting at Offset, up to the offset of
+// the next entry of a line table, to the position of the source code they
+// were compiled from. Line tables are sorted by offset.
+type SourcePosition struct {
+	Offset int
+	Pos    token.Position
+}
+
+// PositionAt returns the source position of the instruction at ip, the zero
+// position when the line table doesn't cover it.
+func (c *CompiledFunction) PositionAt(ip int) token.Position {
+	return PositionAt(c.Positions, ip)
+}
+
+// PositionAt returns the source position of the instruction at ip in a line
+// table.
+func PositionAt(positions []SourcePosition, ip int) token.Position {
+	i := sort.Search(len(positions), func(i int) bool { return positions[i].Offset > ip })
+	if i == 0 {
+		return token.Position{}
+	}
+
+	return positions[i-1].Pos
 }
 
 // Type implements the object interface
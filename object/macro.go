@@ -0,0 +1,54 @@
+package object
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/actuallyachraf/monkey-giggle/ast"
+)
+
+// Quote represents the syntax tree of a quoted expression, macros receive
+// their arguments as quotes and return the quote their call expands to.
+type Quote struct {
+	Node ast.Node
+}
+
+// Type implements the object interface
+func (q *Quote) Type() Type {
+	return QUOTE
+}
+
+// Inspect implements the object interface
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
+
+// Macro represents a macro defined by a macro literal.
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+// Type implements the object interface
+func (m *Macro) Type() Type {
+	return MACRO
+}
+
+// Inspect implements the object interface
+func (m *Macro) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range m.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("macro(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(m.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
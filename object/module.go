@@ -0,0 +1,54 @@
+package object
+
+import "fmt"
+
+// Module represents an imported module, exported bindings are accessed by
+// indexing the module with their name.
+type Module struct {
+	Name    string
+	Exports *HashMap
+}
+
+// Type implements the object interface
+func (m *Module) Type() Type {
+	return MODULE
+}
+
+// Inspect implements the object interface
+func (m *Module) Inspect() string {
+	return fmt.Sprintf("module(%s)", m.Name)
+}
+
+// Export returns the value of an exported binding.
+func (m *Module) Export(name Object) (Object, error) {
+	key, ok := name.(*String)
+	if !ok {
+		return nil, fmt.Errorf("module export name must be STRING got %s", name.Type())
+	}
+	pair, ok := m.Exports.Pairs[key.HashKey()]
+	if !ok {
+		return nil, fmt.Errorf("module %s has no export %s", m.Name, key.Value)
+	}
+
+	return pair.Value, nil
+}
+
+// CompiledModule holds the compiled code of a module, the code runs once with
+// its own globals and returns the module object. GlobalNames are the names of
+// the globals by index.
+type CompiledModule struct {
+	Name        string
+	Fn          *CompiledFunction
+	NumGlobals  int
+	GlobalNames []string
+}
+
+// Type implements the object interface
+func (cm *CompiledModule) Type() Type {
+	return COMPILEDMODULE
+}
+
+// Inspect implements the object interface
+func (cm *CompiledModule) Inspect() string {
+	return fmt.Sprintf("CompiledModule[%s]", cm.Name)
+}
@@ -3,6 +3,8 @@ package object
 const (
 	// INTEGER are wrapped 64 integer values.
 	INTEGER = "INTEGER"
+	// BIGINT are arbitrary precision integers produced when integer arithmetic overflows.
+	BIGINT = "BIGINT"
 	// BOOLEAN represents a wrapped bool value.
 	BOOLEAN = "BOOLEAN"
 	// STRING represents a wrapped Go string
@@ -25,6 +27,14 @@ const (
 	COMPILEDFUNC = "COMPILEDFUNC"
 	// CLOSURE represents a closure (a function that returns a new function)
 	CLOSURE = "CLOSURE"
+	// MODULE represents an imported module
+	MODULE = "MODULE"
+	// COMPILEDMODULE represents the compiled code of a module
+	COMPILEDMODULE = "COMPILEDMODULE"
+	// QUOTE represents a quoted syntax tree
+	QUOTE = "QUOTE"
+	// MACRO represents a macro
+	MACRO = "MACRO"
 )
 
 // Type represents the type of a given object.
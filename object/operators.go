@@ -0,0 +1,144 @@
+package object
+
+import "fmt"
+
+// operators.go implements the semantics of the infix and index operators
+// shared by the evaluator and the virtual machine, both engines rely on these
+// helpers so programs produce the same values and error messages whichever
+// engine runs them.
+
+// Truthy reports whether a value is considered true by conditionals, false and
+// null are the only falsy values.
+func Truthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null, nil:
+		return false
+	default:
+		return true
+	}
+}
+
+// Equal reports whether two values are equal, numbers, strings, booleans and
+// null compare by value while other values compare by identity. Values of
+// different types are never equal.
+func Equal(a, b Object) bool {
+	if IsNumeric(a) && IsNumeric(b) {
+		return CompareNumeric(a, b) == 0
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *String:
+		return a.Value == b.(*String).Value
+	case *Boolean:
+		return a.Value == b.(*Boolean).Value
+	case *Null:
+		return true
+	default:
+		return a == b
+	}
+}
+
+// CompareOp applies one of the == != < > <= >= operators, equality is defined
+// on every value while ordering is defined on numbers and strings.
+func CompareOp(operator string, left, right Object) (bool, error) {
+	switch operator {
+	case "==":
+		return Equal(left, right), nil
+	case "!=":
+		return !Equal(left, right), nil
+	}
+
+	var cmp int
+	switch {
+	case IsNumeric(left) && IsNumeric(right):
+		cmp = CompareNumeric(left, right)
+	case left.Type() != right.Type():
+		return false, fmt.Errorf("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	case left.Type() == STRING:
+		cmp = Compare(left, right)
+	default:
+		return false, fmt.Errorf("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+
+	switch operator {
+	case "<":
+		return cmp < 0, nil
+	case ">":
+		return cmp > 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	default:
+		return false, fmt.Errorf("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// BinaryOp applies one of the + - * / % operators, arithmetic is defined on
+// numbers and + concatenates strings.
+func BinaryOp(operator string, left, right Object) (Object, error) {
+	switch {
+	case IsNumeric(left) && IsNumeric(right):
+		return ArithmeticOp(operator, left, right)
+	case left.Type() != right.Type():
+		return nil, fmt.Errorf("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	case left.Type() == STRING && operator == "+":
+		return &String{Value: left.(*String).Value + right.(*String).Value}, nil
+	default:
+		return nil, fmt.Errorf("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// HashKeyOf returns the key of a value used as a hashmap key.
+func HashKeyOf(obj Object) (HashKey, error) {
+	key, ok := obj.(Hashable)
+	if !ok {
+		return HashKey{}, fmt.Errorf("invalid key for hashmap type : %s", obj.Type())
+	}
+
+	return key.HashKey(), nil
+}
+
+// Index returns the element left[index] of an array, a string, a hashmap or a
+// module, the result is nil when an array or string index is out of range or
+// a hashmap has no such key.
+func Index(left, index Object) (Object, error) {
+	switch left := left.(type) {
+	case *Array:
+		if idx, ok := index.(*Integer); ok {
+			i, ok := NormalizeIndex(idx.Value, len(left.Elements))
+			if !ok {
+				return nil, nil
+			}
+			return left.Elements[i], nil
+		}
+	case *String:
+		if idx, ok := index.(*Integer); ok {
+			runes := []rune(left.Value)
+			i, ok := NormalizeIndex(idx.Value, len(runes))
+			if !ok {
+				return nil, nil
+			}
+			return &String{Value: string(runes[i])}, nil
+		}
+	case *HashMap:
+		key, err := HashKeyOf(index)
+		if err != nil {
+			return nil, err
+		}
+		pair, ok := left.Pairs[key]
+		if !ok {
+			return nil, nil
+		}
+		return pair.Value, nil
+	case *Module:
+		return left.Export(index)
+	}
+
+	return nil, fmt.Errorf("index operator not supported: %s[%s]", left.Type(), index.Type())
+}
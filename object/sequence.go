@@ -0,0 +1,86 @@
+package object
+
+import "fmt"
+
+// sequence.go implements index arithmetic shared by arrays and strings,
+// negative indices count from the end of the sequence so -1 is the last
+// element, strings are indexed by character (rune) like the `len` builtin
+// counts them.
+
+// NormalizeIndex resolves a possibly negative index against a sequence of the
+// given length, ok is false when the index is out of range.
+func NormalizeIndex(idx int64, length int) (int, bool) {
+	if idx < 0 {
+		idx += int64(length)
+	}
+	if idx < 0 || idx >= int64(length) {
+		return 0, false
+	}
+
+	return int(idx), true
+}
+
+// SliceBounds resolves the bounds of a slice expression seq[start:end] where
+// omitted bounds are null, bounds are clamped to the sequence so slicing never
+// fails on out of range values and an empty range is returned when start is
+// past end.
+func SliceBounds(length int, start, end Object) (int, int, error) {
+	low, err := sliceBound(start, 0, length)
+	if err != nil {
+		return 0, 0, err
+	}
+	high, err := sliceBound(end, length, length)
+	if err != nil {
+		return 0, 0, err
+	}
+	if low > high {
+		low = high
+	}
+
+	return low, high, nil
+}
+
+// sliceBound resolves a single slice bound, def is used when the bound is omitted.
+func sliceBound(bound Object, def int, length int) (int, error) {
+	switch bound := bound.(type) {
+	case nil, *Null:
+		return def, nil
+	case *Integer:
+		idx := bound.Value
+		if idx < 0 {
+			idx += int64(length)
+		}
+		if idx < 0 {
+			return 0, nil
+		}
+		if idx > int64(length) {
+			return length, nil
+		}
+		return int(idx), nil
+	default:
+		return 0, fmt.Errorf("slice bounds must be INTEGER got %s", bound.Type())
+	}
+}
+
+// Slice returns the sub-sequence seq[start:end] of an array or a string.
+func Slice(seq, start, end Object) (Object, error) {
+	switch seq := seq.(type) {
+	case *Array:
+		low, high, err := SliceBounds(len(seq.Elements), start, end)
+		if err != nil {
+			return nil, err
+		}
+		elements := make([]Object, high-low)
+		copy(elements, seq.Elements[low:high])
+		return &Array{Elements: elements}, nil
+	case *String:
+		runes := []rune(seq.Value)
+		low, high, err := SliceBounds(len(runes), start, end)
+		if err != nil {
+			return nil, err
+		}
+		return &String{Value: string(runes[low:high])}, nil
+	default:
+		return nil, fmt.Errorf("slice operator not supported: %s", seq.Type())
+	}
+}
@@ -2,7 +2,9 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 	"strconv"
 
 	"github.com/actuallyachraf/monkey-giggle/ast"
@@ -15,6 +17,8 @@ const (
 	_ int = iota
 	// LOWEST marks lowest precedence order
 	LOWEST
+	// COALESCE marks the null-coalescing operator
+	COALESCE
 	// EQUALS marks equality
 	EQUALS
 	// LESSGREATER marks lesser or greater than operations
@@ -32,6 +36,7 @@ const (
 )
 
 var precedenceTable = map[token.Type]int{
+	token.NULLISH:  COALESCE,
 	token.EQ:       EQUALS,
 	token.NEQ:      EQUALS,
 	token.LT:       LESSGREATER,
@@ -45,6 +50,7 @@ var precedenceTable = map[token.Type]int{
 	token.MOD:      PRODUCT,
 	token.LPAREN:   CALL,
 	token.LBRACKET: INDEX,
+	token.OPTCHAIN: INDEX,
 }
 
 type (
@@ -58,7 +64,11 @@ type Parser struct {
 	currToken token.Token
 	peekToken token.Token
 
-	errors []string
+	errors []Error
+
+	// blockDepth counts the blocks being parsed, exports are only allowed
+	// at the top level
+	blockDepth int
 
 	prefixParseFuncs map[token.Type]prefixParseFn
 	infixParseFuncs  map[token.Type]infixParseFn
@@ -68,7 +78,7 @@ type Parser struct {
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:                l,
-		errors:           []string{},
+		errors:           []Error{},
 		prefixParseFuncs: make(map[token.Type]prefixParseFn),
 		infixParseFuncs:  make(map[token.Type]infixParseFn),
 	}
@@ -80,14 +90,21 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.TRUE, p.parseBooleanLiteral)
 	p.registerPrefix(token.FALSE, p.parseBooleanLiteral)
+	p.registerPrefix(token.NULL, p.parseNullLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.SUB, p.parsePrefixExpression)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashmapLiteral)
+	p.registerPrefix(token.ELLIPSIS, p.parseSpreadExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
+	p.registerPrefix(token.IMPORT, p.parseImportExpression)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
 	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.OPTCHAIN, p.parseOptionalIndexExpression)
 
 	p.registerInfix(token.ADD, p.parseInfixExpression)
 	p.registerInfix(token.SUB, p.parseInfixExpression)
@@ -100,6 +117,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GE, p.parseInfixExpression)
 	p.registerInfix(token.LE, p.parseInfixExpression)
+	p.registerInfix(token.NULLISH, p.parseInfixExpression)
 
 	p.nextToken()
 	p.nextToken()
@@ -116,14 +134,40 @@ func (p *Parser) registerInfix(t token.Type, fn infixParseFn) {
 	p.infixParseFuncs[t] = fn
 }
 
+// Error is a syntax error, Pos is the position of the token that raised it.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e Error) Error() string {
+	return e.Msg
+}
+
 // Errors returns the list of errors that occured during parsing
 func (p *Parser) Errors() []string {
+	msgs := make([]string, len(p.errors))
+	for i, err := range p.errors {
+		msgs[i] = err.Msg
+	}
+
+	return msgs
+}
+
+// SyntaxErrors returns the errors that occured during parsing with their
+// position.
+func (p *Parser) SyntaxErrors() []Error {
 	return p.errors
 }
 
+// error records a syntax error raised by the token at pos.
+func (p *Parser) error(pos token.Position, msg string) {
+	p.errors = append(p.errors, Error{Pos: pos, Msg: msg})
+}
+
 func (p *Parser) peekError(t token.Type) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.error(p.peekToken.Pos, msg)
 }
 
 // nextToken reads the next token and updates the fields.
@@ -150,6 +194,9 @@ func (p *Parser) Parse() *ast.Program {
 		}
 		p.nextToken()
 	}
+	for _, comment := range p.l.Comments() {
+		program.Comments = append(program.Comments, &ast.Comment{Token: comment})
+	}
 
 	return program
 }
@@ -162,18 +209,28 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
-// parseIntegerLiteral parse a literal int from string to int64
+// parseIntegerLiteral parse a literal int from string to int64, literals too
+// large for an int64 are parsed as big integers.
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(string(p.currToken.Literal), 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		if n, ok := new(big.Int).SetString(string(p.currToken.Literal), 0); ok {
+			return &ast.BigIntegerLiteral{Token: p.currToken, Value: n}
+		}
+	}
 	if err != nil {
 		msg := fmt.Sprintf("failed to parse %q as int64", p.currToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.error(p.currToken.Pos, msg)
 		return nil
 	}
 
@@ -221,7 +278,7 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 // isn't found for a given token type.
 func (p *Parser) noPrefixParseFnError(t token.Type) {
 	msg := fmt.Sprintf("no prefix parse func found for token type %s", t)
-	p.errors = append(p.errors, msg)
+	p.error(p.currToken.Pos, msg)
 }
 
 // peekPrecedence returns the precedence level of the peek token
@@ -246,7 +303,7 @@ func (p *Parser) currPrecendence() int {
 // isn't found for a given token type.
 func (p *Parser) noInfixParseFnError(t token.Type) {
 	msg := fmt.Sprintf("no infix parse func found for token type %s", t)
-	p.errors = append(p.errors, msg)
+	p.error(p.currToken.Pos, msg)
 }
 
 // parseExpression parses an expression given a precedence enum
@@ -282,11 +339,19 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 		Token: p.currToken,
 	}
 
-	if !p.expectPeek(token.IDENT) {
-		return nil
-	}
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		stmt.Pattern = p.parsePattern()
+		if stmt.Pattern == nil {
+			return nil
+		}
+	} else {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
 
-	stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+		stmt.Name = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	}
 
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
@@ -295,6 +360,9 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	p.nextToken()
 
 	stmt.Value = p.parseExpression(LOWEST)
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok && stmt.Name != nil {
+		fl.Name = string(stmt.Name.Value)
+	}
 
 	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
@@ -303,6 +371,215 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+// parsePattern parses a destructuring pattern starting at the current token,
+// patterns are identifiers, array patterns or hashmap patterns.
+func (p *Parser) parsePattern() ast.Expression {
+	switch p.currToken.Type {
+	case token.IDENT:
+		return &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	case token.LBRACKET:
+		return p.parseArrayPattern(p.parsePattern)
+	case token.LBRACE:
+		return p.parseHashPattern(p.parsePattern)
+	default:
+		msg := fmt.Sprintf("invalid destructuring pattern starting with %s", p.currToken.Type)
+		p.error(p.currToken.Pos, msg)
+		return nil
+	}
+}
+
+// parseArrayPattern parses array patterns [a, [b, c], ...rest], elements
+// are parsed by elem.
+func (p *Parser) parseArrayPattern(elem func() ast.Expression) ast.Expression {
+	pattern := &ast.ArrayPattern{Token: p.currToken, Elements: []ast.Expression{}}
+
+	if p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		return pattern
+	}
+
+	for {
+		if p.peekTokenIs(token.ELLIPSIS) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+			break
+		}
+
+		p.nextToken()
+		el := elem()
+		if el == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, el)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+
+	return pattern
+}
+
+// parseHashPattern parses hashmap patterns {name, "key": pattern}, values
+// are parsed by elem.
+func (p *Parser) parseHashPattern(elem func() ast.Expression) ast.Expression {
+	pattern := &ast.HashPattern{Token: p.currToken}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		switch p.currToken.Type {
+		case token.IDENT:
+			key := &ast.StringLiteral{Token: token.NewLiteral(token.STRING, string(p.currToken.Literal)), Value: string(p.currToken.Literal)}
+			pattern.Keys = append(pattern.Keys, key)
+			pattern.Values = append(pattern.Values, &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal})
+		case token.STRING:
+			key := &ast.StringLiteral{Token: p.currToken, Value: string(p.currToken.Literal)}
+			if !p.expectPeek(token.COLON) {
+				return nil
+			}
+			p.nextToken()
+			value := elem()
+			if value == nil {
+				return nil
+			}
+			pattern.Keys = append(pattern.Keys, key)
+			pattern.Values = append(pattern.Values, value)
+		default:
+			msg := fmt.Sprintf("invalid hashmap pattern key %s", p.currToken.Type)
+			p.error(p.currToken.Pos, msg)
+			return nil
+		}
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return pattern
+}
+
+// parseMatchPattern parses a match arm pattern starting at the current token,
+// on top of destructuring patterns match patterns can be literals that are
+// compared by equality and the wildcard _ that matches anything.
+func (p *Parser) parseMatchPattern() ast.Expression {
+	switch p.currToken.Type {
+	case token.IDENT:
+		return &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+	case token.INT:
+		return p.parseIntegerLiteral()
+	case token.SUB:
+		if !p.expectPeek(token.INT) {
+			return nil
+		}
+		switch lit := p.parseIntegerLiteral().(type) {
+		case *ast.IntegerLiteral:
+			lit.Token = token.NewLiteral(token.INT, "-"+string(lit.Token.Literal))
+			lit.Value = -lit.Value
+			return lit
+		case *ast.BigIntegerLiteral:
+			tok := token.NewLiteral(token.INT, "-"+string(lit.Token.Literal))
+			value := new(big.Int).Neg(lit.Value)
+			if value.IsInt64() {
+				// -9223372036854775808 is the smallest int64
+				return &ast.IntegerLiteral{Token: tok, Value: value.Int64()}
+			}
+			return &ast.BigIntegerLiteral{Token: tok, Value: value}
+		default:
+			return nil
+		}
+	case token.STRING:
+		return p.parseStringLiteral()
+	case token.TRUE, token.FALSE:
+		return p.parseBooleanLiteral()
+	case token.NULL:
+		return p.parseNullLiteral()
+	case token.LBRACKET:
+		return p.parseArrayPattern(p.parseMatchPattern)
+	case token.LBRACE:
+		return p.parseHashPattern(p.parseMatchPattern)
+	default:
+		msg := fmt.Sprintf("invalid match pattern starting with %s", p.currToken.Type)
+		p.error(p.currToken.Pos, msg)
+		return nil
+	}
+}
+
+// parseMatchExpression parses match expressions, arms are separated by commas
+// and an arm body is either a block or a single expression.
+// match (value) { pattern if guard => body, ... }
+func (p *Parser) parseMatchExpression() ast.Expression {
+
+	exp := &ast.MatchExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	exp.Value = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+
+		arm := &ast.MatchArm{Pattern: p.parseMatchPattern()}
+		if arm.Pattern == nil {
+			return nil
+		}
+
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			p.nextToken()
+			arm.Guard = p.parseExpression(LOWEST)
+		}
+
+		if !p.expectPeek(token.ARROW) {
+			return nil
+		}
+
+		if p.peekTokenIs(token.LBRACE) {
+			p.nextToken()
+			arm.Body = p.parseBlockStatement()
+		} else {
+			p.nextToken()
+			stmt := &ast.ExpressionStatement{Token: p.currToken}
+			stmt.Expression = p.parseExpression(LOWEST)
+			arm.Body = &ast.BlockStatement{Token: stmt.Token, Statements: []ast.Statement{stmt}}
+		}
+		exp.Arms = append(exp.Arms, arm)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	exp.Rbrace = p.currToken.Pos
+
+	return exp
+}
+
 // parseReturnStatement parses and construct an ast node for return statements.
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
@@ -311,13 +588,110 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	for !p.currTokenIs(token.SEMICOLON) {
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
 	return stmt
 }
 
+// parseExportStatement parses let statements exported by a module.
+func (p *Parser) parseExportStatement() ast.Statement {
+	if p.blockDepth > 0 {
+		p.error(p.currToken.Pos, "export is only allowed at the top level of a module")
+		return nil
+	}
+	if !p.expectPeek(token.LET) {
+		return nil
+	}
+
+	stmt := p.parseLetStatement()
+	if stmt == nil {
+		return nil
+	}
+	stmt.Exported = true
+
+	return stmt
+}
+
+// parseImportExpression parses module imports, the module path is a string
+// literal.
+func (p *Parser) parseImportExpression() ast.Expression {
+	exp := &ast.ImportExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	exp.Path = string(p.currToken.Literal)
+
+	return exp
+}
+
+// parseThrowStatement parses and construct an ast node for throw statements.
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+
+	stmt := &ast.ThrowStatement{Token: p.currToken}
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseTryExpression parses and construct an ast branch for exception handlers
+// try { } catch (e) { } finally { }
+func (p *Parser) parseTryExpression() ast.Expression {
+
+	exp := &ast.TryExpression{Token: p.currToken}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	exp.Block = p.parseBlockStatement()
+
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		exp.Param = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		exp.Catch = p.parseBlockStatement()
+	}
+
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+
+		exp.Finally = p.parseBlockStatement()
+	}
+
+	if exp.Catch == nil && exp.Finally == nil {
+		p.error(exp.Pos(), "try expression without catch or finally block")
+		return nil
+	}
+
+	return exp
+}
+
 // parseExpressionStatement parses and construct an ast node for expressions.
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	stmt := &ast.ExpressionStatement{Token: p.currToken}
@@ -338,6 +712,11 @@ func (p *Parser) parseBooleanLiteral() ast.Expression {
 	}
 }
 
+// parseNullLiteral parses and construct an ast node for the null literal.
+func (p *Parser) parseNullLiteral() ast.Expression {
+	return &ast.NullLiteral{Token: p.currToken}
+}
+
 // parseGroupedExpression parses and construct an ast node for expressions
 // of the type ((a*b)+c).
 func (p *Parser) parseGroupedExpression() ast.Expression {
@@ -393,6 +772,9 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.currToken}
 	block.Statements = []ast.Statement{}
 
+	p.blockDepth++
+	defer func() { p.blockDepth-- }()
+
 	p.nextToken()
 
 	for !p.currTokenIs(token.RBRACE) && !p.currTokenIs(token.EOF) {
@@ -404,40 +786,78 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 
 		p.nextToken()
 	}
+	block.Rbrace = p.currToken.Pos
 
 	return block
 }
 
-// parseFunctionParameters is used to construct a list of identifiers for
-// function literal parameters
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
+// parseFunctionParameters is used to construct the list of identifiers for
+// function literal parameters, their default values and the rest parameter
+// fn(a, b = 2, ...rest).
+func (p *Parser) parseFunctionParameters(lit *ast.FunctionLiteral) bool {
 
-	identifiers := []*ast.Identifier{}
+	lit.Parameters = []*ast.Identifier{}
 
 	// if the next token is the right parenthesis return (they are no params)
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
-		return identifiers
+		return true
 	}
 
-	p.nextToken()
+	for {
+		if p.peekTokenIs(token.ELLIPSIS) {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
+			lit.Rest = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+			// the rest parameter must be the last one
+			return p.expectPeek(token.RPAREN)
+		}
 
-	ident := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
-	identifiers = append(identifiers, ident)
+		var ident *ast.Identifier
+		if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+			p.nextToken()
+			pattern := p.parsePattern()
+			if pattern == nil {
+				return false
+			}
+			// destructured parameters are passed in a generated binding
+			// that can't clash with user identifiers
+			name := fmt.Sprintf("$%d", len(lit.Parameters))
+			ident = &ast.Identifier{Token: token.NewLiteral(token.IDENT, name), Value: token.Literal(name)}
+			for len(lit.Patterns) < len(lit.Parameters) {
+				lit.Patterns = append(lit.Patterns, nil)
+			}
+			lit.Patterns = append(lit.Patterns, pattern)
+		} else {
+			if !p.expectPeek(token.IDENT) {
+				return false
+			}
+			ident = &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
+		}
+		lit.Parameters = append(lit.Parameters, ident)
+
+		if p.peekTokenIs(token.ASSIGN) {
+			p.nextToken()
+			p.nextToken()
+			for len(lit.Defaults) < len(lit.Parameters)-1 {
+				lit.Defaults = append(lit.Defaults, nil)
+			}
+			lit.Defaults = append(lit.Defaults, p.parseExpression(LOWEST))
+		} else if lit.NumDefaults() > 0 {
+			msg := fmt.Sprintf("parameter %s without default follows a parameter with a default", ident.Value)
+			p.error(ident.Pos(), msg)
+			return false
+		}
 
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken()
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 		p.nextToken()
-
-		ident := &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal}
-		identifiers = append(identifiers, ident)
-	}
-
-	if !p.expectPeek(token.RPAREN) {
-		return nil
 	}
 
-	return identifiers
+	return p.expectPeek(token.RPAREN)
 }
 
 // parseFunctionLiteral constructs an ast branch for function literal expressions.
@@ -449,7 +869,45 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	if !p.parseFunctionParameters(lit) {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
+// parseMacroLiteral parses macro definitions macro(x, y) { body }, the
+// parameters of macros are plain identifiers.
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	lit := &ast.MacroLiteral{Token: p.currToken, Parameters: []*ast.Identifier{}}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+	} else {
+		for {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			lit.Parameters = append(lit.Parameters, &ast.Identifier{Token: p.currToken, Value: p.currToken.Literal})
+			if !p.peekTokenIs(token.COMMA) {
+				break
+			}
+			p.nextToken()
+		}
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+	}
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
@@ -460,6 +918,16 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
+// parseSpreadExpression parses the spread operator ...xs
+func (p *Parser) parseSpreadExpression() ast.Expression {
+	exp := &ast.SpreadExpression{Token: p.currToken}
+	p.nextToken()
+
+	exp.Value = p.parseExpression(LOWEST)
+
+	return exp
+}
+
 // parseCallArguments is used to parse function arguments which are expressions.
 func (p *Parser) parseCallArguments() []ast.Expression {
 
@@ -491,11 +959,14 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 // parseCallExpression parses function calls.
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 
-	return &ast.CallExpression{
-		Token:     p.currToken,
-		Function:  function,
-		Arguments: p.parseExpressionList(token.RPAREN),
+	call := &ast.CallExpression{
+		Token:    p.currToken,
+		Function: function,
 	}
+	call.Arguments = p.parseExpressionList(token.RPAREN)
+	call.Rparen = p.currToken.Pos
+
+	return call
 }
 
 // parseExpressionList parses a list of expressions
@@ -528,25 +999,64 @@ func (p *Parser) parseExpressionList(end token.Type) []ast.Expression {
 // parseArrayLiteral parses an array
 func (p *Parser) parseArrayLiteral() ast.Expression {
 
-	return &ast.ArrayLiteral{
-		Token:    p.currToken,
-		Elements: p.parseExpressionList(token.RBRACKET),
-	}
+	array := &ast.ArrayLiteral{Token: p.currToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	array.Rbracket = p.currToken.Pos
+
+	return array
 }
 
-// parseIndexExpression parses an expression within the index op
+// parseIndexExpression parses an expression within the index op, the index
+// may be a slice xs[a:b] with either bound omitted.
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.currToken, Left: left}
+	tok := p.currToken
 
-	p.nextToken()
+	var index ast.Expression
+	if !p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		index = p.parseExpression(LOWEST)
+	}
 
-	exp.Index = p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		exp := &ast.SliceExpression{Token: tok, Left: left, Start: index}
+		if !p.peekTokenIs(token.RBRACKET) {
+			p.nextToken()
+			exp.End = p.parseExpression(LOWEST)
+		}
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+		return exp
+	}
 
 	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
 
-	return exp
+	return &ast.IndexExpression{Token: tok, Left: left, Index: index}
+}
+
+// parseOptionalIndexExpression parses a safe navigation index expression a?.[k]
+func (p *Parser) parseOptionalIndexExpression(left ast.Expression) ast.Expression {
+	tok := p.currToken
+
+	if !p.expectPeek(token.LBRACKET) {
+		return nil
+	}
+
+	switch exp := p.parseIndexExpression(left).(type) {
+	case *ast.IndexExpression:
+		exp.Token = tok
+		exp.Optional = true
+		return exp
+	case *ast.SliceExpression:
+		exp.Token = tok
+		exp.Optional = true
+		return exp
+	default:
+		return nil
+	}
 }
 
 // parseHashmapLiteral parses a hashmap
@@ -573,6 +1083,7 @@ func (p *Parser) parseHashmapLiteral() ast.Expression {
 	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
+	hash.Rbrace = p.currToken.Pos
 
 	return hash
 }
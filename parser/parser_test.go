@@ -1,8 +1,10 @@
 package parser
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/actuallyachraf/monkey-giggle/ast"
@@ -97,6 +99,135 @@ func TestParser(t *testing.T) {
 			}
 		}
 	})
+	t.Run("TestParseDestructuringLetStatement", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"let [a, b] = xs;", "let [a, b] = xs;"},
+			{"let [a, ...rest] = xs;", "let [a, ...rest] = xs;"},
+			{"let [[a, b], c] = xs;", "let [[a, b], c] = xs;"},
+			{"let [] = xs;", "let [] = xs;"},
+			{"let {name, age} = person;", "let {name, age} = person;"},
+			{`let {"first name": first, "tags": [tag]} = person;`, `let {"first name": first, "tags": [tag]} = person;`},
+			{"fn([a, b], {c}) { a }", "fn([a, b], {c})a"},
+		}
+
+		for _, tt := range tests {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.Parse()
+			checkParserError(t, p)
+
+			if program.String() != tt.expected {
+				t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+			}
+		}
+
+		for _, input := range []string{"let [1] = xs;", "let {1: a} = xs;", "let [...a, b] = xs;"} {
+			p := New(lexer.New(input))
+			p.Parse()
+			if len(p.Errors()) == 0 {
+				t.Errorf("expected parser errors for %q", input)
+			}
+		}
+	})
+	t.Run("TestParseMatchExpression", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"match (x) { 1 => a, _ => b }", "match (x) { 1 => a, _ => b }"},
+			{"match (x) { -1 => a, }", "match (x) { -1 => a }"},
+			{`match (x) { "a" => 1, true => 2, null => 3 }`, "match (x) { a => 1, true => 2, null => 3 }"},
+			{"match (x) { [a, [1, b], ...rest] => a }", "match (x) { [a, [1, b], ...rest] => a }"},
+			{`match (x) { {"type": "circle", r} => r }`, `match (x) { {"type": circle, r} => r }`},
+			{"match (x) { n if n > 0 => n, n => -n }", "match (x) { n if (n > 0) => n, n => (-n) }"},
+			{"match (x) { _ => { let y = 1; y } }", "match (x) { _ => let y = 1;y }"},
+			{"match (x) { }", "match (x) {  }"},
+		}
+
+		for _, tt := range tests {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.Parse()
+			checkParserError(t, p)
+
+			if program.String() != tt.expected {
+				t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+			}
+		}
+
+		for _, input := range []string{"match (x) { a + b => 1 }", "match (x) { 1 2 }", "match x { _ => 1 }", "match (x) { 1 => 2 3 => 4 }"} {
+			p := New(lexer.New(input))
+			p.Parse()
+			if len(p.Errors()) == 0 {
+				t.Errorf("expected parser errors for %q", input)
+			}
+		}
+	})
+	t.Run("TestParseTryExpression", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"throw x;", "throw x;"},
+			{"throw f(1)", "throw f(1);"},
+			{"try { a } catch (e) { b }", "try a catch (e) b"},
+			{"try { a } finally { c }", "try a finally c"},
+			{"try { a } catch (e) { b } finally { c }", "try a catch (e) b finally c"},
+			{"let x = 1 + try { a } catch (e) { 0 };", "let x = (1 + try a catch (e) 0);"},
+		}
+
+		for _, tt := range tests {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.Parse()
+			checkParserError(t, p)
+
+			if program.String() != tt.expected {
+				t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+			}
+		}
+
+		for _, input := range []string{"try { a }", "try { a } catch { b }", "try { a } catch (1) { b }", "try a catch (e) { b }"} {
+			p := New(lexer.New(input))
+			p.Parse()
+			if len(p.Errors()) == 0 {
+				t.Errorf("expected parser errors for %q", input)
+			}
+		}
+	})
+	t.Run("TestParseModules", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{`let math = import "math";`, `let math = import "math";`},
+			{`import "geometry/shapes"`, `import "geometry/shapes"`},
+			{`export let x = 1;`, "export let x = 1;"},
+			{`export let [a, b] = xs;`, "export let [a, b] = xs;"},
+		}
+
+		for _, tt := range tests {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.Parse()
+			checkParserError(t, p)
+
+			if program.String() != tt.expected {
+				t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+			}
+		}
+
+		for _, input := range []string{"import math", "export x", "export 1;", "fn() { export let x = 1; }", `if (true) { export let x = 1; }`} {
+			p := New(lexer.New(input))
+			p.Parse()
+			if len(p.Errors()) == 0 {
+				t.Errorf("expected parser errors for %q", input)
+			}
+		}
+	})
 	t.Run("TestParseReturnStatement", func(t *testing.T) {
 
 		input := `
@@ -127,6 +258,14 @@ func TestParser(t *testing.T) {
 				t.Errorf("returnStmt.TokenLiteral not return got %s", returnStmt.TokenLiteral())
 			}
 		}
+
+		// the semicolon is optional before the end of a block
+		p = New(lexer.New("fn() { if (x) { return 1 } 2 }"))
+		program = p.Parse()
+		checkParserError(t, p)
+		if program.String() != "fn()ifx return 1;2" {
+			t.Errorf("wrong program expected %q got %q", "fn()ifx return 1;2", program.String())
+		}
 	})
 	t.Run("TestParseIdentifierExpression", func(t *testing.T) {
 
@@ -174,6 +313,36 @@ func TestParser(t *testing.T) {
 		if literal.TokenLiteral() != "5" {
 			t.Errorf("program has wrong token literal expected %s got %s", "5", literal.TokenLiteral())
 		}
+
+		// literals too large for an int64 are big integers
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"9223372036854775808", "9223372036854775808"},
+			{"18446744073709551616", "18446744073709551616"},
+			{"match (x) { -9223372036854775809 => 1 }", "-9223372036854775809"},
+		}
+		for _, tt := range tests {
+			p := New(lexer.New(tt.input))
+			program := p.Parse()
+			checkParserError(t, p)
+			var big *ast.BigIntegerLiteral
+			ast.Inspect(program, func(node ast.Node) bool {
+				if lit, ok := node.(*ast.BigIntegerLiteral); ok {
+					big = lit
+				}
+				return true
+			})
+			if big == nil || big.Value.String() != tt.expected {
+				t.Errorf("wrong big integer literal for %s expected %s got %v", tt.input, tt.expected, big)
+			}
+		}
+		p = New(lexer.New("match (x) { -9223372036854775808 => 1 }"))
+		program = p.Parse()
+		checkParserError(t, p)
+		pattern := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.MatchExpression).Arms[0].Pattern
+		testIntegerLiteral(t, pattern, -9223372036854775808)
 	})
 	t.Run("TestParseStringLiteralExpression", func(t *testing.T) {
 		input := `"hello world!`
@@ -389,6 +558,34 @@ func TestParser(t *testing.T) {
 				"add(a * b[2], b[1], 2 * [1, 2][1])",
 				"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
 			},
+			{
+				"a[1:2]",
+				"(a[1:2])",
+			},
+			{
+				"a[:b + 1][0]",
+				"((a[:(b + 1)])[0])",
+			},
+			{
+				"a[1:]",
+				"(a[1:])",
+			},
+			{
+				"a[:]",
+				"(a[:])",
+			},
+			{
+				"a ?? b == c",
+				"(a ?? (b == c))",
+			},
+			{
+				"a ?? b ?? c",
+				"((a ?? b) ?? c)",
+			},
+			{
+				"a?.[b][c] ?? null",
+				"(((a?.[b])[c]) ?? null)",
+			},
 		}
 
 		for _, tt := range tests {
@@ -586,6 +783,58 @@ func TestParser(t *testing.T) {
 
 		testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 	})
+	t.Run("TestParseMacroLiteral", func(t *testing.T) {
+		input := `macro(x, y) { x + y; }`
+
+		l := lexer.New(input)
+		p := New(l)
+		program := p.Parse()
+		checkParserError(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+				1, len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+				program.Statements[0])
+		}
+
+		macro, ok := stmt.Expression.(*ast.MacroLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T",
+				stmt.Expression)
+		}
+
+		if len(macro.Parameters) != 2 {
+			t.Fatalf("macro literal parameters wrong. want 2, got=%d\n",
+				len(macro.Parameters))
+		}
+
+		testLiteralExpression(t, macro.Parameters[0], "x")
+		testLiteralExpression(t, macro.Parameters[1], "y")
+
+		if len(macro.Body.Statements) != 1 {
+			t.Fatalf("macro.Body.Statements has not 1 statements. got=%d\n",
+				len(macro.Body.Statements))
+		}
+
+		bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T",
+				macro.Body.Statements[0])
+		}
+
+		testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+
+		p = New(lexer.New("macro(x = 1) { x }"))
+		p.Parse()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected an error for a macro parameter with a default")
+		}
+	})
 	t.Run("TestParseFunctionParameters", func(t *testing.T) {
 		tests := []struct {
 			input          string
@@ -594,6 +843,8 @@ func TestParser(t *testing.T) {
 			{input: "fn() {};", expectedParams: []string{}},
 			{input: "fn(x) {};", expectedParams: []string{"x"}},
 			{input: "fn(x, y, z) {};", expectedParams: []string{"x", "y", "z"}},
+			{input: "fn(x, y = 2) {};", expectedParams: []string{"x", "y"}},
+			{input: "fn(x, ...rest) {};", expectedParams: []string{"x"}},
 		}
 
 		for _, tt := range tests {
@@ -615,6 +866,37 @@ func TestParser(t *testing.T) {
 			}
 		}
 	})
+	t.Run("TestParseVariadicFunctions", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"fn(a, b = 2, ...rest) { a }", "fn(a, b = 2, ...rest)a"},
+			{"fn(...rest) { rest }", "fn(...rest)rest"},
+			{"fn(a = 1 + 1) { a }", "fn(a = (1 + 1))a"},
+			{"f(...xs, 1)", "f(...xs, 1)"},
+			{"[1, ...xs, ...[2, 3]]", "[1, ...xs, ...[2, 3]]"},
+		}
+
+		for _, tt := range tests {
+			l := lexer.New(tt.input)
+			p := New(l)
+			program := p.Parse()
+			checkParserError(t, p)
+
+			if program.String() != tt.expected {
+				t.Errorf("expected=%q, got=%q", tt.expected, program.String())
+			}
+		}
+
+		for _, input := range []string{"fn(a = 1, b) {}", "fn(...rest, a) {}"} {
+			p := New(lexer.New(input))
+			p.Parse()
+			if len(p.Errors()) == 0 {
+				t.Errorf("expected parser errors for %q", input)
+			}
+		}
+	})
 	t.Run("TestParseCallExpression", func(t *testing.T) {
 		input := "add(1, 2 * 3, 4 + 5);"
 
@@ -652,6 +934,43 @@ func TestParser(t *testing.T) {
 		testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
 		testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
 	})
+	t.Run("TestParseNodePositions", func(t *testing.T) {
+		input := "let add = fn(a, b) {\n  a + b\n};\nadd(1, [2])"
+
+		l := lexer.New(input)
+		p := New(l)
+		program := p.Parse()
+		checkParserError(t, p)
+
+		let := program.Statements[0].(*ast.LetStatement)
+		fn := let.Value.(*ast.FunctionLiteral)
+		sum := fn.Body.Statements[0].(*ast.ExpressionStatement).Expression
+		call := program.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.CallExpression)
+
+		if fn.Name != "add" {
+			t.Errorf("function literal has wrong name expected add got %q", fn.Name)
+		}
+		if call.TokenLiteral() != "(" {
+			t.Errorf("call expression has wrong token expected ( got %q", call.TokenLiteral())
+		}
+
+		tests := []struct {
+			node     ast.Node
+			expected token.Position
+		}{
+			{program, token.Position{Line: 1, Column: 1}},
+			{let, token.Position{Line: 1, Column: 1}},
+			{fn, token.Position{Line: 1, Column: 11}},
+			{sum, token.Position{Line: 2, Column: 5}},
+			{call, token.Position{Line: 4, Column: 4}},
+			{call.Arguments[1], token.Position{Line: 4, Column: 8}},
+		}
+		for _, tt := range tests {
+			if tt.node.Pos() != tt.expected {
+				t.Errorf("%s has wrong position expected %s got %s", tt.node, tt.expected, tt.node.Pos())
+			}
+		}
+	})
 	t.Run("TestParseCallArguments", func(t *testing.T) {
 		tests := []struct {
 			input         string
@@ -767,6 +1086,43 @@ func TestParser(t *testing.T) {
 			return
 		}
 	})
+	t.Run("TestParseOptionalIndexExpression", func(t *testing.T) {
+		input := "myHash?.[1 + 1]"
+
+		l := lexer.New(input)
+		p := New(l)
+		program := p.Parse()
+		checkParserError(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+		if !ok {
+			t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+		}
+		if !indexExp.Optional {
+			t.Fatalf("exp not an optional index expression")
+		}
+		if !testIdentifier(t, indexExp.Left, "myHash") {
+			return
+		}
+		if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
+			return
+		}
+	})
+	t.Run("TestParseNullLiteral", func(t *testing.T) {
+		l := lexer.New("null;")
+		p := New(l)
+		program := p.Parse()
+		checkParserError(t, p)
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+		}
+		if _, ok := stmt.Expression.(*ast.NullLiteral); !ok {
+			t.Fatalf("exp not *ast.NullLiteral. got=%T", stmt.Expression)
+		}
+	})
 	t.Run("TestParseHashmapLiteral", func(t *testing.T) {
 
 		input := `{"one":1,"two":2,"three":3}`
@@ -801,6 +1157,158 @@ func TestParser(t *testing.T) {
 			testIntegerLiteral(t, val, expectedValue)
 		}
 	})
+	t.Run("TestSyntaxErrorPositions", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected []Error
+		}{
+			{"let x = 1;\nlet = 2;", []Error{
+				{Pos: token.Position{Line: 2, Column: 5}, Msg: "expected next token to be IDENT, got ASSIGN instead"},
+				{Pos: token.Position{Line: 2, Column: 5}, Msg: "no prefix parse func found for token type ASSIGN"},
+			}},
+			{"fn(a, 1) { a }", []Error{
+				{Pos: token.Position{Line: 1, Column: 7}, Msg: "expected next token to be IDENT, got INT instead"},
+			}},
+		}
+
+		for _, tt := range tests {
+			p := New(lexer.New(tt.input))
+			p.Parse()
+			errs := p.SyntaxErrors()
+			if len(errs) < len(tt.expected) {
+				t.Fatalf("wrong errors for %q expected %v got %v", tt.input, tt.expected, errs)
+			}
+			for i, expected := range tt.expected {
+				if errs[i] != expected {
+					t.Errorf("wrong error for %q expected %v got %v", tt.input, expected, errs[i])
+				}
+			}
+		}
+	})
+	t.Run("TestJSON", func(t *testing.T) {
+		input := everyNode
+		program := New(lexer.New(input)).Parse()
+
+		data, err := json.Marshal(program)
+		if err != nil {
+			t.Fatalf("failed to encode with error : %s", err)
+		}
+		decoded := &ast.Program{}
+		if err := json.Unmarshal(data, decoded); err != nil {
+			t.Fatalf("failed to decode with error : %s", err)
+		}
+		// decoding keeps the kinds, fields and positions of nodes
+		again, err := json.Marshal(decoded)
+		if err != nil {
+			t.Fatalf("failed to encode with error : %s", err)
+		}
+		if string(again) != string(data) {
+			t.Errorf("decoding changed the program expected\n%s\ngot\n%s", data, again)
+		}
+		if len(decoded.Comments) != 1 || decoded.Comments[0].Pos() != (token.Position{Line: 1, Column: 1}) {
+			t.Errorf("wrong decoded comments got %v", decoded.Comments)
+		}
+		if pos := decoded.Statements[1].Pos(); pos != (token.Position{Line: 7, Column: 1}) {
+			t.Errorf("wrong decoded position got %s", pos)
+		}
+	})
+	t.Run("TestWalk", func(t *testing.T) {
+		program := New(lexer.New(everyNode)).Parse()
+
+		kinds := map[string]bool{}
+		idents := []string{}
+		ast.Inspect(program, func(node ast.Node) bool {
+			kinds[fmt.Sprintf("%T", node)] = true
+			if ident, ok := node.(*ast.Identifier); ok && ident.Pos().IsValid() {
+				idents = append(idents, string(ident.Value))
+			}
+			return true
+		})
+		expected := []string{
+			"Program", "LetStatement", "ReturnStatement", "ExpressionStatement", "ThrowStatement", "BlockStatement",
+			"Identifier", "IntegerLiteral", "BigIntegerLiteral", "StringLiteral", "BooleanLiteral", "NullLiteral", "ArrayLiteral",
+			"HashmapLiteral", "FunctionLiteral", "PrefixExpression", "InfixExpression", "IfExpression",
+			"SpreadExpression", "CallExpression", "IndexExpression", "SliceExpression", "ArrayPattern",
+			"HashPattern", "MatchExpression", "TryExpression", "ImportExpression",
+		}
+		for _, kind := range expected {
+			if !kinds["*ast."+kind] {
+				t.Errorf("%s wasn't visited", kind)
+			}
+		}
+		if len(kinds) != len(expected) {
+			t.Errorf("wrong visited kinds got %v", kinds)
+		}
+		// children are visited in source order
+		if got := strings.Join(idents, " "); got != "f a b c e x rest g h rest x a b c e h err err m f f v v v _" {
+			t.Errorf("wrong visit order got %s", got)
+		}
+
+		// pruned nodes aren't visited and Walk ends visits with nil
+		depth, functions := 0, 0
+		ast.Walk(visitor(func(node ast.Node) bool {
+			if node == nil {
+				depth--
+				return false
+			}
+			depth++
+			_, ok := node.(*ast.FunctionLiteral)
+			if ok {
+				functions++
+			}
+			return !ok
+		}), program)
+		if functions != 1 || depth != 1 {
+			t.Errorf("wrong walk got %d functions and depth %d", functions, depth)
+		}
+	})
+	t.Run("TestRewrite", func(t *testing.T) {
+		program := New(lexer.New(everyNode)).Parse()
+		before, _ := json.Marshal(program)
+
+		rewritten := ast.Rewrite(program, func(node ast.Node) ast.Node {
+			switch node := node.(type) {
+			case *ast.Identifier:
+				if node.Value == "x" {
+					node.Value = "y"
+				}
+			case *ast.IntegerLiteral:
+				node.Value++
+				node.Token.Literal = token.Literal(fmt.Sprint(node.Value))
+			case *ast.LetStatement:
+				// drop the import
+				if _, ok := node.Value.(*ast.ImportExpression); ok {
+					return nil
+				}
+			}
+			return node
+		}).(*ast.Program)
+
+		if after, _ := json.Marshal(program); string(after) != string(before) {
+			t.Errorf("rewriting modified the original tree got %s", program)
+		}
+		if len(rewritten.Statements) != len(program.Statements)-1 || len(rewritten.Comments) != 1 {
+			t.Fatalf("wrong rewritten program got %s", rewritten)
+		}
+		got := rewritten.String()
+		for _, expected := range []string{"y = (-2)", "if(!y)", "e[1]", "h?.[2:]", "err[:3]", "[2, 3]", "(v > 2)"} {
+			if !strings.Contains(got, expected) {
+				t.Errorf("rewritten program doesn't contain %s got %s", expected, got)
+			}
+		}
+
+		defer func() {
+			if r := recover(); r == nil || r != "ast: Identifier rewritten to ExpressionStatement where an expression is expected" {
+				t.Errorf("wrong panic for a misfit got %v", r)
+			}
+		}()
+		ast.Rewrite(New(lexer.New("a + 1")).Parse(), func(node ast.Node) ast.Node {
+			if ident, ok := node.(*ast.Identifier); ok {
+				return &ast.ExpressionStatement{Expression: ident}
+			}
+			return node
+		})
+	})
 }
 
 func testLetStatement(t *testing.T, s ast.Statement, name token.Literal) bool {
@@ -934,3 +1442,25 @@ func checkParserError(t *testing.T, p *Parser) error {
 
 	return errors.New("Parser Failed")
 }
+
+// everyNode is a program holding every kind of node.
+const everyNode = `// every kind of node
+export let f = fn([a, b], {c, "d": e}, x = -1, ...rest) {
+  let [g, ...h] = rest;
+  if (!x) { return a + b * c; } else { throw "no" }
+  try { e[0] ?? h?.[1:] } catch (err) { err[:2] } finally { null }
+};
+let m = import "std/strings";
+f([1, 2], {"c": true, "d": [false, 18446744073709551616]})(...[3]);
+match (f) { {"k": [v]} if v > 1 => { v }, _ => ({"a": 1, "b": 2}) }`
+
+// visitor is a Visitor calling a function, children are visited when it
+// returns true.
+type visitor func(ast.Node) bool
+
+func (v visitor) Visit(node ast.Node) ast.Visitor {
+	if v(node) {
+		return v
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"unicode"
+)
+
+// keys read by the editor, escape sequences are translated to the negative
+// keys.
+const (
+	keyCtrlA     = 0x01
+	keyCtrlB     = 0x02
+	keyCtrlC     = 0x03
+	keyCtrlD     = 0x04
+	keyCtrlE     = 0x05
+	keyCtrlF     = 0x06
+	keyCtrlH     = 0x08
+	keyTab       = 0x09
+	keyCtrlK     = 0x0b
+	keyCtrlL     = 0x0c
+	keyEnter     = 0x0d
+	keyCtrlN     = 0x0e
+	keyCtrlP     = 0x10
+	keyCtrlU     = 0x15
+	keyCtrlW     = 0x17
+	keyEscape    = 0x1b
+	keyBackspace = 0x7f
+)
+
+const (
+	keyUnknown rune = -(iota + 1)
+	keyUp
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDelete
+)
+
+// editor reads lines from a terminal with line editing, the terminal is in raw
+// mode only while a line is read so Ctrl-C still interrupts programs.
+//
+// The cursor moves with the arrows, Home, End, Ctrl-A, Ctrl-E, Ctrl-B and
+// Ctrl-F. Ctrl-K, Ctrl-U and Ctrl-W delete to the end of the line, to its
+// start and the previous word. Up, Down, Ctrl-P and Ctrl-N browse the history.
+// Ctrl-C cancels the input and Ctrl-D on an empty line ends the session.
+type editor struct {
+	in      *bufio.Reader
+	fd      uintptr
+	out     io.Writer
+	history *history
+}
+
+// newEditor returns an editor reading from a terminal, it fails when the file
+// isn't a terminal.
+func newEditor(f *os.File, out io.Writer, history *history) (*editor, error) {
+	state, err := makeRaw(f.Fd())
+	if err != nil {
+		return nil, err
+	}
+	restore(f.Fd(), state)
+
+	return &editor{
+		in:      bufio.NewReader(f),
+		fd:      f.Fd(),
+		out:     out,
+		history: history,
+	}, nil
+}
+
+// line is the line being edited, pos is the index of the rune under the
+// cursor.
+type line struct {
+	prompt string
+	buf    []rune
+	pos    int
+}
+
+func (e *editor) ReadLine(prompt string) (string, error) {
+	state, err := makeRaw(e.fd)
+	if err != nil {
+		return "", err
+	}
+	defer restore(e.fd, state)
+
+	l := &line{prompt: prompt}
+	// entry is the index of the history entry shown, the line being edited
+	// is kept while browsing the history
+	entry := len(e.history.entries)
+	edited := []rune{}
+
+	e.refresh(l)
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case keyEnter, '\n':
+			io.WriteString(e.out, "\r\n")
+			e.history.add(string(l.buf))
+			return string(l.buf), nil
+		case keyCtrlC:
+			io.WriteString(e.out, "^C\r\n")
+			return "", errInterrupt
+		case keyCtrlD:
+			if len(l.buf) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			l.delete(l.pos, l.pos+1)
+		case keyDelete:
+			l.delete(l.pos, l.pos+1)
+		case keyBackspace, keyCtrlH:
+			l.delete(l.pos-1, l.pos)
+		case keyCtrlA, keyHome:
+			l.pos = 0
+		case keyCtrlE, keyEnd:
+			l.pos = len(l.buf)
+		case keyCtrlB, keyLeft:
+			if l.pos > 0 {
+				l.pos--
+			}
+		case keyCtrlF, keyRight:
+			if l.pos < len(l.buf) {
+				l.pos++
+			}
+		case keyCtrlK:
+			l.delete(l.pos, len(l.buf))
+		case keyCtrlU:
+			l.delete(0, l.pos)
+		case keyCtrlW:
+			start := l.pos
+			for start > 0 && unicode.IsSpace(l.buf[start-1]) {
+				start--
+			}
+			for start > 0 && !unicode.IsSpace(l.buf[start-1]) {
+				start--
+			}
+			l.delete(start, l.pos)
+		case keyCtrlL:
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+		case keyCtrlP, keyUp:
+			if entry == 0 {
+				break
+			}
+			if entry == len(e.history.entries) {
+				edited = l.buf
+			}
+			entry--
+			l.set([]rune(e.history.entries[entry]))
+		case keyCtrlN, keyDown:
+			if entry == len(e.history.entries) {
+				break
+			}
+			entry++
+			if entry == len(e.history.entries) {
+				l.set(edited)
+			} else {
+				l.set([]rune(e.history.entries[entry]))
+			}
+		case keyTab:
+			for i := 0; i < 4; i++ {
+				l.insert(' ')
+			}
+		default:
+			if key >= 0 && unicode.IsPrint(key) {
+				l.insert(key)
+			}
+		}
+		e.refresh(l)
+	}
+}
+
+// readKey reads a key translating the escape sequences of the arrows, Home,
+// End and Delete.
+func (e *editor) readKey() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	if err != nil || r != keyEscape {
+		return r, err
+	}
+
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if r != '[' && r != 'O' {
+		return keyUnknown, nil
+	}
+	// sequences are parameters ended by a final byte
+	seq := []rune{}
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		seq = append(seq, r)
+		if r >= 0x40 && r <= 0x7e {
+			break
+		}
+	}
+
+	switch string(seq) {
+	case "A":
+		return keyUp, nil
+	case "B":
+		return keyDown, nil
+	case "C":
+		return keyRight, nil
+	case "D":
+		return keyLeft, nil
+	case "H", "1~", "7~":
+		return keyHome, nil
+	case "F", "4~", "8~":
+		return keyEnd, nil
+	case "3~":
+		return keyDelete, nil
+	default:
+		return keyUnknown, nil
+	}
+}
+
+// refresh redraws a line and moves the cursor to its position.
+func (e *editor) refresh(l *line) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "\r%s%s\x1b[K", l.prompt, string(l.buf))
+	if n := len(l.buf) - l.pos; n > 0 {
+		fmt.Fprintf(&buf, "\x1b[%dD", n)
+	}
+	e.out.Write(buf.Bytes())
+}
+
+// insert inserts a rune at the cursor.
+func (l *line) insert(r rune) {
+	l.buf = append(l.buf, 0)
+	copy(l.buf[l.pos+1:], l.buf[l.pos:])
+	l.buf[l.pos] = r
+	l.pos++
+}
+
+// delete deletes the runes between start and end, the cursor moves to start.
+func (l *line) delete(start int, end int) {
+	if start < 0 || end > len(l.buf) || start >= end {
+		return
+	}
+	l.buf = append(l.buf[:start:start], l.buf[end:]...)
+	l.pos = start
+}
+
+// set replaces the line putting the cursor at its end.
+func (l *line) set(buf []rune) {
+	l.buf = append([]rune{}, buf...)
+	l.pos = len(l.buf)
+}
@@ -0,0 +1,80 @@
+package repl
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MaxHistory is the number of lines kept in the history.
+const MaxHistory = 1000
+
+// history holds the lines entered in the REPL, lines are appended to the
+// history file as they are entered. Saving the history is best effort, the
+// REPL works without it.
+type history struct {
+	entries []string
+	file    string
+}
+
+// historyFile returns the path of the history file, GIGGLE_HISTORY when set
+// or .giggle_history in the home directory. An empty GIGGLE_HISTORY disables
+// the history file.
+func historyFile() string {
+	if file, ok := os.LookupEnv("GIGGLE_HISTORY"); ok {
+		return file
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".giggle_history")
+}
+
+// loadHistory reads the history saved in a file, the file is rewritten with
+// the last MaxHistory lines when it holds more.
+func loadHistory(file string) *history {
+	h := &history{file: file}
+	if file == "" {
+		return h
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return h
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		h.entries = append(h.entries, scanner.Text())
+	}
+	f.Close()
+
+	if len(h.entries) > MaxHistory {
+		h.entries = h.entries[len(h.entries)-MaxHistory:]
+		os.WriteFile(file, []byte(strings.Join(h.entries, "\n")+"\n"), 0600)
+	}
+
+	return h
+}
+
+// add records a line, blank lines and lines repeating the previous one
+// aren't recorded.
+func (h *history) add(line string) {
+	if strings.TrimSpace(line) == "" || len(h.entries) > 0 && h.entries[len(h.entries)-1] == line {
+		return
+	}
+	h.entries = append(h.entries, line)
+	if len(h.entries) > MaxHistory {
+		h.entries = h.entries[1:]
+	}
+	if h.file == "" {
+		return
+	}
+
+	f, err := os.OpenFile(h.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	f.WriteString(line + "\n")
+	f.Close()
+}
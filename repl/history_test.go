@@ -0,0 +1,69 @@
+package repl
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	t.Run("TestSave", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "history")
+
+		h := loadHistory(file)
+		if len(h.entries) != 0 {
+			t.Fatalf("missing history file loaded entries %q", h.entries)
+		}
+		for _, line := range []string{"let a = 1;", "", "  ", "a + 1", "a + 1", "fn(x) {\n  x\n}"} {
+			h.add(line)
+		}
+		expected := []string{"let a = 1;", "a + 1", "fn(x) {\n  x\n}"}
+		if !reflect.DeepEqual(h.entries, expected) {
+			t.Errorf("wrong entries expected %q got %q", expected, h.entries)
+		}
+
+		// multi-line inputs are saved as one line per line
+		reloaded := loadHistory(file)
+		expected = []string{"let a = 1;", "a + 1", "fn(x) {", "  x", "}"}
+		if !reflect.DeepEqual(reloaded.entries, expected) {
+			t.Errorf("wrong entries loaded expected %q got %q", expected, reloaded.entries)
+		}
+	})
+	t.Run("TestTruncate", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "history")
+		lines := []string{}
+		for i := 0; i < MaxHistory+5; i++ {
+			lines = append(lines, fmt.Sprint("line ", i))
+		}
+		if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0600); err != nil {
+			t.Fatalf("failed to write history file with error : %s", err)
+		}
+
+		h := loadHistory(file)
+		if !reflect.DeepEqual(h.entries, lines[5:]) {
+			t.Fatalf("wrong entries loaded expected %d lines from %q got %d lines from %q", MaxHistory, lines[5], len(h.entries), h.entries[0])
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("failed to read history file with error : %s", err)
+		}
+		if saved := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"); !reflect.DeepEqual(saved, lines[5:]) {
+			t.Errorf("history file wasn't truncated expected %d lines got %d", MaxHistory, len(saved))
+		}
+
+		h.add("new line")
+		if len(h.entries) != MaxHistory || h.entries[0] != lines[6] || h.entries[MaxHistory-1] != "new line" {
+			t.Errorf("history wasn't truncated once full got %d entries from %q to %q", len(h.entries), h.entries[0], h.entries[len(h.entries)-1])
+		}
+	})
+	t.Run("TestNoFile", func(t *testing.T) {
+		h := loadHistory("")
+		h.add("1 + 2")
+		if !reflect.DeepEqual(h.entries, []string{"1 + 2"}) {
+			t.Errorf("wrong entries expected [1 + 2] got %q", h.entries)
+		}
+	})
+}
@@ -0,0 +1,86 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// errInterrupt is returned by line readers when the user cancels the input
+// with Ctrl-C.
+var errInterrupt = errors.New("interrupted")
+
+// lineReader reads the lines of inputs showing a prompt before each of them.
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// plainReader reads lines from inputs that aren't terminals.
+type plainReader struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (r *plainReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	line, err := r.in.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+// read reads an input, lines are read with the continuation prompt until the
+// braces, brackets and parenthesis of the input are balanced and its strings
+// closed. The lines read are returned with the error ending the input.
+func read(lines lineReader) (string, error) {
+	input := []string{}
+	prompt := PROMPT
+	for {
+		line, err := lines.ReadLine(prompt)
+		if err != nil {
+			return strings.Join(input, "\n"), err
+		}
+		input = append(input, line)
+
+		src := strings.Join(input, "\n")
+		if !incomplete(src) {
+			return src, nil
+		}
+		prompt = CONTINUATION
+	}
+}
+
+// incomplete reports whether an input has unclosed braces, brackets,
+// parenthesis or strings, strings have no escapes and comments run to the end
+// of the line as in the lexer. Inputs closing more than they open are
+// complete, the parser reports them.
+func incomplete(src string) bool {
+	depth := 0
+	for i := 0; i < len(src); i++ {
+		switch src[i] {
+		case '"':
+			end := strings.IndexByte(src[i+1:], '"')
+			if end == -1 {
+				return true
+			}
+			i += end + 1
+		case '/':
+			if i+1 < len(src) && src[i+1] == '/' {
+				end := strings.IndexByte(src[i:], '\n')
+				if end == -1 {
+					return depth > 0
+				}
+				i += end
+			}
+		case '{', '[', '(':
+			depth++
+		case '}', ']', ')':
+			depth--
+		}
+	}
+
+	return depth > 0
+}
@@ -0,0 +1,123 @@
+package repl
+
+import (
+	"io"
+	"reflect"
+	"testing"
+)
+
+// fakeReader returns scripted lines and records the prompts shown, it returns
+// err once its lines are read.
+type fakeReader struct {
+	lines   []string
+	err     error
+	prompts []string
+}
+
+func (r *fakeReader) ReadLine(prompt string) (string, error) {
+	r.prompts = append(r.prompts, prompt)
+	if len(r.lines) == 0 {
+		return "", r.err
+	}
+	line := r.lines[0]
+	r.lines = r.lines[1:]
+	return line, nil
+}
+
+func TestInput(t *testing.T) {
+	t.Run("TestIncomplete", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected bool
+		}{
+			{"", false},
+			{"1 + 2", false},
+			{"4 / 2", false},
+			{"fn(x) {", true},
+			{"fn(x) { x }", false},
+			{"[1,\n2", true},
+			{"[1,\n2]", false},
+			{"f(g(1)", true},
+			// strings
+			{`"abc`, true},
+			{"\"abc\n", true},
+			{`"a{["`, false},
+			{`"a}" + {`, true},
+			{`let s = "x"; s`, false},
+			// comments run to the end of the line
+			{"// {", false},
+			{"let a = 1 // (", false},
+			{"{ // }", true},
+			{"{ // }\n}", false},
+			{"// \"", false},
+			// more closers than openers are left to the parser
+			{")", false},
+			{"}}", false},
+			{"} {", false},
+			{"]) {", false},
+		}
+
+		for _, tt := range tests {
+			if got := incomplete(tt.input); got != tt.expected {
+				t.Errorf("wrong result for %q expected %t got %t", tt.input, tt.expected, got)
+			}
+		}
+	})
+	t.Run("TestRead", func(t *testing.T) {
+		tests := []struct {
+			lines   []string
+			err     error
+			input   string
+			readErr error
+			prompts []string
+		}{
+			{
+				lines:   []string{"1 + 2"},
+				input:   "1 + 2",
+				prompts: []string{PROMPT},
+			},
+			{
+				lines:   []string{"let f = fn(x) {", "  x * 2", "};"},
+				input:   "let f = fn(x) {\n  x * 2\n};",
+				prompts: []string{PROMPT, CONTINUATION, CONTINUATION},
+			},
+			{
+				lines:   []string{`let s = "a`, `b";`},
+				input:   "let s = \"a\nb\";",
+				prompts: []string{PROMPT, CONTINUATION},
+			},
+			{
+				// the lines read are returned with the error ending the input
+				lines:   []string{"[1,", "2,"},
+				err:     io.EOF,
+				input:   "[1,\n2,",
+				readErr: io.EOF,
+				prompts: []string{PROMPT, CONTINUATION, CONTINUATION},
+			},
+			{
+				lines:   []string{"if (true) {"},
+				err:     errInterrupt,
+				input:   "if (true) {",
+				readErr: errInterrupt,
+				prompts: []string{PROMPT, CONTINUATION},
+			},
+			{
+				err:     io.EOF,
+				input:   "",
+				readErr: io.EOF,
+				prompts: []string{PROMPT},
+			},
+		}
+
+		for _, tt := range tests {
+			reader := &fakeReader{lines: tt.lines, err: tt.err}
+			input, err := read(reader)
+			if input != tt.input || err != tt.readErr {
+				t.Errorf("wrong input read from %q expected %q, %v got %q, %v", tt.lines, tt.input, tt.readErr, input, err)
+			}
+			if !reflect.DeepEqual(reader.prompts, tt.prompts) {
+				t.Errorf("wrong prompts for %q expected %q got %q", tt.lines, tt.prompts, reader.prompts)
+			}
+		}
+	})
+}
@@ -5,8 +5,11 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
+	"strings"
 
 	"github.com/actuallyachraf/monkey-giggle/compiler"
+	"github.com/actuallyachraf/monkey-giggle/macro"
 	"github.com/actuallyachraf/monkey-giggle/object"
 	"github.com/actuallyachraf/monkey-giggle/parser"
 	"github.com/actuallyachraf/monkey-giggle/vm"
@@ -17,38 +20,47 @@ import (
 // PROMPT marks prompt level console
 const PROMPT = "giggle>> "
 
+// CONTINUATION marks the lines continuing an unfinished input
+const CONTINUATION = "      .. "
+
 // WELCOME the user to make us giggle
 const WELCOME = "Make me giggle !\n"
 
 // EXIT the repl
 const EXIT = "Ohhh you're leaving already !"
 
-// Start the read eval print loop.
+// Start the read eval print loop, inputs span several lines until their
+// braces, brackets and parenthesis are balanced and their strings closed.
+// Terminals get line editing with a history saved to the history file and
+// Ctrl-C cancels the current input.
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
+	lines := newLineReader(in, out)
 
 	constants := []object.Object{}
 	globals := make([]object.Object, vm.GlobalsSize)
 
+	expander := macro.New()
 	symbolTable := compiler.NewSymbolTable()
 	for i, v := range object.Builtins {
 		symbolTable.DefineBuiltIn(i, v.Name)
 	}
 
 	for {
-		fmt.Printf(PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		input, err := read(lines)
+		if err == errInterrupt {
+			continue
+		}
+		// inputs ended by the end of the input are still evaluated, the
+		// next read returns the end again
+		if err != nil && strings.TrimSpace(input) == "" {
 			return
 		}
 
-		line := scanner.Text()
-
-		if line == "exit" {
-			fmt.Println(EXIT)
+		if input == "exit" {
+			fmt.Fprintln(out, EXIT)
 			break
 		}
-		l := lexer.New(line)
+		l := lexer.New(input)
 		p := parser.New(l)
 
 		program := p.Parse()
@@ -57,8 +69,14 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
+		program, err = expander.Expand(program)
+		if err != nil {
+			fmt.Fprintf(out, "Woops! Macro expansion failed:\n %s\n", err)
+			continue
+		}
+
 		comp := compiler.NewWithState(symbolTable, constants)
-		err := comp.Compile(program)
+		err = comp.Compile(program)
 		if err != nil {
 			fmt.Fprintf(out, "Woops! Compilation failed:\n %s\n", err)
 			continue
@@ -74,12 +92,28 @@ func Start(in io.Reader, out io.Writer) {
 			continue
 		}
 
+		// inputs only defining macros leave nothing to print
 		lastPopped := machine.LastPoppedStackElem()
+		if lastPopped == nil {
+			continue
+		}
 		io.WriteString(out, lastPopped.Inspect())
 		io.WriteString(out, "\n")
 	}
 }
 
+// newLineReader returns the reader of the lines of inputs, an editor when in
+// is a terminal.
+func newLineReader(in io.Reader, out io.Writer) lineReader {
+	if f, ok := in.(*os.File); ok {
+		if e, err := newEditor(f, out, loadHistory(historyFile())); err == nil {
+			return e
+		}
+	}
+
+	return &plainReader{in: bufio.NewReader(in), out: out}
+}
+
 func printParserErrors(out io.Writer, errors []string) {
 	for _, msg := range errors {
 		io.WriteString(out, "\t"+msg+"\n")
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package repl
+
+import "errors"
+
+// termState is the state of a terminal, line editing isn't supported on this
+// platform and inputs are read as plain lines.
+type termState struct{}
+
+func makeRaw(fd uintptr) (*termState, error) {
+	return nil, errors.New("line editing not supported")
+}
+
+func restore(fd uintptr, state *termState) error {
+	return nil
+}
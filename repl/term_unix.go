@@ -0,0 +1,50 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package repl
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// termState is the state of a terminal restored once a line is read.
+type termState struct {
+	termios syscall.Termios
+}
+
+// makeRaw puts a terminal in raw mode returning its previous state, keys are
+// read as they are typed without echo and Ctrl-C is read instead of raising
+// SIGINT. Output processing is kept so newlines still return the carriage.
+func makeRaw(fd uintptr) (*termState, error) {
+	var state termState
+	if err := ioctlTermios(fd, ioctlGetTermios, &state.termios); err != nil {
+		return nil, err
+	}
+
+	raw := state.termios
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctlTermios(fd, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// restore puts a terminal back in the state returned by makeRaw.
+func restore(fd uintptr, state *termState) error {
+	return ioctlTermios(fd, ioctlSetTermios, &state.termios)
+}
+
+func ioctlTermios(fd uintptr, request uintptr, termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
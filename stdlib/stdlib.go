@@ -0,0 +1,17 @@
+// Package stdlib embeds the giggle standard library, a set of modules written
+// in giggle and imported with the std/ prefix such as import "std/collections".
+//
+// The library ships the following modules :
+//
+//   - std/functional : identity, constant, compose, pipe, partial and flip.
+//   - std/collections : array helpers such as map, filter, reduce and range.
+//   - std/strings : string helpers such as join, split, trim and padLeft.
+//   - std/iterators : lazy sequences built from arrays, counters and functions.
+package stdlib
+
+import "embed"
+
+// FS holds the sources of the standard library modules.
+//
+//go:embed *.gg
+var FS embed.FS
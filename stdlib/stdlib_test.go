@@ -0,0 +1,110 @@
+package stdlib_test
+
+import (
+	"testing"
+
+	"github.com/actuallyachraf/monkey-giggle/ast"
+	"github.com/actuallyachraf/monkey-giggle/compiler"
+	"github.com/actuallyachraf/monkey-giggle/eval"
+	"github.com/actuallyachraf/monkey-giggle/lexer"
+	"github.com/actuallyachraf/monkey-giggle/object"
+	"github.com/actuallyachraf/monkey-giggle/parser"
+	"github.com/actuallyachraf/monkey-giggle/vm"
+)
+
+func TestStdlib(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// std/functional
+		{`let {identity} = import "std/functional"; identity(5)`, "5"},
+		{`let {constant} = import "std/functional"; constant(3)(1, 2)`, "3"},
+		{`let {compose} = import "std/functional"; compose(fn(x) { x * 2 }, fn(x, y) { x + y })(1, 2)`, "6"},
+		{`let {pipe} = import "std/functional"; pipe(fn(x) { x + 1 }, fn(x) { x * 10 })(1)`, "20"},
+		{`let {pipe} = import "std/functional"; pipe()(7)`, "7"},
+		{`let {partial} = import "std/functional"; partial(fn(a, b, c) { a - b - c }, 10, 2)(3)`, "5"},
+		{`let {flip} = import "std/functional"; flip(fn(a, b) { a - b })(1, 10)`, "9"},
+		// std/collections
+		{`let {range} = import "std/collections"; range(0, 5)`, "[0, 1, 2, 3, 4]"},
+		{`let {range} = import "std/collections"; range(3, 1)`, "[]"},
+		{`let {range} = import "std/collections"; len(range(0, 5000))`, "5000"},
+		{`let {map} = import "std/collections"; map([1, 2, 3], fn(x) { x * x })`, "[1, 4, 9]"},
+		{`let {map} = import "std/collections"; map([], fn(x) { x })`, "[]"},
+		{`let {filter} = import "std/collections"; filter([1, 2, 3, 4, 5], fn(x) { x % 2 == 1 })`, "[1, 3, 5]"},
+		{`let {reduce} = import "std/collections"; reduce([1, 2, 3, 4], fn(acc, x) { acc * 10 + x }, 0)`, "1234"},
+		{`let {reverse} = import "std/collections"; reverse([1, 2, 3])`, "[3, 2, 1]"},
+		{`let {flatten} = import "std/collections"; flatten([[1], [], [2, 3]])`, "[1, 2, 3]"},
+		{`let {any, all} = import "std/collections"; [any([1, 2], fn(x) { x > 1 }), all([1, 2], fn(x) { x > 1 }), all([], fn(x) { false })]`, "[true, false, true]"},
+		{`let {find, findIndex} = import "std/collections"; [find([1, 4, 6], fn(x) { x > 3 }), findIndex([1, 4, 6], fn(x) { x > 4 }), find([1], fn(x) { false })]`, "[4, 2, null]"},
+		{`let {indexOf, contains} = import "std/collections"; [indexOf([5, 6, 7], 7), indexOf([5], 1), contains([5, 6], 6)]`, "[2, -1, true]"},
+		{`let {count, sum} = import "std/collections"; [count([1, 2, 3], fn(x) { x > 1 }), sum([1, 2, 3])]`, "[2, 6]"},
+		{`let {take, drop} = import "std/collections"; [take([1, 2, 3], 2), drop([1, 2, 3], 2), take([1], 0)]`, "[[1, 2], [3], []]"},
+		{`let {zip} = import "std/collections"; zip([1, 2, 3], ["a", "b"])`, "[[1, a], [2, b]]"},
+		{`let {unique} = import "std/collections"; unique([1, 2, 1, 3, 2])`, "[1, 2, 3]"},
+		{`let {sortBy} = import "std/collections"; sortBy(["ccc", "a", "bb", "d"], len)`, "[a, d, bb, ccc]"},
+		// std/strings
+		{`let {join} = import "std/strings"; join(["a", "b", "c"], ", ")`, "a, b, c"},
+		{`let {join} = import "std/strings"; join([], ", ")`, ""},
+		{`let {repeat} = import "std/strings"; repeat("ab", 3)`, "ababab"},
+		{`let {reverse} = import "std/strings"; reverse("giggle")`, "elggig"},
+		{`let {chars} = import "std/strings"; chars("abc")`, "[a, b, c]"},
+		{`let {startsWith, endsWith} = import "std/strings"; [startsWith("giggle", "gig"), endsWith("giggle", "gle"), startsWith("a", "ab")]`, "[true, true, false]"},
+		{`let {indexOf, contains} = import "std/strings"; [indexOf("monkey giggle", "gig"), indexOf("abc", "d"), contains("abc", "bc")]`, "[7, -1, true]"},
+		{`let {split} = import "std/strings"; split("a,b,,c", ",")`, "[a, b, , c]"},
+		{`let {split} = import "std/strings"; split("ab", "")`, "[a, b]"},
+		{`let {trim, trimLeft, trimRight} = import "std/strings"; [trim("  a b  "), trimLeft(" a "), trimRight(" a "), trim("   ")]`, "[a b, a ,  a, ]"},
+		{`let {padLeft, padRight} = import "std/strings"; [padLeft("7", 3, "0"), padRight("ab", 4, "."), padLeft("abc", 2, "0")]`, "[007, ab.., abc]"},
+		// std/iterators
+		{`let it = import "std/iterators"; it["toArray"](it["fromArray"]([1, 2, 3]))`, "[1, 2, 3]"},
+		{`let it = import "std/iterators"; it["toArray"](it["empty"])`, "[]"},
+		{`let it = import "std/iterators"; it["toArray"](it["take"](it["count"](0, 2), 4))`, "[0, 2, 4, 6]"},
+		{`let it = import "std/iterators"; it["toArray"](it["take"](it["iterate"](fn(x) { x * 2 }, 1), 5))`, "[1, 2, 4, 8, 16]"},
+		{`let it = import "std/iterators"; it["toArray"](it["take"](it["repeat"]("x"), 2))`, "[x, x]"},
+		{`let {map, filter, take, count, toArray} = import "std/iterators"; toArray(take(filter(map(count(1, 1), fn(x) { x * x }), fn(x) { x % 2 == 0 }), 3))`, "[4, 16, 36]"},
+		{`let {drop, takeWhile, count, toArray} = import "std/iterators"; toArray(takeWhile(drop(count(0, 1), 3), fn(x) { x < 6 }))`, "[3, 4, 5]"},
+		{`let {zip, fromArray, count, toArray} = import "std/iterators"; toArray(zip(count(0, 1), fromArray(["a", "b"])))`, "[[0, a], [1, b]]"},
+		{`let {reduce, fromArray} = import "std/iterators"; reduce(fromArray([1, 2, 3]), fn(acc, x) { acc + x }, 10)`, "16"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+
+		evaluated := eval.Eval(program, object.NewEnv())
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("eval : wrong result for %s expected %s got %v", tt.input, tt.expected, inspect(evaluated))
+		}
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Errorf("compiler error for %s : %s", tt.input, err)
+			continue
+		}
+		machine := vm.New(comp.Bytecode())
+		if err := machine.Run(); err != nil {
+			t.Errorf("vm error for %s : %s", tt.input, err)
+			continue
+		}
+		if got := machine.LastPoppedStackElem(); got.Inspect() != tt.expected {
+			t.Errorf("vm : wrong result for %s expected %s got %s", tt.input, tt.expected, got.Inspect())
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.Parse()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %s : %v", input, p.Errors())
+	}
+
+	return program
+}
+
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "nil"
+	}
+
+	return obj.Inspect()
+}
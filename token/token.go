@@ -1,15 +1,39 @@
 package token
 
+import "fmt"
+
 // Type encodes the type of the token
 type Type string
 
 // Literal encodes a literal value
 type Literal string
 
-// Token represents the actual token holds the type and it's literal representation.
+// Token represents the actual token holds the type and it's literal representation,
+// Pos is where the token starts in the source code.
 type Token struct {
 	Type
 	Literal
+	Pos Position
+}
+
+// Position is a position in the source code, lines and columns start at 1 and
+// columns count bytes. The zero value is the position of synthesized tokens.
+type Position struct {
+	Line   int
+	Column int
+}
+
+// IsValid reports whether the position is in the source code.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String implements the stringer interface
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 // New creates a new token instance
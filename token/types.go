@@ -14,6 +14,9 @@ const (
 	INT = "INT"
 	// STRING denotes the string type
 	STRING = "STRING"
+	// COMMENT denotes line comments starting with // which the lexer records
+	// instead of returning them
+	COMMENT = "COMMENT"
 
 	// Operators
 
@@ -44,9 +47,17 @@ const (
 
 	// BANG denotes the bang token
 	BANG = "!"
+	// NULLISH denotes the null-coalescing operator
+	NULLISH = "??"
+	// OPTCHAIN denotes the safe navigation operator used as a?.[k]
+	OPTCHAIN = "?."
 
 	// Delimiters are used to separate text representations
 
+	// ARROW separates match arm patterns from their body
+	ARROW = "=>"
+	// ELLIPSIS represents the rest parameter and spread operator
+	ELLIPSIS = "..."
 	// COLON represents the colon assignment for hashmaps
 	COLON = ":"
 	// SEMICOLON represents the semicolon delimiter for scopes
@@ -83,4 +94,22 @@ const (
 	ELSE = "ELSE"
 	// RETURN represents the return instruction
 	RETURN = "RETURN"
+	// NULL represents the null value
+	NULL = "NULL"
+	// MATCH represents the pattern matching expression
+	MATCH = "MATCH"
+	// THROW represents the throw statement
+	THROW = "THROW"
+	// TRY represents the try expression
+	TRY = "TRY"
+	// CATCH represents the exception handler of a try expression
+	CATCH = "CATCH"
+	// FINALLY represents the cleanup block of a try expression
+	FINALLY = "FINALLY"
+	// IMPORT represents the module import expression
+	IMPORT = "IMPORT"
+	// EXPORT represents exported let statements
+	EXPORT = "EXPORT"
+	// MACRO represents a new macro declaration
+	MACRO = "MACRO"
 )
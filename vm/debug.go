@@ -0,0 +1,306 @@
+package vm
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/actuallyachraf/monkey-giggle/object"
+	"github.com/actuallyachraf/monkey-giggle/token"
+)
+
+// debug.go implements the debugger hooked in the main loop of the VM, the
+// debugger follows the source line of the instruction about to run in every
+// frame and stops when a frame enters a new line that holds a breakpoint or
+// ends a step. Execution resumes with the action returned by the callback
+// invoked on every stop, the state of the VM can be inspected meanwhile.
+
+// ErrAborted is returned by Run when the debugger aborts the program.
+var ErrAborted = errors.New("program aborted by the debugger")
+
+// Action tells the debugger how to resume execution after a stop.
+type Action int
+
+const (
+	// Continue runs until the next breakpoint.
+	Continue Action = iota
+	// StepIn stops at the next line, in a called function if any.
+	StepIn
+	// StepOver stops at the next line of the current function or its callers.
+	StepOver
+	// StepOut stops at the next line of the calling function.
+	StepOut
+	// Abort ends the program.
+	Abort
+)
+
+// StopReason tells why the debugger stopped.
+type StopReason string
+
+const (
+	// StopEntry is the stop before the first line of the program.
+	StopEntry StopReason = "entry"
+	// StopBreakpoint is a stop at a breakpoint.
+	StopBreakpoint StopReason = "breakpoint"
+	// StopStep is a stop ending a step.
+	StopStep StopReason = "step"
+)
+
+// StackFrame locates a call frame, Pos is the position of the instruction
+// about to run in the innermost frame and of the pending call in the others.
+type StackFrame struct {
+	Function string
+	File     string
+	Pos      token.Position
+}
+
+// Stop describes a stop of the debugger in the innermost frame.
+type Stop struct {
+	Reason StopReason
+	StackFrame
+}
+
+// Variable is a named value of a frame.
+type Variable struct {
+	Name  string
+	Value object.Object
+}
+
+// Breakpoint is a source line the debugger stops at.
+type Breakpoint struct {
+	File string
+	Line int
+}
+
+// Debugger controls the execution of a VM, OnStop is called on every stop and
+// returns how execution resumes. Breakpoints can be changed from another
+// goroutine while the program runs.
+type Debugger struct {
+	StopOnEntry bool
+	OnStop      func(stop Stop) Action
+
+	mu          sync.Mutex
+	breakpoints map[Breakpoint]bool
+	action      Action
+	// depth is the number of frames when the last step started
+	depth int
+	// started is set once the first line of the program was reached
+	started bool
+}
+
+// NewDebugger creates a new debugger calling onStop on every stop.
+func NewDebugger(onStop func(stop Stop) Action) *Debugger {
+	return &Debugger{
+		OnStop:      onStop,
+		breakpoints: make(map[Breakpoint]bool),
+	}
+}
+
+// SetBreakpoint adds a breakpoint at a line of a file.
+func (d *Debugger) SetBreakpoint(file string, line int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints[Breakpoint{File: file, Line: line}] = true
+}
+
+// ClearBreakpoint removes the breakpoint at a line of a file.
+func (d *Debugger) ClearBreakpoint(file string, line int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.breakpoints, Breakpoint{File: file, Line: line})
+}
+
+// ClearBreakpoints removes the breakpoints of a file.
+func (d *Debugger) ClearBreakpoints(file string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for bp := range d.breakpoints {
+		if bp.File == file {
+			delete(d.breakpoints, bp)
+		}
+	}
+}
+
+// Breakpoints returns the breakpoints sorted by file and line.
+func (d *Debugger) Breakpoints() []Breakpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	bps := make([]Breakpoint, 0, len(d.breakpoints))
+	for bp := range d.breakpoints {
+		bps = append(bps, bp)
+	}
+	sort.Slice(bps, func(i, j int) bool {
+		if bps[i].File != bps[j].File {
+			return bps[i].File < bps[j].File
+		}
+		return bps[i].Line < bps[j].Line
+	})
+
+	return bps
+}
+
+// SetDebugger attaches a debugger to the VM, a nil debugger detaches it.
+func (vm *VM) SetDebugger(d *Debugger) {
+	vm.debugger = d
+}
+
+// debug is called before every instruction while a debugger is attached, it
+// stops when the instruction starts a new line in its frame.
+func (vm *VM) debug() error {
+	d := vm.debugger
+	frame := vm.currentFrame()
+	pos := frame.cl.Fn.PositionAt(frame.ip + 1)
+	if !pos.IsValid() || pos.Line == frame.line {
+		return nil
+	}
+	frame.line = pos.Line
+
+	entry := !d.started
+	d.started = true
+
+	d.mu.Lock()
+	breakpoint := d.breakpoints[Breakpoint{File: frame.cl.Fn.File, Line: pos.Line}]
+	d.mu.Unlock()
+
+	var reason StopReason
+	switch {
+	case entry && d.StopOnEntry:
+		reason = StopEntry
+	case breakpoint:
+		reason = StopBreakpoint
+	case d.action == StepIn,
+		d.action == StepOver && vm.framesIndex <= d.depth,
+		d.action == StepOut && vm.framesIndex < d.depth:
+		reason = StopStep
+	default:
+		return nil
+	}
+
+	d.action = Continue
+	if d.OnStop != nil {
+		d.action = d.OnStop(Stop{Reason: reason, StackFrame: vm.stackFrame(0)})
+	}
+	d.depth = vm.framesIndex
+	if d.action == Abort {
+		return ErrAborted
+	}
+
+	return nil
+}
+
+// frame returns the i-th frame starting from the innermost one.
+func (vm *VM) frame(i int) (*Frame, bool) {
+	if i < 0 || i >= vm.framesIndex {
+		return nil, false
+	}
+
+	return vm.frames[vm.framesIndex-1-i], true
+}
+
+// stackFrame returns the location of the i-th frame.
+func (vm *VM) stackFrame(i int) StackFrame {
+	frame := vm.frames[vm.framesIndex-1-i]
+	ip := frame.ip
+	if i == 0 {
+		// the innermost frame is about to run the next instruction
+		ip++
+	}
+
+	return StackFrame{
+		Function: frame.cl.Fn.Name,
+		File:     frame.cl.Fn.File,
+		Pos:      frame.cl.Fn.PositionAt(ip),
+	}
+}
+
+// StackTrace returns the call frames starting from the innermost one, it's
+// meant to be called while the debugger is stopped.
+func (vm *VM) StackTrace() []StackFrame {
+	trace := make([]StackFrame, vm.framesIndex)
+	for i := range trace {
+		trace[i] = vm.stackFrame(i)
+	}
+
+	return trace
+}
+
+// Locals returns the local bindings of the i-th frame that hold a value,
+// hidden bindings of the compiler are omitted.
+func (vm *VM) Locals(i int) []Variable {
+	frame, ok := vm.frame(i)
+	if !ok {
+		return nil
+	}
+
+	locals := []Variable{}
+	for index, name := range frame.cl.Fn.LocalNames {
+		val := vm.stack[frame.basePointer+index]
+		if val == nil || strings.HasPrefix(name, "$") {
+			continue
+		}
+		locals = append(locals, Variable{Name: name, Value: val})
+	}
+
+	return locals
+}
+
+// FreeVariables returns the free variables of the i-th frame.
+func (vm *VM) FreeVariables(i int) []Variable {
+	frame, ok := vm.frame(i)
+	if !ok {
+		return nil
+	}
+
+	free := make([]Variable, 0, len(frame.cl.FreeVariables))
+	for index, val := range frame.cl.FreeVariables {
+		name := ""
+		if index < len(frame.cl.Fn.FreeNames) {
+			name = frame.cl.Fn.FreeNames[index]
+		}
+		free = append(free, Variable{Name: name, Value: val})
+	}
+
+	return free
+}
+
+// Globals returns the global bindings of the main program that hold a value.
+func (vm *VM) Globals() []Variable {
+	globals := []Variable{}
+	for index, name := range vm.globalNames {
+		if index >= len(vm.globals) {
+			break
+		}
+		val := vm.globals[index]
+		if val == nil || strings.HasPrefix(name, "$") {
+			continue
+		}
+		globals = append(globals, Variable{Name: name, Value: val})
+	}
+
+	return globals
+}
+
+// OperandStack returns the values pushed by the i-th frame above its local
+// bindings, the bottom of the stack first.
+func (vm *VM) OperandStack(i int) []object.Object {
+	frame, ok := vm.frame(i)
+	if !ok {
+		return nil
+	}
+
+	top := vm.sp
+	if callee, ok := vm.frame(i - 1); ok {
+		// the callee and its arguments belong to the called frame
+		top = callee.basePointer - 1
+	}
+	bottom := frame.basePointer + frame.cl.Fn.NumLocals
+	if top < bottom {
+		return []object.Object{}
+	}
+
+	operands := make([]object.Object, top-bottom)
+	copy(operands, vm.stack[bottom:top])
+
+	return operands
+}
@@ -5,11 +5,22 @@ import (
 	"github.com/actuallyachraf/monkey-giggle/object"
 )
 
-// Frame represents a stack frame used to execute function calls
+// Frame represents a stack frame used to execute function calls, tries holds
+// the exception handlers activated in the frame and line the last source line
+// the debugger reported in the frame.
 type Frame struct {
 	cl          *object.Closure
 	ip          int
 	basePointer int
+	tries       []tryBlock
+	line        int
+}
+
+// tryBlock represents an active exception handler, sp is the stack pointer
+// restored when the handler catches an exception.
+type tryBlock struct {
+	target int
+	sp     int
 }
 
 // NewFrame creates a new frame for a given compiled function
@@ -6,6 +6,7 @@ import (
 	"github.com/actuallyachraf/monkey-giggle/code"
 	"github.com/actuallyachraf/monkey-giggle/compiler"
 	"github.com/actuallyachraf/monkey-giggle/object"
+	"github.com/actuallyachraf/monkey-giggle/token"
 )
 
 const (
@@ -37,6 +38,17 @@ type VM struct {
 
 	frames      []*Frame
 	framesIndex int
+
+	// modules caches the imported modules so their code runs once
+	modules map[*object.CompiledModule]*object.Module
+
+	// globalNames are the names of the global bindings of the main program
+	// and debugger the debugger attached to the VM if any
+	globalNames []string
+	debugger    *Debugger
+
+	// executed counts the instructions run, benchmarks report it
+	executed int
 }
 
 // New creates a new instance of VM using bytecode to execute.
@@ -44,8 +56,14 @@ func New(bytecode compiler.Bytecode) *VM {
 
 	// the program bytecode is considered an entire function and is pushed
 	// as part of it's own call frame
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
-	mainClosure := &object.Closure{Fn: mainFn}
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Handlers:     bytecode.Handlers,
+		File:         bytecode.File,
+		Positions:    bytecode.Positions,
+	}
+	globals := make([]object.Object, GlobalsSize)
+	mainClosure := &object.Closure{Fn: mainFn, Globals: globals, GlobalNames: bytecode.GlobalNames}
 	mainFrame := NewFrame(mainClosure, 0)
 
 	frames := make([]*Frame, MaxFrames)
@@ -53,11 +71,13 @@ func New(bytecode compiler.Bytecode) *VM {
 
 	return &VM{
 		constants:   bytecode.Constants,
-		globals:     make([]object.Object, GlobalsSize),
+		globals:     globals,
 		stack:       make([]object.Object, StackSize),
 		sp:          0,
 		frames:      frames,
 		framesIndex: 1,
+		modules:     make(map[*object.CompiledModule]*object.Module),
+		globalNames: bytecode.GlobalNames,
 	}
 }
 
@@ -65,6 +85,7 @@ func New(bytecode compiler.Bytecode) *VM {
 func NewWithGlobalState(bytecode compiler.Bytecode, s []object.Object) *VM {
 	vm := New(bytecode)
 	vm.globals = s
+	vm.frames[0].cl.Globals = s
 
 	return vm
 }
@@ -95,8 +116,96 @@ func (vm *VM) StackTop() object.Object {
 	return vm.stack[vm.sp-1]
 }
 
-// Run is the main loop that runs a fetch-decode-execute cycle.
+// RuntimeError is an error raised while running a program that no exception
+// handler caught, File, Function and Pos locate the instruction that raised it.
+type RuntimeError struct {
+	Err      error
+	File     string
+	Function string
+	Pos      token.Position
+}
+
+func (e *RuntimeError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the raised error.
+func (e *RuntimeError) Unwrap() error {
+	return e.Err
+}
+
+// Location returns the file:line:column location of the instruction that
+// raised the error, unknown parts are omitted.
+func (e *RuntimeError) Location() string {
+	switch {
+	case !e.Pos.IsValid():
+		return e.File
+	case e.File == "":
+		return e.Pos.String()
+	default:
+		return e.File + ":" + e.Pos.String()
+	}
+}
+
+// exception is the error raised by throw statements and failing builtins.
+type exception struct {
+	err *object.Error
+}
+
+func (e *exception) Error() string {
+	return e.err.Message
+}
+
+// Run executes the program, errors raised while running unwind the stack to
+// the closest active exception handler and are returned when none catches them.
 func (vm *VM) Run() error {
+	for {
+		err := vm.run()
+		if err == nil || err == ErrAborted {
+			return err
+		}
+		frame := vm.currentFrame()
+		raised := &RuntimeError{
+			Err:      err,
+			File:     frame.cl.Fn.File,
+			Function: frame.cl.Fn.Name,
+			Pos:      frame.cl.Fn.PositionAt(frame.ip),
+		}
+		err = vm.throw(err)
+		if err != nil {
+			return raised
+		}
+	}
+}
+
+// throw unwinds the call frames until one has an active exception handler
+// and jumps to it, the error is returned if it is uncaught.
+func (vm *VM) throw(err error) error {
+	var exc *object.Error
+	if e, ok := err.(*exception); ok {
+		exc = e.err
+	} else {
+		exc = &object.Error{Message: err.Error()}
+	}
+
+	for {
+		frame := vm.currentFrame()
+		if n := len(frame.tries); n > 0 {
+			handler := frame.tries[n-1]
+			frame.tries = frame.tries[:n-1]
+			vm.sp = handler.sp
+			frame.ip = handler.target - 1
+			return vm.push(exc.Caught())
+		}
+		if vm.framesIndex == 1 {
+			return err
+		}
+		vm.popFrame()
+	}
+}
+
+// run is the main loop that runs a fetch-decode-execute cycle.
+func (vm *VM) run() error {
 
 	var ip int
 	var inst code.Instructions
@@ -104,7 +213,15 @@ func (vm *VM) Run() error {
 
 	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
 
+		if vm.debugger != nil {
+			err := vm.debug()
+			if err != nil {
+				return err
+			}
+		}
+
 		vm.currentFrame().ip++
+		vm.executed++
 
 		ip = vm.currentFrame().ip
 		inst = vm.currentFrame().Instructions()
@@ -126,7 +243,7 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterOrEqual, code.OpGreaterThan:
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterOrEqual, code.OpGreaterThan, code.OpLessThan, code.OpLessOrEqual:
 			err := vm.executeCompare(op)
 			if err != nil {
 				return err
@@ -162,6 +279,20 @@ func (vm *VM) Run() error {
 			if !isTrue(condition) {
 				vm.currentFrame().ip = pos - 1
 			}
+		case code.OpJumpNull:
+			pos := int(code.ReadUint16(inst[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if isNull(vm.StackTop()) {
+				vm.currentFrame().ip = pos - 1
+			}
+		case code.OpJumpNotNull:
+			pos := int(code.ReadUint16(inst[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			if !isNull(vm.StackTop()) {
+				vm.currentFrame().ip = pos - 1
+			}
 		case code.OpNull:
 			err := vm.push(Null)
 			if err != nil {
@@ -171,12 +302,18 @@ func (vm *VM) Run() error {
 			globalIndex := code.ReadUint16(inst[ip+1:])
 			vm.currentFrame().ip += 2
 
-			vm.globals[globalIndex] = vm.pop()
+			vm.currentFrame().cl.Globals[globalIndex] = vm.pop()
 		case code.OpGetGlobal:
 			globalIndex := code.ReadUint16(inst[ip+1:])
 			vm.currentFrame().ip += 2
 
-			err := vm.push(vm.globals[globalIndex])
+			cl := vm.currentFrame().cl
+			global := cl.Globals[globalIndex]
+			if global == nil {
+				// the binding was skipped by a branch that didn't run
+				return undefinedGlobal(cl, int(globalIndex))
+			}
+			err := vm.push(global)
 			if err != nil {
 				return err
 			}
@@ -228,6 +365,128 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpSlice:
+			end := vm.pop()
+			start := vm.pop()
+			left := vm.pop()
+
+			slice, err := object.Slice(left, start, end)
+			if err != nil {
+				return err
+			}
+			err = vm.push(slice)
+			if err != nil {
+				return err
+			}
+		case code.OpConcatArrays:
+			numArrays := int(code.ReadUint16(inst[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			array, err := vm.concatArrays(vm.sp-numArrays, vm.sp)
+			if err != nil {
+				return err
+			}
+			vm.sp = vm.sp - numArrays
+
+			err = vm.push(array)
+			if err != nil {
+				return err
+			}
+		case code.OpCallSpread:
+			numArgs, err := vm.spreadArguments()
+			if err != nil {
+				return err
+			}
+			err = vm.executeFunctionCall(numArgs)
+			if err != nil {
+				return err
+			}
+		case code.OpTailCallSpread:
+			numArgs, err := vm.spreadArguments()
+			if err != nil {
+				return err
+			}
+			err = vm.executeTailCall(numArgs)
+			if err != nil {
+				return err
+			}
+		case code.OpDup:
+			err := vm.push(vm.StackTop())
+			if err != nil {
+				return err
+			}
+		case code.OpDestructureArray:
+			numElements := int(code.ReadUint16(inst[ip+1:]))
+			rest := code.ReadUint8(inst[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			err := object.CheckArrayShape(vm.StackTop(), numElements, rest)
+			if err != nil {
+				return err
+			}
+		case code.OpDestructureHash:
+			numKeys := int(code.ReadUint16(inst[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			keys := make([]object.Object, numKeys)
+			copy(keys, vm.stack[vm.sp-numKeys:vm.sp])
+			vm.sp = vm.sp - numKeys
+
+			err := object.CheckHashShape(vm.StackTop(), keys)
+			if err != nil {
+				return err
+			}
+		case code.OpMatchArray:
+			numElements := int(code.ReadUint16(inst[ip+1:]))
+			rest := code.ReadUint8(inst[ip+3:]) == 1
+			vm.currentFrame().ip += 3
+
+			err := object.CheckArrayShape(vm.pop(), numElements, rest)
+			err = vm.push(nativeBoolToBooleanObject(err == nil))
+			if err != nil {
+				return err
+			}
+		case code.OpMatchHash:
+			numKeys := int(code.ReadUint16(inst[ip+1:]))
+			vm.currentFrame().ip += 2
+
+			keys := make([]object.Object, numKeys)
+			copy(keys, vm.stack[vm.sp-numKeys:vm.sp])
+			vm.sp = vm.sp - numKeys
+
+			err := object.CheckHashShape(vm.pop(), keys)
+			err = vm.push(nativeBoolToBooleanObject(err == nil))
+			if err != nil {
+				return err
+			}
+		case code.OpTry:
+			handlerIndex := code.ReadUint16(inst[ip+1:])
+			vm.currentFrame().ip += 2
+
+			frame := vm.currentFrame()
+			handler := frame.cl.Fn.Handlers[handlerIndex]
+			frame.tries = append(frame.tries, tryBlock{target: handler.Target, sp: vm.sp})
+		case code.OpEndTry:
+			frame := vm.currentFrame()
+			frame.tries = frame.tries[:len(frame.tries)-1]
+		case code.OpImport:
+			constIndex := code.ReadUint16(inst[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.importModule(vm.constants[constIndex].(*object.CompiledModule))
+			if err != nil {
+				return err
+			}
+		case code.OpModule:
+			constIndex := code.ReadUint16(inst[ip+1:])
+			vm.currentFrame().ip += 2
+
+			err := vm.pushModule(int(constIndex))
+			if err != nil {
+				return err
+			}
+		case code.OpThrow:
+			return &exception{err: object.Throw(vm.pop())}
 		case code.OpCall:
 
 			numArgs := code.ReadUint8(inst[ip+1:])
@@ -236,6 +495,13 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpTailCall:
+			numArgs := code.ReadUint8(inst[ip+1:])
+			vm.currentFrame().ip++
+			err := vm.executeTailCall(int(numArgs))
+			if err != nil {
+				return err
+			}
 		case code.OpReturnValue:
 			// pop the return value from stack
 			returnVal := vm.pop()
@@ -286,12 +552,86 @@ func (vm *VM) Run() error {
 			if err != nil {
 				return err
 			}
+		case code.OpWide:
+			wideOp, operands, read, err := code.ReadInstruction(inst[ip:])
+			if err != nil {
+				return err
+			}
+			vm.currentFrame().ip += read - 1
+
+			err = vm.executeWide(wideOp, operands)
+			if err != nil {
+				return err
+			}
 		}
 	}
 
 	return nil
 }
 
+// spreadArguments pops the array of arguments of a spread call and pushes its
+// elements, it returns the number of arguments.
+func (vm *VM) spreadArguments() (int, error) {
+	args := vm.pop().(*object.Array)
+	for _, arg := range args.Elements {
+		err := vm.push(arg)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(args.Elements), nil
+}
+
+// executeWide executes an instruction prefixed by OpWide.
+func (vm *VM) executeWide(op code.OpCode, operands []int) error {
+	frame := vm.currentFrame()
+
+	switch op {
+	case code.OpConstant:
+		return vm.push(vm.constants[operands[0]])
+	case code.OpGetLocal:
+		return vm.push(vm.stack[frame.basePointer+operands[0]])
+	case code.OpSetLocal:
+		vm.stack[frame.basePointer+operands[0]] = vm.pop()
+		return nil
+	case code.OpGetFree:
+		return vm.push(frame.cl.FreeVariables[operands[0]])
+	case code.OpCall:
+		return vm.executeFunctionCall(operands[0])
+	case code.OpTailCall:
+		return vm.executeTailCall(operands[0])
+	case code.OpClosure:
+		return vm.pushClosure(operands[0], operands[1])
+	case code.OpImport:
+		return vm.importModule(vm.constants[operands[0]].(*object.CompiledModule))
+	case code.OpModule:
+		return vm.pushModule(operands[0])
+	default:
+		return fmt.Errorf("opcode %d can't be prefixed by OpWide", op)
+	}
+}
+
+// undefinedGlobal returns the error raised when reading a global binding
+// that was never set.
+func undefinedGlobal(cl *object.Closure, index int) error {
+	if index < len(cl.GlobalNames) {
+		return fmt.Errorf("identifier not found: %s", cl.GlobalNames[index])
+	}
+
+	return fmt.Errorf("identifier not found: global %d", index)
+}
+
+// pushModule pops the exports of the module compiled in the constant at
+// constIndex and pushes the module object.
+func (vm *VM) pushModule(constIndex int) error {
+	compiled := vm.constants[constIndex].(*object.CompiledModule)
+	mod := &object.Module{Name: compiled.Name, Exports: vm.pop().(*object.HashMap)}
+	vm.modules[compiled] = mod
+
+	return vm.push(mod)
+}
+
 // push an element to the stack and increment the stack pointer.
 func (vm *VM) push(obj object.Object) error {
 	if vm.sp >= StackSize {
@@ -314,14 +654,12 @@ func (vm *VM) pop() object.Object {
 
 // isTrue checks if the given object evaluates to boolean true
 func isTrue(obj object.Object) bool {
-	switch obj := obj.(type) {
-	case *object.Boolean:
-		return obj.Value
-	case *object.Null:
-		return false
-	default:
-		return true
-	}
+	return object.Truthy(obj)
+}
+
+// isNull checks if the given object is the null value
+func isNull(obj object.Object) bool {
+	return obj == nil || obj.Type() == object.NULL
 }
 
 // LastPoppedStackElem returns the last pop'd item.
@@ -340,20 +678,77 @@ func (vm *VM) executeFunctionCall(numArgs int) error {
 	case *object.BuiltIn:
 		return vm.callBuiltIn(callee, numArgs)
 	default:
-		return fmt.Errorf("calling non-function")
+		return fmt.Errorf("not a function: %s", callee.Type())
+	}
+}
+
+// executeTailCall executes a function call in tail position, a closure
+// replaces the current frame unless the frame has an active exception handler
+// which must still catch what the callee raises. Other calls run as usual and
+// return through the instructions that follow.
+func (vm *VM) executeTailCall(numArgs int) error {
+	frame := vm.currentFrame()
+	callee, ok := vm.stack[vm.sp-1-numArgs].(*object.Closure)
+	if !ok || len(frame.tries) > 0 || vm.framesIndex == 1 {
+		return vm.executeFunctionCall(numArgs)
 	}
+
+	// move the callee and its arguments in place of the current call
+	base := frame.basePointer - 1
+	copy(vm.stack[base:], vm.stack[vm.sp-1-numArgs:vm.sp])
+	vm.sp = base + 1 + numArgs
+	vm.popFrame()
+
+	return vm.callClosure(callee, numArgs)
 }
 
-// callClosure executes a function call on user defined functions
+// callClosure executes a function call on user defined functions, missing
+// parameters with a default are computed by the function prologue and extra
+// arguments are collected in the rest parameter of variadic functions.
 func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
-	if numArgs != cl.Fn.NumParams {
-		return fmt.Errorf("wrong number of parameters : want %d, got %d", cl.Fn.NumParams, numArgs)
+	fn := cl.Fn
+	if err := object.CheckArity(fn.NumParams, fn.NumDefaults, fn.Variadic, numArgs); err != nil {
+		return err
+	}
+	if vm.framesIndex >= MaxFrames || vm.sp-numArgs+fn.NumLocals >= StackSize {
+		return fmt.Errorf("stack overflow")
 	}
 	// substract numArgs to correctly set bp
 	frame := NewFrame(cl, vm.sp-numArgs)
+
+	if vm.debugger != nil {
+		// clear the local bindings left by previous calls so the debugger
+		// only shows the ones assigned by this call
+		first := frame.basePointer + numArgs
+		if fn.Variadic {
+			first = frame.basePointer + fn.NumParams + 1
+		}
+		for i := first; i < frame.basePointer+fn.NumLocals; i++ {
+			vm.stack[i] = nil
+		}
+	}
+
+	if fn.Variadic {
+		rest := []object.Object{}
+		if numArgs > fn.NumParams {
+			rest = make([]object.Object, numArgs-fn.NumParams)
+			copy(rest, vm.stack[frame.basePointer+fn.NumParams:vm.sp])
+		}
+		vm.stack[frame.basePointer+fn.NumParams] = &object.Array{Elements: rest}
+	}
+	if numArgs < fn.NumParams {
+		// missing parameters are null until the prologue computes their default
+		for i := numArgs; i < fn.NumParams; i++ {
+			vm.stack[frame.basePointer+i] = Null
+		}
+		frame.ip = fn.DefaultOffsets[numArgs-(fn.NumParams-fn.NumDefaults)] - 1
+	} else if fn.NumDefaults > 0 {
+		frame.ip = fn.DefaultOffsets[fn.NumDefaults] - 1
+	}
+
 	vm.pushFrame(frame)
 	// increment the stack pointer to make place for local variables
-	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	vm.sp = frame.basePointer + fn.NumLocals
 	return nil
 }
 
@@ -365,6 +760,9 @@ func (vm *VM) callBuiltIn(builtin *object.BuiltIn, numArgs int) error {
 	res := builtin.Fn(args...)
 	vm.sp = vm.sp - numArgs - 1
 
+	if err, ok := res.(*object.Error); ok {
+		return &exception{err: err}
+	}
 	if res != nil {
 		vm.push(res)
 	} else {
@@ -374,101 +772,47 @@ func (vm *VM) callBuiltIn(builtin *object.BuiltIn, numArgs int) error {
 	return nil
 }
 
-// executeBinOp executes a binary opeartion
+// operators maps arithmetic and comparison opcodes to their operator symbol,
+// it is indexed by opcode since a map lookup is noticeable in the main loop.
+var operators = [...]string{
+	code.OpAdd:            "+",
+	code.OpSub:            "-",
+	code.OpMul:            "*",
+	code.OpDiv:            "/",
+	code.OpMod:            "%",
+	code.OpEqual:          "==",
+	code.OpNotEqual:       "!=",
+	code.OpGreaterThan:    ">",
+	code.OpGreaterOrEqual: ">=",
+	code.OpLessThan:       "<",
+	code.OpLessOrEqual:    "<=",
+}
+
+// executeBinOp executes a binary operation, results that overflow are
+// promoted to big integers.
 func (vm *VM) executeBinOp(op code.OpCode) error {
 	right := vm.pop()
 	left := vm.pop()
 
-	rightType := right.Type()
-	leftType := right.Type()
-
-	if rightType == object.INTEGER && leftType == object.INTEGER {
-		return vm.executeIntegerOp(op, left, right)
-	} else if rightType == object.STRING && leftType == object.STRING {
-		return vm.executeStringOp(op, left, right)
+	result, err := object.BinaryOp(operators[op], left, right)
+	if err != nil {
+		return err
 	}
 
-	return fmt.Errorf("unsupported types for binary operation for %d %s %s", op, rightType, leftType)
-}
-
-// executeIntegerOp executes a binary operation on integers
-func (vm *VM) executeIntegerOp(op code.OpCode, left, right object.Object) error {
-
-	rightVal := right.(*object.Integer).Value
-	leftVal := left.(*object.Integer).Value
-
-	var result int64
-
-	switch op {
-	case code.OpAdd:
-		result = leftVal + rightVal
-	case code.OpSub:
-		result = leftVal - rightVal
-	case code.OpMul:
-		result = leftVal * rightVal
-	case code.OpDiv:
-		result = leftVal / rightVal
-	case code.OpMod:
-		result = leftVal % rightVal
-	}
-	return vm.push(&object.Integer{Value: result})
-}
-
-// executeStringOp executes a binary operation on integers
-func (vm *VM) executeStringOp(op code.OpCode, left, right object.Object) error {
-
-	rightVal := right.(*object.String).Value
-	leftVal := left.(*object.String).Value
-
-	if op != code.OpAdd {
-		return fmt.Errorf("Unknown operator %d for type %s %s", op, left.Type(), right.Type())
-	}
-	result := leftVal + rightVal
-
-	return vm.push(&object.String{Value: result})
+	return vm.push(result)
 }
 
 // executeCompare executes comparison opcodes pushing the result to the stack
 func (vm *VM) executeCompare(op code.OpCode) error {
-
 	right := vm.pop()
 	left := vm.pop()
 
-	leftType := left.Type()
-	rightType := right.Type()
-
-	if rightType == object.INTEGER && leftType == object.INTEGER {
-		return vm.executeIntegerCompare(op, left, right)
+	result, err := object.CompareOp(operators[op], left, right)
+	if err != nil {
+		return err
 	}
 
-	switch op {
-	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(left == right))
-	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(left != right))
-	default:
-		return fmt.Errorf("unknown operator : %d for type %s %s", op, leftType, rightType)
-	}
-}
-
-// executeIntegerCompare compares two integers using a comparison operator and pushes the result to the stack
-func (vm *VM) executeIntegerCompare(op code.OpCode, left, right object.Object) error {
-	leftVal := left.(*object.Integer).Value
-	rightVal := right.(*object.Integer).Value
-
-	switch op {
-
-	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(leftVal == rightVal))
-	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(leftVal != rightVal))
-	case code.OpGreaterOrEqual:
-		return vm.push(nativeBoolToBooleanObject(leftVal >= rightVal))
-	case code.OpGreaterThan:
-		return vm.push(nativeBoolToBooleanObject(leftVal > rightVal))
-	default:
-		return fmt.Errorf("unknown operator %d for INTEGER Type", op)
-	}
+	return vm.push(nativeBoolToBooleanObject(result))
 }
 
 // executeNotOp on the top item of the stack
@@ -476,71 +820,47 @@ func (vm *VM) executeNotOp() error {
 
 	operand := vm.pop()
 
-	switch operand {
-	case True:
-		return vm.push(False)
-	case False:
-		return vm.push(True)
-	case Null:
-		return vm.push(True)
-	default:
-		return vm.push(False)
-	}
+	return vm.push(nativeBoolToBooleanObject(!isTrue(operand)))
 }
 
-// executeNegOp on the top item of the stack (must be an INTEGER)
+// executeNegOp on the top item of the stack (must be numeric)
 func (vm *VM) executeNegOp() error {
-	operand := vm.pop()
-
-	switch operand.Type() {
-	case object.INTEGER:
-		val := operand.(*object.Integer).Value
-		return vm.push(&object.Integer{Value: -val})
-	default:
-		return fmt.Errorf("Unsupported operand type %s for NEG operator", operand.Type())
+	val, err := object.Negate(vm.pop())
+	if err != nil {
+		return err
 	}
+
+	return vm.push(val)
 }
 
 // executeIndexExpression pops the index and the object to be indexed from the stack
 // and pushes the value
 func (vm *VM) executeIndexExpression(left, index object.Object) error {
-	switch {
-	case left.Type() == object.ARRAY && index.Type() == object.INTEGER:
-		return vm.executeArrayIndex(left, index)
-	case left.Type() == object.HASH:
-		return vm.executeHashMapIndex(left, index)
-	default:
-		return fmt.Errorf("index operator %T not supported for type %T", index.Type(), left.Type())
+	val, err := object.Index(left, index)
+	if err != nil {
+		return err
 	}
-}
-
-// executeArrayIndex executes the indexing operations for array cases
-func (vm *VM) executeArrayIndex(array, index object.Object) error {
-	arrayObj := array.(*object.Array)
-	idx := index.(*object.Integer).Value
-
-	max := int64(len(arrayObj.Elements) - 1)
-
-	if idx < 0 || idx > max {
+	if val == nil {
 		return vm.push(Null)
 	}
-	return vm.push(arrayObj.Elements[idx])
-}
 
-// executeHashmapIndex executes the indexing operations for hashmaps
-func (vm *VM) executeHashMapIndex(hash, index object.Object) error {
-	hashObj := hash.(*object.HashMap)
+	return vm.push(val)
+}
 
-	key, ok := index.(object.Hashable)
-	if !ok {
-		return fmt.Errorf("invalid key for hashmap type :%T", index.Type())
+// importModule pushes an imported module, the first import calls the module
+// code with fresh globals which ends by pushing and caching the module object.
+func (vm *VM) importModule(compiled *object.CompiledModule) error {
+	if mod, ok := vm.modules[compiled]; ok {
+		return vm.push(mod)
 	}
-	pair, ok := hashObj.Pairs[key.HashKey()]
-	if !ok {
-		return vm.push(Null)
+
+	cl := &object.Closure{Fn: compiled.Fn, Globals: make([]object.Object, compiled.NumGlobals), GlobalNames: compiled.GlobalNames}
+	err := vm.push(cl)
+	if err != nil {
+		return err
 	}
 
-	return vm.push(pair.Value)
+	return vm.callClosure(cl, 0)
 }
 
 // nativeBoolToBooleanObject returns a boolean object equivalent to input
@@ -564,6 +884,23 @@ func (vm *VM) buildArrayObject(startIndex, endIndex int) object.Object {
 	return &object.Array{Elements: elements}
 }
 
+// concatArrays concatenates the arrays on the stack between startIndex and
+// endIndex, it's used to build call arguments and array literals that use the
+// spread operator.
+func (vm *VM) concatArrays(startIndex, endIndex int) (object.Object, error) {
+	elements := []object.Object{}
+
+	for i := startIndex; i < endIndex; i++ {
+		array, ok := vm.stack[i].(*object.Array)
+		if !ok {
+			return nil, fmt.Errorf("spread operator requires ARRAY got %s", vm.stack[i].Type())
+		}
+		elements = append(elements, array.Elements...)
+	}
+
+	return &object.Array{Elements: elements}, nil
+}
+
 // buildHashmapObject creates a new object.Hashmap from stack elements
 func (vm *VM) buildHashmapObject(startIndex, endIndex int) (object.Object, error) {
 
@@ -573,12 +910,11 @@ func (vm *VM) buildHashmapObject(startIndex, endIndex int) (object.Object, error
 		key := vm.stack[i]
 		val := vm.stack[i+1]
 
-		pair := object.HashPair{Key: key, Value: val}
-		hashKey, ok := key.(object.Hashable)
-		if !ok {
-			return nil, fmt.Errorf("Type unusable for hashmap key : %s", key.Type())
+		hashKey, err := object.HashKeyOf(key)
+		if err != nil {
+			return nil, err
 		}
-		hashedPairs[hashKey.HashKey()] = pair
+		hashedPairs[hashKey] = object.HashPair{Key: key, Value: val}
 	}
 
 	return &object.HashMap{Pairs: hashedPairs}, nil
@@ -597,7 +933,8 @@ func (vm *VM) pushClosure(constIndex int, numFree int) error {
 		free[i] = vm.stack[vm.sp-numFree+i]
 	}
 	vm.sp = vm.sp - numFree
-	cl := &object.Closure{Fn: fn, FreeVariables: free}
+	current := vm.currentFrame().cl
+	cl := &object.Closure{Fn: fn, FreeVariables: free, Globals: current.Globals, GlobalNames: current.GlobalNames}
 
 	return vm.push(cl)
 }
@@ -1,12 +1,18 @@
 package vm
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"math/big"
+	"strings"
 	"testing"
 
 	"github.com/actuallyachraf/monkey-giggle/ast"
 	"github.com/actuallyachraf/monkey-giggle/compiler"
+	"github.com/actuallyachraf/monkey-giggle/eval"
 	"github.com/actuallyachraf/monkey-giggle/lexer"
+	"github.com/actuallyachraf/monkey-giggle/module"
 	"github.com/actuallyachraf/monkey-giggle/object"
 	"github.com/actuallyachraf/monkey-giggle/parser"
 )
@@ -35,6 +41,123 @@ func TestVM(t *testing.T) {
 		}
 		runVMTests(t, tests)
 	})
+	t.Run("TestBigIntegerArithmetic", func(t *testing.T) {
+		maxInt, _ := new(big.Int).SetString("9223372036854775808", 10)
+		minInt, _ := new(big.Int).SetString("-9223372036854775809", 10)
+		square, _ := new(big.Int).SetString("85070591730234615847396907784232501249", 10)
+		tests := []vmTestCase{
+			{"9223372036854775807 + 1", maxInt},
+			{"-9223372036854775807 - 2", minInt},
+			{"9223372036854775807 * 9223372036854775807", square},
+			{"(9223372036854775807 + 1) - 1", 9223372036854775807},
+			{"(9223372036854775807 + 1) / 2", 4611686018427387904},
+			{"(9223372036854775807 + 10) % 10", 7},
+			{"-(-9223372036854775807 - 1)", maxInt},
+			{"9223372036854775807 + 1 > 9223372036854775807", true},
+			{"9223372036854775807 + 1 == 9223372036854775807 + 1", true},
+			{"{9223372036854775807 + 1: 1}[9223372036854775807 + 1]", 1},
+			// literals too large for an int64 are big integer constants
+			{"9223372036854775808", maxInt},
+			{"-9223372036854775808", -9223372036854775808},
+			{"-9223372036854775809", minInt},
+			{"9223372036854775808 == 9223372036854775807 + 1", true},
+			{"9223372036854775808 - 1", 9223372036854775807},
+			{"9223372036854775808 * 0", 0},
+			{"match (9223372036854775807 + 1) { 9223372036854775808 => true, _ => false }", true},
+			{"let f = fn(x) { x * 2 }; f(9223372036854775808) / 2", maxInt},
+		}
+		runVMTests(t, tests)
+	})
+	t.Run("TestRuntimeErrors", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"1 / 0", "division by zero"},
+			{"1 % 0", "division by zero"},
+			{"(9223372036854775807 + 1) / 0", "division by zero"},
+			{"9223372036854775808 % 0", "division by zero"},
+			{"let f = fn(x, y) { x / y }; f(9223372036854775808, 0)", "division by zero"},
+			{`{}["a"]["b"]`, "index operator not supported: NULL[STRING]"},
+			{`[1,2]["a":]`, "slice bounds must be INTEGER got STRING"},
+			{`5[1:]`, "slice operator not supported: INTEGER"},
+			{`fn(a) { a }()`, "wrong number of parameters : want 1, got 0"},
+			{`fn(a, b = 1) { a }()`, "wrong number of parameters : want 1 to 2, got 0"},
+			{`fn(a, b = 1) { a }(1, 2, 3)`, "wrong number of parameters : want 1 to 2, got 3"},
+			{`fn(a, ...rest) { a }()`, "wrong number of parameters : want at least 1, got 0"},
+			{`len(...1)`, "spread operator requires ARRAY got INTEGER"},
+			{`let [a, b] = 1;`, "cannot destructure INTEGER as ARRAY"},
+			{`let [a, b] = [1];`, "cannot destructure ARRAY of 1 elements into 2"},
+			{`let [a, b, ...c] = [1];`, "cannot destructure ARRAY of 1 elements into at least 2"},
+			{`let {a} = [1];`, "cannot destructure ARRAY as HASH"},
+			{`let {a} = {"b": 1};`, "missing key a in HASH destructuring"},
+			{`fn([a]) { a }(2)`, "cannot destructure INTEGER as ARRAY"},
+			{`len(1)`, "argument to `len` not supported, got INTEGER"},
+			{`throw "boom";`, "uncaught exception: boom"},
+			{`try { throw [1] } finally { 2 }`, "uncaught exception: [1]"},
+			{`try { throw 1 } catch (e) { throw e + 1 }`, "uncaught exception: 2"},
+			{`try { 1 } catch (e) { 2 }; 1 / 0`, "division by zero"},
+			{`let f = fn(n) { 1 + f(n + 1) }; f(0)`, "stack overflow"},
+		}
+		for _, tt := range tests {
+			program := parse(tt.input)
+			comp := compiler.New()
+			err := comp.Compile(program)
+			if err != nil {
+				t.Fatalf("compiler error : %s", err)
+			}
+			vm := New(comp.Bytecode())
+			err = vm.Run()
+			if err == nil {
+				t.Fatalf("expected VM error %q got none", tt.expected)
+			}
+			if err.Error() != tt.expected {
+				t.Errorf("wrong VM error expected %q got %q", tt.expected, err)
+			}
+		}
+	})
+	t.Run("TestRuntimeErrorLocations", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+			location string
+			function string
+		}{
+			{"let a = 1;\nlet f = fn(x) {\n  x / 0\n};\nf(2)", "division by zero", "main.gg:3:5", "f"},
+			{"1 +\n  \"a\"", "type mismatch: INTEGER + STRING", "main.gg:1:3", ""},
+			{"let check = fn(x) {\n  if (x) { throw \"bad\" }\n};\ncheck(true)", "uncaught exception: bad", "main.gg:2:12", "check"},
+			{"let f = fn() { [1][\"a\":] };\ntry { f() } catch (e) { e };\nf()", "slice bounds must be INTEGER got STRING", "main.gg:1:19", "f"},
+		}
+		for _, tt := range tests {
+			comp := compiler.New()
+			comp.SetFile("main.gg")
+			if err := comp.Compile(parse(tt.input)); err != nil {
+				t.Fatalf("compiler error : %s", err)
+			}
+
+			// the line tables are serialized with the bytecode
+			var buf bytes.Buffer
+			if err := comp.Bytecode().Encode(&buf); err != nil {
+				t.Fatalf("Encode failed with error : %s", err)
+			}
+			bytecode, err := compiler.DecodeBytecode(&buf)
+			if err != nil {
+				t.Fatalf("DecodeBytecode failed with error : %s", err)
+			}
+
+			err = New(bytecode).Run()
+			rerr, ok := err.(*RuntimeError)
+			if !ok {
+				t.Fatalf("expected a RuntimeError got %T (%v)", err, err)
+			}
+			if rerr.Error() != tt.expected {
+				t.Errorf("wrong VM error expected %q got %q", tt.expected, rerr)
+			}
+			if rerr.Location() != tt.location || rerr.Function != tt.function {
+				t.Errorf("wrong error location for %q expected %s in %q got %s in %q", tt.expected, tt.location, tt.function, rerr.Location(), rerr.Function)
+			}
+		}
+	})
 	t.Run("TestBooleanExpression", func(t *testing.T) {
 		tests := []vmTestCase{
 			{"true", true},
@@ -79,6 +202,23 @@ func TestVM(t *testing.T) {
 		}
 		runVMTests(t, tests)
 	})
+	t.Run("TestNullExpression", func(t *testing.T) {
+		tests := []vmTestCase{
+			{"null", Null},
+			{"null ?? 1", 1},
+			{"2 ?? 1", 2},
+			{"false ?? 1", false},
+			{"null ?? null ?? 3", 3},
+			{`let h = {"a": {"b": 1}}; h["x"]?.["b"]`, Null},
+			{`let h = {"a": {"b": 1}}; h["a"]?.["b"]`, 1},
+			{`let h = {"a": {"b": 1}}; h["x"]?.["b"] ?? 42`, 42},
+			{`null?.[0]?.[1]`, Null},
+			{`[[1,2]][0]?.[1]`, 2},
+			{`let f = fn(){ null }; f() ?? "default"`, "default"},
+			{`null == null`, true},
+		}
+		runVMTests(t, tests)
+	})
 	t.Run("TestGlobalLetStatement", func(t *testing.T) {
 		tests := []vmTestCase{
 			{"let one = 1;let two = 2;one + two;", 3},
@@ -94,6 +234,13 @@ func TestVM(t *testing.T) {
 			{`"foo"+"bar"`, "foobar"},
 			{`"foo"+"bar"+"banana"`, "foobarbanana"},
 			{`"Hello " + " World !"`, "Hello  World !"},
+			{`"a" < "b"`, true},
+			{`"b" < "a"`, false},
+			{`"abc" <= "abc"`, true},
+			{`"abd" > "abc"`, true},
+			{`"ab" >= "abc"`, false},
+			{`"foo" == "foo"`, true},
+			{`"foo" != "bar"`, true},
 		}
 		runVMTests(t, tests)
 	})
@@ -134,7 +281,16 @@ func TestVM(t *testing.T) {
 			{"[1,2,3][0+2]", 3},
 			{"[[1,2,3],[4,5,6]][1][1]", 5},
 			{"[[1,2,3]][0][0]", 1},
-			{"[1,2][-1]", Null},
+			{"[1,2][-1]", 2},
+			{"[1,2][-2]", 1},
+			{"[1,2][-3]", Null},
+			{`"hello"[1]`, "e"},
+			{`"hello"[-1]`, "o"},
+			{`"hello"[5]`, Null},
+			{`"héllo"[1]`, "é"},
+			{`"héllo"[-4]`, "é"},
+			{`"日本語"[2]`, "語"},
+			{`"日本語"[3]`, Null},
 			{"[][0]", Null},
 			{"[1,2,3][99]", Null},
 			{"{1:1,2:2}[1]", 1},
@@ -144,6 +300,26 @@ func TestVM(t *testing.T) {
 		}
 		runVMTests(t, tests)
 	})
+	t.Run("TestSliceExpression", func(t *testing.T) {
+		tests := []vmTestCase{
+			{"[1,2,3,4][1:3]", []interface{}{2, 3}},
+			{"[1,2,3,4][:2]", []interface{}{1, 2}},
+			{"[1,2,3,4][2:]", []interface{}{3, 4}},
+			{"[1,2,3,4][:]", []interface{}{1, 2, 3, 4}},
+			{"[1,2,3,4][-2:]", []interface{}{3, 4}},
+			{"[1,2,3,4][:-1]", []interface{}{1, 2, 3}},
+			{"[1,2,3,4][3:1]", []interface{}{}},
+			{"[1,2,3,4][-10:10]", []interface{}{1, 2, 3, 4}},
+			{`"hello"[1:3]`, "el"},
+			{`"hello"[:-2]`, "hel"},
+			{`"hello"[3:]`, "lo"},
+			{`"héllo"[1:3]`, "él"},
+			{`"日本語"[:-1]`, "日本"},
+			{`null?.[1:]`, Null},
+			{`let xs = [1,2,3]; let i = 1; xs[i:i+1]`, []interface{}{2}},
+		}
+		runVMTests(t, tests)
+	})
 	t.Run("TestFunctionCallNoArgs", func(t *testing.T) {
 		tests := []vmTestCase{
 			{
@@ -216,6 +392,139 @@ func TestVM(t *testing.T) {
 		}
 		runVMTests(t, tests)
 	})
+	t.Run("TestFunctionDefaultsAndSpread", func(t *testing.T) {
+		tests := []vmTestCase{
+			{"let f = fn(a, b = 2) { a + b }; f(1)", 3},
+			{"let f = fn(a, b = 2) { a + b }; f(1, 5)", 6},
+			{"let f = fn(a = 1, b = a + 1) { a * b }; f()", 2},
+			{"let f = fn(a = 1, b = a + 1) { a * b }; f(3)", 12},
+			{"let f = fn(a, ...rest) { rest }; f(1)", []interface{}{}},
+			{"let f = fn(a, ...rest) { rest }; f(1, 2, 3)", []interface{}{2, 3}},
+			{"let f = fn(a, b = 10, ...rest) { [a, b, len(rest)] }; f(1)", []interface{}{1, 10, 0}},
+			{"let f = fn(a, b = 10, ...rest) { [a, b, len(rest)] }; f(1, 2, 3, 4)", []interface{}{1, 2, 2}},
+			{"let f = fn(a, b) { a - b }; let xs = [5, 3]; f(...xs)", 2},
+			{"let f = fn(a, b) { a - b }; f(...[5], 3)", 2},
+			{"let sum = fn(...xs) { if (len(xs) == 0) { 0 } else { head(xs) + sum(...tail(xs)) } }; sum(1, 2, 3, 4)", 10},
+			{"len(...[[1, 2, 3]])", 3},
+			{"let xs = [2, 3]; [1, ...xs, 4, ...[]]", []interface{}{1, 2, 3, 4}},
+			{"let mk = fn(x) { fn(y = x) { y } }; mk(7)()", 7},
+		}
+		runVMTests(t, tests)
+	})
+	t.Run("TestDestructuring", func(t *testing.T) {
+		tests := []vmTestCase{
+			{"let [a, b] = [1, 2]; a + b", 3},
+			{"let [a, ...rest] = [1, 2, 3]; rest", []interface{}{2, 3}},
+			{"let [a, ...rest] = [1]; rest", []interface{}{}},
+			{"let [[a, b], c] = [[1, 2], 3]; a + b + c", 6},
+			{`let {name, age} = {"name": "giggle", "age": 3}; name`, "giggle"},
+			{`let {name, age} = {"name": "giggle", "age": 3}; age`, 3},
+			{`let {"tags": [first, ...others]} = {"tags": ["a", "b"]}; first + others[0]`, "ab"},
+			{"let f = fn([a, b]) { a * b }; f([3, 4])", 12},
+			{`let f = fn(x, {y}) { x + y }; f(1, {"y": 2})`, 3},
+			{"let f = fn([a, b] = [5, 6]) { a - b }; f()", -1},
+			{"let f = fn() { let [a, b] = [1, 2]; a + b }; f()", 3},
+			{"let f = fn(xs) { let [a, ...rest] = xs; fn() { a + len(rest) } }; f([1, 2, 3])()", 3},
+			{"let f = fn() { let [a] = [1]; }; f()", Null},
+		}
+		runVMTests(t, tests)
+	})
+	t.Run("TestMatchExpression", func(t *testing.T) {
+		tests := []vmTestCase{
+			{"match (1) { 1 => 10, _ => 20 }", 10},
+			{"match (2) { 1 => 10, _ => 20 }", 20},
+			{"match (3) { 1 => 10 }", Null},
+			{"match (-1) { -1 => true, _ => false }", true},
+			{`match ("b") { "a" => 1, "b" => 2 }`, 2},
+			{`match (1) { "1" => 1, true => 2, n => n + 2 }`, 3},
+			{"match (null) { null => 1, _ => 2 }", 1},
+			{"match (false) { true => 1, false => 2 }", 2},
+			{"match ([1, 2]) { [x] => x, [x, y] => x + y }", 3},
+			{"match ([1, [2, 3]]) { [1, [a, 4]] => a, [1, [a, b]] => a * b }", 6},
+			{"match ([1, 2, 3]) { [a, ...rest] => rest }", []interface{}{2, 3}},
+			{"match (1) { [a] => a, {a} => a, _ => 0 }", 0},
+			{`match ({"type": "square", "side": 3}) { {"type": "circle", r} => r, {"type": "square", side} => side * side }`, 9},
+			{`match ({"a": 1}) { {b} => b, {a} => a }`, 1},
+			{"match (5) { n if n < 0 => -1, n if n > 0 => 1, _ => 0 }", 1},
+			{"match (0) { n if n < 0 => -1, n if n > 0 => 1, _ => 0 }", 0},
+			{"match (2) { _ => { let x = 3; x * 2 } }", 6},
+			{"match (2) { _ => {} }", Null},
+			{"let f = fn(x) { match (x) { [a, b] => a + b, _ => match (x) { 0 => 100, _ => x } } }; [f([1, 2]), f(0), f(7)]", []interface{}{3, 100, 7}},
+			{"let f = fn(n) { match (n) { 0 => 1, _ => n * f(n - 1) } }; f(5)", 120},
+			{"let f = fn(xs) { match (xs) { [x, ...rest] => fn() { x + len(rest) } } }; f([1, 2, 3])()", 3},
+		}
+		runVMTests(t, tests)
+	})
+	t.Run("TestExceptions", func(t *testing.T) {
+		tests := []vmTestCase{
+			{"try { 1 } catch (e) { 2 }", 1},
+			{"try { throw 5; 1 } catch (e) { e + 1 }", 6},
+			{"try { 1 / 0 } catch (e) { e }", "division by zero"},
+			{"try { [1][\"a\":] } catch (e) { e }", "slice bounds must be INTEGER got STRING"},
+			{"try { } catch (e) { 2 }", Null},
+			{"try { throw 1 } catch (e) { }", Null},
+			{`let f = fn() { throw "boom" }; try { f() } catch (e) { e }`, "boom"},
+			{`let f = fn(x) { if (x == 0) { throw "bottom" } 1 + f(x - 1) }; 10 + try { f(5) } catch (e) { len(e) }`, 16},
+			{"try { try { throw 1 } catch (e) { throw e + 1 } } catch (e) { e * 10 }", 20},
+			{"let f = fn() { try { throw 1 } catch (e) { e + 1 } }; [f(), f()]", []interface{}{2, 2}},
+			{"let r = try { 1 } finally { let done = true; }; [r, done]", []interface{}{1, true}},
+			{"let r = try { throw 1 } catch (e) { e + 1 } finally { let done = e; }; [r, done]", []interface{}{2, 1}},
+			{`try { try { throw "x" } finally { let cleaned = true; } } catch (e) { [e, cleaned] }`, []interface{}{"x", true}},
+			{`try { try { throw "x" } catch (e) { throw e + "y" } finally { let cleaned = true; } } catch (e) { [e, cleaned] }`, []interface{}{"xy", true}},
+			{"let f = fn() { let a = try { return 1; } finally { 3 }; 5 }; f()", 1},
+			{"let f = fn() { try { return 1; } finally { return 2; } }; f()", 2},
+			{`let f = fn() { try { return 1; } finally { throw "late" } }; try { f() } catch (e) { e }`, "late"},
+			{`let f = fn() { try { try { return 1; } finally { let inner = 2; } } finally { let outer = 3; } }; f()`, 1},
+			{`let f = fn() { try { return 1; } catch (e) { 2 } }; try { f() + len(1) } catch (e) { len(e) > 0 }`, true},
+			{`let check = fn(x) { match (x) { [a] => a, _ => { throw "bad shape" } } }; try { check([1]) + check(2) } catch (e) { e }`, "bad shape"},
+		}
+		runVMTests(t, tests)
+	})
+	t.Run("TestModules", func(t *testing.T) {
+		tests := []vmTestCase{
+			{`let math = import "math"; math["square"](3)`, 9},
+			{`let {answer, one, two} = import "math"; answer + one + two`, 45},
+			{`let base = 1; let counter = import "counter"; counter["addBase"](base)`, 11},
+			{`let shapes = import "geometry/shapes"; shapes["area"](4)`, 16},
+			{`(import "math") == (import "math")`, true},
+			{`let shapes = import "geometry/shapes"; let math = import "math"; math["square"](2) + shapes["area"](2)`, 8},
+			{`let f = fn() { import "math" }; f()["answer"]`, 42},
+			{`match (import "math") { {square} => square(5) }`, 25},
+			{`try { import "thrower" } catch (e) { e }`, "module failed"},
+			{`try { (import "math")["secret"] } catch (e) { e }`, "module math has no export secret"},
+		}
+		for i, tt := range tests {
+			comp := compiler.New()
+			comp.SetLoader(module.NewLoader("../module/testdata"))
+			err := comp.Compile(parse(tt.input))
+			if err != nil {
+				t.Fatalf("compiler error : %s", err)
+			}
+			vm := New(comp.Bytecode())
+			err = vm.Run()
+			if err != nil {
+				t.Fatalf("VM error : %s", err)
+			}
+			testExpectedObject(i, t, tt.expected, vm.LastPoppedStackElem())
+		}
+
+		errors := []struct {
+			input    string
+			expected string
+		}{
+			{`import "missing"`, "module not found: missing"},
+			{`import "cycle_a"`, "import cycle: cycle_a -> cycle_b -> cycle_a"},
+			{`import "broken"`, "module broken: expected next token to be IDENT, got ASSIGN instead; no prefix parse func found for token type ASSIGN"},
+		}
+		for _, tt := range errors {
+			comp := compiler.New()
+			comp.SetLoader(module.NewLoader("../module/testdata"))
+			err := comp.Compile(parse(tt.input))
+			if err == nil || err.Error() != tt.expected {
+				t.Errorf("wrong compiler error expected %q got %v", tt.expected, err)
+			}
+		}
+	})
 	t.Run("TestFunctionCallWithBindings", func(t *testing.T) {
 		tests := []vmTestCase{
 			{
@@ -285,20 +594,20 @@ func TestVM(t *testing.T) {
 			{`len("")`, 0},
 			{`len("four")`, 4},
 			{`len("Hello World!")`, 12},
-			{`len(1)`, &object.Error{
-				Message: "argument to `len` not supported, got INTEGER",
-			}},
-			{`len("one","two")`, &object.Error{
-				Message: "wrong number of arguments, expected 1 got 2",
-			}},
+			{`len("héllo")`, 5},
+			{`try { len(1) } catch (e) { e }`, "argument to `len` not supported, got INTEGER"},
+			{`try { len("one","two") } catch (e) { e }`, "wrong number of arguments, expected 1 got 2"},
 			{`len([1,2,3])`, 3},
 			{`head([1,2,3])`, 1},
 			{`head([])`, Null},
 			{`tail([1,2,3])`, []int{2, 3}},
 			{`append([],1)`, []int{1}},
-			{`append(1,1)`, &object.Error{
-				Message: "argument to `append` must be ARRAY got INTEGER",
-			}},
+			{`try { append(1,1) } catch (e) { e }`, "argument to `append` must be ARRAY got INTEGER"},
+			{`sort([3,1,2])`, []interface{}{1, 2, 3}},
+			{`sort(["pear","apple","fig"])`, []interface{}{"apple", "fig", "pear"}},
+			{`sort(["b",2,"a",1])`, []interface{}{1, 2, "a", "b"}},
+			{`sort([])`, []interface{}{}},
+			{`try { sort(1) } catch (e) { e }`, "argument to `sort` must be ARRAY got INTEGER"},
 		}
 		runVMTests(t, tests)
 	})
@@ -444,9 +753,458 @@ func TestVM(t *testing.T) {
 		}
 		runVMTests(t, tests)
 	})
+	t.Run("TestTailCalls", func(t *testing.T) {
+		tests := []vmTestCase{
+			{`let loop = fn(n) { if (n == 0) { "done" } else { loop(n - 1) } }; loop(100000)`, "done"},
+			{`
+			let build = fn(n, acc) { if (n == 0) { acc } else { build(n - 1, append(acc, n)) } };
+			let sum = fn(xs, acc) { if (len(xs) == 0) { acc } else { return sum(tail(xs), acc + head(xs)); } };
+			sum(build(2000, []), 0)
+			`, 2001000},
+			{`let count = fn(n, acc) { match (n) { 0 => acc, _ => count(n - 1, acc + 1) } }; count(5000, 0)`, 5000},
+			{`let f = fn(n, acc = 0) { if (n == 0) { acc } else { f(n - 1, acc + n) } }; f(3000)`, 4501500},
+			{`let f = fn(n, ...xs) { if (n == 0) { len(xs) } else { f(n - 1, 1, 2) } }; f(3000)`, 2},
+			{`let f = fn(n, ...r) { if (n == 0) { r } else { f(n - 1, ...[n]) } }; f(5000)`, []int{1}},
+			{`let f = fn(xs) { len(xs) }; f([1, 2]) + 1`, 3},
+			{`let g = fn() { throw "inner" }; let f = fn() { try { return g(); } catch (e) { "caught " + e } }; f()`, "caught inner"},
+			{`let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; try { f(5000) } catch (e) { e }`, "stack overflow"},
+		}
+		runVMTests(t, tests)
+	})
+	t.Run("TestWideOperands", func(t *testing.T) {
+		var constants strings.Builder
+		constants.WriteString("let f = fn(x) { x };")
+		for i := 1; i <= 70000; i++ {
+			fmt.Fprintf(&constants, "f(%d);", i)
+		}
+
+		names := make([]string, 300)
+		for i := range names {
+			names[i] = identifier(i)
+		}
+		var locals, free strings.Builder
+		locals.WriteString("let f = fn() {")
+		free.WriteString("let f = fn() {")
+		for i, name := range names {
+			fmt.Fprintf(&locals, "let %s = %d;", name, i)
+			fmt.Fprintf(&free, "let %s = %d;", name, i)
+		}
+		fmt.Fprintf(&locals, "%s + %s }; f()", names[0], names[299])
+		fmt.Fprintf(&free, "fn() { %s } }; f()()", strings.Join(names, " + "))
+
+		args := make([]string, 300)
+		for i := range args {
+			args[i] = fmt.Sprint(i)
+		}
+		call := fmt.Sprintf("let f = fn(%s) { %s }; f(%s) + 1", strings.Join(names, ", "), names[299], strings.Join(args, ", "))
+		tailCall := fmt.Sprintf("let f = fn(%s) { %s }; let g = fn() { f(%s) }; g()", strings.Join(names, ", "), names[299], strings.Join(args, ", "))
+
+		tests := []vmTestCase{
+			{constants.String(), 70000},
+			{locals.String(), 299},
+			{free.String(), 44850},
+			{call, 300},
+			{tailCall, 299},
+		}
+		runVMTests(t, tests)
+	})
+	t.Run("TestDebugger", func(t *testing.T) {
+		input := `let make = fn(k) {
+  fn(v) {
+    let r = v + k;
+    r * 2
+  }
+};
+let f = make(3);
+let x = 100 + f(1);
+f(x)`
+		debug := func(breakpoints []int, onStop func(vm *VM, stop Stop) Action) error {
+			comp := compiler.New()
+			comp.SetFile("main.gg")
+			comp.SetFolding(false)
+			comp.SetPeephole(false)
+			if err := comp.Compile(parse(input)); err != nil {
+				t.Fatalf("compiler error : %s", err)
+			}
+			machine := New(comp.Bytecode())
+			d := NewDebugger(nil)
+			d.StopOnEntry = true
+			d.OnStop = func(stop Stop) Action { return onStop(machine, stop) }
+			for _, line := range breakpoints {
+				d.SetBreakpoint("main.gg", line)
+			}
+			machine.SetDebugger(d)
+			return machine.Run()
+		}
+		variables := func(vars []Variable) string {
+			s := []string{}
+			for _, v := range vars {
+				s = append(s, v.Name+"="+v.Value.Inspect())
+			}
+			return strings.Join(s, " ")
+		}
+
+		steps := []struct {
+			action      Action
+			breakpoints []int
+			expected    []string
+		}{
+			{StepIn, nil, []string{"entry 1 ", "step 7 ", "step 2 make", "step 8 ", "step 3 ", "step 4 ", "step 9 ", "step 3 ", "step 4 "}},
+			{StepOver, nil, []string{"entry 1 ", "step 7 ", "step 8 ", "step 9 "}},
+			{Continue, []int{4}, []string{"entry 1 ", "breakpoint 4 ", "breakpoint 4 "}},
+			{StepOut, []int{3}, []string{"entry 1 ", "breakpoint 3 ", "step 9 ", "breakpoint 3 "}},
+		}
+		for _, tt := range steps {
+			stops := []string{}
+			err := debug(tt.breakpoints, func(vm *VM, stop Stop) Action {
+				stops = append(stops, fmt.Sprintf("%s %d %s", stop.Reason, stop.Pos.Line, stop.Function))
+				if stop.Reason == StopEntry && tt.action != StepIn && tt.action != StepOver {
+					return Continue
+				}
+				return tt.action
+			})
+			if err != nil {
+				t.Fatalf("Run failed with error : %s", err)
+			}
+			if strings.Join(stops, ", ") != strings.Join(tt.expected, ", ") {
+				t.Errorf("wrong stops for action %d expected %v got %v", tt.action, tt.expected, stops)
+			}
+		}
+
+		inspected := []string{}
+		err := debug([]int{3}, func(vm *VM, stop Stop) Action {
+			if stop.Reason == StopEntry {
+				return Continue
+			}
+			trace := []string{}
+			for _, frame := range vm.StackTrace() {
+				trace = append(trace, fmt.Sprintf("%s:%s %q", frame.File, frame.Pos, frame.Function))
+			}
+			globals := []string{}
+			for _, v := range vm.Globals() {
+				globals = append(globals, v.Name)
+			}
+			operands := []string{}
+			for _, obj := range vm.OperandStack(1) {
+				operands = append(operands, obj.Inspect())
+			}
+			inspected = append(inspected, fmt.Sprintf("locals[%s] free[%s] globals[%s] operands[%s] trace[%s]",
+				variables(vm.Locals(0)), variables(vm.FreeVariables(0)), strings.Join(globals, " "), strings.Join(operands, " "), strings.Join(trace, " ")))
+			return Continue
+		})
+		if err != nil {
+			t.Fatalf("Run failed with error : %s", err)
+		}
+		expected := []string{
+			// the local r of the first call is cleared before the second one
+			`locals[v=1] free[k=3] globals[make f] operands[100] trace[main.gg:3:13 "" main.gg:8:16 ""]`,
+			`locals[v=108] free[k=3] globals[make f x] operands[] trace[main.gg:3:13 "" main.gg:9:2 ""]`,
+		}
+		if strings.Join(inspected, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("wrong inspected state expected %v got %v", expected, inspected)
+		}
+
+		err = debug(nil, func(vm *VM, stop Stop) Action { return Abort })
+		if err != ErrAborted {
+			t.Errorf("expected the program to be aborted got %v", err)
+		}
+	})
+	t.Run("TestEvalParity", func(t *testing.T) {
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"1 + 2 * 3", "7"},
+			{"2 * 60 * 60", "7200"},
+			{"if (1 > 2) { 1 }", "null"},
+			{"if (!false) { 1 } else { 2 }", "1"},
+			{`-(-9223372036854775807 - 1)`, "9223372036854775808"},
+			{"-7 / 2", "-3"},
+			{"-7 % 3", "-1"},
+			{"9223372036854775807 + 1", "9223372036854775808"},
+			{"9223372036854775808", "9223372036854775808"},
+			{"-9223372036854775808", "-9223372036854775808"},
+			{"18446744073709551616 / 9223372036854775808", "2"},
+			{"18446744073709551616 % 0", "error: division by zero"},
+			{`"gig" + "gle"`, "giggle"},
+			{"1 < 2", "true"},
+			{"2 <= 2", "true"},
+			{"3 > 2", "true"},
+			{"2 >= 3", "false"},
+			{`"a" < "b"`, "true"},
+			{`"b" <= "a"`, "false"},
+			{`1 == "1"`, "false"},
+			{`1 != "1"`, "true"},
+			{"null == null", "true"},
+			{"true == (1 < 2)", "true"},
+			{"[1] == [1]", "false"},
+			{"let a = [1]; a == a", "true"},
+			{"!5", "false"},
+			{"!null", "true"},
+			{"!!0", "true"},
+			{`if (0) { 1 } else { 2 }`, "1"},
+			{`if ("") { 1 } else { 2 }`, "1"},
+			{`if (null) { 1 }`, "null"},
+			{"[1, 2][5]", "null"},
+			{`"ab"[-1]`, "b"},
+			{`{"a": 1}["b"]`, "null"},
+			{"head([])", "null"},
+			{"concat([1], [2])", "[1, 2]"},
+			{`try { throw [1] } catch (e) { e }`, "[1]"},
+			{`match (2) { 1 => "one", n if n > 1 => n * 10 }`, "20"},
+			{`let {sum} = import "std/collections"; sum([1, 2, 3])`, "6"},
+			// return statements nested in expressions leave the function
+			{`let f = fn(x) { let y = if (x > 0) { return "positive" } else { x }; y * 2 }; [f(1), f(-1)]`, "[positive, -2]"},
+			{`let f = fn() { [1, match (1) { 1 => { return 2 } }] }; f()`, "2"},
+			{`let f = fn() { len(if (true) { return 3 } else { [] }) }; f()`, "3"},
+			{`let f = fn() { 1 + if (true) { return 4 } else { 0 } }; f()`, "4"},
+			// operands are evaluated from left to right
+			{`let f = fn() { throw "left" }; let g = fn() { throw "right" }; try { f() < g() } catch (e) { e }`, "left"},
+			{`let f = fn() { throw "left" }; let g = fn() { throw "right" }; try { f() <= g() } catch (e) { e }`, "left"},
+			{`try { {fn() { throw "b" }(): 1, fn() { throw "a" }(): 2} } catch (e) { e }`, "a"},
+			// errors
+			{"1 + true", "error: type mismatch: INTEGER + BOOLEAN"},
+			{`1 < "a"`, "error: type mismatch: INTEGER < STRING"},
+			{`"a" <= 1`, "error: type mismatch: STRING <= INTEGER"},
+			{`"a" - "b"`, "error: unknown operator: STRING - STRING"},
+			{"true < false", "error: unknown operator: BOOLEAN < BOOLEAN"},
+			{"[1] + [2]", "error: unknown operator: ARRAY + ARRAY"},
+			{`-"a"`, "error: unknown operator: -STRING"},
+			{"1 / 0", "error: division by zero"},
+			{"if (1 + true) { 1 } else { 2 }", "error: type mismatch: INTEGER + BOOLEAN"},
+			{"5[0]", "error: index operator not supported: INTEGER[INTEGER]"},
+			{`[1]["a"]`, "error: index operator not supported: ARRAY[STRING]"},
+			{"{}[[1]]", "error: invalid key for hashmap type : ARRAY"},
+			{"{[1]: 2}", "error: invalid key for hashmap type : ARRAY"},
+			{"5()", "error: not a function: INTEGER"},
+			{"foo", "error: identifier not found: foo"},
+			{"if (false) { let x = 1 }; x", "error: identifier not found: x"},
+			{"if (false) { let x = 1 }; x + 1", "error: identifier not found: x"},
+			{"if (true) { 1 } else { let y = 2 }; y", "error: identifier not found: y"},
+			{"len(1)", "error: argument to `len` not supported, got INTEGER"},
+			{"fn(a) { a }()", "error: wrong number of parameters : want 1, got 0"},
+			{`throw "oops"`, "error: uncaught exception: oops"},
+		}
+
+		for _, tt := range tests {
+			evaluated := evalOutcome(tt.input)
+			executed := vmOutcome(tt.input, true)
+			if evaluated != executed {
+				t.Errorf("engines disagree on %s : eval %q vm %q", tt.input, evaluated, executed)
+			}
+			if unoptimized := vmOutcome(tt.input, false); unoptimized != executed {
+				t.Errorf("optimizations changed the result of %s : optimized %q unoptimized %q", tt.input, executed, unoptimized)
+			}
+			if executed != tt.expected {
+				t.Errorf("wrong result for %s expected %q got %q", tt.input, tt.expected, executed)
+			}
+		}
+	})
+	t.Run("TestFoldingParity", func(t *testing.T) {
+		// programs whose results differ between the engines but not between
+		// folded and unfolded compilation
+		tests := []struct {
+			input    string
+			expected string
+		}{
+			{"if (false) { undefinedName }", "error: identifier not found: undefinedName"},
+			{"if (true) { 1 } else { undefinedName }", "error: identifier not found: undefinedName"},
+			{"let f = fn() { try { if (false) { return 1 }; 2 } finally { 3 } }; f()", "2"},
+			{`if (false) { import "std/collections" }; let {sum} = import "std/collections"; sum([1, 2])`, "3"},
+		}
+
+		for _, tt := range tests {
+			folded := vmOutcome(tt.input, true)
+			if unfolded := vmOutcome(tt.input, false); unfolded != folded {
+				t.Errorf("optimizations changed the result of %s : optimized %q unoptimized %q", tt.input, folded, unfolded)
+			}
+			if folded != tt.expected {
+				t.Errorf("wrong result for %s expected %q got %q", tt.input, tt.expected, folded)
+			}
+		}
+	})
+	t.Run("TestJSONPrograms", func(t *testing.T) {
+		tests := []string{
+			`let f = fn([a, b], x = 2, ...xs) { (a + b) * x + len(xs) }; f([1, 2], 3, 4, 5)`,
+			`let fib = fn(n) { match (n) { 0 => 0, 1 => 1, _ => fib(n - 1) + fib(n - 2) } }; fib(10)`,
+			`let h = {"a": [1, 2, 3]}; try { h["a"][1:] } catch (e) { e } finally { null }`,
+			`let {join} = import "std/strings"; let h = null; join(["a", "b"], h?.["c"] ?? "-")`,
+		}
+
+		for _, input := range tests {
+			data, err := json.Marshal(parse(input))
+			if err != nil {
+				t.Fatalf("failed to encode %s with error : %s", input, err)
+			}
+			program := &ast.Program{}
+			if err := json.Unmarshal(data, program); err != nil {
+				t.Fatalf("failed to decode %s with error : %s", input, err)
+			}
+
+			comp := compiler.New()
+			if err := comp.Compile(program); err != nil {
+				t.Fatalf("failed to compile decoded %s with error : %s", input, err)
+			}
+			vm := New(comp.Bytecode())
+			if err := vm.Run(); err != nil {
+				t.Fatalf("failed to run decoded %s with error : %s", input, err)
+			}
+			if got, expected := vm.LastPoppedStackElem().Inspect(), vmOutcome(input, false); got != expected {
+				t.Errorf("wrong result for decoded %s expected %s got %s", input, expected, got)
+			}
+		}
+	})
+}
+
+func BenchmarkVM(b *testing.B) {
+	benchmarks := []struct {
+		name  string
+		input string
+	}{
+		{
+			name: "Fibonacci",
+			input: `
+			let fib = fn(x) {
+				if (x < 2) {
+					return x;
+				} else {
+					return fib(x - 1) + fib(x - 2);
+				}
+			};
+			fib(20)`,
+		},
+		{
+			name: "NestedConditionals",
+			input: `
+			let grade = fn(x) {
+				if (x > 50) {
+					if (x > 75) {
+						if (x > 90) { "a" } else { "b" }
+					} else {
+						if (x > 60) { "c" } else { "d" }
+					}
+				} else {
+					if (x > 25) {
+						if (x > 40) { "e" } else { "f" }
+					} else {
+						if (x > 10) { "g" } else { "h" }
+					}
+				}
+			};
+			let loop = fn(n) {
+				if (n == 0) {
+					0
+				} else {
+					grade(n); grade(n + 13); grade(n + 37); grade(n + 71);
+					loop(n - 1)
+				}
+			};
+			loop(1000)`,
+		},
+		{
+			// the branches of the nested conditionals jump through every
+			// enclosing conditional, the peephole optimizer threads them
+			name: "JumpChains",
+			input: `
+			let loop = fn(n, acc) {
+				if (n == 0) {
+					acc
+				} else {
+					let x = n % 6;
+					let v = if (x > 0) {
+						if (x > 1) {
+							if (x > 2) {
+								if (x > 3) {
+									if (x > 4) { 5 } else { 4 }
+								} else { 3 }
+							} else { 2 }
+						} else { 1 }
+					} else { 0 };
+					loop(n - 1, acc + v)
+				}
+			};
+			loop(20000, 0)`,
+		},
+	}
+
+	for _, bench := range benchmarks {
+		for _, peephole := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/peephole=%t", bench.name, peephole), func(b *testing.B) {
+				comp := compiler.New()
+				comp.SetPeephole(peephole)
+				if err := comp.Compile(parse(bench.input)); err != nil {
+					b.Fatalf("compiler error : %s", err)
+				}
+				bytecode := comp.Bytecode()
+
+				// only the execution of the program is timed, not the
+				// allocation of its stack, frames and globals, the number of
+				// executed instructions is reported as timings are noisy
+				executed := 0
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					b.StopTimer()
+					vm := New(bytecode)
+					b.StartTimer()
+					if err := vm.Run(); err != nil {
+						b.Fatalf("vm error : %s", err)
+					}
+					executed = vm.executed
+				}
+				b.ReportMetric(float64(executed), "instructions/op")
+			})
+		}
+	}
+}
+
+// evalOutcome evaluates a program with the tree-walking evaluator and
+// returns its result or error message.
+func evalOutcome(input string) string {
+	result := eval.Eval(parse(input), object.NewEnv())
+	if err, ok := result.(*object.Error); ok {
+		return "error: " + err.Message
+	}
+	if result == nil {
+		return "nil"
+	}
+
+	return result.Inspect()
+}
+
+// vmOutcome compiles and runs a program with or without optimizations and
+// returns its result or error message.
+func vmOutcome(input string, optimize bool) string {
+	comp := compiler.New()
+	comp.SetFolding(optimize)
+	comp.SetPeephole(optimize)
+	if err := comp.Compile(parse(input)); err != nil {
+		return "error: " + err.Error()
+	}
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		return "error: " + err.Error()
+	}
+	result := vm.LastPoppedStackElem()
+	if result == nil {
+		return "nil"
+	}
+
+	return result.Inspect()
 }
 
 // parse takes an input string and returns an ast.Program
+// identifier returns the i-th identifier of generated programs.
+func identifier(i int) string {
+	name := []byte{'v'}
+	for {
+		name = append(name, byte('a'+i%26))
+		i /= 26
+		if i == 0 {
+			return string(name)
+		}
+	}
+}
+
 func parse(input string) *ast.Program {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -535,6 +1293,15 @@ func testExpectedObject(i int, t *testing.T, expected interface{}, actual object
 		if err != nil {
 			t.Errorf("testStringObject[%d] failed with error : %s", i, err)
 		}
+	case *big.Int:
+		result, ok := actual.(*object.BigInt)
+		if !ok {
+			t.Errorf("object is not BigInt got %T (%+v)", actual, actual)
+			return
+		}
+		if result.Value.Cmp(expected) != 0 {
+			t.Errorf("object has wrong value expected %s got %s", expected, result.Value)
+		}
 	case *object.Null:
 		if actual != Null {
 			t.Errorf("object not Null ! %s", actual.Type())